@@ -1,18 +1,33 @@
 package main
 
 import (
+	"fmt"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
+	"github.com/twonegatives/drweb_challenge/pkg/archives"
 	"github.com/twonegatives/drweb_challenge/pkg/callbacks"
 	"github.com/twonegatives/drweb_challenge/pkg/config"
 	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+	"github.com/twonegatives/drweb_challenge/pkg/entropy"
+	"github.com/twonegatives/drweb_challenge/pkg/fulltext"
+	"github.com/twonegatives/drweb_challenge/pkg/hashlists"
+	"github.com/twonegatives/drweb_challenge/pkg/imagemeta"
+	"github.com/twonegatives/drweb_challenge/pkg/jobs"
 	"github.com/twonegatives/drweb_challenge/pkg/namegenerators"
 	"github.com/twonegatives/drweb_challenge/pkg/pathgenerators"
+	"github.com/twonegatives/drweb_challenge/pkg/rules"
+	"github.com/twonegatives/drweb_challenge/pkg/scanners"
+	"github.com/twonegatives/drweb_challenge/pkg/similarity"
 	"github.com/twonegatives/drweb_challenge/pkg/storages"
+	"github.com/twonegatives/drweb_challenge/pkg/thumbnails"
+	"github.com/twonegatives/drweb_challenge/pkg/zipcrypto"
 )
 
 func main() {
@@ -27,19 +42,582 @@ func main() {
 	}
 
 	storage := storages.FileSystemStorage{
+		BasePath:          cfg.GetString("PATH_BASE"),
 		FileMode:          os.FileMode(cfg.GetInt("STORAGE_FILE_MODE")),
 		FilePathGenerator: &pathgen,
 	}
 
+	openDisk := func(base string) (*storages.FileSystemStorage, error) {
+		// NOTE: uploads are renamed into place, so they are written on the same disk
+		temp := filepath.Join(base, "tmp")
+		if err := os.MkdirAll(temp, os.FileMode(cfg.GetInt("STORAGE_FILE_MODE"))); err != nil {
+			return nil, errors.Wrap(err, "failed to create temp folder")
+		}
+		return &storages.FileSystemStorage{
+			BasePath: base,
+			TempPath: temp,
+			FileMode: os.FileMode(cfg.GetInt("STORAGE_FILE_MODE")),
+			FilePathGenerator: &pathgenerators.NestedGenerator{
+				Levels:       cfg.GetInt("PATH_NESTED_LEVELS"),
+				FolderLength: cfg.GetInt("PATH_NESTED_FOLDERS_LENGTH"),
+				BasePath:     base,
+			},
+		}, nil
+	}
+
+	openDisks := func(paths string) ([]*storages.FileSystemStorage, error) {
+		disks := []*storages.FileSystemStorage{}
+		for _, base := range strings.Fields(paths) {
+			disk, err := openDisk(base)
+			if err != nil {
+				return nil, err
+			}
+			disks = append(disks, disk)
+		}
+		if len(disks) == 0 {
+			return nil, errors.New("no disk paths given")
+		}
+		return disks, nil
+	}
+
+	metadataPathgen := pathgenerators.NestedGenerator{
+		Levels:       cfg.GetInt("PATH_NESTED_LEVELS"),
+		FolderLength: cfg.GetInt("PATH_NESTED_FOLDERS_LENGTH"),
+		BasePath:     cfg.GetString("METADATA_PATH_BASE"),
+	}
+
+	fileMetadata := storages.FileSystemMetadataStore{
+		BasePath:          cfg.GetString("METADATA_PATH_BASE"),
+		FileMode:          os.FileMode(cfg.GetInt("STORAGE_FILE_MODE")),
+		FilePathGenerator: &metadataPathgen,
+	}
+	var metadata drweb.MetadataStore = &fileMetadata
+
+	// NOTE: backends are opened once, even if several routes lead to them
+	backends := map[string]drweb.WalkableStorage{"filesystem": &storage}
+	var openBackend func(name string) (drweb.WalkableStorage, error)
+	openBackend = func(name string) (drweb.WalkableStorage, error) {
+		if opened, ok := backends[name]; ok {
+			return opened, nil
+		}
+
+		var opened drweb.WalkableStorage
+		switch name {
+		case "s3":
+			opened = &storages.S3Storage{
+				Endpoint:  cfg.GetString("S3_ENDPOINT"),
+				Bucket:    cfg.GetString("S3_BUCKET"),
+				Region:    cfg.GetString("S3_REGION"),
+				AccessKey: cfg.GetString("S3_ACCESS_KEY"),
+				SecretKey: cfg.GetString("S3_SECRET_KEY"),
+				PartSize:  cfg.GetInt64("S3_PART_SIZE"),
+				FilePathGenerator: &pathgenerators.NestedGenerator{
+					Levels:       cfg.GetInt("PATH_NESTED_LEVELS"),
+					FolderLength: cfg.GetInt("PATH_NESTED_FOLDERS_LENGTH"),
+				},
+			}
+		case "kv":
+			kv := &storages.KVStorage{
+				Path:      cfg.GetString("KV_PATH"),
+				FileMode:  os.FileMode(cfg.GetInt("STORAGE_FILE_MODE")),
+				ChunkSize: cfg.GetInt("KV_CHUNK_SIZE"),
+			}
+			if err := kv.Open(); err != nil {
+				return nil, errors.Wrap(err, "failed to open kv storage")
+			}
+			opened = kv
+		case "sqlite":
+			sqlite := &storages.SQLiteStorage{
+				Path:      cfg.GetString("SQLITE_PATH"),
+				ChunkSize: cfg.GetInt("SQLITE_CHUNK_SIZE"),
+			}
+			if err := sqlite.Open(); err != nil {
+				return nil, errors.Wrap(err, "failed to open sqlite storage")
+			}
+			opened = sqlite
+		case "memory":
+			opened = &storages.MemoryStorage{
+				MaxSize: cfg.GetInt64("MEMORY_MAX_SIZE"),
+				Evict:   cfg.GetBool("MEMORY_EVICT"),
+			}
+		case "mirrored":
+			disks, err := openDisks(cfg.GetString("MIRROR_PATHS"))
+			if err != nil {
+				return nil, err
+			}
+			mirrored := &storages.MirroredStorage{
+				NameGenerator: &namegenerators.SHA256{},
+				RetryInterval: cfg.GetDuration("MIRROR_RETRY_INTERVAL") * time.Second,
+			}
+			for _, disk := range disks {
+				mirrored.Replicas = append(mirrored.Replicas, disk)
+			}
+			opened = mirrored
+		case "erasure":
+			disks, err := openDisks(cfg.GetString("ERASURE_PATHS"))
+			if err != nil {
+				return nil, err
+			}
+			opened = &storages.ErasureStorage{
+				Targets:      disks,
+				DataShards:   cfg.GetInt("ERASURE_DATA_SHARDS"),
+				ParityShards: cfg.GetInt("ERASURE_PARITY_SHARDS"),
+				ChunkSize:    cfg.GetInt("ERASURE_CHUNK_SIZE"),
+			}
+		case "spread":
+			disks, err := storages.ParseSpreadDisks(cfg.GetString("SPREAD_DISKS"), openDisk)
+			if err != nil {
+				return nil, err
+			}
+			opened = &storages.SpreadStorage{
+				Disks:         disks,
+				MinFree:       uint64(cfg.GetInt64("SPREAD_MIN_FREE")),
+				NameGenerator: &namegenerators.SHA256{},
+			}
+		case "remote":
+			if cfg.GetString("UPSTREAM_URL") == "" {
+				return nil, errors.New("no upstream url given")
+			}
+			opened = &storages.RemoteStorage{
+				Endpoint: cfg.GetString("UPSTREAM_URL"),
+				Client:   &http.Client{Transport: storages.RemoteTransport(cfg.GetDuration("UPSTREAM_TIMEOUT") * time.Second)},
+			}
+		case "proxy":
+			upstream, err := openBackend("remote")
+			if err != nil {
+				return nil, err
+			}
+			opened = &storages.ProxyStorage{
+				Local:         &storage,
+				Upstream:      upstream,
+				NameGenerator: &namegenerators.SHA256{},
+				PullTimeout:   cfg.GetDuration("UPSTREAM_TIMEOUT") * time.Second,
+			}
+		case "tiered":
+			tiers := []drweb.WalkableStorage{}
+			for _, tier := range []string{cfg.GetString("TIER_HOT_BACKEND"), cfg.GetString("TIER_COLD_BACKEND")} {
+				if tier == "tiered" {
+					return nil, errors.New("tiers should not be tiered themselves")
+				}
+				opened, err := openBackend(tier)
+				if err != nil {
+					return nil, errors.Wrapf(err, "failed to open tier '%s'", tier)
+				}
+				tiers = append(tiers, opened)
+			}
+			opened = &storages.TieredStorage{
+				Hot:           tiers[0],
+				Cold:          tiers[1],
+				Metadata:      metadata,
+				MaxAge:        cfg.GetDuration("TIER_DEMOTE_AFTER") * 24 * time.Hour,
+				SyncPromotion: cfg.GetBool("TIER_SYNC_PROMOTION"),
+				NameGenerator: &namegenerators.SHA256{},
+			}
+		default:
+			return nil, fmt.Errorf("unknown storage backend '%s'", name)
+		}
+
+		backends[name] = opened
+		return opened, nil
+	}
+
+	var files drweb.WalkableStorage
+	backend := cfg.GetString("STORAGE_BACKEND")
+	if backend == "routed" {
+		routes, err := storages.ParseSizeRoutes(cfg.GetString("STORAGE_ROUTES"), func(name string) (drweb.Storage, error) {
+			return openBackend(name)
+		})
+		if err != nil {
+			log.WithError(err).Fatal("failed to set up storage routes")
+		}
+		files = &storages.SizeRoutedStorage{Routes: routes}
+	} else {
+		opened, err := openBackend(backend)
+		if err != nil {
+			log.WithError(err).WithField("backend", backend).Fatal("failed to set up storage backend")
+		}
+		files = opened
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "compact" {
+		kv, ok := backends["kv"].(*storages.KVStorage)
+		if !ok {
+			log.WithField("backend", backend).Fatal("only kv storage backend may be compacted")
+		}
+
+		before, after, err := kv.Compact()
+		if err != nil {
+			log.WithError(err).Fatal("failed to compact kv storage")
+		}
+		log.WithFields(log.Fields{"before": before, "after": after}).Info("kv storage compacted")
+		kv.Close()
+		return
+	}
+
+	// NOTE: the whole store is kept in a single file, metadata included
+	sqlite, isSQLite := backends["sqlite"].(*storages.SQLiteStorage)
+	if isSQLite && backend == "sqlite" {
+		metadata = &storages.SQLiteMetadataStore{Storage: sqlite}
+	}
+
+	if len(os.Args) > 1 && (os.Args[1] == "vacuum" || os.Args[1] == "backup") {
+		if !isSQLite {
+			log.WithField("backend", backend).Fatalf("only sqlite storage backend may be given to %s", os.Args[1])
+		}
+		defer sqlite.Close()
+
+		if os.Args[1] == "backup" {
+			if len(os.Args) < 3 {
+				log.Fatal("no backup path given")
+			}
+			if err := sqlite.Backup(os.Args[2]); err != nil {
+				log.WithError(err).Fatal("failed to back up sqlite storage")
+			}
+			log.WithField("path", os.Args[2]).Info("sqlite storage backed up")
+			return
+		}
+
+		before, after, err := sqlite.Vacuum()
+		if err != nil {
+			log.WithError(err).Fatal("failed to vacuum sqlite storage")
+		}
+		log.WithFields(log.Fields{"before": before, "after": after}).Info("sqlite storage vacuumed")
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "rebuild" {
+		erasure, ok := backends["erasure"].(*storages.ErasureStorage)
+		if !ok {
+			log.WithField("backend", backend).Fatal("only erasure storage backend may be rebuilt")
+		}
+
+		count := 0
+		err := erasure.Walk(func(filename string) error {
+			count++
+			if err := erasure.Rebuild(filename); err != nil {
+				log.WithError(err).WithField("filename", filename).Error("failed to rebuild shards")
+			}
+			return nil
+		})
+		if err != nil {
+			log.WithError(err).Fatal("failed to rebuild erasure storage")
+		}
+		log.WithField("files", count).Info("erasure storage checked")
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "rebalance" {
+		spread, ok := backends["spread"].(*storages.SpreadStorage)
+		if !ok {
+			log.WithField("backend", backend).Fatal("only spread storage backend may be rebalanced")
+		}
+
+		moved, err := spread.Rebalance()
+		if err != nil {
+			log.WithError(err).WithField("moved", moved).Fatal("failed to rebalance spread storage")
+		}
+		log.WithField("moved", moved).Info("spread storage rebalanced")
+		return
+	}
+
+	// NOTE: jobs going through every file should not keep them hot
+	scanned := files
+	if tiered, ok := backends["tiered"].(*storages.TieredStorage); ok {
+		scanned = tiered.Untracked()
+		go tiered.Watch(cfg.GetDuration("TIER_DEMOTE_INTERVAL")*time.Second, nil)
+	}
+
+	// NOTE: jobs do not go through the cache either, so they neither evict files nor count as uses
+	cache := storages.CacheStorage{
+		Storage:    files,
+		MaxSize:    cfg.GetInt64("CACHE_MAX_SIZE"),
+		Policy:     cfg.GetString("CACHE_POLICY"),
+		LedgerPath: cfg.GetString("CACHE_LEDGER_PATH"),
+		FileMode:   os.FileMode(cfg.GetInt("STORAGE_FILE_MODE")),
+		Metadata:   metadata,
+	}
+	if cache.MaxSize > 0 {
+		// NOTE: proxy deletes files upstream, evictions would take them from every region
+		if _, ok := backends["proxy"]; ok {
+			log.Fatal("cache can not be set up over proxy storage backend")
+		}
+		files = &cache
+	}
+
+	quarantinePathgen := pathgenerators.NestedGenerator{
+		Levels:       cfg.GetInt("PATH_NESTED_LEVELS"),
+		FolderLength: cfg.GetInt("PATH_NESTED_FOLDERS_LENGTH"),
+		BasePath:     cfg.GetString("QUARANTINE_PATH_BASE"),
+	}
+
+	quarantine := storages.FileSystemQuarantine{
+		BasePath:          cfg.GetString("QUARANTINE_PATH_BASE"),
+		FileMode:          os.FileMode(cfg.GetInt("STORAGE_FILE_MODE")),
+		FilePathGenerator: &quarantinePathgen,
+		Storage:           &storage,
+	}
+
+	indexed := storages.IndexedStorage{
+		Storage:  files,
+		Metadata: metadata,
+	}
+
+	searchPathgen := pathgenerators.NestedGenerator{
+		Levels:       cfg.GetInt("PATH_NESTED_LEVELS"),
+		FolderLength: cfg.GetInt("PATH_NESTED_FOLDERS_LENGTH"),
+		BasePath:     cfg.GetString("SEARCH_PATH_BASE"),
+	}
+
+	search := fulltext.Index{
+		BasePath:          cfg.GetString("SEARCH_PATH_BASE"),
+		FileMode:          os.FileMode(cfg.GetInt("STORAGE_FILE_MODE")),
+		FilePathGenerator: &searchPathgen,
+	}
+	if err := search.Load(); err != nil {
+		log.WithError(err).Fatal("failed to load full-text index")
+	}
+
+	indexing := jobs.Indexing{
+		Storage:   scanned,
+		Index:     &search,
+		Workers:   cfg.GetInt("SEARCH_WORKERS"),
+		QueueSize: cfg.GetInt("SEARCH_QUEUE_SIZE"),
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "reindex" {
+		count, err := indexing.Reindex()
+		if err != nil {
+			log.WithError(err).Fatal("failed to reindex files")
+		}
+		log.WithField("files", count).Info("files reindexed")
+		return
+	}
+	go indexing.Run(nil)
+
+	analysisPathgen := pathgenerators.NestedGenerator{
+		Levels:       cfg.GetInt("PATH_NESTED_LEVELS"),
+		FolderLength: cfg.GetInt("PATH_NESTED_FOLDERS_LENGTH"),
+		BasePath:     cfg.GetString("ANALYSIS_PATH_BASE"),
+	}
+
+	analysisStore := storages.FileSystemAnalysisStore{
+		FileMode:          os.FileMode(cfg.GetInt("STORAGE_FILE_MODE")),
+		FilePathGenerator: &analysisPathgen,
+	}
+
+	analysis := jobs.Analysis{
+		Storage:       scanned,
+		Store:         &analysisStore,
+		Workers:       cfg.GetInt("ANALYSIS_WORKERS"),
+		QueueSize:     cfg.GetInt("ANALYSIS_QUEUE_SIZE"),
+		MaxBufferSize: cfg.GetInt64("ANALYSIS_MAX_BUFFER_SIZE"),
+	}
+	go analysis.Run(nil)
+
+	similar := similarity.Index{Metadata: metadata}
+	if err := similar.Load(); err != nil {
+		log.WithError(err).Fatal("failed to load similarity index")
+	}
+
+	// NOTE: metadata outlives isolation, quarantined files are not to be found similar
+	isolated, err := quarantine.List()
+	if err != nil {
+		log.WithError(err).Fatal("failed to list quarantined files")
+	}
+	for _, record := range isolated {
+		similar.Remove(record.Filename)
+	}
+
+	processed := storages.JobStorage{
+		Storage: &indexed,
+		Jobs:    []drweb.PostSaveJob{&analysis, &similar, &indexing},
+	}
+
 	filenamegenerator := namegenerators.SHA256{}
+	adminToken := cfg.GetString("ADMIN_TOKEN")
+
+	inspectors := []drweb.InspectorFactory{similar.NewInspector, entropy.NewInspector, imagemeta.NewInspector}
+	retrieveFile := drweb.WithQuarantineCheck(drweb.RetrieveFileHandler(&processed), &quarantine)
+
+	lists := hashlists.Lists{}
+	for _, spec := range cfg.GetStringSlice("HASHLISTS") {
+		list, err := hashlists.ParseSpec(spec)
+		if err != nil {
+			log.WithError(err).Fatal("failed to configure hash lists")
+		}
+		lists.Lists = append(lists.Lists, list)
+	}
+
+	if len(lists.Lists) > 0 {
+		if err := lists.Reload(); err != nil {
+			log.WithError(err).Fatal("failed to load hash lists")
+		}
+
+		go lists.Watch(cfg.GetDuration("HASHLISTS_RELOAD_INTERVAL")*time.Second, nil)
+		inspectors = append(inspectors, lists.NewInspector)
+		retrieveFile = drweb.WithHashListCheck(retrieveFile, &lists)
+	}
+
+	policies, err := drweb.ParseWrapPolicies(cfg.GetStringSlice("WRAP_POLICIES"))
+	if err != nil {
+		log.WithError(err).Fatal("failed to configure wrap policies")
+	}
+
+	wrapper := zipcrypto.Wrapper{Password: cfg.GetString("WRAP_PASSWORD")}
+	retrieveFile = drweb.WithWrapping(retrieveFile, &wrapper, policies)
+
+	serving := drweb.ServingPolicy{
+		InlineTypes:  cfg.GetStringSlice("SERVE_INLINE_TYPES"),
+		DownloadHost: cfg.GetString("DOWNLOAD_HOST"),
+	}
+	retrieveFile = drweb.WithServingPolicy(retrieveFile, &serving)
+
+	engine := rules.Engine{Path: cfg.GetString("RULES_PATH")}
+	if engine.Path != "" {
+		if err := engine.Reload(); err != nil {
+			log.WithError(err).Fatal("failed to load rules")
+		}
+
+		inspectors = append(inspectors, engine.NewInspector)
+	}
+
+	extractor := archives.Extractor{
+		Storage:       &processed,
+		Metadata:      metadata,
+		NameGenerator: &filenamegenerator,
+		Inspectors:    inspectors,
+		Limits: archives.Limits{
+			MaxEntries:   cfg.GetInt("ARCHIVE_MAX_ENTRIES"),
+			MaxEntrySize: cfg.GetInt64("ARCHIVE_MAX_ENTRY_SIZE"),
+			MaxTotalSize: cfg.GetInt64("ARCHIVE_MAX_TOTAL_SIZE"),
+			MaxRatio:     cfg.GetInt64("ARCHIVE_MAX_RATIO"),
+			MaxDepth:     cfg.GetInt("ARCHIVE_MAX_DEPTH"),
+		},
+	}
+
+	thumbnailer := thumbnails.Thumbnailer{
+		Storage:       &indexed,
+		Metadata:      metadata,
+		NameGenerator: &filenamegenerator,
+		MaxPixels:     cfg.GetInt64("THUMBNAIL_MAX_PIXELS"),
+	}
+
+	// NOTE: thumbnails are refused as their sources are, and dropped once sources are isolated
+	thumbnail := drweb.WithQuarantineCheck(drweb.ThumbnailHandler(&thumbnailer), &quarantine)
+	if len(lists.Lists) > 0 {
+		thumbnail = drweb.WithHashListCheck(thumbnail, &lists)
+	}
+	quarantine.Jobs = append(quarantine.Jobs, &indexing, &similar, &analysis, &thumbnailer)
+	// NOTE: quarantine moves files on disk past the cache, which has to keep count,
+	// and files evicted by the cache are forgotten as isolated ones are
+	if cache.MaxSize > 0 {
+		quarantine.Jobs = append(quarantine.Jobs, &cache)
+		cache.Jobs = []drweb.PostSaveJob{&indexing, &similar, &analysis, &thumbnailer}
+		if err := cache.Open(); err != nil {
+			log.WithError(err).Fatal("failed to open cache")
+		}
+	}
 
 	router := mux.NewRouter()
 	startSaveCbk := callbacks.LogCallback{Content: "Started to save a file"}
 	finishSaveCbk := callbacks.LogCallback{Content: "Finished file saving process"}
-	createFile := drweb.CreateFileHandler(&storage, &filenamegenerator)
-	router.HandleFunc("/files", drweb.WithCallbacks(createFile, &startSaveCbk, &finishSaveCbk)).Methods("POST")
-	router.HandleFunc("/files/{hashstring}", drweb.RetrieveFileHandler(&storage)).Methods("GET")
-	router.HandleFunc("/files/{hashstring}", drweb.DeleteFileHandler(&storage)).Methods("DELETE")
+	createFile := drweb.CreateFileHandler(&processed, &filenamegenerator, inspectors...)
+
+	var originals drweb.Storage
+	if path := cfg.GetString("ORIGINALS_PATH_BASE"); path != "" {
+		originals = &storages.FileSystemStorage{
+			BasePath: path,
+			FileMode: os.FileMode(cfg.GetInt("STORAGE_FILE_MODE")),
+			FilePathGenerator: &pathgenerators.NestedGenerator{
+				Levels:       cfg.GetInt("PATH_NESTED_LEVELS"),
+				FolderLength: cfg.GetInt("PATH_NESTED_FOLDERS_LENGTH"),
+				BasePath:     path,
+			},
+		}
+	}
+	createFile = drweb.WithMetadataStripping(createFile, &imagemeta.Stripper{}, originals)
+
+	uploadPolicies := drweb.UploadPolicies{}
+	if path := cfg.GetString("UPLOAD_POLICIES_PATH"); path != "" {
+		if uploadPolicies, err = drweb.LoadUploadPolicies(path); err != nil {
+			log.WithError(err).Fatal("failed to load upload policies")
+		}
+	}
+
+	for _, route := range uploadPolicies.Routes() {
+		upload := drweb.WithUploadPolicies(createFile, uploadPolicies, route)
+		router.HandleFunc(route, drweb.WithCallbacks(upload, &startSaveCbk, &finishSaveCbk)).Methods("POST")
+	}
+	router.HandleFunc("/files", drweb.ListFilesHandler(metadata)).Methods("GET")
+	router.HandleFunc("/files/{hashstring}", retrieveFile).Methods("GET")
+	router.HandleFunc("/files/{hashstring}", drweb.DeleteFileHandler(&processed)).Methods("DELETE")
+	router.HandleFunc("/files/{hashstring}/meta", drweb.FileMetadataHandler(metadata)).Methods("GET")
+	router.HandleFunc("/files/{hashstring}/analysis", drweb.AnalysisHandler(&analysisStore, metadata)).Methods("GET")
+	router.HandleFunc("/search", drweb.SearchHandler(&search)).Methods("GET")
+	router.HandleFunc("/files/{hashstring}/similar", drweb.SimilarFilesHandler(&similar)).Methods("GET")
+	router.HandleFunc("/files/{hashstring}/thumbnail", thumbnail).Methods("GET")
+	router.HandleFunc("/files/{hashstring}/entries", drweb.ArchiveEntriesHandler(&extractor)).Methods("GET")
+	router.HandleFunc("/files/{hashstring}/explode", drweb.ExplodeArchiveHandler(&extractor)).Methods("POST")
+
+	admin := router.PathPrefix("/admin").Subrouter()
+	admin.HandleFunc("/hashlists", drweb.WithAdminAuth(drweb.HashListStatsHandler(&lists), adminToken)).Methods("GET")
+	if originals != nil {
+		admin.HandleFunc("/originals/{hashstring}", drweb.WithAdminAuth(drweb.RetrieveFileHandler(originals), adminToken)).Methods("GET")
+		admin.HandleFunc("/originals/{hashstring}", drweb.WithAdminAuth(drweb.DeleteFileHandler(originals), adminToken)).Methods("DELETE")
+	}
+	if cache.MaxSize > 0 {
+		admin.HandleFunc("/cache", drweb.WithAdminAuth(drweb.CacheStatsHandler(&cache), adminToken)).Methods("GET")
+		admin.HandleFunc("/cache/pins/{hashstring}", drweb.WithAdminAuth(drweb.PinFileHandler(&cache), adminToken)).Methods("POST")
+		admin.HandleFunc("/cache/pins/{hashstring}", drweb.WithAdminAuth(drweb.UnpinFileHandler(&cache), adminToken)).Methods("DELETE")
+	}
+	admin.HandleFunc("/quarantine", drweb.WithAdminAuth(drweb.ListQuarantineHandler(&quarantine), adminToken)).Methods("GET")
+	admin.HandleFunc("/quarantine/{hashstring}", drweb.WithAdminAuth(drweb.InspectQuarantineHandler(&quarantine), adminToken)).Methods("GET")
+	// NOTE: quarantine moves files between folders, so it takes files on disk
+	if backend == "filesystem" {
+		admin.HandleFunc("/quarantine/{hashstring}", drweb.WithAdminAuth(drweb.IsolateFileHandler(&quarantine), adminToken)).Methods("POST")
+		admin.HandleFunc("/quarantine/{hashstring}/release", drweb.WithAdminAuth(drweb.ReleaseFileHandler(&quarantine), adminToken)).Methods("POST")
+	}
+	admin.HandleFunc("/quarantine/{hashstring}", drweb.WithAdminAuth(drweb.PurgeFileHandler(&quarantine), adminToken)).Methods("DELETE")
+
+	if engine.Path != "" {
+		evaluation := jobs.Evaluation{
+			Storage:  scanned,
+			Metadata: metadata,
+			Engine:   &engine,
+		}
+
+		admin.HandleFunc("/rules/evaluate", drweb.WithAdminAuth(drweb.RuleEvaluationStatusHandler(&evaluation), adminToken)).Methods("GET")
+		admin.HandleFunc("/rules/evaluate", drweb.WithAdminAuth(drweb.StartRuleEvaluationHandler(&evaluation), adminToken)).Methods("POST")
+	}
+
+	if cfg.GetString("SCANNER_COMMAND") != "" && backend != "filesystem" {
+		log.WithField("backend", backend).Warn("rescans need filesystem storage backend to quarantine files")
+	} else if cfg.GetString("SCANNER_COMMAND") != "" {
+		scanner := scanners.CommandScanner{
+			Path:             cfg.GetString("SCANNER_COMMAND"),
+			Args:             cfg.GetStringSlice("SCANNER_ARGS"),
+			VersionArgs:      cfg.GetStringSlice("SCANNER_VERSION_ARGS"),
+			InfectedExitCode: cfg.GetInt("SCANNER_INFECTED_EXIT_CODE"),
+		}
+
+		rescan := jobs.Rescan{
+			Storage:        scanned,
+			Scanner:        &scanner,
+			Quarantine:     &quarantine,
+			CheckpointPath: cfg.GetString("RESCAN_CHECKPOINT_PATH"),
+		}
+
+		if rate := cfg.GetInt("RESCAN_RATE"); rate > 0 {
+			rescan.Interval = time.Second / time.Duration(rate)
+		}
+
+		admin.HandleFunc("/rescan", drweb.WithAdminAuth(drweb.RescanStatusHandler(&rescan), adminToken)).Methods("GET")
+		admin.HandleFunc("/rescan", drweb.WithAdminAuth(drweb.StartRescanHandler(&rescan), adminToken)).Methods("POST")
+
+		if interval := cfg.GetDuration("RESCAN_WATCH_INTERVAL"); interval > 0 {
+			go rescan.Watch(interval*time.Second, nil)
+		}
+	}
 
 	srv := &http.Server{
 		Handler:      router,
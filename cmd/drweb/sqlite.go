@@ -0,0 +1,8 @@
+//go:build sqlite
+// +build sqlite
+
+package main
+
+// NOTE: the driver of sqlite storage backend is pure Go, but it is large
+// and needs a newer Go, so it is only built in on demand
+import _ "modernc.org/sqlite"
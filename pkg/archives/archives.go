@@ -0,0 +1,200 @@
+package archives
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+)
+
+// Limits protect against archive bombs, sizes are the ones of decompressed data.
+// Entries, TotalSize and Depth apply to an archive along with nested ones.
+// Zero stands for no limit.
+type Limits struct {
+	MaxEntries   int
+	MaxEntrySize int64
+	MaxTotalSize int64
+	MaxRatio     int64
+	MaxDepth     int
+}
+
+// ratioFloor keeps small members from tripping compression ratio limit,
+// a few kilobytes of zeros are fine whatever their ratio is.
+const ratioFloor = 1 << 20
+
+const (
+	formatZip   = "zip"
+	formatTar   = "tar"
+	formatTarGz = "tar.gz"
+	formatGzip  = "gzip"
+)
+
+// opener gives member contents. Readers of the same archive
+// are sequential, a member should be read before the next one is opened.
+type opener func() (io.Reader, error)
+
+type walkFunc func(entry *drweb.ArchiveEntry, open opener) error
+
+// memberError is a failure to read a single member (corrupted or too large one),
+// which does not prevent the rest of an archive from being extracted.
+type memberError struct {
+	reason string
+}
+
+func (e *memberError) Error() string {
+	return e.reason
+}
+
+// budget is shared by an archive and whatever is nested in it.
+type budget struct {
+	limits  Limits
+	entries int
+	total   int64
+}
+
+func (b *budget) entry() error {
+	b.entries++
+	if b.limits.MaxEntries > 0 && b.entries > b.limits.MaxEntries {
+		return &drweb.ArchiveLimitError{Limit: "entries count"}
+	}
+	return nil
+}
+
+// meter reads up to max bytes (0 for any) of decompressed data.
+// Only the outermost reader of a stream counts towards total size.
+type meter struct {
+	reader io.Reader
+	budget *budget
+	max    int64
+	limit  string
+	total  bool
+	read   int64
+}
+
+func (m *meter) Read(p []byte) (int, error) {
+	n, err := m.reader.Read(p)
+	m.read += int64(n)
+
+	if m.total {
+		m.budget.total += int64(n)
+		if m.budget.limits.MaxTotalSize > 0 && m.budget.total > m.budget.limits.MaxTotalSize {
+			return n, &drweb.ArchiveLimitError{Limit: "total size"}
+		}
+	}
+
+	if m.max > 0 && m.read > m.max {
+		if m.limit != "" {
+			return n, &drweb.ArchiveLimitError{Limit: m.limit}
+		}
+		return n, &memberError{reason: "member exceeds size limit"}
+	}
+
+	switch err.(type) {
+	case nil, *drweb.ArchiveLimitError, *memberError:
+	default:
+		if err != io.EOF {
+			return n, &memberError{reason: "member is corrupted: " + err.Error()}
+		}
+	}
+
+	return n, err
+}
+
+// ratioLimit bounds decompressed size of compressed data.
+func (b *budget) ratioLimit(compressed int64) int64 {
+	if b.limits.MaxRatio <= 0 || compressed <= 0 {
+		return 0
+	}
+
+	if limit := compressed * b.limits.MaxRatio; limit > ratioFloor {
+		return limit
+	}
+	return ratioFloor
+}
+
+// entryLimit bounds a member by its compressed size as well, since declared sizes may lie.
+func (b *budget) entryLimit(compressed int64) int64 {
+	max, byRatio := b.limits.MaxEntrySize, b.ratioLimit(compressed)
+	if max == 0 || byRatio > 0 && byRatio < max {
+		return byRatio
+	}
+	return max
+}
+
+func detect(input io.ReaderAt, size int64) string {
+	magic := make([]byte, 262)
+	read, _ := input.ReadAt(magic, 0)
+	magic = magic[:read]
+
+	switch {
+	case bytes.HasPrefix(magic, []byte("PK\x03\x04")), bytes.HasPrefix(magic, []byte("PK\x05\x06")):
+		return formatZip
+	case isTar(magic):
+		return formatTar
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		stream, err := gzip.NewReader(io.NewSectionReader(input, 0, size))
+		if err != nil {
+			return ""
+		}
+		header := make([]byte, 262)
+		read, _ = io.ReadFull(stream, header)
+		if isTar(header[:read]) {
+			return formatTarGz
+		}
+		return formatGzip
+	}
+
+	return ""
+}
+
+// NOTE: only POSIX and GNU tarballs are recognised, ancient v7 ones have no magic
+func isTar(magic []byte) bool {
+	return len(magic) >= 262 && bytes.Equal(magic[257:262], []byte("ustar"))
+}
+
+func walk(input io.ReaderAt, size int64, b *budget, fn walkFunc) error {
+	counted := func(entry *drweb.ArchiveEntry, open opener) error {
+		if err := b.entry(); err != nil {
+			return err
+		}
+		entry.Unsafe = unsafeName(entry.Name)
+		return fn(entry, open)
+	}
+
+	switch detect(input, size) {
+	case formatZip:
+		return walkZip(input, size, b, counted)
+	case formatTar:
+		return walkTar(io.NewSectionReader(input, 0, size), b, counted, true)
+	case formatTarGz:
+		return walkTarGz(input, size, b, counted)
+	case formatGzip:
+		return walkGzip(input, size, b, counted)
+	}
+
+	return drweb.ErrNotArchive
+}
+
+// unsafeName tells whether extracting a member as is would escape target directory.
+func unsafeName(name string) bool {
+	name = strings.Replace(name, "\\", "/", -1)
+
+	if name == "" || strings.HasPrefix(name, "/") || strings.ContainsRune(name, 0) {
+		return true
+	}
+
+	// NOTE: windows drive letters, like c:/windows
+	if len(name) > 1 && name[1] == ':' {
+		return true
+	}
+
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,205 @@
+package archives
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+)
+
+// Extractor lists and explodes stored archives. Exploded members are saved
+// through Storage like any upload would be, inspectors included,
+// and linked with their archives in metadata.
+type Extractor struct {
+	Storage       drweb.Storage
+	Metadata      drweb.MetadataStore
+	NameGenerator drweb.FileNameGenerator
+	Inspectors    []drweb.InspectorFactory
+	Limits        Limits
+}
+
+type openedFile struct {
+	*drweb.File
+	input io.ReaderAt
+}
+
+func (e *Extractor) open(filename string) (*openedFile, error) {
+	file, err := e.Storage.Load(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	// NOTE: zip needs random access, storages
+	// which can not provide it have the file read in memory
+	input, ok := file.Body.(io.ReaderAt)
+	if !ok {
+		contents, err := ioutil.ReadAll(file.Body)
+		if err != nil {
+			file.Close()
+			return nil, errors.Wrap(err, "failed to read file")
+		}
+		input = bytes.NewReader(contents)
+	}
+
+	return &openedFile{File: file, input: input}, nil
+}
+
+// Entries lists archive members without extracting them.
+func (e *Extractor) Entries(filename string) ([]*drweb.ArchiveEntry, error) {
+	file, err := e.open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	entries := []*drweb.ArchiveEntry{}
+	err = walk(file.input, file.Size, &budget{limits: e.Limits}, func(entry *drweb.ArchiveEntry, open opener) error {
+		entries = append(entries, entry)
+		return nil
+	})
+
+	return entries, err
+}
+
+// Explode stores every archive member, nested archives get exploded as well.
+// Members which can not be stored safely are skipped, while exceeding
+// limits of the whole archive stops the explosion: whatever was
+// stored by then is kept, as it would be with separate uploads.
+func (e *Extractor) Explode(filename string) (*drweb.Explosion, error) {
+	explosion := &drweb.Explosion{Filename: filename, Members: []*drweb.ExplodedMember{}}
+	err := e.explode(filename, []string{filename}, &budget{limits: e.Limits}, explosion)
+	return explosion, err
+}
+
+func (e *Extractor) explode(filename string, ancestors []string, b *budget, explosion *drweb.Explosion) error {
+	file, err := e.open(filename)
+	if err != nil {
+		return err
+	}
+
+	stored := []*drweb.ExplodedMember{}
+	err = walk(file.input, file.Size, b, func(entry *drweb.ArchiveEntry, open opener) error {
+		if entry.Type == drweb.ArchiveEntryDirectory {
+			return nil
+		}
+
+		member := &drweb.ExplodedMember{Parent: filename, Name: entry.Name}
+		explosion.Members = append(explosion.Members, member)
+
+		switch {
+		case entry.Unsafe:
+			member.Skipped = "member path is unsafe"
+		case entry.Encrypted:
+			member.Skipped = "member is encrypted"
+		case entry.Type != drweb.ArchiveEntryFile:
+			member.Skipped = "member is not a regular file"
+		default:
+			var err error
+			if member.Filename, member.Skipped, err = e.save(filename, open); err != nil {
+				return err
+			}
+		}
+
+		if member.Filename != "" {
+			stored = append(stored, member)
+		}
+		return nil
+	})
+	file.Close()
+
+	if err != nil {
+		return err
+	}
+
+	if err = e.link(filename, stored); err != nil {
+		return err
+	}
+
+	for _, member := range stored {
+		if err = e.explodeNested(member, ancestors, b, explosion); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// explodeNested goes on with a member if it turns out to be an archive.
+func (e *Extractor) explodeNested(member *drweb.ExplodedMember, ancestors []string, b *budget, explosion *drweb.Explosion) error {
+	for _, ancestor := range ancestors {
+		if ancestor == member.Filename {
+			member.Skipped = "archive contains itself"
+			return nil
+		}
+	}
+
+	if b.limits.MaxDepth > 0 && len(ancestors) >= b.limits.MaxDepth {
+		file, err := e.open(member.Filename)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		if detect(file.input, file.Size) != "" {
+			member.Skipped = "archive nesting exceeds depth limit"
+		}
+		return nil
+	}
+
+	nested := append(append([]string{}, ancestors...), member.Filename)
+	err := e.explode(member.Filename, nested, b, explosion)
+	if errors.Cause(err) == drweb.ErrNotArchive {
+		return nil
+	}
+	return err
+}
+
+// save returns either name of the stored member or the reason it was skipped.
+func (e *Extractor) save(parent string, open opener) (string, string, error) {
+	body, err := open()
+	if err != nil {
+		return "", err.Error(), nil
+	}
+
+	metadata := &drweb.Metadata{}
+	metadata.AddParent(parent)
+
+	file := &drweb.FileCreateRequest{
+		Body:          ioutil.NopCloser(body),
+		NameGenerator: e.NameGenerator,
+		Metadata:      metadata,
+	}
+
+	for _, newInspector := range e.Inspectors {
+		file.Inspectors = append(file.Inspectors, newInspector())
+	}
+
+	filename, err := e.Storage.Save(file)
+	switch cause := errors.Cause(err).(type) {
+	case nil:
+		return filename, "", nil
+	case *drweb.RejectionError, *memberError:
+		log.WithError(err).WithField("archive", parent).Info("archive member skipped")
+		return "", cause.Error(), nil
+	}
+
+	return "", "", err
+}
+
+func (e *Extractor) link(parent string, members []*drweb.ExplodedMember) error {
+	if len(members) == 0 {
+		return nil
+	}
+
+	err := e.Metadata.Update(parent, func(metadata *drweb.Metadata) error {
+		for _, member := range members {
+			metadata.AddChild(member.Filename)
+		}
+		return nil
+	})
+
+	return errors.Wrap(err, "failed to link archive members")
+}
@@ -0,0 +1,241 @@
+package archives_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	pkgerrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/twonegatives/drweb_challenge/pkg/archives"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+	"github.com/twonegatives/drweb_challenge/pkg/namegenerators"
+	"github.com/twonegatives/drweb_challenge/pkg/pathgenerators"
+	"github.com/twonegatives/drweb_challenge/pkg/storages"
+)
+
+type zipMember struct {
+	Name      string
+	Contents  []byte
+	Encrypted bool
+}
+
+func buildZip(t *testing.T, members ...zipMember) []byte {
+	buf := new(bytes.Buffer)
+	writer := zip.NewWriter(buf)
+
+	for _, member := range members {
+		header := &zip.FileHeader{Name: member.Name, Method: zip.Deflate}
+		if member.Encrypted {
+			header.Flags |= 0x1
+		}
+
+		w, err := writer.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(member.Contents)
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func buildTarGz(t *testing.T, members map[string][]byte) []byte {
+	buf := new(bytes.Buffer)
+	compressed := gzip.NewWriter(buf)
+	writer := tar.NewWriter(compressed)
+
+	for name, contents := range members {
+		header := &tar.Header{Name: name, Mode: 0600, Size: int64(len(contents)), Typeflag: tar.TypeReg}
+		if err := writer.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		writer.Write(contents)
+	}
+
+	writer.WriteHeader(&tar.Header{Name: "link", Linkname: "/etc/passwd", Typeflag: tar.TypeSymlink})
+	writer.Close()
+	compressed.Close()
+	return buf.Bytes()
+}
+
+func generateExtractor(t *testing.T, limits archives.Limits) (*archives.Extractor, func()) {
+	base, err := ioutil.TempDir("../../tmp", "archives")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pathgen := &pathgenerators.NestedGenerator{BasePath: base, Levels: 1, FolderLength: 2}
+	storage := &storages.FileSystemStorage{BasePath: base, FileMode: 0700, FilePathGenerator: pathgen}
+	metadata := &storages.FileSystemMetadataStore{
+		BasePath:          base + "/metadata",
+		FileMode:          0700,
+		FilePathGenerator: &pathgenerators.NestedGenerator{BasePath: base + "/metadata", Levels: 1, FolderLength: 2},
+	}
+
+	extractor := &archives.Extractor{
+		Storage:       &storages.IndexedStorage{Storage: storage, Metadata: metadata},
+		Metadata:      metadata,
+		NameGenerator: &namegenerators.SHA256{},
+		Limits:        limits,
+	}
+
+	return extractor, func() { os.RemoveAll(base) }
+}
+
+func store(t *testing.T, extractor *archives.Extractor, contents []byte) string {
+	filename, err := extractor.Storage.Save(&drweb.FileCreateRequest{
+		Body:          ioutil.NopCloser(bytes.NewReader(contents)),
+		NameGenerator: extractor.NameGenerator,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestExtractorEntries(t *testing.T) {
+	extractor, cleanup := generateExtractor(t, archives.Limits{})
+	defer cleanup()
+
+	zipped := store(t, extractor, buildZip(t,
+		zipMember{Name: "docs/"},
+		zipMember{Name: "docs/alice.txt", Contents: []byte("alice")},
+		zipMember{Name: "../../etc/cron.d/evil", Contents: []byte("evil")},
+		zipMember{Name: "secret.txt", Contents: []byte("secret"), Encrypted: true},
+	))
+
+	entries, err := extractor.Entries(zipped)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(entries))
+	assert.Equal(t, drweb.ArchiveEntryDirectory, entries[0].Type)
+	assert.Equal(t, &drweb.ArchiveEntry{
+		Name:           "docs/alice.txt",
+		Type:           drweb.ArchiveEntryFile,
+		Size:           5,
+		CompressedSize: entries[1].CompressedSize,
+		CRC32:          "278ebc47",
+	}, entries[1])
+	assert.True(t, entries[2].Unsafe)
+	assert.True(t, entries[3].Encrypted)
+
+	tarball := store(t, extractor, buildTarGz(t, map[string][]byte{"alice.txt": []byte("alice")}))
+	entries, err = extractor.Entries(tarball)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(entries))
+	assert.Equal(t, "alice.txt", entries[0].Name)
+	assert.Equal(t, int64(5), entries[0].Size)
+	assert.Equal(t, drweb.ArchiveEntryLink, entries[1].Type)
+
+	buf := new(bytes.Buffer)
+	compressed := gzip.NewWriter(buf)
+	compressed.Name = "alice.txt"
+	compressed.Write([]byte("alice"))
+	compressed.Close()
+
+	entries, err = extractor.Entries(store(t, extractor, buf.Bytes()))
+	assert.Nil(t, err)
+	assert.Equal(t, []*drweb.ArchiveEntry{{
+		Name:           "alice.txt",
+		Type:           drweb.ArchiveEntryFile,
+		Size:           5,
+		CompressedSize: int64(buf.Len()),
+		CRC32:          "278ebc47",
+	}}, entries)
+
+	_, err = extractor.Entries(store(t, extractor, []byte("just a text")))
+	assert.Equal(t, drweb.ErrNotArchive, pkgerrors.Cause(err))
+
+	_, err = extractor.Entries(store(t, extractor, []byte("PK\x03\x04 is not enough")))
+	assert.Equal(t, drweb.ErrNotArchive, pkgerrors.Cause(err))
+
+	_, err = extractor.Entries("missing")
+	assert.True(t, os.IsNotExist(pkgerrors.Cause(err)))
+}
+
+func TestExtractorExplode(t *testing.T) {
+	extractor, cleanup := generateExtractor(t, archives.Limits{MaxDepth: 2, MaxEntrySize: 1 << 10})
+	defer cleanup()
+
+	deepest := buildZip(t, zipMember{Name: "deepest.txt", Contents: []byte("deepest")})
+	deeper := buildZip(t, zipMember{Name: "deepest.zip", Contents: deepest})
+	archive := store(t, extractor, buildZip(t,
+		zipMember{Name: "alice.txt", Contents: []byte("alice")},
+		zipMember{Name: "../evil", Contents: []byte("evil")},
+		zipMember{Name: "secret.txt", Contents: []byte("secret"), Encrypted: true},
+		zipMember{Name: "zeros", Contents: make([]byte, 1<<11)},
+		zipMember{Name: "deeper.zip", Contents: deeper},
+	))
+
+	explosion, err := extractor.Explode(archive)
+	assert.Nil(t, err)
+	assert.Equal(t, archive, explosion.Filename)
+	assert.Equal(t, 6, len(explosion.Members))
+
+	skipped := map[string]string{}
+	stored := map[string]string{}
+	for _, member := range explosion.Members {
+		skipped[member.Name] = member.Skipped
+		stored[member.Name] = member.Filename
+	}
+
+	assert.Equal(t, "", skipped["alice.txt"])
+	assert.Equal(t, "member path is unsafe", skipped["../evil"])
+	assert.Equal(t, "member is encrypted", skipped["secret.txt"])
+	assert.Equal(t, "member exceeds size limit", skipped["zeros"])
+	assert.Equal(t, "", skipped["deeper.zip"])
+	assert.Equal(t, "archive nesting exceeds depth limit", skipped["deepest.zip"])
+	assert.Equal(t, "", stored["zeros"])
+	assert.NotEqual(t, "", stored["deepest.zip"])
+
+	parent, err := extractor.Metadata.Get(archive)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{stored["alice.txt"], stored["deeper.zip"]}, parent.Children)
+
+	child, err := extractor.Metadata.Get(stored["deepest.zip"])
+	assert.Nil(t, err)
+	assert.Equal(t, []string{stored["deeper.zip"]}, child.Parents)
+
+	loaded, err := extractor.Storage.Load(stored["alice.txt"])
+	assert.Nil(t, err)
+	contents, _ := ioutil.ReadAll(loaded.Body)
+	loaded.Close()
+	assert.Equal(t, "alice", string(contents))
+
+	_, err = extractor.Explode(store(t, extractor, []byte("just a text")))
+	assert.Equal(t, drweb.ErrNotArchive, pkgerrors.Cause(err))
+}
+
+func TestExtractorLimits(t *testing.T) {
+	var objects = map[string]struct {
+		Limits archives.Limits
+		Limit  string
+	}{
+		"entries":    {Limits: archives.Limits{MaxEntries: 1}, Limit: "entries count"},
+		"total size": {Limits: archives.Limits{MaxTotalSize: 3 << 20}, Limit: "total size"},
+		"ratio":      {Limits: archives.Limits{MaxRatio: 10}, Limit: "compression ratio"},
+	}
+
+	for testName, testObject := range objects {
+		t.Run(testName, func(t *testing.T) {
+			extractor, cleanup := generateExtractor(t, testObject.Limits)
+			defer cleanup()
+
+			zeros := make([]byte, 2<<20)
+			bomb := store(t, extractor, buildTarGz(t, map[string][]byte{"a": zeros}))
+			if testObject.Limit != "compression ratio" {
+				bomb = store(t, extractor, buildZip(t, zipMember{Name: "a", Contents: zeros}, zipMember{Name: "b", Contents: zeros[1:]}))
+			}
+
+			_, err := extractor.Explode(bomb)
+			assert.Equal(t, &drweb.ArchiveLimitError{Limit: testObject.Limit}, pkgerrors.Cause(err))
+		})
+	}
+}
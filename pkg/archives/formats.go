@@ -0,0 +1,161 @@
+package archives
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+)
+
+// zipEncrypted is general purpose flag of encrypted zip members.
+const zipEncrypted = 0x1
+
+// malformed keeps ErrNotArchive as a cause, so that broken archives
+// are reported the same way as anything else which can not be listed.
+func malformed(format string, err error) error {
+	if _, ok := err.(*drweb.ArchiveLimitError); ok {
+		return err
+	}
+	return errors.Wrap(drweb.ErrNotArchive, fmt.Sprintf("malformed %s (%s)", format, err))
+}
+
+func walkZip(input io.ReaderAt, size int64, b *budget, fn walkFunc) error {
+	archive, err := zip.NewReader(input, size)
+	if err != nil {
+		return malformed("zip", err)
+	}
+
+	for _, member := range archive.File {
+		var body io.ReadCloser
+
+		entry := &drweb.ArchiveEntry{
+			Name:           member.Name,
+			Type:           drweb.ArchiveEntryFile,
+			Size:           int64(member.UncompressedSize64),
+			CompressedSize: int64(member.CompressedSize64),
+			CRC32:          fmt.Sprintf("%08x", member.CRC32),
+			Encrypted:      member.Flags&zipEncrypted != 0,
+		}
+
+		switch mode := member.Mode(); {
+		case mode.IsDir():
+			entry.Type = drweb.ArchiveEntryDirectory
+		case mode&os.ModeSymlink != 0:
+			entry.Type = drweb.ArchiveEntryLink
+		}
+
+		member := member
+		open := func() (io.Reader, error) {
+			limit := b.entryLimit(entry.CompressedSize)
+			if limit > 0 && entry.Size > limit {
+				return nil, &memberError{reason: "member exceeds size limit"}
+			}
+
+			if body, err = member.Open(); err != nil {
+				return nil, &memberError{reason: err.Error()}
+			}
+			return &meter{reader: body, budget: b, max: limit, total: true}, nil
+		}
+
+		err = fn(entry, open)
+		if body != nil {
+			body.Close()
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// walkTar reads the tarball sequentially, compressed ones included.
+func walkTar(input io.Reader, b *budget, fn walkFunc, total bool) error {
+	archive := tar.NewReader(input)
+
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return malformed("tar", errors.Cause(err))
+		}
+
+		entry := &drweb.ArchiveEntry{Name: header.Name, Size: header.Size}
+
+		switch header.Typeflag {
+		case tar.TypeReg, tar.TypeRegA:
+			entry.Type = drweb.ArchiveEntryFile
+		case tar.TypeDir:
+			entry.Type = drweb.ArchiveEntryDirectory
+		case tar.TypeSymlink, tar.TypeLink:
+			entry.Type = drweb.ArchiveEntryLink
+		default:
+			entry.Type = drweb.ArchiveEntryOther
+		}
+
+		open := func() (io.Reader, error) {
+			limit := b.limits.MaxEntrySize
+			if limit > 0 && entry.Size > limit {
+				return nil, &memberError{reason: "member exceeds size limit"}
+			}
+			return &meter{reader: archive, budget: b, max: limit, total: total}, nil
+		}
+
+		if err = fn(entry, open); err != nil {
+			return err
+		}
+	}
+}
+
+func walkTarGz(input io.ReaderAt, size int64, b *budget, fn walkFunc) error {
+	stream, err := gzip.NewReader(io.NewSectionReader(input, 0, size))
+	if err != nil {
+		return malformed("gzip", err)
+	}
+	defer stream.Close()
+
+	metered := &meter{reader: stream, budget: b, max: b.ratioLimit(size), limit: "compression ratio", total: true}
+	return walkTar(metered, b, fn, false)
+}
+
+// walkGzip treats a compressed file as an archive of a single member.
+// NOTE: size and checksum come from gzip trailer, which only
+// describes the last member of concatenated gzip streams.
+func walkGzip(input io.ReaderAt, size int64, b *budget, fn walkFunc) error {
+	stream, err := gzip.NewReader(io.NewSectionReader(input, 0, size))
+	if err != nil {
+		return malformed("gzip", err)
+	}
+	defer stream.Close()
+
+	entry := &drweb.ArchiveEntry{
+		Name:           stream.Name,
+		Type:           drweb.ArchiveEntryFile,
+		CompressedSize: size,
+	}
+
+	if stream.Name == "" {
+		entry.Name = "data"
+	}
+
+	trailer := make([]byte, 8)
+	if _, err = input.ReadAt(trailer, size-8); err == nil {
+		entry.CRC32 = fmt.Sprintf("%08x", binary.LittleEndian.Uint32(trailer[:4]))
+		entry.Size = int64(binary.LittleEndian.Uint32(trailer[4:]))
+	}
+
+	open := func() (io.Reader, error) {
+		return &meter{reader: stream, budget: b, max: b.entryLimit(size), total: true}, nil
+	}
+
+	return fn(entry, open)
+}
@@ -21,6 +21,70 @@ func GetConfig() *viper.Viper {
 		cfg.SetDefault("PATH_NESTED_FOLDERS_LENGTH", defaults.PathNestedFoldersLength)
 		cfg.SetDefault("PATH_BASE", defaults.PathBase)
 		cfg.SetDefault("STORAGE_FILE_MODE", defaults.StorageFileMode)
+		cfg.SetDefault("QUARANTINE_PATH_BASE", defaults.QuarantinePathBase)
+		cfg.SetDefault("ADMIN_TOKEN", defaults.AdminToken)
+		cfg.SetDefault("SCANNER_COMMAND", defaults.ScannerCommand)
+		cfg.SetDefault("SCANNER_ARGS", defaults.ScannerArgs)
+		cfg.SetDefault("SCANNER_VERSION_ARGS", defaults.ScannerVersionArgs)
+		cfg.SetDefault("SCANNER_INFECTED_EXIT_CODE", defaults.ScannerInfectedExitCode)
+		cfg.SetDefault("RESCAN_RATE", defaults.RescanRate)
+		cfg.SetDefault("RESCAN_CHECKPOINT_PATH", defaults.RescanCheckpointPath)
+		cfg.SetDefault("RESCAN_WATCH_INTERVAL", defaults.RescanWatchInterval)
+		cfg.SetDefault("METADATA_PATH_BASE", defaults.MetadataPathBase)
+		cfg.SetDefault("HASHLISTS", defaults.HashLists)
+		cfg.SetDefault("HASHLISTS_RELOAD_INTERVAL", defaults.HashListsReloadInterval)
+		cfg.SetDefault("RULES_PATH", defaults.RulesPath)
+		cfg.SetDefault("ANALYSIS_WORKERS", defaults.AnalysisWorkers)
+		cfg.SetDefault("ANALYSIS_QUEUE_SIZE", defaults.AnalysisQueueSize)
+		cfg.SetDefault("ANALYSIS_PATH_BASE", defaults.AnalysisPathBase)
+		cfg.SetDefault("ANALYSIS_MAX_BUFFER_SIZE", defaults.AnalysisMaxBufferSize)
+		cfg.SetDefault("SEARCH_PATH_BASE", defaults.SearchPathBase)
+		cfg.SetDefault("SEARCH_WORKERS", defaults.SearchWorkers)
+		cfg.SetDefault("SEARCH_QUEUE_SIZE", defaults.SearchQueueSize)
+		cfg.SetDefault("ARCHIVE_MAX_ENTRIES", defaults.ArchiveMaxEntries)
+		cfg.SetDefault("ARCHIVE_MAX_ENTRY_SIZE", defaults.ArchiveMaxEntrySize)
+		cfg.SetDefault("ARCHIVE_MAX_TOTAL_SIZE", defaults.ArchiveMaxTotalSize)
+		cfg.SetDefault("ARCHIVE_MAX_RATIO", defaults.ArchiveMaxRatio)
+		cfg.SetDefault("ARCHIVE_MAX_DEPTH", defaults.ArchiveMaxDepth)
+		cfg.SetDefault("WRAP_PASSWORD", defaults.WrapPassword)
+		cfg.SetDefault("WRAP_POLICIES", defaults.WrapPolicies)
+		cfg.SetDefault("SERVE_INLINE_TYPES", defaults.ServeInlineTypes)
+		cfg.SetDefault("DOWNLOAD_HOST", defaults.DownloadHost)
+		cfg.SetDefault("UPLOAD_POLICIES_PATH", defaults.UploadPoliciesPath)
+		cfg.SetDefault("THUMBNAIL_MAX_PIXELS", defaults.ThumbnailMaxPixels)
+		cfg.SetDefault("ORIGINALS_PATH_BASE", defaults.OriginalsPathBase)
+		cfg.SetDefault("STORAGE_BACKEND", defaults.StorageBackend)
+		cfg.SetDefault("S3_ENDPOINT", defaults.S3Endpoint)
+		cfg.SetDefault("S3_BUCKET", defaults.S3Bucket)
+		cfg.SetDefault("S3_REGION", defaults.S3Region)
+		cfg.SetDefault("S3_ACCESS_KEY", defaults.S3AccessKey)
+		cfg.SetDefault("S3_SECRET_KEY", defaults.S3SecretKey)
+		cfg.SetDefault("S3_PART_SIZE", defaults.S3PartSize)
+		cfg.SetDefault("KV_PATH", defaults.KVPath)
+		cfg.SetDefault("KV_CHUNK_SIZE", defaults.KVChunkSize)
+		cfg.SetDefault("SQLITE_PATH", defaults.SQLitePath)
+		cfg.SetDefault("SQLITE_CHUNK_SIZE", defaults.SQLiteChunkSize)
+		cfg.SetDefault("MEMORY_MAX_SIZE", defaults.MemoryMaxSize)
+		cfg.SetDefault("MEMORY_EVICT", defaults.MemoryEvict)
+		cfg.SetDefault("STORAGE_ROUTES", defaults.StorageRoutes)
+		cfg.SetDefault("MIRROR_PATHS", defaults.MirrorPaths)
+		cfg.SetDefault("MIRROR_RETRY_INTERVAL", defaults.MirrorRetryInterval)
+		cfg.SetDefault("ERASURE_PATHS", defaults.ErasurePaths)
+		cfg.SetDefault("ERASURE_DATA_SHARDS", defaults.ErasureDataShards)
+		cfg.SetDefault("ERASURE_PARITY_SHARDS", defaults.ErasureParityShards)
+		cfg.SetDefault("ERASURE_CHUNK_SIZE", defaults.ErasureChunkSize)
+		cfg.SetDefault("SPREAD_DISKS", defaults.SpreadDisks)
+		cfg.SetDefault("SPREAD_MIN_FREE", defaults.SpreadMinFree)
+		cfg.SetDefault("TIER_HOT_BACKEND", defaults.TierHotBackend)
+		cfg.SetDefault("TIER_COLD_BACKEND", defaults.TierColdBackend)
+		cfg.SetDefault("TIER_DEMOTE_AFTER", defaults.TierDemoteAfter)
+		cfg.SetDefault("TIER_DEMOTE_INTERVAL", defaults.TierDemoteInterval)
+		cfg.SetDefault("TIER_SYNC_PROMOTION", defaults.TierSyncPromotion)
+		cfg.SetDefault("CACHE_MAX_SIZE", defaults.CacheMaxSize)
+		cfg.SetDefault("CACHE_POLICY", defaults.CachePolicy)
+		cfg.SetDefault("CACHE_LEDGER_PATH", defaults.CacheLedgerPath)
+		cfg.SetDefault("UPSTREAM_URL", defaults.UpstreamURL)
+		cfg.SetDefault("UPSTREAM_TIMEOUT", defaults.UpstreamTimeout)
 		cfg.AutomaticEnv()
 	})
 
@@ -35,6 +99,70 @@ type configDefaults struct {
 	PathNestedFoldersLength int
 	PathBase                string
 	StorageFileMode         int
+	QuarantinePathBase      string
+	AdminToken              string
+	ScannerCommand          string
+	ScannerArgs             string
+	ScannerVersionArgs      string
+	ScannerInfectedExitCode int
+	RescanRate              int
+	RescanCheckpointPath    string
+	RescanWatchInterval     time.Duration
+	MetadataPathBase        string
+	HashLists               string
+	HashListsReloadInterval time.Duration
+	RulesPath               string
+	AnalysisWorkers         int
+	AnalysisQueueSize       int
+	AnalysisPathBase        string
+	AnalysisMaxBufferSize   int64
+	SearchPathBase          string
+	SearchWorkers           int
+	SearchQueueSize         int
+	ArchiveMaxEntries       int
+	ArchiveMaxEntrySize     int64
+	ArchiveMaxTotalSize     int64
+	ArchiveMaxRatio         int64
+	ArchiveMaxDepth         int
+	WrapPassword            string
+	WrapPolicies            string
+	ServeInlineTypes        string
+	DownloadHost            string
+	UploadPoliciesPath      string
+	ThumbnailMaxPixels      int64
+	OriginalsPathBase       string
+	StorageBackend          string
+	S3Endpoint              string
+	S3Bucket                string
+	S3Region                string
+	S3AccessKey             string
+	S3SecretKey             string
+	S3PartSize              int64
+	KVPath                  string
+	KVChunkSize             int
+	SQLitePath              string
+	SQLiteChunkSize         int
+	MemoryMaxSize           int64
+	MemoryEvict             bool
+	StorageRoutes           string
+	MirrorPaths             string
+	MirrorRetryInterval     time.Duration
+	ErasurePaths            string
+	ErasureDataShards       int
+	ErasureParityShards     int
+	ErasureChunkSize        int
+	SpreadDisks             string
+	SpreadMinFree           int64
+	TierHotBackend          string
+	TierColdBackend         string
+	TierDemoteAfter         int
+	TierDemoteInterval      int
+	TierSyncPromotion       bool
+	CacheMaxSize            int64
+	CachePolicy             string
+	CacheLedgerPath         string
+	UpstreamURL             string
+	UpstreamTimeout         int
 }
 
 func getDefaults() *configDefaults {
@@ -48,5 +176,94 @@ func getDefaults() *configDefaults {
 		PathNestedFoldersLength: 2,
 		PathBase:                ".",
 		StorageFileMode:         0755,
+		QuarantinePathBase:      "./quarantine",
+		// NOTE: blank token keeps admin endpoints disabled
+		AdminToken: "",
+		// NOTE: rescan is disabled unless scanner command is given
+		ScannerCommand:          "",
+		ScannerArgs:             "",
+		ScannerVersionArgs:      "--version",
+		ScannerInfectedExitCode: 1,
+		RescanRate:              10,
+		RescanCheckpointPath:    "./rescan.json",
+		RescanWatchInterval:     3600,
+		MetadataPathBase:        "./metadata",
+		HashLists:               "",
+		HashListsReloadInterval: 60,
+		// NOTE: rules are not applied unless rules directory is given
+		RulesPath:         "",
+		AnalysisWorkers:   2,
+		AnalysisQueueSize: 1000,
+		AnalysisPathBase:  "./analysis",
+		// NOTE: only files of storages without random access are read in memory
+		AnalysisMaxBufferSize: 64 << 20,
+		SearchPathBase:        "./search",
+		SearchWorkers:         2,
+		SearchQueueSize:       1000,
+		// NOTE: archive limits keep zip bombs from filling up the storage
+		ArchiveMaxEntries:   10000,
+		ArchiveMaxEntrySize: 100 << 20,
+		ArchiveMaxTotalSize: 1 << 30,
+		ArchiveMaxRatio:     100,
+		ArchiveMaxDepth:     3,
+		// NOTE: password malware samples are conventionally shared with
+		WrapPassword: "infected",
+		WrapPolicies: "",
+		// NOTE: none of these may run script, unlike HTML or SVG
+		ServeInlineTypes: "text/plain image/png image/jpeg image/gif image/webp",
+		DownloadHost:     "",
+		// NOTE: uploads are not restricted unless policies are given
+		UploadPoliciesPath: "",
+		// NOTE: decoded image takes 4 bytes a pixel at least, 100MB here
+		ThumbnailMaxPixels: 25000000,
+		// NOTE: originals of stripped images are discarded unless path is given
+		OriginalsPathBase: "",
+		// NOTE: either "filesystem", "s3", "kv", "sqlite", "memory", "mirrored", "erasure", "spread", "tiered", "remote", "proxy" or "routed"
+		StorageBackend: "filesystem",
+		S3Endpoint:     "https://s3.amazonaws.com",
+		S3Bucket:       "",
+		S3Region:       "us-east-1",
+		// NOTE: blank keys make requests anonymous
+		S3AccessKey: "",
+		S3SecretKey: "",
+		// NOTE: that much memory is taken by every upload in progress
+		S3PartSize:  8 << 20,
+		KVPath:      "./files.db",
+		KVChunkSize: 64 << 10,
+		// NOTE: only used by "sqlite" backend, which has to be built with "sqlite" tag
+		SQLitePath:      "./files.sqlite",
+		SQLiteChunkSize: 64 << 10,
+		// NOTE: memory backend is a cache of recent uploads by default
+		MemoryMaxSize: 1 << 30,
+		MemoryEvict:   true,
+		// NOTE: only used by "routed" backend, tiny files go to kv
+		StorageRoutes: "65536:kv filesystem",
+		// NOTE: only used by "mirrored" backend
+		MirrorPaths:         "",
+		MirrorRetryInterval: 60,
+		// NOTE: only used by "erasure" backend, takes as many paths as shards
+		ErasurePaths:        "",
+		ErasureDataShards:   4,
+		ErasureParityShards: 2,
+		ErasureChunkSize:    64 << 10,
+		// NOTE: only used by "spread" backend
+		SpreadDisks:   "",
+		SpreadMinFree: 1 << 30,
+		// NOTE: only used by "tiered" backend, files not read for 30 days go to s3
+		TierHotBackend:     "filesystem",
+		TierColdBackend:    "s3",
+		TierDemoteAfter:    30,
+		TierDemoteInterval: 3600,
+		// NOTE: cold files are served right away and promoted in background
+		TierSyncPromotion: false,
+		// NOTE: files are never evicted unless size is given
+		CacheMaxSize: 0,
+		// NOTE: either "lru" or "lfu"
+		CachePolicy:     "lru",
+		CacheLedgerPath: "./cache.ledger",
+		// NOTE: only used by "remote" and "proxy" backends
+		UpstreamURL: "",
+		// NOTE: bodies of downloads are read within that time as well
+		UpstreamTimeout: 300,
 	}
 }
@@ -0,0 +1,100 @@
+package drweb
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// NOTE: executables are analysed in background, so there might be no analysis
+// yet for a freshly uploaded file, as well as for anything but executables.
+// Entropy is computed at upload, so it is reported on its own for such files.
+func AnalysisHandler(store AnalysisStore, metadata MetadataStore) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		filename := mux.Vars(r)["hashstring"]
+
+		analysis, err := store.Get(filename)
+		if err != nil && !os.IsNotExist(errors.Cause(err)) {
+			log.WithError(err).Error("failed to get file analysis")
+			writeJSONError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		meta, err := metadata.Get(filename)
+		if err != nil && !os.IsNotExist(errors.Cause(err)) {
+			log.WithError(err).Error("failed to get file metadata")
+			writeJSONError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		if analysis == nil {
+			if meta == nil || meta.Entropy == nil {
+				writeJSONError(w, errors.New("file was not analysed"), http.StatusNotFound)
+				return
+			}
+			analysis = &Analysis{Filename: filename}
+		}
+
+		if meta != nil {
+			analysis.Entropy = meta.Entropy
+		}
+
+		if err = json.NewEncoder(w).Encode(analysis); err != nil {
+			log.WithError(err).Error("failed to write JSON encoding to the stream")
+		}
+	}
+}
+
+// entropyFilter narrows listings down by ?min_entropy=, ?max_entropy=,
+// ?packer= and ?payload= query parameters.
+type entropyFilter struct {
+	min     float64
+	max     float64
+	packer  string
+	payload string
+}
+
+func parseEntropyFilter(r *http.Request) (*entropyFilter, error) {
+	var err error
+	filter := &entropyFilter{
+		packer:  r.URL.Query().Get("packer"),
+		payload: r.URL.Query().Get("payload"),
+	}
+
+	if filter.min, err = queryFloat(r, "min_entropy", 0, 0, 8); err != nil {
+		return nil, err
+	}
+
+	if filter.max, err = queryFloat(r, "max_entropy", 8, 0, 8); err != nil {
+		return nil, err
+	}
+
+	return filter, nil
+}
+
+func (f *entropyFilter) active() bool {
+	return f.min > 0 || f.max < 8 || f.packer != "" || f.payload != ""
+}
+
+// NOTE: files uploaded before entropy was computed never match an active filter
+func (f *entropyFilter) match(metadata *Metadata) bool {
+	if !f.active() {
+		return true
+	}
+
+	entropy := metadata.Entropy
+	if entropy == nil || entropy.Overall < f.min || entropy.Overall > f.max {
+		return false
+	}
+
+	if f.payload != "" && entropy.Payload != f.payload {
+		return false
+	}
+
+	return f.packer == "" || contains(entropy.Packers, f.packer)
+}
@@ -0,0 +1,68 @@
+package drweb_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+	"github.com/twonegatives/drweb_challenge/pkg/mocks"
+)
+
+func TestAnalysisHandler(t *testing.T) {
+	entropy := &drweb.Entropy{Overall: 7.99, WindowSize: 1024, Profile: []float64{7.8}}
+
+	var objects = map[string]struct {
+		Analysis      *drweb.Analysis
+		Error         error
+		Metadata      *drweb.Metadata
+		MetadataError error
+		ServerCode    int
+		Format        string
+		Entropy       *drweb.Entropy
+	}{
+		"analysed":       {Analysis: &drweb.Analysis{Filename: "abcdef", Format: "elf"}, MetadataError: os.ErrNotExist, ServerCode: http.StatusOK, Format: "elf"},
+		"with entropy":   {Analysis: &drweb.Analysis{Filename: "abcdef", Format: "elf"}, Metadata: &drweb.Metadata{Entropy: entropy}, ServerCode: http.StatusOK, Format: "elf", Entropy: entropy},
+		"entropy only":   {Error: os.ErrNotExist, Metadata: &drweb.Metadata{Entropy: entropy}, ServerCode: http.StatusOK, Entropy: entropy},
+		"not analysed":   {Error: os.ErrNotExist, Metadata: &drweb.Metadata{}, ServerCode: http.StatusNotFound},
+		"not found":      {Error: os.ErrNotExist, MetadataError: os.ErrNotExist, ServerCode: http.StatusNotFound},
+		"store error":    {Error: errors.New("disk is gone"), ServerCode: http.StatusInternalServerError},
+		"metadata error": {Error: os.ErrNotExist, MetadataError: errors.New("disk is gone"), ServerCode: http.StatusInternalServerError},
+	}
+
+	for testName, testObject := range objects {
+		t.Run(testName, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			store := mocks.NewMockAnalysisStore(mockCtrl)
+			store.EXPECT().Get("abcdef").Return(testObject.Analysis, testObject.Error)
+			metadata := mocks.NewMockMetadataStore(mockCtrl)
+			metadata.EXPECT().Get("abcdef").Return(testObject.Metadata, testObject.MetadataError).MaxTimes(1)
+
+			req, err := http.NewRequest("GET", "/files/abcdef/analysis", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			router := mux.NewRouter()
+			router.HandleFunc("/files/{hashstring}/analysis", drweb.AnalysisHandler(store, metadata))
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, testObject.ServerCode, rr.Code)
+			if rr.Code == http.StatusOK {
+				var analysis drweb.Analysis
+				assert.Nil(t, json.NewDecoder(rr.Body).Decode(&analysis))
+				assert.Equal(t, "abcdef", analysis.Filename)
+				assert.Equal(t, testObject.Format, analysis.Format)
+				assert.Equal(t, testObject.Entropy, analysis.Entropy)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package drweb
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// writeArchiveError tells client errors (missing files, non archives, bombs)
+// apart from storage failures.
+func writeArchiveError(w http.ResponseWriter, err error, action string) {
+	cause := errors.Cause(err)
+	if _, ok := cause.(*ArchiveLimitError); ok {
+		writeJSONError(w, err, http.StatusUnprocessableEntity)
+		return
+	}
+
+	switch {
+	case os.IsNotExist(cause):
+		writeJSONError(w, err, http.StatusNotFound)
+	case cause == ErrNotArchive:
+		writeJSONError(w, err, http.StatusUnprocessableEntity)
+	default:
+		log.WithError(err).Error("failed to " + action)
+		writeJSONError(w, err, http.StatusInternalServerError)
+	}
+}
+
+func ArchiveEntriesHandler(archives Archives) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		entries, err := archives.Entries(mux.Vars(r)["hashstring"])
+		if err != nil {
+			writeArchiveError(w, err, "list archive entries")
+			return
+		}
+
+		if err = json.NewEncoder(w).Encode(entries); err != nil {
+			log.WithError(err).Error("failed to write JSON encoding to the stream")
+		}
+	}
+}
+
+func ExplodeArchiveHandler(archives Archives) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		explosion, err := archives.Explode(mux.Vars(r)["hashstring"])
+		if err != nil {
+			writeArchiveError(w, err, "explode archive")
+			return
+		}
+
+		if err = json.NewEncoder(w).Encode(explosion); err != nil {
+			log.WithError(err).Error("failed to write JSON encoding to the stream")
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package drweb_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	pkgerrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+	"github.com/twonegatives/drweb_challenge/pkg/mocks"
+)
+
+var archiveErrors = map[string]struct {
+	Error      error
+	ServerCode int
+}{
+	"success":       {ServerCode: http.StatusOK},
+	"not found":     {Error: pkgerrors.Wrap(os.ErrNotExist, "failed to get file info"), ServerCode: http.StatusNotFound},
+	"not archive":   {Error: drweb.ErrNotArchive, ServerCode: http.StatusUnprocessableEntity},
+	"archive bomb":  {Error: &drweb.ArchiveLimitError{Limit: "total size"}, ServerCode: http.StatusUnprocessableEntity},
+	"storage error": {Error: errors.New("disk is gone"), ServerCode: http.StatusInternalServerError},
+}
+
+func TestArchiveEntriesHandler(t *testing.T) {
+	for testName, testObject := range archiveErrors {
+		t.Run(testName, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			archives := mocks.NewMockArchives(mockCtrl)
+			archives.EXPECT().Entries("abcdef").Return([]*drweb.ArchiveEntry{}, testObject.Error)
+
+			req, err := http.NewRequest("GET", "/files/abcdef/entries", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			router := mux.NewRouter()
+			router.HandleFunc("/files/{hashstring}/entries", drweb.ArchiveEntriesHandler(archives))
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, testObject.ServerCode, rr.Code)
+		})
+	}
+}
+
+func TestExplodeArchiveHandler(t *testing.T) {
+	for testName, testObject := range archiveErrors {
+		t.Run(testName, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			archives := mocks.NewMockArchives(mockCtrl)
+			archives.EXPECT().Explode("abcdef").Return(&drweb.Explosion{Filename: "abcdef"}, testObject.Error)
+
+			req, err := http.NewRequest("POST", "/files/abcdef/explode", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			router := mux.NewRouter()
+			router.HandleFunc("/files/{hashstring}/explode", drweb.ExplodeArchiveHandler(archives))
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, testObject.ServerCode, rr.Code)
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package drweb
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+func CacheStatsHandler(cache Cache) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(cache.Stats()); err != nil {
+			log.WithError(err).Error("failed to write JSON encoding to the stream")
+		}
+	}
+}
+
+// PinFileHandler protects the file from eviction,
+// it may be pinned before it is uploaded.
+func PinFileHandler(cache Cache) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if err := cache.Pin(mux.Vars(r)["hashstring"]); err != nil {
+			log.WithError(err).Error("failed to pin file")
+			writeJSONError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+func UnpinFileHandler(cache Cache) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		err := cache.Unpin(mux.Vars(r)["hashstring"])
+		if os.IsNotExist(errors.Cause(err)) {
+			writeJSONError(w, errors.New("file is not pinned"), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.WithError(err).Error("failed to unpin file")
+			writeJSONError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,73 @@
+package drweb_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+	"github.com/twonegatives/drweb_challenge/pkg/mocks"
+)
+
+func TestCacheStatsHandler(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cache := mocks.NewMockCache(mockCtrl)
+	cache.EXPECT().Stats().Return(&drweb.CacheStats{Policy: drweb.CachePolicyLRU, MaxSize: 1024, Size: 512, Evictions: 3})
+
+	rr := httptest.NewRecorder()
+	drweb.CacheStatsHandler(cache)(rr, &http.Request{})
+
+	var response map[string]interface{}
+	json.Unmarshal(rr.Body.Bytes(), &response)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "lru", response["policy"])
+	assert.Equal(t, float64(3), response["evictions"])
+}
+
+func TestPinFileHandlers(t *testing.T) {
+	var objects = map[string]struct {
+		Method     string
+		Error      error
+		ServerCode int
+	}{
+		"pinned":        {Method: "POST", ServerCode: http.StatusCreated},
+		"pin failure":   {Method: "POST", Error: errors.New("disk is gone"), ServerCode: http.StatusInternalServerError},
+		"unpinned":      {Method: "DELETE", ServerCode: http.StatusNoContent},
+		"not pinned":    {Method: "DELETE", Error: os.ErrNotExist, ServerCode: http.StatusNotFound},
+		"unpin failure": {Method: "DELETE", Error: errors.New("disk is gone"), ServerCode: http.StatusInternalServerError},
+	}
+
+	for testName, testObject := range objects {
+		t.Run(testName, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			cache := mocks.NewMockCache(mockCtrl)
+			if testObject.Method == "POST" {
+				cache.EXPECT().Pin("abcdef").Return(testObject.Error)
+			} else {
+				cache.EXPECT().Unpin("abcdef").Return(testObject.Error)
+			}
+
+			req, err := http.NewRequest(testObject.Method, "/admin/cache/pins/abcdef", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			router := mux.NewRouter()
+			router.HandleFunc("/admin/cache/pins/{hashstring}", drweb.PinFileHandler(cache)).Methods("POST")
+			router.HandleFunc("/admin/cache/pins/{hashstring}", drweb.UnpinFileHandler(cache)).Methods("DELETE")
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, testObject.ServerCode, rr.Code)
+		})
+	}
+}
@@ -1,7 +1,10 @@
 package drweb
 
 import (
+	"errors"
+	"fmt"
 	"io"
+	"time"
 )
 
 //go:generate mockgen -source=drweb.go -destination ../mocks/mock_drweb.go -package mocks
@@ -16,9 +19,21 @@ type Storage interface {
 	Delete(filename string) error
 }
 
+// ErrStorageFull tells a file does not fit into a storage of limited size.
+var ErrStorageFull = errors.New("storage is full")
+
+// WalkableStorage is a storage which can enumerate files it keeps,
+// Walk calls fn for every stored file in lexical order of their names.
+type WalkableStorage interface {
+	Storage
+	Walk(fn func(filename string) error) error
+}
+
 type FileCreateRequest struct {
 	Body          io.ReadCloser
 	NameGenerator FileNameGenerator
+	Inspectors    []Inspector
+	Metadata      *Metadata
 }
 
 func (f *FileCreateRequest) Close() error {
@@ -41,3 +56,510 @@ type FileNameGenerator interface {
 type FilePathGenerator interface {
 	Generate(filename string) (string, error)
 }
+
+// PostSaveJob processes stored files in background, e.g. extracts their metadata.
+// Forget drops whatever the job derived from a file once it is deleted.
+type PostSaveJob interface {
+	Enqueue(filename string)
+	Forget(filename string) error
+}
+
+// Analysis describes an executable (PE, ELF or Mach-O) file.
+// NOTE: malformed executables are still analysed as far as possible,
+// Error tells what went wrong.
+type Analysis struct {
+	Filename     string             `json:"hashstring"`
+	Format       string             `json:"format"`
+	Architecture string             `json:"architecture"`
+	EntryPoint   uint64             `json:"entry_point"`
+	CompiledAt   *time.Time         `json:"compiled_at,omitempty"`
+	Sections     []*AnalysisSection `json:"sections"`
+	Libraries    []string           `json:"libraries"`
+	Imports      []*AnalysisImport  `json:"imports"`
+	Exports      []string           `json:"exports"`
+	Imphash      string             `json:"imphash,omitempty"`
+	Signed       bool               `json:"signed"`
+	Entropy      *Entropy           `json:"entropy,omitempty"`
+	Error        string             `json:"error,omitempty"`
+	AnalyzedAt   time.Time          `json:"analyzed_at"`
+}
+
+// Entropy is computed for every upload. Profile holds mean entropy
+// of WindowSize bytes long windows, so that it stays short for large files.
+type Entropy struct {
+	Overall    float64   `json:"overall"`
+	ChiSquare  float64   `json:"chi_square"`
+	WindowSize int64     `json:"window_size"`
+	Profile    []float64 `json:"profile"`
+	Packers    []string  `json:"packers,omitempty"`
+	Payload    string    `json:"payload,omitempty"`
+}
+
+const (
+	PayloadCompressed = "compressed"
+	PayloadEncrypted  = "encrypted"
+)
+
+type AnalysisSection struct {
+	Name    string `json:"name"`
+	Address uint64 `json:"address"`
+	Size    uint64 `json:"size"`
+}
+
+type AnalysisImport struct {
+	Library string `json:"library,omitempty"`
+	Symbol  string `json:"symbol"`
+}
+
+// Wrapper packs a file into an (encrypted) archive while it is served.
+type Wrapper interface {
+	Wrap(w io.Writer, filename string, body io.Reader) error
+}
+
+type AnalysisStore interface {
+	Get(filename string) (*Analysis, error)
+	Put(analysis *Analysis) error
+	Delete(filename string) error
+}
+
+// Inspector is fed with file contents while storage saves it.
+// Once the name is known, Inspect may fill in metadata or reject the file.
+type Inspector interface {
+	io.Writer
+	Inspect(filename string, metadata *Metadata) error
+}
+
+type InspectorFactory func() Inspector
+
+// RejectionError is returned by inspectors when a file must not be accepted.
+type RejectionError struct {
+	Status int
+	Rule   string
+	Reason string
+}
+
+func (e *RejectionError) Error() string {
+	return fmt.Sprintf("file rejected by %s: %s", e.Rule, e.Reason)
+}
+
+type Metadata struct {
+	Filename  string    `json:"hashstring"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+	Tags      []string  `json:"tags"`
+	Ssdeep    string    `json:"ssdeep,omitempty"`
+	Entropy   *Entropy  `json:"entropy,omitempty"`
+	Parents   []string  `json:"parents,omitempty"`
+	Children  []string  `json:"children,omitempty"`
+	// NOTE: derived files (thumbnails) are keyed by what they were derived with
+	Derived     map[string]string `json:"derived,omitempty"`
+	DerivedFrom []string          `json:"derived_from,omitempty"`
+	Image       *ImageMetadata    `json:"image,omitempty"`
+	// NOTE: original of a stripped image, kept in a separate restricted storage
+	Original string `json:"original,omitempty"`
+	// NOTE: kept by tiered storage only
+	Tier       string     `json:"tier,omitempty"`
+	AccessedAt *time.Time `json:"accessed_at,omitempty"`
+}
+
+// ImageMetadata is what EXIF and XMP of an image tell. Stripped lists
+// kinds of metadata (exif, xmp, iptc, text) removed out of the upload.
+type ImageMetadata struct {
+	Make     string            `json:"make,omitempty"`
+	Model    string            `json:"model,omitempty"`
+	Software string            `json:"software,omitempty"`
+	Lens     string            `json:"lens,omitempty"`
+	Serial   string            `json:"serial,omitempty"`
+	TakenAt  string            `json:"taken_at,omitempty"`
+	GPS      *GPSPosition      `json:"gps,omitempty"`
+	XMP      map[string]string `json:"xmp,omitempty"`
+	Stripped []string          `json:"stripped,omitempty"`
+}
+
+type GPSPosition struct {
+	Latitude  float64  `json:"latitude"`
+	Longitude float64  `json:"longitude"`
+	Altitude  *float64 `json:"altitude,omitempty"`
+}
+
+// Stripper removes metadata out of images while they are streamed.
+type Stripper interface {
+	NewReader(body io.Reader) StrippingReader
+}
+
+// StrippingReader tells what was removed once read through.
+type StrippingReader interface {
+	io.Reader
+	Stripped() []string
+}
+
+// AddTag keeps tags unique, so repeated uploads do not pile them up.
+func (m *Metadata) AddTag(tag string) {
+	for _, existing := range m.Tags {
+		if existing == tag {
+			return
+		}
+	}
+	m.Tags = append(m.Tags, tag)
+}
+
+// Merge brings in whatever was collected during another upload of the same file.
+func (m *Metadata) Merge(other *Metadata) {
+	if m.CreatedAt.IsZero() {
+		m.CreatedAt = other.CreatedAt
+	}
+	m.Size = other.Size
+	if other.Ssdeep != "" {
+		m.Ssdeep = other.Ssdeep
+	}
+	if other.Entropy != nil {
+		m.Entropy = other.Entropy
+	}
+	if other.Image != nil {
+		m.Image = other.Image
+	}
+	if other.Original != "" {
+		m.Original = other.Original
+	}
+	if other.Tier != "" {
+		m.Tier = other.Tier
+	}
+	if other.AccessedAt != nil {
+		m.AccessedAt = other.AccessedAt
+	}
+
+	for _, tag := range other.Tags {
+		m.AddTag(tag)
+	}
+
+	for _, parent := range other.Parents {
+		m.AddParent(parent)
+	}
+
+	for _, child := range other.Children {
+		m.AddChild(child)
+	}
+
+	for key, derived := range other.Derived {
+		m.AddDerived(key, derived)
+	}
+
+	for _, source := range other.DerivedFrom {
+		m.DerivedFrom = appendUnique(m.DerivedFrom, source)
+	}
+}
+
+// AddParent links the file to an archive it was extracted from.
+func (m *Metadata) AddParent(filename string) {
+	m.Parents = appendUnique(m.Parents, filename)
+}
+
+// AddChild links an archive to a file extracted out of it.
+func (m *Metadata) AddChild(filename string) {
+	m.Children = appendUnique(m.Children, filename)
+}
+
+// AddDerived links a file to another one derived from it.
+func (m *Metadata) AddDerived(key string, filename string) {
+	if m.Derived == nil {
+		m.Derived = map[string]string{}
+	}
+	m.Derived[key] = filename
+}
+
+// RemoveDerivedFrom unlinks a derived file from its (deleted) source.
+func (m *Metadata) RemoveDerivedFrom(source string) {
+	sources := m.DerivedFrom[:0]
+	for _, existing := range m.DerivedFrom {
+		if existing != source {
+			sources = append(sources, existing)
+		}
+	}
+	m.DerivedFrom = sources
+}
+
+func appendUnique(list []string, item string) []string {
+	for _, existing := range list {
+		if existing == item {
+			return list
+		}
+	}
+	return append(list, item)
+}
+
+type MetadataStore interface {
+	Get(filename string) (*Metadata, error)
+	Update(filename string, fn func(metadata *Metadata) error) error
+	Delete(filename string) error
+	List() ([]*Metadata, error)
+}
+
+// HasTags tells whether every given tag is present.
+func (m *Metadata) HasTags(tags ...string) bool {
+	for _, tag := range tags {
+		found := false
+		for _, existing := range m.Tags {
+			if existing == tag {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+var ErrNotArchive = errors.New("file is not an archive")
+
+// Archives lists members of stored zip, tar and gzip files and explodes them,
+// i.e. stores every member as a file of its own.
+type Archives interface {
+	Entries(filename string) ([]*ArchiveEntry, error)
+	Explode(filename string) (*Explosion, error)
+}
+
+const (
+	ArchiveEntryFile      = "file"
+	ArchiveEntryDirectory = "directory"
+	ArchiveEntryLink      = "link"
+	ArchiveEntryOther     = "other"
+)
+
+// ArchiveEntry describes an archive member as the archive itself states it.
+// Unsafe entries are the ones whose names would escape extraction directory.
+type ArchiveEntry struct {
+	Name           string `json:"name"`
+	Type           string `json:"type"`
+	Size           int64  `json:"size"`
+	CompressedSize int64  `json:"compressed_size,omitempty"`
+	CRC32          string `json:"crc32,omitempty"`
+	Encrypted      bool   `json:"encrypted"`
+	Unsafe         bool   `json:"unsafe,omitempty"`
+}
+
+// ArchiveLimitError is returned once an archive turns out to be a bomb.
+type ArchiveLimitError struct {
+	Limit string
+}
+
+func (e *ArchiveLimitError) Error() string {
+	return fmt.Sprintf("archive exceeds %s limit", e.Limit)
+}
+
+// Explosion tells what came out of an archive, nested archives included.
+type Explosion struct {
+	Filename string            `json:"hashstring"`
+	Members  []*ExplodedMember `json:"members"`
+}
+
+// ExplodedMember is set Filename once stored. Skipped tells why it was not
+// stored or, for a stored nested archive, why it was not exploded in turn.
+type ExplodedMember struct {
+	Parent   string `json:"parent"`
+	Name     string `json:"name"`
+	Filename string `json:"hashstring,omitempty"`
+	Skipped  string `json:"skipped,omitempty"`
+}
+
+var ErrNotIndexed = errors.New("file has no similarity digest")
+
+type SimilarityIndex interface {
+	Similar(filename string, threshold int, limit int) ([]*SimilarFile, error)
+}
+
+type SimilarFile struct {
+	Filename string `json:"hashstring"`
+	Ssdeep   string `json:"ssdeep"`
+	Score    int    `json:"score"`
+}
+
+var ErrNotImage = errors.New("file is not a JPEG, PNG or GIF image")
+
+const (
+	ThumbnailContain = "contain"
+	ThumbnailCover   = "cover"
+	ThumbnailFill    = "fill"
+)
+
+// ThumbnailSpec bounds a thumbnail by Width and Height. Images are never
+// upscaled: contain fits the whole image within bounds, cover crops it
+// to fill bounds, fill stretches it to bounds.
+type ThumbnailSpec struct {
+	Width  int
+	Height int
+	Fit    string
+}
+
+func (s *ThumbnailSpec) Key() string {
+	return fmt.Sprintf("thumbnail:%dx%d:%s", s.Width, s.Height, s.Fit)
+}
+
+// Thumbnails renders thumbnails of stored images, caching them as derived files.
+type Thumbnails interface {
+	Thumbnail(filename string, spec *ThumbnailSpec) (*File, error)
+}
+
+// ImageLimitError is returned once an image turns out to be a decompression bomb.
+type ImageLimitError struct {
+	Width  int
+	Height int
+}
+
+func (e *ImageLimitError) Error() string {
+	return fmt.Sprintf("image of %dx%d pixels exceeds size limit", e.Width, e.Height)
+}
+
+var ErrEmptyQuery = errors.New("query has no words to search for")
+
+// FullTextIndex searches texts extracted out of stored files.
+type FullTextIndex interface {
+	Search(query string, limit int) ([]*SearchHit, error)
+}
+
+// SearchHit snippets are HTML, with matching words wrapped in <mark>.
+type SearchHit struct {
+	Filename string   `json:"hashstring"`
+	Score    float64  `json:"score"`
+	Snippets []string `json:"snippets"`
+}
+
+var ErrEvaluationRunning = errors.New("rules evaluation is already running")
+
+type RuleEvaluator interface {
+	Start(actor string) error
+	Status() *RuleEvaluationReport
+}
+
+type RuleEvaluationReport struct {
+	Actor      string         `json:"actor"`
+	Running    bool           `json:"running"`
+	StartedAt  time.Time      `json:"started_at"`
+	FinishedAt time.Time      `json:"finished_at"`
+	Rules      int            `json:"rules"`
+	Evaluated  int            `json:"evaluated"`
+	Failed     int            `json:"failed"`
+	Matches    map[string]int `json:"matches"`
+}
+
+const (
+	HashListAllow = "allow"
+	HashListBlock = "block"
+)
+
+type HashLists interface {
+	Match(filename string) []*HashListMatch
+	Stats() []*HashListStats
+}
+
+type HashListMatch struct {
+	List   string
+	Kind   string
+	Reject bool
+}
+
+type HashListStats struct {
+	List     string    `json:"list"`
+	Kind     string    `json:"kind"`
+	Path     string    `json:"path"`
+	Entries  int       `json:"entries"`
+	Hits     uint64    `json:"hits"`
+	LoadedAt time.Time `json:"loaded_at"`
+}
+
+type Scanner interface {
+	Scan(input io.Reader) (*ScanResult, error)
+	Version() (string, error)
+}
+
+type ScanResult struct {
+	Infected bool
+	Threat   string
+}
+
+var ErrRescanRunning = errors.New("rescan is already running")
+
+type Rescanner interface {
+	Start(actor string) error
+	Status() *RescanReport
+}
+
+type RescanReport struct {
+	SignatureVersion string             `json:"signature_version"`
+	Actor            string             `json:"actor"`
+	Running          bool               `json:"running"`
+	StartedAt        time.Time          `json:"started_at"`
+	FinishedAt       time.Time          `json:"finished_at"`
+	Scanned          int                `json:"scanned"`
+	Failed           int                `json:"failed"`
+	Detections       []*RescanDetection `json:"detections"`
+	Error            string             `json:"error,omitempty"`
+}
+
+type RescanDetection struct {
+	Filename string `json:"hashstring"`
+	Threat   string `json:"threat"`
+}
+
+type Quarantine interface {
+	Isolate(filename string, category string, actor string, reason string) error
+	Inspect(filename string) (*QuarantineRecord, error)
+	Load(filename string) (*File, error)
+	List() ([]*QuarantineRecord, error)
+	Release(filename string, actor string, reason string) error
+	Purge(filename string, actor string, reason string) error
+}
+
+const (
+	QuarantineInfected  = "infected"
+	QuarantineCorrupted = "corrupted"
+	QuarantinePolicy    = "policy"
+)
+
+const (
+	QuarantineActionIsolate = "isolate"
+	QuarantineActionRelease = "release"
+	QuarantineActionPurge   = "purge"
+)
+
+type QuarantineRecord struct {
+	Filename    string                  `json:"hashstring"`
+	Category    string                  `json:"category"`
+	Reason      string                  `json:"reason"`
+	Size        int64                   `json:"size"`
+	CreatedAt   time.Time               `json:"created_at"`
+	Transitions []*QuarantineTransition `json:"transitions"`
+}
+
+type QuarantineTransition struct {
+	Filename string    `json:"hashstring"`
+	Action   string    `json:"action"`
+	Actor    string    `json:"actor"`
+	Reason   string    `json:"reason"`
+	At       time.Time `json:"at"`
+}
+
+const (
+	CachePolicyLRU = "lru"
+	CachePolicyLFU = "lfu"
+)
+
+type Cache interface {
+	Pin(filename string) error
+	Unpin(filename string) error
+	Stats() *CacheStats
+}
+
+type CacheStats struct {
+	Policy       string `json:"policy"`
+	MaxSize      int64  `json:"max_size"`
+	Size         int64  `json:"size"`
+	Files        int    `json:"files"`
+	Pinned       int    `json:"pinned"`
+	Hits         uint64 `json:"hits"`
+	Misses       uint64 `json:"misses"`
+	Evictions    uint64 `json:"evictions"`
+	EvictedBytes uint64 `json:"evicted_bytes"`
+}
@@ -0,0 +1,49 @@
+package drweb
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+// NOTE: file might have been stored before its hash got into a block list,
+// which is why downloads are checked as well as uploads.
+func WithHashListCheck(handler func(http.ResponseWriter, *http.Request), lists HashLists) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		for _, match := range lists.Match(mux.Vars(r)["hashstring"]) {
+			if match.Kind != HashListBlock {
+				continue
+			}
+
+			if wrapped, ok := forceWrapping(r, func(policy *WrapPolicy) bool { return policy.Flagged }); ok {
+				handler(w, wrapped)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			err := json.NewEncoder(w).Encode(map[string]string{
+				"error": fmt.Sprintf("file is blocked by hash list '%s'", match.List),
+				"list":  match.List,
+			})
+			if err != nil {
+				log.WithError(err).Error("failed to write JSON encoding to the stream")
+			}
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+func HashListStatsHandler(lists HashLists) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(lists.Stats()); err != nil {
+			log.WithError(err).Error("failed to write JSON encoding to the stream")
+		}
+	}
+}
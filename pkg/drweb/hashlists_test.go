@@ -0,0 +1,85 @@
+package drweb_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+	"github.com/twonegatives/drweb_challenge/pkg/mocks"
+)
+
+type hashListCheckCase struct {
+	Matches    []*drweb.HashListMatch
+	ServerCode int
+	List       string
+}
+
+func TestWithHashListCheck(t *testing.T) {
+	var objects = map[string]hashListCheckCase{
+		"unknown file": {
+			Matches:    []*drweb.HashListMatch{},
+			ServerCode: http.StatusOK,
+		},
+		"allow listed": {
+			Matches:    []*drweb.HashListMatch{{List: "nsrl", Kind: drweb.HashListAllow}},
+			ServerCode: http.StatusOK,
+		},
+		"block listed": {
+			Matches:    []*drweb.HashListMatch{{List: "nsrl", Kind: drweb.HashListAllow}, {List: "internal", Kind: drweb.HashListBlock, Reject: true}},
+			ServerCode: http.StatusForbidden,
+			List:       "internal",
+		},
+		"flagged": {
+			Matches:    []*drweb.HashListMatch{{List: "suspicious", Kind: drweb.HashListBlock}},
+			ServerCode: http.StatusForbidden,
+			List:       "suspicious",
+		},
+	}
+
+	for testName, testObject := range objects {
+		t.Run(testName, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			lists := mocks.NewMockHashLists(mockCtrl)
+			lists.EXPECT().Match("hash").Return(testObject.Matches)
+
+			req, err := http.NewRequest("GET", "/files/hash", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			router := mux.NewRouter()
+			handler := func(http.ResponseWriter, *http.Request) {}
+			router.HandleFunc("/files/{hashstring}", drweb.WithHashListCheck(handler, lists))
+			router.ServeHTTP(rr, req)
+
+			var response map[string]string
+			json.Unmarshal(rr.Body.Bytes(), &response)
+
+			assert.Equal(t, testObject.ServerCode, rr.Code)
+			assert.Equal(t, testObject.List, response["list"])
+		})
+	}
+}
+
+func TestHashListStatsHandler(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	lists := mocks.NewMockHashLists(mockCtrl)
+	lists.EXPECT().Stats().Return([]*drweb.HashListStats{{List: "internal", Kind: drweb.HashListBlock, Entries: 3, Hits: 7}})
+
+	rr := httptest.NewRecorder()
+	drweb.HashListStatsHandler(lists)(rr, &http.Request{})
+
+	var response []map[string]interface{}
+	json.Unmarshal(rr.Body.Bytes(), &response)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, float64(7), response[0]["hits"])
+}
@@ -0,0 +1,193 @@
+package drweb
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+type quarantineRequest struct {
+	Category string `json:"category"`
+	Reason   string `json:"reason"`
+}
+
+// NOTE: policy violations are a matter of law or terms of use,
+// everything else (infected, corrupted) is just forbidden to serve.
+func quarantineStatus(category string) int {
+	if category == QuarantinePolicy {
+		return http.StatusUnavailableForLegalReasons
+	}
+	return http.StatusForbidden
+}
+
+func parseQuarantineRequest(w http.ResponseWriter, r *http.Request) (*quarantineRequest, bool) {
+	var request quarantineRequest
+
+	if r.Body != nil {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeJSONError(w, errors.Wrap(err, "failed to parse request body"), http.StatusBadRequest)
+			return nil, false
+		}
+	}
+
+	if request.Reason == "" {
+		writeJSONError(w, errors.New("reason is required"), http.StatusBadRequest)
+		return nil, false
+	}
+
+	return &request, true
+}
+
+func writeQuarantineError(w http.ResponseWriter, err error) {
+	if os.IsNotExist(errors.Cause(err)) {
+		writeJSONError(w, err, http.StatusNotFound)
+		return
+	}
+
+	log.WithError(err).Error("quarantine transition failed")
+	writeJSONError(w, err, http.StatusInternalServerError)
+}
+
+func WithQuarantineCheck(handler func(http.ResponseWriter, *http.Request), quarantine Quarantine) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		record, err := quarantine.Inspect(mux.Vars(r)["hashstring"])
+		if err != nil {
+			if os.IsNotExist(errors.Cause(err)) {
+				handler(w, r)
+				return
+			}
+
+			log.WithError(err).Error("failed to check quarantine")
+			w.Header().Set("Content-Type", "application/json")
+			writeJSONError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		// NOTE: files quarantined for legal reasons are not served anyhow
+		forced := func(policy *WrapPolicy) bool { return policy.Quarantined && record.Category != QuarantinePolicy }
+		if wrapped, ok := forceWrapping(r, forced); ok {
+			serveQuarantined(w, wrapped, quarantine)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(quarantineStatus(record.Category))
+		err = json.NewEncoder(w).Encode(map[string]string{
+			"error":    fmt.Sprintf("file is quarantined as %s", record.Category),
+			"category": record.Category,
+			"reason":   record.Reason,
+		})
+		if err != nil {
+			log.WithError(err).Error("failed to write JSON encoding to the stream")
+		}
+	}
+}
+
+func serveQuarantined(w http.ResponseWriter, r *http.Request, quarantine Quarantine) {
+	filename := mux.Vars(r)["hashstring"]
+
+	file, err := quarantine.Load(filename)
+	if err != nil {
+		log.WithError(err).Error("failed to load quarantined file")
+		w.Header().Set("Content-Type", "application/json")
+		writeJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	defer file.Close()
+	serveFile(w, r, filename, file)
+}
+
+func ListQuarantineHandler(quarantine Quarantine) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		records, err := quarantine.List()
+		if err != nil {
+			log.WithError(err).Error("failed to list quarantine")
+			writeJSONError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		if err = json.NewEncoder(w).Encode(records); err != nil {
+			log.WithError(err).Error("failed to write JSON encoding to the stream")
+		}
+	}
+}
+
+func InspectQuarantineHandler(quarantine Quarantine) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		record, err := quarantine.Inspect(mux.Vars(r)["hashstring"])
+		if err != nil {
+			writeQuarantineError(w, err)
+			return
+		}
+
+		if err = json.NewEncoder(w).Encode(record); err != nil {
+			log.WithError(err).Error("failed to write JSON encoding to the stream")
+		}
+	}
+}
+
+func IsolateFileHandler(quarantine Quarantine) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		request, ok := parseQuarantineRequest(w, r)
+		if !ok {
+			return
+		}
+
+		switch request.Category {
+		case QuarantineInfected, QuarantineCorrupted, QuarantinePolicy:
+		default:
+			writeJSONError(w, fmt.Errorf("unknown quarantine category '%s'", request.Category), http.StatusBadRequest)
+			return
+		}
+
+		err := quarantine.Isolate(mux.Vars(r)["hashstring"], request.Category, AdminActor(r), request.Reason)
+		if err != nil {
+			writeQuarantineError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+func ReleaseFileHandler(quarantine Quarantine) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		request, ok := parseQuarantineRequest(w, r)
+		if !ok {
+			return
+		}
+
+		if err := quarantine.Release(mux.Vars(r)["hashstring"], AdminActor(r), request.Reason); err != nil {
+			writeQuarantineError(w, err)
+		}
+	}
+}
+
+func PurgeFileHandler(quarantine Quarantine) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		request, ok := parseQuarantineRequest(w, r)
+		if !ok {
+			return
+		}
+
+		if err := quarantine.Purge(mux.Vars(r)["hashstring"], AdminActor(r), request.Reason); err != nil {
+			writeQuarantineError(w, err)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package drweb_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+	"github.com/twonegatives/drweb_challenge/pkg/mocks"
+)
+
+type quarantineCheckCase struct {
+	Record     *drweb.QuarantineRecord
+	Error      error
+	ServerCode int
+	Reason     string
+}
+
+func TestWithQuarantineCheck(t *testing.T) {
+	var objects = map[string]quarantineCheckCase{
+		"not quarantined": {
+			Error:      errors.Wrap(os.ErrNotExist, "failed to read quarantine record"),
+			ServerCode: http.StatusOK,
+		},
+		"infected": {
+			Record:     &drweb.QuarantineRecord{Category: drweb.QuarantineInfected, Reason: "EICAR-Test-File"},
+			ServerCode: http.StatusForbidden,
+			Reason:     "EICAR-Test-File",
+		},
+		"policy violation": {
+			Record:     &drweb.QuarantineRecord{Category: drweb.QuarantinePolicy, Reason: "takedown notice"},
+			ServerCode: http.StatusUnavailableForLegalReasons,
+			Reason:     "takedown notice",
+		},
+		"broken quarantine": {
+			Error:      errors.New("disk failure"),
+			ServerCode: http.StatusInternalServerError,
+		},
+	}
+
+	for testName, testObject := range objects {
+		t.Run(testName, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			quarantine := mocks.NewMockQuarantine(mockCtrl)
+			quarantine.EXPECT().Inspect("hash").Return(testObject.Record, testObject.Error)
+
+			req, err := http.NewRequest("GET", "/files/hash", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			router := mux.NewRouter()
+			handler := func(http.ResponseWriter, *http.Request) {}
+			router.HandleFunc("/files/{hashstring}", drweb.WithQuarantineCheck(handler, quarantine))
+			router.ServeHTTP(rr, req)
+
+			var response map[string]string
+			json.Unmarshal(rr.Body.Bytes(), &response)
+
+			assert.Equal(t, testObject.ServerCode, rr.Code)
+			assert.Equal(t, testObject.Reason, response["reason"])
+		})
+	}
+}
+
+func TestWithAdminAuth(t *testing.T) {
+	var objects = map[string]struct {
+		Token      string
+		Header     string
+		Actor      string
+		ServerCode int
+	}{
+		"disabled":      {Token: "", Header: "Bearer ", Actor: "alice", ServerCode: http.StatusUnauthorized},
+		"wrong token":   {Token: "secret", Header: "Bearer guess", Actor: "alice", ServerCode: http.StatusUnauthorized},
+		"missing actor": {Token: "secret", Header: "Bearer secret", ServerCode: http.StatusBadRequest},
+		"authorized":    {Token: "secret", Header: "Bearer secret", Actor: "alice", ServerCode: http.StatusOK},
+	}
+
+	for testName, testObject := range objects {
+		t.Run(testName, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/admin", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", testObject.Header)
+			req.Header.Set("X-Actor", testObject.Actor)
+
+			rr := httptest.NewRecorder()
+			handler := func(http.ResponseWriter, *http.Request) {}
+			drweb.WithAdminAuth(handler, testObject.Token)(rr, req)
+
+			assert.Equal(t, testObject.ServerCode, rr.Code)
+		})
+	}
+}
+
+func TestIsolateFileHandler(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+		quarantine := mocks.NewMockQuarantine(mockCtrl)
+		quarantine.EXPECT().Isolate("hash", drweb.QuarantineCorrupted, "alice", "truncated").Return(nil)
+
+		body := bytes.NewBufferString(`{"category": "corrupted", "reason": "truncated"}`)
+		req, err := http.NewRequest("POST", "/admin/quarantine/hash", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("X-Actor", "alice")
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+		router.HandleFunc("/admin/quarantine/{hashstring}", drweb.IsolateFileHandler(quarantine))
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusCreated, rr.Code)
+	})
+
+	t.Run("unknown category", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+		quarantine := mocks.NewMockQuarantine(mockCtrl)
+
+		body := bytes.NewBufferString(`{"category": "boring", "reason": "meh"}`)
+		req, err := http.NewRequest("POST", "/admin/quarantine/hash", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+		router.HandleFunc("/admin/quarantine/{hashstring}", drweb.IsolateFileHandler(quarantine))
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+		quarantine := mocks.NewMockQuarantine(mockCtrl)
+		quarantine.EXPECT().Isolate("hash", drweb.QuarantineInfected, "", "virus").Return(errors.Wrap(os.ErrNotExist, "failed to get file info"))
+
+		body := bytes.NewBufferString(`{"category": "infected", "reason": "virus"}`)
+		req, err := http.NewRequest("POST", "/admin/quarantine/hash", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+		router.HandleFunc("/admin/quarantine/{hashstring}", drweb.IsolateFileHandler(quarantine))
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}
+
+func TestReleaseFileHandler(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	quarantine := mocks.NewMockQuarantine(mockCtrl)
+	quarantine.EXPECT().Release("hash", "alice", "false positive").Return(nil)
+
+	body := bytes.NewBufferString(`{"reason": "false positive"}`)
+	req, err := http.NewRequest("POST", "/admin/quarantine/hash/release", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Actor", "alice")
+
+	rr := httptest.NewRecorder()
+	router := mux.NewRouter()
+	router.HandleFunc("/admin/quarantine/{hashstring}/release", drweb.ReleaseFileHandler(quarantine))
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
@@ -0,0 +1,47 @@
+package drweb
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func StartRescanHandler(rescanner Rescanner) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if err := rescanner.Start(AdminActor(r)); err != nil {
+			if err == ErrRescanRunning {
+				writeJSONError(w, err, http.StatusConflict)
+				return
+			}
+
+			log.WithError(err).Error("failed to start rescan")
+			writeJSONError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+		if err := json.NewEncoder(w).Encode(rescanner.Status()); err != nil {
+			log.WithError(err).Error("failed to write JSON encoding to the stream")
+		}
+	}
+}
+
+func RescanStatusHandler(rescanner Rescanner) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		report := rescanner.Status()
+		if report == nil {
+			writeJSONError(w, errors.New("rescan was never run"), http.StatusNotFound)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(report); err != nil {
+			log.WithError(err).Error("failed to write JSON encoding to the stream")
+		}
+	}
+}
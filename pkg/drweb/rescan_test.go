@@ -0,0 +1,77 @@
+package drweb_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+	"github.com/twonegatives/drweb_challenge/pkg/mocks"
+)
+
+type startRescanCase struct {
+	Error      error
+	ServerCode int
+}
+
+func TestStartRescanHandler(t *testing.T) {
+	var objects = map[string]startRescanCase{
+		"started":         {Error: nil, ServerCode: http.StatusAccepted},
+		"already running": {Error: drweb.ErrRescanRunning, ServerCode: http.StatusConflict},
+		"scanner failure": {Error: errors.New("scanner is gone"), ServerCode: http.StatusInternalServerError},
+	}
+
+	for testName, testObject := range objects {
+		t.Run(testName, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			rescanner := mocks.NewMockRescanner(mockCtrl)
+			rescanner.EXPECT().Start("alice").Return(testObject.Error)
+			rescanner.EXPECT().Status().Return(&drweb.RescanReport{Running: true}).AnyTimes()
+
+			req, err := http.NewRequest("POST", "/admin/rescan", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("X-Actor", "alice")
+
+			rr := httptest.NewRecorder()
+			drweb.StartRescanHandler(rescanner)(rr, req)
+
+			assert.Equal(t, testObject.ServerCode, rr.Code)
+		})
+	}
+}
+
+func TestRescanStatusHandler(t *testing.T) {
+	t.Run("never run", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+		rescanner := mocks.NewMockRescanner(mockCtrl)
+		rescanner.EXPECT().Status().Return(nil)
+
+		rr := httptest.NewRecorder()
+		drweb.RescanStatusHandler(rescanner)(rr, &http.Request{})
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("finished", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+		rescanner := mocks.NewMockRescanner(mockCtrl)
+		rescanner.EXPECT().Status().Return(&drweb.RescanReport{
+			SignatureVersion: "v2",
+			Detections:       []*drweb.RescanDetection{{Filename: "hash", Threat: "EICAR"}},
+		})
+
+		rr := httptest.NewRecorder()
+		drweb.RescanStatusHandler(rescanner)(rr, &http.Request{})
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), `"threat":"EICAR"`)
+	})
+}
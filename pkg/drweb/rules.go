@@ -0,0 +1,106 @@
+package drweb
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// ListFilesHandler lists metadata of stored files,
+// every tag given as ?tag= query parameter has to be present.
+// Entropy filters are described at entropyFilter.
+func ListFilesHandler(metadata MetadataStore) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		filter, err := parseEntropyFilter(r)
+		if err != nil {
+			writeJSONError(w, err, http.StatusBadRequest)
+			return
+		}
+
+		list, err := metadata.List()
+		if err != nil {
+			log.WithError(err).Error("failed to list files")
+			writeJSONError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		tags := r.URL.Query()["tag"]
+		found := []*Metadata{}
+		for _, item := range list {
+			if item.HasTags(tags...) && filter.match(item) {
+				found = append(found, item)
+			}
+		}
+
+		if err = json.NewEncoder(w).Encode(found); err != nil {
+			log.WithError(err).Error("failed to write JSON encoding to the stream")
+		}
+	}
+}
+
+// FileMetadataHandler shows metadata of a stored file, e.g. its tags and tier.
+func FileMetadataHandler(metadata MetadataStore) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		filename := mux.Vars(r)["hashstring"]
+
+		meta, err := metadata.Get(filename)
+		if os.IsNotExist(errors.Cause(err)) {
+			writeJSONError(w, errors.New("file has no metadata"), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.WithError(err).Error("failed to get file metadata")
+			writeJSONError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		if err = json.NewEncoder(w).Encode(meta); err != nil {
+			log.WithError(err).Error("failed to write JSON encoding to the stream")
+		}
+	}
+}
+
+func StartRuleEvaluationHandler(evaluator RuleEvaluator) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if err := evaluator.Start(AdminActor(r)); err != nil {
+			if err == ErrEvaluationRunning {
+				writeJSONError(w, err, http.StatusConflict)
+				return
+			}
+
+			log.WithError(err).Error("failed to start rules evaluation")
+			writeJSONError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+		if err := json.NewEncoder(w).Encode(evaluator.Status()); err != nil {
+			log.WithError(err).Error("failed to write JSON encoding to the stream")
+		}
+	}
+}
+
+func RuleEvaluationStatusHandler(evaluator RuleEvaluator) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		report := evaluator.Status()
+		if report == nil {
+			writeJSONError(w, errors.New("rules evaluation was never run"), http.StatusNotFound)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(report); err != nil {
+			log.WithError(err).Error("failed to write JSON encoding to the stream")
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package drweb_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+	"github.com/twonegatives/drweb_challenge/pkg/mocks"
+)
+
+func TestListFilesHandler(t *testing.T) {
+	list := []*drweb.Metadata{
+		{Filename: "aaaa", Tags: []string{"rule:mz", "rule:evil"}, Entropy: &drweb.Entropy{Overall: 7.4, Packers: []string{"upx"}, Payload: drweb.PayloadCompressed}},
+		{Filename: "bbbb", Tags: []string{"rule:mz"}, Entropy: &drweb.Entropy{Overall: 5.1}},
+		{Filename: "cccc"},
+	}
+
+	var objects = map[string]struct {
+		Query     string
+		Filenames []string
+	}{
+		"no filter":   {Query: "", Filenames: []string{"aaaa", "bbbb", "cccc"}},
+		"single tag":  {Query: "?tag=rule:mz", Filenames: []string{"aaaa", "bbbb"}},
+		"every tag":   {Query: "?tag=rule:mz&tag=rule:evil", Filenames: []string{"aaaa"}},
+		"no match":    {Query: "?tag=rule:elf", Filenames: []string{}},
+		"min entropy": {Query: "?min_entropy=7", Filenames: []string{"aaaa"}},
+		"max entropy": {Query: "?max_entropy=7", Filenames: []string{"bbbb"}},
+		"packer":      {Query: "?packer=upx", Filenames: []string{"aaaa"}},
+		"payload":     {Query: "?payload=encrypted&tag=rule:mz", Filenames: []string{}},
+	}
+
+	for testName, testObject := range objects {
+		t.Run(testName, func(t *testing.T) {
+			var found []*drweb.Metadata
+
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			metadata := mocks.NewMockMetadataStore(mockCtrl)
+			metadata.EXPECT().List().Return(list, nil)
+
+			req, err := http.NewRequest("GET", "/files"+testObject.Query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			drweb.ListFilesHandler(metadata)(rr, req)
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Nil(t, json.NewDecoder(rr.Body).Decode(&found))
+
+			filenames := []string{}
+			for _, item := range found {
+				filenames = append(filenames, item.Filename)
+			}
+			assert.Equal(t, testObject.Filenames, filenames)
+		})
+	}
+
+	t.Run("malformed filter", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/files?min_entropy=9", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		drweb.ListFilesHandler(nil)(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("store failure", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+		metadata := mocks.NewMockMetadataStore(mockCtrl)
+		metadata.EXPECT().List().Return(nil, errors.New("disk is gone"))
+
+		req, err := http.NewRequest("GET", "/files", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		drweb.ListFilesHandler(metadata)(rr, req)
+
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	})
+}
+
+func TestFileMetadataHandler(t *testing.T) {
+	accessed := time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	var objects = map[string]struct {
+		Metadata   *drweb.Metadata
+		Error      error
+		ServerCode int
+		Tier       string
+	}{
+		"found":       {Metadata: &drweb.Metadata{Filename: "abcdef", Tier: "cold", AccessedAt: &accessed}, ServerCode: http.StatusOK, Tier: "cold"},
+		"not tiered":  {Metadata: &drweb.Metadata{Filename: "abcdef"}, ServerCode: http.StatusOK},
+		"not found":   {Error: os.ErrNotExist, ServerCode: http.StatusNotFound},
+		"store error": {Error: errors.New("disk is gone"), ServerCode: http.StatusInternalServerError},
+	}
+
+	for testName, testObject := range objects {
+		t.Run(testName, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			metadata := mocks.NewMockMetadataStore(mockCtrl)
+			metadata.EXPECT().Get("abcdef").Return(testObject.Metadata, testObject.Error)
+
+			req, err := http.NewRequest("GET", "/files/abcdef/meta", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			router := mux.NewRouter()
+			router.HandleFunc("/files/{hashstring}/meta", drweb.FileMetadataHandler(metadata))
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, testObject.ServerCode, rr.Code)
+			if rr.Code == http.StatusOK {
+				var found drweb.Metadata
+				assert.Nil(t, json.NewDecoder(rr.Body).Decode(&found))
+				assert.Equal(t, "abcdef", found.Filename)
+				assert.Equal(t, testObject.Tier, found.Tier)
+				assert.Equal(t, testObject.Metadata.AccessedAt, found.AccessedAt)
+			}
+		})
+	}
+}
+
+func TestStartRuleEvaluationHandler(t *testing.T) {
+	var objects = map[string]struct {
+		Error      error
+		ServerCode int
+	}{
+		"started":         {Error: nil, ServerCode: http.StatusAccepted},
+		"already running": {Error: drweb.ErrEvaluationRunning, ServerCode: http.StatusConflict},
+		"broken rules":    {Error: errors.New("failed to parse default.yar"), ServerCode: http.StatusInternalServerError},
+	}
+
+	for testName, testObject := range objects {
+		t.Run(testName, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			evaluator := mocks.NewMockRuleEvaluator(mockCtrl)
+			evaluator.EXPECT().Start("alice").Return(testObject.Error)
+			evaluator.EXPECT().Status().Return(&drweb.RuleEvaluationReport{Running: true}).AnyTimes()
+
+			req, err := http.NewRequest("POST", "/admin/rules/evaluate", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("X-Actor", "alice")
+
+			rr := httptest.NewRecorder()
+			drweb.StartRuleEvaluationHandler(evaluator)(rr, req)
+
+			assert.Equal(t, testObject.ServerCode, rr.Code)
+		})
+	}
+}
+
+func TestRuleEvaluationStatusHandler(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	evaluator := mocks.NewMockRuleEvaluator(mockCtrl)
+	evaluator.EXPECT().Status().Return(nil)
+
+	rr := httptest.NewRecorder()
+	drweb.RuleEvaluationStatusHandler(evaluator)(rr, &http.Request{})
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
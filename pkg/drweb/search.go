@@ -0,0 +1,43 @@
+package drweb
+
+import (
+	"encoding/json"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// SearchHandler finds stored files containing every word of ?q=,
+// the best matching first.
+func SearchHandler(index FullTextIndex) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		limit, err := queryInt(r, "limit", defaultSearchLimit, 1, maxSearchLimit)
+		if err != nil {
+			writeJSONError(w, err, http.StatusBadRequest)
+			return
+		}
+
+		hits, err := index.Search(r.URL.Query().Get("q"), limit)
+		if err != nil {
+			if err == ErrEmptyQuery {
+				writeJSONError(w, err, http.StatusBadRequest)
+				return
+			}
+
+			log.WithError(err).Error("failed to search files")
+			writeJSONError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		if err = json.NewEncoder(w).Encode(hits); err != nil {
+			log.WithError(err).Error("failed to write JSON encoding to the stream")
+		}
+	}
+}
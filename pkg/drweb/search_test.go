@@ -0,0 +1,50 @@
+package drweb_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+	"github.com/twonegatives/drweb_challenge/pkg/mocks"
+)
+
+func TestSearchHandler(t *testing.T) {
+	var objects = map[string]struct {
+		Query      string
+		Words      string
+		Limit      int
+		Error      error
+		ServerCode int
+	}{
+		"defaults":      {Query: "?q=powershell", Words: "powershell", Limit: 20, ServerCode: http.StatusOK},
+		"given limit":   {Query: "?q=invoke+webrequest&limit=5", Words: "invoke webrequest", Limit: 5, ServerCode: http.StatusOK},
+		"no words":      {Query: "?q=++", Words: "  ", Limit: 20, Error: drweb.ErrEmptyQuery, ServerCode: http.StatusBadRequest},
+		"index failure": {Query: "?q=powershell", Words: "powershell", Limit: 20, Error: errors.New("index is gone"), ServerCode: http.StatusInternalServerError},
+		"limit too big": {Query: "?q=powershell&limit=1000", ServerCode: http.StatusBadRequest},
+	}
+
+	for testName, testObject := range objects {
+		t.Run(testName, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			index := mocks.NewMockFullTextIndex(mockCtrl)
+			if testObject.Limit > 0 {
+				index.EXPECT().Search(testObject.Words, testObject.Limit).Return([]*drweb.SearchHit{}, testObject.Error)
+			}
+
+			req, err := http.NewRequest("GET", "/search"+testObject.Query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			drweb.SearchHandler(index)(rr, req)
+
+			assert.Equal(t, testObject.ServerCode, rr.Code)
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package drweb
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// NOTE: net/http has no name for it until go 1.11
+const statusMisdirectedRequest = 421
+
+// ServingPolicy keeps uploaded content (HTML, SVG and such) from running
+// script on our domain. Only content of InlineTypes is served as detected,
+// anything else is downloaded as application/octet-stream. Files are served
+// sandboxed either way, and only on DownloadHost if it is given.
+type ServingPolicy struct {
+	InlineTypes  []string
+	DownloadHost string
+}
+
+func (p *ServingPolicy) inline(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	for _, inline := range p.InlineTypes {
+		if strings.EqualFold(inline, mediaType) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *ServingPolicy) allowsHost(host string) bool {
+	if p.DownloadHost == "" || strings.EqualFold(host, p.DownloadHost) {
+		return true
+	}
+
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		return strings.EqualFold(hostname, p.DownloadHost)
+	}
+	return false
+}
+
+// contentHeaders gives content type and disposition to serve detected content with.
+func (p *ServingPolicy) contentHeaders(detected string) (string, string) {
+	if p.inline(detected) {
+		return detected, "inline"
+	}
+	return "application/octet-stream", "attachment"
+}
+
+type servingKey struct{}
+
+func servingPolicyOf(r *http.Request) *ServingPolicy {
+	policy, _ := r.Context().Value(servingKey{}).(*ServingPolicy)
+	return policy
+}
+
+func WithServingPolicy(handler func(http.ResponseWriter, *http.Request), policy *ServingPolicy) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Content-Security-Policy", "sandbox")
+
+		if !policy.allowsHost(r.Host) {
+			w.Header().Set("Content-Type", "application/json")
+			writeJSONError(w, fmt.Errorf("files are only served on %s", policy.DownloadHost), statusMisdirectedRequest)
+			return
+		}
+
+		handler(w, r.WithContext(context.WithValue(r.Context(), servingKey{}, policy)))
+	}
+}
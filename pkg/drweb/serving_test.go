@@ -0,0 +1,104 @@
+package drweb_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+	"github.com/twonegatives/drweb_challenge/pkg/mocks"
+)
+
+type servingCase struct {
+	Contents    string
+	Host        string
+	ServerCode  int
+	ContentType string
+	Disposition string
+}
+
+func TestWithServingPolicy(t *testing.T) {
+	policy := &drweb.ServingPolicy{
+		InlineTypes:  []string{"text/plain", "image/png"},
+		DownloadHost: "files.example.com",
+	}
+
+	var objects = map[string]servingCase{
+		"text": {
+			Contents:    "alice was beginning to get very tired",
+			ServerCode:  http.StatusOK,
+			ContentType: "text/plain; charset=utf-8",
+			Disposition: "inline; filename=abcdef",
+		},
+		"image": {
+			Contents:    "\x89PNG\x0d\x0a\x1a\x0a",
+			ServerCode:  http.StatusOK,
+			ContentType: "image/png",
+			Disposition: "inline; filename=abcdef",
+		},
+		"html": {
+			Contents:    "<html><script>alert(document.cookie)</script></html>",
+			ServerCode:  http.StatusOK,
+			ContentType: "application/octet-stream",
+			Disposition: "attachment; filename=abcdef",
+		},
+		"svg": {
+			Contents:    "<?xml version=\"1.0\"?><svg onload=\"alert(1)\"></svg>",
+			ServerCode:  http.StatusOK,
+			ContentType: "application/octet-stream",
+			Disposition: "attachment; filename=abcdef",
+		},
+		"download host with port": {
+			Contents:    "alice",
+			Host:        "files.example.com:8080",
+			ServerCode:  http.StatusOK,
+			ContentType: "text/plain; charset=utf-8",
+			Disposition: "inline; filename=abcdef",
+		},
+		"another host": {
+			Host:        "www.example.com",
+			ServerCode:  421,
+			ContentType: "application/json",
+		},
+	}
+
+	for testName, testObject := range objects {
+		t.Run(testName, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			storage := mocks.NewMockStorage(mockCtrl)
+
+			if testObject.ServerCode == http.StatusOK {
+				contents := []byte(testObject.Contents)
+				file := &drweb.File{Body: ioutil.NopCloser(bytes.NewReader(contents)), Size: int64(len(contents))}
+				storage.EXPECT().Load("abcdef").Return(file, nil)
+			}
+
+			req, err := http.NewRequest("GET", "/files/abcdef", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req.Host = "files.example.com"
+			if testObject.Host != "" {
+				req.Host = testObject.Host
+			}
+
+			rr := httptest.NewRecorder()
+			router := mux.NewRouter()
+			router.HandleFunc("/files/{hashstring}", drweb.WithServingPolicy(drweb.RetrieveFileHandler(storage), policy))
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, testObject.ServerCode, rr.Code)
+			assert.Equal(t, testObject.ContentType, rr.Header().Get("Content-Type"))
+			assert.Equal(t, testObject.Disposition, rr.Header().Get("Content-Disposition"))
+			assert.Equal(t, "nosniff", rr.Header().Get("X-Content-Type-Options"))
+			assert.Equal(t, "sandbox", rr.Header().Get("Content-Security-Policy"))
+		})
+	}
+}
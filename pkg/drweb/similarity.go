@@ -0,0 +1,80 @@
+package drweb
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultSimilarThreshold = 1
+	defaultSimilarLimit     = 10
+	maxSimilarLimit         = 100
+)
+
+func queryInt(r *http.Request, name string, fallback int, min int, max int) (int, error) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return fallback, nil
+	}
+
+	value, err := strconv.Atoi(raw)
+	if err != nil || value < min || value > max {
+		return 0, fmt.Errorf("%s should be an integer within %d..%d (given '%s')", name, min, max, raw)
+	}
+
+	return value, nil
+}
+
+func queryFloat(r *http.Request, name string, fallback float64, min float64, max float64) (float64, error) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return fallback, nil
+	}
+
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil || value < min || value > max {
+		return 0, fmt.Errorf("%s should be a number within %g..%g (given '%s')", name, min, max, raw)
+	}
+
+	return value, nil
+}
+
+// SimilarFilesHandler lists stored files alike the given one, scored 1..100.
+func SimilarFilesHandler(index SimilarityIndex) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		threshold, err := queryInt(r, "threshold", defaultSimilarThreshold, 0, 100)
+		if err != nil {
+			writeJSONError(w, err, http.StatusBadRequest)
+			return
+		}
+
+		limit, err := queryInt(r, "limit", defaultSimilarLimit, 1, maxSimilarLimit)
+		if err != nil {
+			writeJSONError(w, err, http.StatusBadRequest)
+			return
+		}
+
+		similar, err := index.Similar(mux.Vars(r)["hashstring"], threshold, limit)
+		if err != nil {
+			if err == ErrNotIndexed {
+				writeJSONError(w, err, http.StatusNotFound)
+				return
+			}
+
+			log.WithError(err).Error("failed to look up similar files")
+			writeJSONError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		if err = json.NewEncoder(w).Encode(similar); err != nil {
+			log.WithError(err).Error("failed to write JSON encoding to the stream")
+		}
+	}
+}
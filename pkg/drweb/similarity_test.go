@@ -0,0 +1,57 @@
+package drweb_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+	"github.com/twonegatives/drweb_challenge/pkg/mocks"
+)
+
+type similarFilesCase struct {
+	Query      string
+	Threshold  int
+	Limit      int
+	Error      error
+	ServerCode int
+}
+
+func TestSimilarFilesHandler(t *testing.T) {
+	var objects = map[string]similarFilesCase{
+		"defaults":          {Query: "", Threshold: 1, Limit: 10, ServerCode: http.StatusOK},
+		"given threshold":   {Query: "?threshold=80&limit=3", Threshold: 80, Limit: 3, ServerCode: http.StatusOK},
+		"not indexed":       {Query: "", Threshold: 1, Limit: 10, Error: drweb.ErrNotIndexed, ServerCode: http.StatusNotFound},
+		"index failure":     {Query: "", Threshold: 1, Limit: 10, Error: errors.New("index is gone"), ServerCode: http.StatusInternalServerError},
+		"malformed":         {Query: "?threshold=high", ServerCode: http.StatusBadRequest},
+		"threshold too big": {Query: "?threshold=101", ServerCode: http.StatusBadRequest},
+		"limit too big":     {Query: "?limit=1000", ServerCode: http.StatusBadRequest},
+	}
+
+	for testName, testObject := range objects {
+		t.Run(testName, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			index := mocks.NewMockSimilarityIndex(mockCtrl)
+			if testObject.ServerCode != http.StatusBadRequest {
+				index.EXPECT().Similar("abcdef", testObject.Threshold, testObject.Limit).Return([]*drweb.SimilarFile{}, testObject.Error)
+			}
+
+			req, err := http.NewRequest("GET", "/files/abcdef/similar"+testObject.Query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			router := mux.NewRouter()
+			router.HandleFunc("/files/{hashstring}/similar", drweb.SimilarFilesHandler(index))
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, testObject.ServerCode, rr.Code)
+		})
+	}
+}
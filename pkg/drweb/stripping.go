@@ -0,0 +1,116 @@
+package drweb
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+type strippingKey struct{}
+
+type stripping struct {
+	stripper  Stripper
+	originals Storage
+	requested bool
+}
+
+func strippingOf(r *http.Request) *stripping {
+	state, _ := r.Context().Value(strippingKey{}).(*stripping)
+	return state
+}
+
+// WithMetadataStripping lets uploads handled by CreateFileHandler have EXIF, XMP
+// and alike stripped before they are hashed and stored, either on ?strip_metadata=1
+// or by an upload policy. Originals are kept in originals storage unless it is nil.
+func WithMetadataStripping(handler func(http.ResponseWriter, *http.Request), stripper Stripper, originals Storage) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		state := &stripping{stripper: stripper, originals: originals}
+
+		if raw := r.URL.Query().Get("strip_metadata"); raw != "" {
+			requested, err := strconv.ParseBool(raw)
+			if err != nil {
+				w.Header().Set("Content-Type", "application/json")
+				writeJSONError(w, fmt.Errorf("strip_metadata should be a boolean (given '%s')", raw), http.StatusBadRequest)
+				return
+			}
+			state.requested = requested
+		}
+
+		handler(w, r.WithContext(context.WithValue(r.Context(), strippingKey{}, state)))
+	}
+}
+
+func (s *stripping) wanted(upload *upload) bool {
+	if s.requested || upload == nil {
+		return s.requested
+	}
+
+	for _, policy := range upload.policies {
+		if policy.StripMetadata {
+			return true
+		}
+	}
+	return false
+}
+
+// apply has the upload streamed through the stripper. NOTE: inspectors
+// see stripped contents, so the original's metadata is never recorded.
+func (s *stripping) apply(file *FileCreateRequest, original multipart.File) {
+	reader := s.stripper.NewReader(original)
+	file.Body = ioutil.NopCloser(reader)
+	file.Inspectors = append(file.Inspectors, &originalKeeper{
+		reader:        reader,
+		original:      original,
+		originals:     s.originals,
+		nameGenerator: file.NameGenerator,
+	})
+}
+
+// originalKeeper goes last, so that rejected uploads keep no originals.
+type originalKeeper struct {
+	reader        StrippingReader
+	original      multipart.File
+	originals     Storage
+	nameGenerator FileNameGenerator
+}
+
+func (k *originalKeeper) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (k *originalKeeper) Inspect(filename string, metadata *Metadata) error {
+	stripped := k.reader.Stripped()
+	if len(stripped) == 0 {
+		return nil
+	}
+
+	if metadata.Image == nil {
+		metadata.Image = &ImageMetadata{}
+	}
+	metadata.Image.Stripped = stripped
+
+	if k.originals == nil {
+		return nil
+	}
+
+	if _, err := k.original.Seek(0, io.SeekStart); err != nil {
+		return errors.Wrap(err, "failed to rewind original")
+	}
+
+	original, err := k.originals.Save(&FileCreateRequest{
+		Body:          ioutil.NopCloser(k.original),
+		NameGenerator: k.nameGenerator,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to keep original")
+	}
+
+	metadata.Original = original
+	return nil
+}
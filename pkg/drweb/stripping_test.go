@@ -0,0 +1,98 @@
+package drweb_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+	"github.com/twonegatives/drweb_challenge/pkg/imagemeta"
+	"github.com/twonegatives/drweb_challenge/pkg/namegenerators"
+	"github.com/twonegatives/drweb_challenge/pkg/storages"
+	"github.com/twonegatives/drweb_challenge/pkg/testutils"
+)
+
+func TestWithMetadataStripping(t *testing.T) {
+	storage := &storages.MemoryStorage{}
+	originals := &storages.MemoryStorage{}
+
+	// NOTE: gopher.jpg carries two IPTC segments
+	gopher, err := ioutil.ReadFile("../testdata/gopher.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := []byte("nothing to strip in here")
+
+	policies := drweb.UploadPolicies{
+		{Name: "gallery", Routes: []string{"/uploads/images"}, StripMetadata: true},
+	}
+
+	var objects = map[string]struct {
+		Route      string
+		Query      string
+		Contents   []byte
+		ServerCode int
+		Stripped   bool
+	}{
+		"not requested":    {Route: "/files", Contents: gopher, ServerCode: http.StatusCreated},
+		"requested":        {Route: "/files", Query: "?strip_metadata=1", Contents: gopher, ServerCode: http.StatusCreated, Stripped: true},
+		"declined":         {Route: "/files", Query: "?strip_metadata=false", Contents: gopher, ServerCode: http.StatusCreated},
+		"by policy":        {Route: "/uploads/images", Contents: gopher, ServerCode: http.StatusCreated, Stripped: true},
+		"nothing to strip": {Route: "/files", Query: "?strip_metadata=true", Contents: text, ServerCode: http.StatusCreated},
+		"invalid":          {Route: "/files", Query: "?strip_metadata=maybe", Contents: gopher, ServerCode: http.StatusBadRequest},
+	}
+
+	for testName, testObject := range objects {
+		t.Run(testName, func(t *testing.T) {
+			multipartBody, multipartBoundary, err := testutils.FileToFormData("gopher.jpg", testObject.Contents, "file")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req, err := http.NewRequest("POST", testObject.Route+testObject.Query, bytes.NewReader(multipartBody.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", fmt.Sprintf("multipart/form-data; boundary=\"%s\"", multipartBoundary))
+
+			rr := httptest.NewRecorder()
+			router := mux.NewRouter()
+			createFile := drweb.CreateFileHandler(storage, &namegenerators.SHA256{})
+			createFile = drweb.WithMetadataStripping(createFile, &imagemeta.Stripper{}, originals)
+			router.HandleFunc(testObject.Route, drweb.WithUploadPolicies(createFile, policies, testObject.Route))
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, testObject.ServerCode, rr.Code)
+			if rr.Code != http.StatusCreated {
+				return
+			}
+
+			var response map[string]string
+			json.Unmarshal(rr.Body.Bytes(), &response)
+
+			hashstring := fmt.Sprintf("%x", sha256.Sum256(testObject.Contents))
+			assert.Equal(t, testObject.Stripped, response["hashstring"] != hashstring)
+
+			stored, err := storage.Load(response["hashstring"])
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer stored.Close()
+			contents, _ := ioutil.ReadAll(stored.Body)
+			assert.Equal(t, testObject.Stripped, len(contents) < len(testObject.Contents))
+
+			if testObject.Stripped {
+				original, err := originals.Load(hashstring)
+				assert.Nil(t, err)
+				original.Close()
+			}
+		})
+	}
+}
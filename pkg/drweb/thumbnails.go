@@ -0,0 +1,81 @@
+package drweb
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultThumbnailSize = 256
+	maxThumbnailSize     = 2048
+)
+
+// ThumbnailHandler serves a downscaled image, ?w= and ?h= bound it
+// and ?fit= tells how, see ThumbnailSpec.
+func ThumbnailHandler(thumbnails Thumbnails) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		spec := &ThumbnailSpec{Fit: r.URL.Query().Get("fit")}
+
+		if spec.Width, err = queryInt(r, "w", defaultThumbnailSize, 1, maxThumbnailSize); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			writeJSONError(w, err, http.StatusBadRequest)
+			return
+		}
+
+		if spec.Height, err = queryInt(r, "h", defaultThumbnailSize, 1, maxThumbnailSize); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			writeJSONError(w, err, http.StatusBadRequest)
+			return
+		}
+
+		switch spec.Fit {
+		case "":
+			spec.Fit = ThumbnailContain
+		case ThumbnailContain, ThumbnailCover, ThumbnailFill:
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			writeJSONError(w, fmt.Errorf("fit should be one of contain, cover or fill (given '%s')", spec.Fit), http.StatusBadRequest)
+			return
+		}
+
+		thumbnail, err := thumbnails.Thumbnail(mux.Vars(r)["hashstring"], spec)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			cause := errors.Cause(err)
+			_, limited := cause.(*ImageLimitError)
+
+			switch {
+			case os.IsNotExist(cause):
+				writeJSONError(w, err, http.StatusNotFound)
+			case cause == ErrNotImage || limited:
+				writeJSONError(w, err, http.StatusUnprocessableEntity)
+			default:
+				log.WithError(err).Error("failed to render thumbnail")
+				writeJSONError(w, err, http.StatusInternalServerError)
+			}
+			return
+		}
+		defer thumbnail.Close()
+
+		// NOTE: thumbnails are rendered by us, so their type is known to be safe
+		head := make([]byte, 512)
+		read, _ := io.ReadFull(thumbnail.Body, head)
+		w.Header().Set("Content-Type", http.DetectContentType(head[:read]))
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", thumbnail.Size))
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+
+		if _, err = w.Write(head[:read]); err == nil {
+			_, err = io.Copy(w, thumbnail.Body)
+		}
+		if err != nil {
+			log.WithError(err).Error("failed to write thumbnail")
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package drweb_test
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+	"github.com/twonegatives/drweb_challenge/pkg/mocks"
+)
+
+func TestThumbnailHandler(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n")
+
+	var objects = map[string]struct {
+		Query      string
+		Spec       *drweb.ThumbnailSpec
+		Error      error
+		ServerCode int
+	}{
+		"defaults":     {Query: "", Spec: &drweb.ThumbnailSpec{Width: 256, Height: 256, Fit: drweb.ThumbnailContain}, ServerCode: http.StatusOK},
+		"given":        {Query: "?w=64&h=32&fit=cover", Spec: &drweb.ThumbnailSpec{Width: 64, Height: 32, Fit: drweb.ThumbnailCover}, ServerCode: http.StatusOK},
+		"not found":    {Query: "", Spec: &drweb.ThumbnailSpec{Width: 256, Height: 256, Fit: drweb.ThumbnailContain}, Error: os.ErrNotExist, ServerCode: http.StatusNotFound},
+		"not an image": {Query: "", Spec: &drweb.ThumbnailSpec{Width: 256, Height: 256, Fit: drweb.ThumbnailContain}, Error: drweb.ErrNotImage, ServerCode: http.StatusUnprocessableEntity},
+		"bomb":         {Query: "", Spec: &drweb.ThumbnailSpec{Width: 256, Height: 256, Fit: drweb.ThumbnailContain}, Error: &drweb.ImageLimitError{Width: 1 << 16, Height: 1 << 16}, ServerCode: http.StatusUnprocessableEntity},
+		"failure":      {Query: "", Spec: &drweb.ThumbnailSpec{Width: 256, Height: 256, Fit: drweb.ThumbnailContain}, Error: errors.New("disk is gone"), ServerCode: http.StatusInternalServerError},
+		"unknown fit":  {Query: "?fit=tile", ServerCode: http.StatusBadRequest},
+		"too wide":     {Query: "?w=4096", ServerCode: http.StatusBadRequest},
+		"no height":    {Query: "?h=0", ServerCode: http.StatusBadRequest},
+	}
+
+	for testName, testObject := range objects {
+		t.Run(testName, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			thumbnails := mocks.NewMockThumbnails(mockCtrl)
+			if testObject.Spec != nil {
+				var file *drweb.File
+				if testObject.Error == nil {
+					file = &drweb.File{Body: ioutil.NopCloser(bytes.NewReader(png)), Size: int64(len(png))}
+				}
+				thumbnails.EXPECT().Thumbnail("abcdef", testObject.Spec).Return(file, testObject.Error)
+			}
+
+			req, err := http.NewRequest("GET", "/files/abcdef/thumbnail"+testObject.Query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			router := mux.NewRouter()
+			router.HandleFunc("/files/{hashstring}/thumbnail", drweb.ThumbnailHandler(thumbnails))
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, testObject.ServerCode, rr.Code)
+			if rr.Code == http.StatusOK {
+				assert.Equal(t, "image/png", rr.Header().Get("Content-Type"))
+				assert.Equal(t, png, rr.Body.Bytes())
+			}
+		})
+	}
+}
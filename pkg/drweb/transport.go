@@ -2,12 +2,14 @@ package drweb
 
 import (
 	"bytes"
+	"crypto/subtle"
 	"encoding/json"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
 	"os"
+	"strings"
 
 	log "github.com/sirupsen/logrus"
 
@@ -23,16 +25,26 @@ func writeJSONError(writer http.ResponseWriter, err error, status int) {
 	}
 }
 
-func CreateFileHandler(storage Storage, filenamegenerator FileNameGenerator) func(http.ResponseWriter, *http.Request) {
+func CreateFileHandler(storage Storage, filenamegenerator FileNameGenerator, inspectors ...InspectorFactory) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var formFile multipart.File
+		var header *multipart.FileHeader
 		var file *FileCreateRequest
 		var filename string
 		var err error
 
 		w.Header().Set("Content-Type", "application/json")
 
-		if formFile, _, err = r.FormFile("file"); err != nil {
+		upload := uploadOf(r)
+
+		if formFile, header, err = r.FormFile("file"); err != nil {
+			if upload != nil && upload.body != nil && upload.body.exceeded {
+				rejection := upload.limit.tooLarge()
+				log.WithError(rejection).Info("file rejected")
+				writeJSONError(w, rejection, rejection.Status)
+				return
+			}
+
 			log.WithError(err).Error("failed to get a form file")
 			writeJSONError(w, err, http.StatusBadRequest)
 			return
@@ -42,9 +54,37 @@ func CreateFileHandler(storage Storage, filenamegenerator FileNameGenerator) fun
 		file = &FileCreateRequest{
 			Body:          formFile,
 			NameGenerator: filenamegenerator,
+			Metadata:      &Metadata{},
+		}
+
+		// NOTE: policies go first, as they are cheap and abort uploads early
+		if upload != nil {
+			for _, policy := range upload.policies {
+				file.Inspectors = append(file.Inspectors, policy.NewInspector(header.Filename))
+			}
+		}
+
+		for _, newInspector := range inspectors {
+			file.Inspectors = append(file.Inspectors, newInspector())
+		}
+
+		if stripping := strippingOf(r); stripping != nil && stripping.wanted(upload) {
+			stripping.apply(file, formFile)
 		}
 
 		if filename, err = storage.Save(file); err != nil {
+			if rejection, ok := errors.Cause(err).(*RejectionError); ok {
+				log.WithError(err).Info("file rejected")
+				writeJSONError(w, rejection, rejection.Status)
+				return
+			}
+
+			if errors.Cause(err) == ErrStorageFull {
+				log.WithError(err).Warn("file does not fit into storage")
+				writeJSONError(w, err, http.StatusInsufficientStorage)
+				return
+			}
+
 			log.WithError(err).Error("failed to save file")
 			writeJSONError(w, err, http.StatusInternalServerError)
 			return
@@ -62,7 +102,6 @@ func RetrieveFileHandler(storage Storage) func(http.ResponseWriter, *http.Reques
 	return func(w http.ResponseWriter, req *http.Request) {
 		var err error
 		var file *File
-		var leadingCnt int
 
 		vars := mux.Vars(req)
 		filename := vars["hashstring"]
@@ -80,31 +119,47 @@ func RetrieveFileHandler(storage Storage) func(http.ResponseWriter, *http.Reques
 		}
 
 		defer file.Close()
+		serveFile(w, req, filename, file)
+	}
+}
 
-		min := func(x, y int64) int64 {
-			if x < y {
-				return x
-			}
-			return y
-		}
+func serveFile(w http.ResponseWriter, req *http.Request, filename string, file *File) {
+	var leadingCnt int
+	var err error
 
-		buffer := make([]byte, min(file.Size, 512))
-		if leadingCnt, err = file.Body.Read(buffer); err != nil {
-			w.Header().Set("Content-Type", "application/json")
-			writeJSONError(w, err, http.StatusInternalServerError)
+	if state := wrappingOf(req); state != nil && state.wrap {
+		serveWrapped(w, state.wrapper, filename, file)
+		return
+	}
+
+	min := func(x, y int64) int64 {
+		if x < y {
+			return x
 		}
+		return y
+	}
 
-		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
-		w.Header().Set("Content-Type", http.DetectContentType(buffer))
-		w.Header().Set("Content-Length", fmt.Sprintf("%d", file.Size))
-		_, err = io.Copy(w, io.MultiReader(bytes.NewReader(buffer[0:leadingCnt]), file.Body))
+	buffer := make([]byte, min(file.Size, 512))
+	if leadingCnt, err = file.Body.Read(buffer); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		writeJSONError(w, err, http.StatusInternalServerError)
+	}
 
-		if err != nil {
-			// NOTE: streaming does not leave us much to do in case of failure
-			// but to close the connection and assume client will check
-			// hashsum or content-length by himself. in any case we can log this
-			log.WithError(err).Error("file streaming over http failed")
-		}
+	contentType, disposition := http.DetectContentType(buffer), "attachment"
+	if policy := servingPolicyOf(req); policy != nil {
+		contentType, disposition = policy.contentHeaders(contentType)
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("%s; filename=%s", disposition, filename))
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", file.Size))
+	_, err = io.Copy(w, io.MultiReader(bytes.NewReader(buffer[0:leadingCnt]), file.Body))
+
+	if err != nil {
+		// NOTE: streaming does not leave us much to do in case of failure
+		// but to close the connection and assume client will check
+		// hashsum or content-length by himself. in any case we can log this
+		log.WithError(err).Error("file streaming over http failed")
 	}
 }
 
@@ -132,3 +187,30 @@ func WithCallbacks(handler func(http.ResponseWriter, *http.Request), before Call
 		handler(w, r)
 	}
 }
+
+// AdminActor names whoever performs an admin request, as stated by WithAdminAuth.
+func AdminActor(r *http.Request) string {
+	return r.Header.Get("X-Actor")
+}
+
+// NOTE: admin endpoints are disabled altogether unless a token is configured.
+// Callers should present it as a bearer token and name themselves via X-Actor,
+// so that actions on files could be attributed later on.
+func WithAdminAuth(handler func(http.ResponseWriter, *http.Request), token string) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("Content-Type", "application/json")
+			writeJSONError(w, errors.New("admin token is invalid"), http.StatusUnauthorized)
+			return
+		}
+
+		if AdminActor(r) == "" {
+			w.Header().Set("Content-Type", "application/json")
+			writeJSONError(w, errors.New("X-Actor header is required"), http.StatusBadRequest)
+			return
+		}
+
+		handler(w, r)
+	}
+}
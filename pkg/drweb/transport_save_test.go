@@ -72,6 +72,67 @@ func TestSaveFailure(t *testing.T) {
 		assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
 		assert.NotNil(t, response["error"])
 	})
+
+	t.Run("file rejected", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+		rejection := &drweb.RejectionError{Status: http.StatusForbidden, Rule: "hash list 'internal'", Reason: "file is known to be malicious"}
+		storage := mocks.NewMockStorage(mockCtrl)
+		storage.EXPECT().Save(gomock.Any()).Return("", rejection)
+		filenamegenerator := mocks.NewMockFileNameGenerator(mockCtrl)
+		inspector := mocks.NewMockInspector(mockCtrl)
+		newInspector := func() drweb.Inspector { return inspector }
+
+		multipartBody, multipartBoundary, err := testutils.FileToFormData("original_filename", []byte("Byte file contents"), "file")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := http.NewRequest("POST", "/files", multipartBody)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Content-Type", fmt.Sprintf("multipart/form-data; boundary=\"%s\"", multipartBoundary))
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+		router.HandleFunc("/files", drweb.CreateFileHandler(storage, filenamegenerator, newInspector))
+		router.ServeHTTP(rr, req)
+
+		var response map[string]string
+		json.Unmarshal(rr.Body.Bytes(), &response)
+
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		assert.Contains(t, response["error"], "hash list 'internal'")
+	})
+
+	t.Run("storage full", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+		storage := mocks.NewMockStorage(mockCtrl)
+		storage.EXPECT().Save(gomock.Any()).Return("", drweb.ErrStorageFull)
+		filenamegenerator := mocks.NewMockFileNameGenerator(mockCtrl)
+
+		multipartBody, multipartBoundary, err := testutils.FileToFormData("original_filename", []byte("Byte file contents"), "file")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := http.NewRequest("POST", "/files", multipartBody)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Content-Type", fmt.Sprintf("multipart/form-data; boundary=\"%s\"", multipartBoundary))
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+		router.HandleFunc("/files", drweb.CreateFileHandler(storage, filenamegenerator))
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusInsufficientStorage, rr.Code)
+	})
 }
 
 func TestSaveFileHandlerSuccess(t *testing.T) {
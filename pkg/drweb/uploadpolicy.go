@@ -0,0 +1,292 @@
+package drweb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// sniffLength is how much content http.DetectContentType looks at.
+const sniffLength = 512
+
+// multipartSlack leaves room for multipart boundaries and headers
+// when request body is capped by upload size limit.
+const multipartSlack = 64 << 10
+
+// UploadPolicy restricts uploads by their content type, detected out of
+// magic bytes rather than taken from the client, and size. Policy applies
+// to uploads on any of its Routes as well as to ones made by its Tenants.
+// StripMetadata has image metadata stripped, see WithMetadataStripping.
+type UploadPolicy struct {
+	Name           string   `json:"name"`
+	Routes         []string `json:"routes"`
+	Tenants        []string `json:"tenants"`
+	Allow          []string `json:"allow"`
+	Deny           []string `json:"deny"`
+	MinSize        int64    `json:"min_size"`
+	MaxSize        int64    `json:"max_size"`
+	MatchExtension bool     `json:"match_extension"`
+	StripMetadata  bool     `json:"strip_metadata"`
+}
+
+type UploadPolicies []*UploadPolicy
+
+// extensionTypes tells what content is expected of a file extension
+// for MatchExtension. NOTE: mime package is not used, since its table
+// depends on mime.types files of the host.
+var extensionTypes = map[string][]string{
+	".txt":  {"text/plain"},
+	".csv":  {"text/plain"},
+	".json": {"text/plain"},
+	".log":  {"text/plain"},
+	".htm":  {"text/html"},
+	".html": {"text/html"},
+	".xml":  {"text/xml"},
+	".svg":  {"text/xml", "text/plain"},
+	".pdf":  {"application/pdf"},
+	".png":  {"image/png"},
+	".jpg":  {"image/jpeg"},
+	".jpeg": {"image/jpeg"},
+	".gif":  {"image/gif"},
+	".webp": {"image/webp"},
+	".bmp":  {"image/bmp"},
+	".ico":  {"image/x-icon"},
+	".zip":  {"application/zip"},
+	".gz":   {"application/x-gzip"},
+	".tgz":  {"application/x-gzip"},
+	".rar":  {"application/x-rar-compressed"},
+	".mp3":  {"audio/mpeg"},
+	".wav":  {"audio/wave"},
+	".ogg":  {"application/ogg"},
+	".mp4":  {"video/mp4"},
+	".webm": {"video/webm"},
+	".exe":  {"application/octet-stream"},
+	".dll":  {"application/octet-stream"},
+	".bin":  {"application/octet-stream"},
+}
+
+// LoadUploadPolicies reads a json array of policies.
+// Routes other than /files are expected to lie under /uploads/.
+func LoadUploadPolicies(path string) (UploadPolicies, error) {
+	var policies UploadPolicies
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read upload policies")
+	}
+
+	if err = json.Unmarshal(contents, &policies); err != nil {
+		return nil, errors.Wrap(err, "failed to parse upload policies")
+	}
+
+	names := map[string]bool{}
+	for _, policy := range policies {
+		if policy.Name == "" || names[policy.Name] {
+			return nil, fmt.Errorf("upload policy name '%s' is blank or duplicated", policy.Name)
+		}
+		names[policy.Name] = true
+
+		for _, route := range policy.Routes {
+			if route != "/files" && !strings.HasPrefix(route, "/uploads/") {
+				return nil, fmt.Errorf("upload policy '%s' route '%s' should be /files or lie under /uploads/", policy.Name, route)
+			}
+		}
+	}
+
+	return policies, nil
+}
+
+// Routes lists upload routes: /files along with every route policies are attached to.
+func (p UploadPolicies) Routes() []string {
+	routes := []string{"/files"}
+	for _, policy := range p {
+		for _, route := range policy.Routes {
+			routes = appendUnique(routes, route)
+		}
+	}
+	return routes
+}
+
+// For gives every policy which applies to an upload, all of them have to be met.
+func (p UploadPolicies) For(route string, tenant string) []*UploadPolicy {
+	found := []*UploadPolicy{}
+	for _, policy := range p {
+		if contains(policy.Routes, route) || tenant != "" && contains(policy.Tenants, tenant) {
+			found = append(found, policy)
+		}
+	}
+	return found
+}
+
+func contains(list []string, item string) bool {
+	for _, existing := range list {
+		if existing == item {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *UploadPolicy) reject(status int, rule string, reason string) *RejectionError {
+	return &RejectionError{
+		Status: status,
+		Rule:   fmt.Sprintf("upload policy '%s' %s", p.Name, rule),
+		Reason: reason,
+	}
+}
+
+func (p *UploadPolicy) tooLarge() *RejectionError {
+	return p.reject(http.StatusRequestEntityTooLarge, "max_size", fmt.Sprintf("file exceeds %d bytes", p.MaxSize))
+}
+
+// matchType matches media types, "image/*" stands for any image.
+func matchType(patterns []string, mediaType string) bool {
+	for _, pattern := range patterns {
+		if strings.EqualFold(pattern, mediaType) {
+			return true
+		}
+
+		if strings.HasSuffix(pattern, "/*") && strings.HasPrefix(mediaType, strings.ToLower(strings.TrimSuffix(pattern, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *UploadPolicy) checkType(head []byte, clientFilename string) error {
+	mediaType, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+
+	if matchType(p.Deny, mediaType) {
+		return p.reject(http.StatusUnsupportedMediaType, "deny", fmt.Sprintf("%s is denied", mediaType))
+	}
+
+	if len(p.Allow) > 0 && !matchType(p.Allow, mediaType) {
+		return p.reject(http.StatusUnsupportedMediaType, "allow", fmt.Sprintf("%s is not allowed", mediaType))
+	}
+
+	if p.MatchExtension {
+		ext := strings.ToLower(filepath.Ext(clientFilename))
+		if !contains(extensionTypes[ext], mediaType) {
+			return p.reject(http.StatusUnsupportedMediaType, "match_extension", fmt.Sprintf("%s does not match '%s' extension", mediaType, ext))
+		}
+	}
+
+	return nil
+}
+
+// NewInspector checks content as it is streamed, so that
+// violating uploads are aborted as soon as it becomes clear.
+func (p *UploadPolicy) NewInspector(clientFilename string) Inspector {
+	return &policyInspector{policy: p, clientFilename: clientFilename}
+}
+
+type policyInspector struct {
+	policy         *UploadPolicy
+	clientFilename string
+	head           []byte
+	size           int64
+	checked        bool
+}
+
+func (i *policyInspector) Write(p []byte) (int, error) {
+	i.size += int64(len(p))
+	if i.policy.MaxSize > 0 && i.size > i.policy.MaxSize {
+		return 0, i.policy.tooLarge()
+	}
+
+	if !i.checked {
+		missing := sniffLength - len(i.head)
+		if missing > len(p) {
+			missing = len(p)
+		}
+		i.head = append(i.head, p[:missing]...)
+
+		if len(i.head) == sniffLength {
+			i.checked = true
+			if err := i.policy.checkType(i.head, i.clientFilename); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	return len(p), nil
+}
+
+func (i *policyInspector) Inspect(filename string, metadata *Metadata) error {
+	if !i.checked {
+		if err := i.policy.checkType(i.head, i.clientFilename); err != nil {
+			return err
+		}
+	}
+
+	if i.size < i.policy.MinSize {
+		return i.policy.reject(http.StatusBadRequest, "min_size", fmt.Sprintf("file is smaller than %d bytes", i.policy.MinSize))
+	}
+
+	return nil
+}
+
+type uploadKey struct{}
+
+type upload struct {
+	policies []*UploadPolicy
+	limit    *UploadPolicy
+	body     *cappedBody
+}
+
+func uploadOf(r *http.Request) *upload {
+	state, _ := r.Context().Value(uploadKey{}).(*upload)
+	return state
+}
+
+// cappedBody stops reading request body beyond the limit,
+// so that oversized uploads are not received in whole.
+type cappedBody struct {
+	io.ReadCloser
+	remaining int64
+	exceeded  bool
+}
+
+func (b *cappedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		b.exceeded = true
+		return 0, errors.New("request body is too large")
+	}
+
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	return n, err
+}
+
+// WithUploadPolicies enforces policies attached to the route or to the tenant
+// named by TenantHeader on uploads handled by CreateFileHandler.
+func WithUploadPolicies(handler func(http.ResponseWriter, *http.Request), policies UploadPolicies, route string) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		state := &upload{policies: policies.For(route, r.Header.Get(TenantHeader))}
+
+		for _, policy := range state.policies {
+			if policy.MaxSize > 0 && (state.limit == nil || policy.MaxSize < state.limit.MaxSize) {
+				state.limit = policy
+			}
+		}
+
+		if state.limit != nil && r.Body != nil {
+			state.body = &cappedBody{ReadCloser: r.Body, remaining: state.limit.MaxSize + multipartSlack}
+			r.Body = state.body
+		}
+
+		handler(w, r.WithContext(context.WithValue(r.Context(), uploadKey{}, state)))
+	}
+}
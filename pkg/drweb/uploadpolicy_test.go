@@ -0,0 +1,116 @@
+package drweb_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+	"github.com/twonegatives/drweb_challenge/pkg/namegenerators"
+	"github.com/twonegatives/drweb_challenge/pkg/storages"
+	"github.com/twonegatives/drweb_challenge/pkg/testutils"
+)
+
+func TestLoadUploadPolicies(t *testing.T) {
+	base, err := ioutil.TempDir("../../tmp", "policies")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(base)
+
+	var objects = map[string]struct {
+		Contents string
+		Valid    bool
+	}{
+		"valid":          {Contents: `[{"name": "images", "routes": ["/uploads/images", "/files"], "allow": ["image/*"]}]`, Valid: true},
+		"malformed":      {Contents: `{"name": "images"}`},
+		"blank name":     {Contents: `[{"routes": ["/uploads/images"]}]`},
+		"duplicate name": {Contents: `[{"name": "images"}, {"name": "images"}]`},
+		"foreign route":  {Contents: `[{"name": "images", "routes": ["/files/images"]}]`},
+	}
+
+	for testName, testObject := range objects {
+		t.Run(testName, func(t *testing.T) {
+			policyPath := path.Join(base, "policies.json")
+			if err := ioutil.WriteFile(policyPath, []byte(testObject.Contents), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			policies, err := drweb.LoadUploadPolicies(policyPath)
+			assert.Equal(t, testObject.Valid, err == nil)
+			if testObject.Valid {
+				assert.Equal(t, []string{"/files", "/uploads/images"}, policies.Routes())
+			}
+		})
+	}
+}
+
+type uploadPolicyCase struct {
+	Route      string
+	Tenant     string
+	Filename   string
+	Contents   []byte
+	ServerCode int
+	Rule       string
+}
+
+func TestWithUploadPolicies(t *testing.T) {
+	storage := &storages.MemoryStorage{}
+
+	policies := drweb.UploadPolicies{
+		{Name: "images", Routes: []string{"/uploads/images"}, Allow: []string{"image/*"}, MaxSize: 1 << 10, MatchExtension: true},
+		{Name: "no-html", Tenants: []string{"gallery"}, Deny: []string{"text/html"}, MinSize: 4},
+	}
+
+	png := append([]byte("\x89PNG\x0d\x0a\x1a\x0a"), make([]byte, 100)...)
+	html := []byte("<html><script>alert(1)</script></html>")
+
+	var objects = map[string]uploadPolicyCase{
+		"allowed":              {Route: "/uploads/images", Filename: "gopher.png", Contents: png, ServerCode: http.StatusCreated},
+		"not allowed":          {Route: "/uploads/images", Filename: "page.png", Contents: html, ServerCode: http.StatusUnsupportedMediaType, Rule: "upload policy 'images' allow"},
+		"extension mismatch":   {Route: "/uploads/images", Filename: "gopher.jpg", Contents: png, ServerCode: http.StatusUnsupportedMediaType, Rule: "upload policy 'images' match_extension"},
+		"too large, streamed":  {Route: "/uploads/images", Filename: "gopher.png", Contents: append(png, make([]byte, 2<<10)...), ServerCode: http.StatusRequestEntityTooLarge, Rule: "upload policy 'images' max_size"},
+		"too large, received":  {Route: "/uploads/images", Filename: "gopher.png", Contents: append(png, make([]byte, 128<<10)...), ServerCode: http.StatusRequestEntityTooLarge, Rule: "upload policy 'images' max_size"},
+		"no policy":            {Route: "/files", Filename: "page.html", Contents: html, ServerCode: http.StatusCreated},
+		"tenant denied":        {Route: "/files", Tenant: "gallery", Filename: "page.html", Contents: html, ServerCode: http.StatusUnsupportedMediaType, Rule: "upload policy 'no-html' deny"},
+		"tenant too small":     {Route: "/files", Tenant: "gallery", Filename: "a.txt", Contents: []byte("abc"), ServerCode: http.StatusBadRequest, Rule: "upload policy 'no-html' min_size"},
+		"route and tenant met": {Route: "/uploads/images", Tenant: "gallery", Filename: "gopher.png", Contents: png, ServerCode: http.StatusCreated},
+	}
+
+	for testName, testObject := range objects {
+		t.Run(testName, func(t *testing.T) {
+			multipartBody, multipartBoundary, err := testutils.FileToFormData(testObject.Filename, testObject.Contents, "file")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req, err := http.NewRequest("POST", testObject.Route, bytes.NewReader(multipartBody.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req.Header.Set("Content-Type", fmt.Sprintf("multipart/form-data; boundary=\"%s\"", multipartBoundary))
+			req.Header.Set(drweb.TenantHeader, testObject.Tenant)
+
+			rr := httptest.NewRecorder()
+			router := mux.NewRouter()
+			createFile := drweb.CreateFileHandler(storage, &namegenerators.SHA256{})
+			router.HandleFunc(testObject.Route, drweb.WithUploadPolicies(createFile, policies, testObject.Route))
+			router.ServeHTTP(rr, req)
+
+			var response map[string]string
+			json.Unmarshal(rr.Body.Bytes(), &response)
+
+			assert.Equal(t, testObject.ServerCode, rr.Code)
+			assert.Contains(t, response["error"], testObject.Rule)
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package drweb
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// TenantHeader names the tenant a download is made for.
+// NOTE: it is expected to be set by an authenticating proxy in front of us.
+const TenantHeader = "X-Tenant"
+
+const WrapZip = "zip"
+
+// WrapPolicy makes files be served wrapped into an encrypted zip
+// whether client asks for it or not. Quarantined and flagged files,
+// which are not served otherwise, become available wrapped.
+type WrapPolicy struct {
+	Always      bool
+	Quarantined bool
+	Flagged     bool
+}
+
+// WrapPolicies are kept per tenant, "*" stands for any other tenant.
+type WrapPolicies map[string]*WrapPolicy
+
+// ParseWrapPolicies reads "tenant:rule,rule" specs, where rule is one of
+// always, quarantined or flagged.
+func ParseWrapPolicies(specs []string) (WrapPolicies, error) {
+	policies := WrapPolicies{}
+
+	for _, spec := range specs {
+		parts := strings.SplitN(spec, ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("wrap policy should be given as tenant:rules (given '%s')", spec)
+		}
+
+		policy := &WrapPolicy{}
+		for _, rule := range strings.Split(parts[1], ",") {
+			switch rule {
+			case "always":
+				policy.Always = true
+			case "quarantined":
+				policy.Quarantined = true
+			case "flagged":
+				policy.Flagged = true
+			default:
+				return nil, fmt.Errorf("unknown wrap policy rule '%s'", rule)
+			}
+		}
+
+		policies[parts[0]] = policy
+	}
+
+	return policies, nil
+}
+
+func (p WrapPolicies) For(tenant string) *WrapPolicy {
+	if policy, ok := p[tenant]; ok && tenant != "" {
+		return policy
+	}
+
+	if policy, ok := p["*"]; ok {
+		return policy
+	}
+
+	return &WrapPolicy{}
+}
+
+type wrappingKey struct{}
+
+type wrapping struct {
+	wrapper Wrapper
+	policy  *WrapPolicy
+	wrap    bool
+}
+
+func wrappingOf(r *http.Request) *wrapping {
+	state, _ := r.Context().Value(wrappingKey{}).(*wrapping)
+	return state
+}
+
+// forceWrapping returns request to serve a file, which would be refused
+// otherwise, wrapped. It is only possible if tenant policy says so.
+func forceWrapping(r *http.Request, forced func(policy *WrapPolicy) bool) (*http.Request, bool) {
+	state := wrappingOf(r)
+	if state == nil || !forced(state.policy) {
+		return r, false
+	}
+
+	wrapped := *state
+	wrapped.wrap = true
+	return r.WithContext(context.WithValue(r.Context(), wrappingKey{}, &wrapped)), true
+}
+
+// WithWrapping lets downloads be wrapped into encrypted zip, either asked by
+// ?wrap=zip or forced by tenant policy. It should go before any other check,
+// since checks may allow wrapped downloads of files they refuse to serve.
+func WithWrapping(handler func(http.ResponseWriter, *http.Request), wrapper Wrapper, policies WrapPolicies) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		wrap := r.URL.Query().Get("wrap")
+		if wrap != "" && wrap != WrapZip {
+			w.Header().Set("Content-Type", "application/json")
+			writeJSONError(w, fmt.Errorf("unsupported wrap '%s'", wrap), http.StatusBadRequest)
+			return
+		}
+
+		policy := policies.For(r.Header.Get(TenantHeader))
+		state := &wrapping{wrapper: wrapper, policy: policy, wrap: wrap == WrapZip || policy.Always}
+		handler(w, r.WithContext(context.WithValue(r.Context(), wrappingKey{}, state)))
+	}
+}
+
+func serveWrapped(w http.ResponseWriter, wrapper Wrapper, filename string, file *File) {
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s.zip", filename))
+	w.Header().Set("Content-Type", "application/zip")
+
+	if err := wrapper.Wrap(w, filename, file.Body); err != nil {
+		// NOTE: archive is streamed, so a broken one is all client gets
+		log.WithError(errors.Cause(err)).Error("wrapped file streaming over http failed")
+	}
+}
@@ -0,0 +1,124 @@
+package drweb_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+	"github.com/twonegatives/drweb_challenge/pkg/mocks"
+)
+
+func TestParseWrapPolicies(t *testing.T) {
+	policies, err := drweb.ParseWrapPolicies([]string{"analysts:quarantined,flagged", "*:always"})
+	assert.Nil(t, err)
+	assert.Equal(t, &drweb.WrapPolicy{Quarantined: true, Flagged: true}, policies.For("analysts"))
+	assert.Equal(t, &drweb.WrapPolicy{Always: true}, policies.For("support"))
+	assert.Equal(t, &drweb.WrapPolicy{Always: true}, policies.For(""))
+	assert.Equal(t, &drweb.WrapPolicy{}, drweb.WrapPolicies{}.For("analysts"))
+
+	for _, spec := range []string{"analysts", ":always", "analysts:", "analysts:sometimes"} {
+		_, err = drweb.ParseWrapPolicies([]string{spec})
+		assert.NotNil(t, err, spec)
+	}
+}
+
+type wrappingCase struct {
+	Query       string
+	Tenant      string
+	Quarantined *drweb.QuarantineRecord
+	Flagged     bool
+	ServerCode  int
+	ContentType string
+	Source      string
+}
+
+func TestWithWrapping(t *testing.T) {
+	policies := drweb.WrapPolicies{
+		"analysts": &drweb.WrapPolicy{Quarantined: true, Flagged: true},
+		"support":  &drweb.WrapPolicy{Always: true},
+	}
+
+	infected := &drweb.QuarantineRecord{Category: drweb.QuarantineInfected}
+	takedown := &drweb.QuarantineRecord{Category: drweb.QuarantinePolicy}
+
+	var objects = map[string]wrappingCase{
+		"plain":                      {ServerCode: http.StatusOK, ContentType: "text/plain; charset=utf-8", Source: "storage"},
+		"asked to wrap":              {Query: "?wrap=zip", ServerCode: http.StatusOK, ContentType: "application/zip", Source: "storage"},
+		"unsupported wrap":           {Query: "?wrap=rar", ServerCode: http.StatusBadRequest},
+		"always wrapped":             {Tenant: "support", ServerCode: http.StatusOK, ContentType: "application/zip", Source: "storage"},
+		"quarantined":                {Query: "?wrap=zip", Quarantined: infected, ServerCode: http.StatusForbidden},
+		"quarantined, forced":        {Tenant: "analysts", Quarantined: infected, ServerCode: http.StatusOK, ContentType: "application/zip", Source: "quarantine"},
+		"quarantined legally, force": {Tenant: "analysts", Quarantined: takedown, ServerCode: http.StatusUnavailableForLegalReasons},
+		"flagged":                    {Query: "?wrap=zip", Tenant: "support", Flagged: true, ServerCode: http.StatusForbidden},
+		"flagged, forced":            {Tenant: "analysts", Flagged: true, ServerCode: http.StatusOK, ContentType: "application/zip", Source: "storage"},
+	}
+
+	for testName, testObject := range objects {
+		t.Run(testName, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			file := &drweb.File{Body: ioutil.NopCloser(bytes.NewReader([]byte("EICAR"))), Size: 5}
+
+			storage := mocks.NewMockStorage(mockCtrl)
+			quarantine := mocks.NewMockQuarantine(mockCtrl)
+			lists := mocks.NewMockHashLists(mockCtrl)
+			wrapper := mocks.NewMockWrapper(mockCtrl)
+
+			if testObject.ServerCode != http.StatusBadRequest {
+				matches := []*drweb.HashListMatch{}
+				if testObject.Flagged {
+					matches = append(matches, &drweb.HashListMatch{List: "malware", Kind: drweb.HashListBlock})
+				}
+				lists.EXPECT().Match("abcdef").Return(matches)
+			}
+
+			// NOTE: flagged files are checked against quarantine as well, unless refused
+			refused := testObject.Flagged && testObject.ServerCode == http.StatusForbidden
+			if !refused && testObject.ServerCode != http.StatusBadRequest {
+				if testObject.Quarantined != nil {
+					quarantine.EXPECT().Inspect("abcdef").Return(testObject.Quarantined, nil)
+				} else {
+					quarantine.EXPECT().Inspect("abcdef").Return(nil, errors.Wrap(os.ErrNotExist, "no record"))
+				}
+			}
+
+			switch testObject.Source {
+			case "storage":
+				storage.EXPECT().Load("abcdef").Return(file, nil)
+			case "quarantine":
+				quarantine.EXPECT().Load("abcdef").Return(file, nil)
+			}
+
+			if testObject.ContentType == "application/zip" {
+				wrapper.EXPECT().Wrap(gomock.Any(), "abcdef", file.Body).Return(nil)
+			}
+
+			req, err := http.NewRequest("GET", "/files/abcdef"+testObject.Query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set(drweb.TenantHeader, testObject.Tenant)
+
+			retrieve := drweb.WithQuarantineCheck(drweb.RetrieveFileHandler(storage), quarantine)
+			retrieve = drweb.WithWrapping(drweb.WithHashListCheck(retrieve, lists), wrapper, policies)
+
+			rr := httptest.NewRecorder()
+			router := mux.NewRouter()
+			router.HandleFunc("/files/{hashstring}", retrieve)
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, testObject.ServerCode, rr.Code)
+			if testObject.ContentType != "" {
+				assert.Equal(t, testObject.ContentType, rr.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package entropy
+
+import (
+	"math"
+
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+)
+
+// blockSize is how much data a single entropy sample is taken of.
+// NOTE: smaller blocks can not get close to 8 bits even for random data.
+const blockSize = 1024
+
+// maxPoints bounds the profile, windows get twice as large
+// (adjacent points are merged) each time it is exceeded.
+const maxPoints = 128
+
+// headSize is how much of a file packers are looked for in.
+const headSize = 4096
+
+// Meter computes Shannon entropy of a stream, both overall
+// and per window, along with packers and payload heuristics.
+type Meter struct {
+	counts [256]int64
+	size   int64
+	block  [256]int64
+	filled int
+	window int
+	sums   []float64
+	blocks []int
+	head   []byte
+}
+
+func NewMeter() *Meter {
+	return &Meter{window: 1}
+}
+
+func (m *Meter) Write(p []byte) (int, error) {
+	if missing := headSize - len(m.head); missing > 0 {
+		if missing > len(p) {
+			missing = len(p)
+		}
+		m.head = append(m.head, p[:missing]...)
+	}
+
+	for _, c := range p {
+		m.counts[c]++
+		m.block[c]++
+		m.filled++
+
+		if m.filled == blockSize {
+			m.flush()
+		}
+	}
+
+	m.size += int64(len(p))
+	return len(p), nil
+}
+
+// flush adds entropy of the current block to the profile.
+func (m *Meter) flush() {
+	value := shannon(m.block[:], int64(m.filled))
+	m.block = [256]int64{}
+	m.filled = 0
+
+	last := len(m.sums) - 1
+	if last < 0 || m.blocks[last] == m.window {
+		m.sums = append(m.sums, 0)
+		m.blocks = append(m.blocks, 0)
+		last++
+	}
+	m.sums[last] += value
+	m.blocks[last]++
+
+	if len(m.sums) > maxPoints {
+		for i := 0; i < len(m.sums)/2; i++ {
+			m.sums[i] = m.sums[2*i] + m.sums[2*i+1]
+			m.blocks[i] = m.blocks[2*i] + m.blocks[2*i+1]
+		}
+		if len(m.sums)%2 == 1 {
+			m.sums[len(m.sums)/2] = m.sums[len(m.sums)-1]
+			m.blocks[len(m.sums)/2] = m.blocks[len(m.sums)-1]
+		}
+		m.sums = m.sums[:(len(m.sums)+1)/2]
+		m.blocks = m.blocks[:len(m.sums)]
+		m.window *= 2
+	}
+}
+
+// Entropy reports whatever was written so far.
+func (m *Meter) Entropy() *drweb.Entropy {
+	// NOTE: trailing partial block is a sample of its own
+	if m.filled > 0 {
+		m.flush()
+	}
+
+	result := &drweb.Entropy{
+		Overall:    round(shannon(m.counts[:], m.size)),
+		ChiSquare:  round(chiSquare(m.counts[:], m.size)),
+		WindowSize: int64(m.window) * blockSize,
+		Profile:    make([]float64, len(m.sums)),
+		Packers:    packers(m.head),
+	}
+
+	for i, sum := range m.sums {
+		result.Profile[i] = round(sum / float64(m.blocks[i]))
+	}
+
+	result.Payload = payload(m.head, m.size, result)
+	return result
+}
+
+func shannon(counts []int64, size int64) float64 {
+	if size == 0 {
+		return 0
+	}
+
+	entropy := 0.0
+	for _, count := range counts {
+		if count == 0 {
+			continue
+		}
+		p := float64(count) / float64(size)
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+// chiSquare tells how far byte distribution is from uniform one,
+// encrypted data stays close to 255 (the degrees of freedom).
+func chiSquare(counts []int64, size int64) float64 {
+	if size == 0 {
+		return 0
+	}
+
+	expected := float64(size) / 256
+	result := 0.0
+	for _, count := range counts {
+		diff := float64(count) - expected
+		result += diff * diff / expected
+	}
+	return result
+}
+
+// NOTE: math.Round is not there in go1.9
+func round(value float64) float64 {
+	return math.Floor(value*100+0.5) / 100
+}
+
+// NewInspector fits drweb.InspectorFactory, so that entropy
+// is computed in the same pass the upload is stored and hashed in.
+func NewInspector() drweb.Inspector {
+	return &inspector{meter: NewMeter()}
+}
+
+type inspector struct {
+	meter *Meter
+}
+
+func (i *inspector) Write(p []byte) (int, error) {
+	return i.meter.Write(p)
+}
+
+func (i *inspector) Inspect(filename string, metadata *drweb.Metadata) error {
+	metadata.Entropy = i.meter.Entropy()
+	return nil
+}
@@ -0,0 +1,90 @@
+package entropy_test
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+	"github.com/twonegatives/drweb_challenge/pkg/entropy"
+)
+
+func random(size int) []byte {
+	contents := make([]byte, size)
+	rand.New(rand.NewSource(1)).Read(contents)
+	return contents
+}
+
+func measure(contents []byte) *drweb.Entropy {
+	meter := entropy.NewMeter()
+	meter.Write(contents)
+	return meter.Entropy()
+}
+
+func TestMeter(t *testing.T) {
+	upx := append([]byte("MZ"), make([]byte, 510)...)
+	upx = append(upx, []byte("UPX0\x00\x00\x00\x00")...)
+	upx = append(upx, random(64<<10)...)
+
+	var objects = map[string]struct {
+		Contents []byte
+		Min      float64
+		Max      float64
+		Packers  []string
+		Payload  string
+	}{
+		"empty":      {Contents: []byte{}, Min: 0, Max: 0},
+		"zeros":      {Contents: make([]byte, 10000), Min: 0, Max: 0},
+		"text":       {Contents: bytes.Repeat([]byte("the quick brown fox jumps over the lazy dog "), 100), Min: 4, Max: 4.5},
+		"random":     {Contents: random(64 << 10), Min: 7.99, Max: 8, Payload: drweb.PayloadEncrypted},
+		"gzip":       {Contents: append([]byte{0x1f, 0x8b}, random(64<<10)...), Min: 7.99, Max: 8, Payload: drweb.PayloadCompressed},
+		"upx":        {Contents: upx, Min: 7.9, Max: 8, Packers: []string{"upx"}, Payload: drweb.PayloadCompressed},
+		"not an exe": {Contents: append([]byte("UPX0\x00\x00\x00\x00"), make([]byte, 100)...), Max: 1},
+	}
+
+	for testName, testObject := range objects {
+		t.Run(testName, func(t *testing.T) {
+			result := measure(testObject.Contents)
+
+			assert.True(t, result.Overall >= testObject.Min && result.Overall <= testObject.Max, "entropy is %f", result.Overall)
+			assert.Equal(t, testObject.Packers, result.Packers)
+			assert.Equal(t, testObject.Payload, result.Payload)
+			assert.Equal(t, int64(1024), result.WindowSize)
+			assert.Len(t, result.Profile, (len(testObject.Contents)+1023)/1024)
+		})
+	}
+}
+
+func TestMeterProfile(t *testing.T) {
+	contents := append(make([]byte, 1<<20), random(1<<20)...)
+
+	// NOTE: profile should not depend on how the stream is chunked
+	meter := entropy.NewMeter()
+	for start := 0; start < len(contents); start += 777 {
+		end := start + 777
+		if end > len(contents) {
+			end = len(contents)
+		}
+		meter.Write(contents[start:end])
+	}
+	result := meter.Entropy()
+
+	assert.Equal(t, measure(contents), result)
+	assert.Equal(t, int64(16<<10), result.WindowSize)
+	assert.Len(t, result.Profile, 128)
+	assert.Equal(t, 0.0, result.Profile[0])
+	assert.Equal(t, 0.0, result.Profile[63])
+	assert.True(t, result.Profile[64] > 7.7)
+	assert.True(t, result.Profile[127] > 7.7)
+}
+
+func TestInspector(t *testing.T) {
+	metadata := &drweb.Metadata{}
+	inspector := entropy.NewInspector()
+	inspector.Write(random(4096))
+
+	assert.Nil(t, inspector.Inspect("abcdef", metadata))
+	assert.NotNil(t, metadata.Entropy)
+	assert.Len(t, metadata.Entropy.Profile, 4)
+}
@@ -0,0 +1,113 @@
+package entropy
+
+import (
+	"bytes"
+
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+)
+
+// highEntropy is where payload is considered either compressed or encrypted.
+const highEntropy = 7.2
+
+// randomChiSquare is about 1% critical value for 255 degrees of freedom,
+// data below it is indistinguishable from random, i.e. likely encrypted.
+// minRandomSize keeps the test from judging by too small a sample.
+const (
+	randomChiSquare = 310
+	minRandomSize   = 4096
+)
+
+type signature struct {
+	packer string
+	marker []byte
+}
+
+// NOTE: section names are zero padded to 8 bytes in PE section table,
+// so the padding is matched as well to avoid hitting them within strings.
+var signatures = []signature{
+	{packer: "upx", marker: []byte("UPX!")},
+	{packer: "upx", marker: []byte("UPX0\x00\x00\x00\x00")},
+	{packer: "upx", marker: []byte("UPX1\x00\x00\x00\x00")},
+	{packer: "mpress", marker: []byte(".MPRESS1")},
+	{packer: "aspack", marker: []byte(".aspack\x00")},
+	{packer: "aspack", marker: []byte(".adata\x00\x00")},
+	{packer: "pecompact", marker: []byte("PEC2")},
+	{packer: "themida", marker: []byte(".themida")},
+	{packer: "fsg", marker: []byte("FSG!")},
+	{packer: "petite", marker: []byte(".petite\x00")},
+	{packer: "nspack", marker: []byte(".nsp0\x00\x00\x00")},
+	{packer: "nspack", marker: []byte(".nsp1\x00\x00\x00")},
+	{packer: "vmprotect", marker: []byte(".vmp0\x00\x00\x00")},
+	{packer: "vmprotect", marker: []byte(".vmp1\x00\x00\x00")},
+	{packer: "enigma", marker: []byte(".enigma1")},
+}
+
+var executableMagics = [][]byte{
+	[]byte("MZ"),
+	[]byte("\x7fELF"),
+	{0xfe, 0xed, 0xfa, 0xce},
+	{0xfe, 0xed, 0xfa, 0xcf},
+	{0xce, 0xfa, 0xed, 0xfe},
+	{0xcf, 0xfa, 0xed, 0xfe},
+}
+
+var compressedMagics = [][]byte{
+	[]byte("PK\x03\x04"),
+	{0x1f, 0x8b},
+	[]byte("BZh"),
+	{0xfd, '7', 'z', 'X', 'Z', 0x00},
+	{'7', 'z', 0xbc, 0xaf, 0x27, 0x1c},
+	[]byte("Rar!\x1a\x07"),
+	{0x28, 0xb5, 0x2f, 0xfd},
+	[]byte("\x89PNG\r\n\x1a\n"),
+	{0xff, 0xd8, 0xff},
+}
+
+func hasMagic(head []byte, magics [][]byte) bool {
+	for _, magic := range magics {
+		if bytes.HasPrefix(head, magic) {
+			return true
+		}
+	}
+	return false
+}
+
+// packers looks for markers packers leave within executable headers.
+func packers(head []byte) []string {
+	if !hasMagic(head, executableMagics) {
+		return nil
+	}
+
+	found := []string{}
+	for _, sig := range signatures {
+		if len(found) > 0 && found[len(found)-1] == sig.packer {
+			continue
+		}
+		if bytes.Contains(head, sig.marker) {
+			found = append(found, sig.packer)
+		}
+	}
+
+	if len(found) == 0 {
+		return nil
+	}
+	return found
+}
+
+// payload tells high entropy data of well known compressed formats
+// and anything resembling random data apart from the rest.
+func payload(head []byte, size int64, entropy *drweb.Entropy) string {
+	if entropy.Overall < highEntropy {
+		return ""
+	}
+
+	if hasMagic(head, compressedMagics) {
+		return drweb.PayloadCompressed
+	}
+
+	if size >= minRandomSize && entropy.ChiSquare < randomChiSquare {
+		return drweb.PayloadEncrypted
+	}
+
+	return drweb.PayloadCompressed
+}
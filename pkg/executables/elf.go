@@ -0,0 +1,87 @@
+package executables
+
+import (
+	"debug/elf"
+	"io"
+	"strings"
+
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+)
+
+var elfArchitectures = map[elf.Machine]string{
+	elf.EM_386:     "386",
+	elf.EM_X86_64:  "amd64",
+	elf.EM_ARM:     "arm",
+	elf.EM_AARCH64: "arm64",
+	elf.EM_MIPS:    "mips",
+	elf.EM_PPC64:   "ppc64",
+	elf.EM_S390:    "s390x",
+}
+
+// NOTE: ELF has neither a compile timestamp nor a standard signature,
+// so CompiledAt and Signed are left blank.
+func analyzeELF(input io.ReaderAt, size int64, analysis *drweb.Analysis) error {
+	file, err := elf.NewFile(input)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	analysis.Architecture = elfArchitectures[file.Machine]
+	if analysis.Architecture == "" {
+		analysis.Architecture = strings.ToLower(strings.TrimPrefix(file.Machine.String(), "EM_"))
+	}
+	analysis.EntryPoint = file.Entry
+
+	for _, section := range file.Sections {
+		if len(analysis.Sections) == maxListed {
+			break
+		}
+		if section.Type == elf.SHT_NULL {
+			continue
+		}
+		analysis.Sections = append(analysis.Sections, &drweb.AnalysisSection{
+			Name:    section.Name,
+			Address: section.Addr,
+			Size:    section.Size,
+		})
+	}
+
+	// NOTE: static executables have no dynamic symbols at all
+	libraries, err := file.ImportedLibraries()
+	if err != nil && err != elf.ErrNoSymbols {
+		return err
+	}
+	analysis.Libraries = append(analysis.Libraries, libraries...)
+
+	imported, err := file.ImportedSymbols()
+	if err != nil && err != elf.ErrNoSymbols {
+		return err
+	}
+
+	for _, symbol := range imported {
+		if len(analysis.Imports) == maxListed {
+			break
+		}
+		analysis.Imports = append(analysis.Imports, &drweb.AnalysisImport{Library: symbol.Library, Symbol: symbol.Name})
+	}
+
+	symbols, err := file.DynamicSymbols()
+	if err != nil && err != elf.ErrNoSymbols {
+		return err
+	}
+
+	for _, symbol := range symbols {
+		if len(analysis.Exports) == maxListed {
+			break
+		}
+
+		bind := elf.ST_BIND(symbol.Info)
+		if symbol.Section == elf.SHN_UNDEF || symbol.Name == "" || bind != elf.STB_GLOBAL && bind != elf.STB_WEAK {
+			continue
+		}
+		analysis.Exports = append(analysis.Exports, symbol.Name)
+	}
+
+	return nil
+}
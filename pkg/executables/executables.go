@@ -0,0 +1,80 @@
+package executables
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+)
+
+var ErrNotExecutable = errors.New("file is not an executable")
+
+// recoveredPrefix starts errors of analyses which ended up in a panic.
+const recoveredPrefix = "malformed executable: "
+
+// maxListed bounds sections, imports and exports we report,
+// malformed headers may claim millions of them.
+const maxListed = 4096
+
+// Analyze extracts metadata out of PE, ELF and Mach-O executables.
+// Anything else is reported with ErrNotExecutable. Executables which turn
+// out to be malformed are still reported, with Error telling what is wrong.
+func Analyze(input io.ReaderAt, size int64) (*drweb.Analysis, error) {
+	magic := make([]byte, 4)
+	read, _ := input.ReadAt(magic, 0)
+	magic = magic[:read]
+
+	var analyze func(io.ReaderAt, int64, *drweb.Analysis) error
+	analysis := &drweb.Analysis{
+		Sections:   []*drweb.AnalysisSection{},
+		Libraries:  []string{},
+		Imports:    []*drweb.AnalysisImport{},
+		Exports:    []string{},
+		AnalyzedAt: time.Now().UTC(),
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, []byte("MZ")):
+		analysis.Format, analyze = "pe", analyzePE
+	case bytes.Equal(magic, []byte("\x7fELF")):
+		analysis.Format, analyze = "elf", analyzeELF
+	case isMachO(magic):
+		analysis.Format, analyze = "macho", analyzeMachO
+	case bytes.Equal(magic, []byte{0xca, 0xfe, 0xba, 0xbe}):
+		// NOTE: java class files share magic with fat mach-o binaries
+		if !isFatMachO(input) {
+			return nil, ErrNotExecutable
+		}
+		analysis.Format, analyze = "macho", analyzeFatMachO
+	default:
+		return nil, ErrNotExecutable
+	}
+
+	if err := safely(func() error { return analyze(input, size, analysis) }); err != nil {
+		analysis.Error = err.Error()
+	}
+
+	return analysis, nil
+}
+
+// safely turns panics into errors. debug/* packages are meant for
+// binaries produced by a toolchain, uploads are anything but.
+func safely(fn func() error) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("%s%v", recoveredPrefix, recovered)
+		}
+	}()
+
+	return fn()
+}
+
+func cString(data []byte) string {
+	if end := bytes.IndexByte(data, 0); end >= 0 {
+		return string(data[:end])
+	}
+	return string(data)
+}
@@ -0,0 +1,126 @@
+package executables_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+	"github.com/twonegatives/drweb_challenge/pkg/executables"
+)
+
+func analyzeFixture(t *testing.T, name string) *drweb.Analysis {
+	contents, err := ioutil.ReadFile("../testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	analysis, err := executables.Analyze(bytes.NewReader(contents), int64(len(contents)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Empty(t, analysis.Error)
+	return analysis
+}
+
+func sectionNames(analysis *drweb.Analysis) []string {
+	names := []string{}
+	for _, section := range analysis.Sections {
+		names = append(names, section.Name)
+	}
+	return names
+}
+
+func TestAnalyzePE(t *testing.T) {
+	analysis := analyzeFixture(t, "hello.dll")
+
+	assert.Equal(t, "pe", analysis.Format)
+	assert.Equal(t, "amd64", analysis.Architecture)
+	assert.Equal(t, uint64(0x180001000), analysis.EntryPoint)
+	assert.Equal(t, "2018-05-19T10:44:16Z", analysis.CompiledAt.Format("2006-01-02T15:04:05Z07:00"))
+	assert.Equal(t, []string{".text", ".rdata"}, sectionNames(analysis))
+	assert.Equal(t, []string{"KERNEL32.dll", "user32.dll"}, analysis.Libraries)
+	assert.Equal(t, []*drweb.AnalysisImport{
+		{Library: "KERNEL32.dll", Symbol: "ExitProcess"},
+		{Library: "KERNEL32.dll", Symbol: "GetProcAddress"},
+		{Library: "user32.dll", Symbol: "MessageBoxA"},
+	}, analysis.Imports)
+	assert.Equal(t, []string{"goodbye", "hello"}, analysis.Exports)
+	// NOTE: md5 of "kernel32.exitprocess,kernel32.getprocaddress,user32.messageboxa"
+	assert.Equal(t, "56f3c475ff77d7015b2825c8af009c24", analysis.Imphash)
+	assert.True(t, analysis.Signed)
+}
+
+func TestAnalyzeELF(t *testing.T) {
+	analysis := analyzeFixture(t, "hello.elf")
+
+	assert.Equal(t, "elf", analysis.Format)
+	assert.Equal(t, "amd64", analysis.Architecture)
+	assert.Nil(t, analysis.CompiledAt)
+	assert.Contains(t, sectionNames(analysis), ".text")
+	assert.Equal(t, []string{"libc.so.6"}, analysis.Libraries)
+	assert.Equal(t, []*drweb.AnalysisImport{{Library: "libc.so.6", Symbol: "puts"}}, analysis.Imports)
+	assert.Equal(t, []string{"hello"}, analysis.Exports)
+	assert.Empty(t, analysis.Imphash)
+	assert.False(t, analysis.Signed)
+}
+
+func TestAnalyzeMachO(t *testing.T) {
+	analysis := analyzeFixture(t, "hello.macho")
+
+	assert.Equal(t, "macho", analysis.Format)
+	assert.Equal(t, "amd64", analysis.Architecture)
+	assert.Equal(t, uint64(0x100000400), analysis.EntryPoint)
+	assert.Nil(t, analysis.CompiledAt)
+	assert.Equal(t, []string{"__TEXT,__text"}, sectionNames(analysis))
+	assert.Equal(t, []string{"/usr/lib/libSystem.B.dylib"}, analysis.Libraries)
+	assert.Equal(t, []*drweb.AnalysisImport{{Library: "/usr/lib/libSystem.B.dylib", Symbol: "_puts"}}, analysis.Imports)
+	assert.Equal(t, []string{"_hello"}, analysis.Exports)
+	assert.False(t, analysis.Signed)
+}
+
+func TestAnalyzeNotExecutable(t *testing.T) {
+	for _, contents := range []string{"", "MZ", "plain text", "\xca\xfe\xba\xbe\x00\x00\x00\x34"} {
+		analysis, err := executables.Analyze(bytes.NewReader([]byte(contents)), int64(len(contents)))
+		if contents == "MZ" {
+			// NOTE: looks like an executable, yet is malformed
+			assert.Nil(t, err)
+			assert.NotEmpty(t, analysis.Error)
+			continue
+		}
+		assert.Equal(t, executables.ErrNotExecutable, err, contents)
+	}
+}
+
+// NOTE: corpus holds malformed executables, each of them
+// should be either reported as malformed or not recognized at all
+func TestAnalyzeCorpus(t *testing.T) {
+	paths, err := filepath.Glob("testdata/corpus/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range paths {
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// NOTE: every prefix of a file is a truncated executable as well
+		for length := 0; length <= len(contents); length += 7 {
+			truncated := contents[:length]
+			analysis, err := executables.Analyze(bytes.NewReader(truncated), int64(len(truncated)))
+			if err != nil {
+				assert.Equal(t, executables.ErrNotExecutable, err, path)
+				continue
+			}
+			assert.NotEmpty(t, analysis.Format, path)
+			// NOTE: a recovered panic is a parser bug, not a malformed input
+			assert.False(t, strings.HasPrefix(analysis.Error, "malformed executable: "), "%s: %s", path, analysis.Error)
+		}
+	}
+}
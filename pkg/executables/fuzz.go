@@ -0,0 +1,32 @@
+//go:build gofuzz
+// +build gofuzz
+
+package executables
+
+import (
+	"bytes"
+	"strings"
+)
+
+// Fuzz is an entry point for go-fuzz, testdata/corpus holds its seeds:
+//
+//	go-fuzz-build github.com/twonegatives/drweb_challenge/pkg/executables
+//	go-fuzz -bin=executables-fuzz.zip -workdir=testdata
+//
+// NOTE: panics are recovered by Analyze, so they are raised once again
+// for the fuzzer to notice them.
+func Fuzz(data []byte) int {
+	analysis, err := Analyze(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return 0
+	}
+
+	if strings.HasPrefix(analysis.Error, recoveredPrefix) {
+		panic(analysis.Error)
+	}
+
+	if analysis.Error != "" {
+		return 0
+	}
+	return 1
+}
@@ -0,0 +1,170 @@
+package executables
+
+import (
+	"debug/macho"
+	"encoding/binary"
+	"io"
+	"strings"
+
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+)
+
+const (
+	machoMain          = 0x80000028
+	machoCodeSignature = 0x1d
+	machoExternal      = 0x01
+	machoTypeMask      = 0x0e
+	machoDefined       = 0x0e
+)
+
+var machoArchitectures = map[macho.Cpu]string{
+	macho.Cpu386:              "386",
+	macho.CpuAmd64:            "amd64",
+	macho.CpuArm:              "arm",
+	macho.CpuArm | 0x01000000: "arm64",
+	macho.CpuPpc:              "ppc",
+	macho.CpuPpc64:            "ppc64",
+}
+
+func isMachO(magic []byte) bool {
+	if len(magic) < 4 {
+		return false
+	}
+
+	for _, order := range []binary.ByteOrder{binary.BigEndian, binary.LittleEndian} {
+		switch order.Uint32(magic) {
+		case macho.Magic32, macho.Magic64:
+			return true
+		}
+	}
+	return false
+}
+
+func isFatMachO(input io.ReaderAt) bool {
+	fat, err := macho.NewFatFile(input)
+	if err != nil {
+		return false
+	}
+	fat.Close()
+	return true
+}
+
+// NOTE: Mach-O has no compile timestamp, CompiledAt is left blank.
+func analyzeMachO(input io.ReaderAt, size int64, analysis *drweb.Analysis) error {
+	file, err := macho.NewFile(input)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return describeMachO(file, analysis)
+}
+
+// analyzeFatMachO describes the first architecture of a universal binary,
+// all of them are listed in Architecture.
+func analyzeFatMachO(input io.ReaderAt, size int64, analysis *drweb.Analysis) error {
+	fat, err := macho.NewFatFile(input)
+	if err != nil {
+		return err
+	}
+	defer fat.Close()
+
+	architectures := []string{}
+	for _, arch := range fat.Arches {
+		architectures = append(architectures, machoArchitecture(arch.Cpu))
+	}
+
+	if len(fat.Arches) == 0 {
+		return nil
+	}
+
+	err = describeMachO(fat.Arches[0].File, analysis)
+	analysis.Architecture = strings.Join(architectures, ",")
+	return err
+}
+
+func machoArchitecture(cpu macho.Cpu) string {
+	if name, ok := machoArchitectures[cpu]; ok {
+		return name
+	}
+	return strings.ToLower(strings.TrimPrefix(cpu.String(), "Cpu"))
+}
+
+func describeMachO(file *macho.File, analysis *drweb.Analysis) error {
+	analysis.Architecture = machoArchitecture(file.Cpu)
+
+	var textAddress uint64
+	for _, load := range file.Loads {
+		if segment, ok := load.(*macho.Segment); ok && segment.Name == "__TEXT" {
+			textAddress = segment.Addr
+		}
+	}
+
+	// NOTE: debug/macho does not parse LC_MAIN and LC_CODE_SIGNATURE,
+	// both are read out of raw load commands
+	for _, load := range file.Loads {
+		raw := load.Raw()
+		if len(raw) < 8 {
+			continue
+		}
+
+		switch file.ByteOrder.Uint32(raw) {
+		case machoMain:
+			if len(raw) >= 16 {
+				analysis.EntryPoint = textAddress + file.ByteOrder.Uint64(raw[8:16])
+			}
+		case machoCodeSignature:
+			analysis.Signed = true
+		}
+	}
+
+	for _, section := range file.Sections {
+		if len(analysis.Sections) == maxListed {
+			break
+		}
+		analysis.Sections = append(analysis.Sections, &drweb.AnalysisSection{
+			Name:    section.Seg + "," + section.Name,
+			Address: section.Addr,
+			Size:    section.Size,
+		})
+	}
+
+	libraries, err := file.ImportedLibraries()
+	if err != nil {
+		return err
+	}
+	analysis.Libraries = append(analysis.Libraries, libraries...)
+
+	if file.Symtab == nil {
+		return nil
+	}
+
+	// NOTE: with two-level namespace high byte of n_desc
+	// tells which of the libraries a symbol is imported from
+	if file.Dysymtab != nil {
+		first, count := file.Dysymtab.Iundefsym, file.Dysymtab.Nundefsym
+		for i := first; i-first < count && int(i) < len(file.Symtab.Syms); i++ {
+			if len(analysis.Imports) == maxListed {
+				break
+			}
+
+			symbol := file.Symtab.Syms[i]
+			imported := &drweb.AnalysisImport{Symbol: symbol.Name}
+			if ordinal := int(symbol.Desc >> 8); ordinal > 0 && ordinal <= len(libraries) {
+				imported.Library = libraries[ordinal-1]
+			}
+			analysis.Imports = append(analysis.Imports, imported)
+		}
+	}
+
+	for _, symbol := range file.Symtab.Syms {
+		if len(analysis.Exports) == maxListed {
+			break
+		}
+		if symbol.Type&machoExternal != 0 && symbol.Type&machoTypeMask == machoDefined && symbol.Sect != 0 {
+			analysis.Exports = append(analysis.Exports, symbol.Name)
+		}
+	}
+
+	return nil
+}
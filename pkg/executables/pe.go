@@ -0,0 +1,180 @@
+package executables
+
+import (
+	"crypto/md5"
+	"debug/pe"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+)
+
+const (
+	peExportDirectory   = 0
+	peSecurityDirectory = 4
+)
+
+var peArchitectures = map[uint16]string{
+	0x014c: "386",
+	0x8664: "amd64",
+	0x01c0: "arm",
+	0x01c4: "arm",
+	0xaa64: "arm64",
+}
+
+func analyzePE(input io.ReaderAt, size int64, analysis *drweb.Analysis) error {
+	file, err := pe.NewFile(input)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	analysis.Architecture = peArchitectures[file.Machine]
+	if analysis.Architecture == "" {
+		analysis.Architecture = fmt.Sprintf("0x%04x", file.Machine)
+	}
+	if file.TimeDateStamp != 0 {
+		compiledAt := time.Unix(int64(file.TimeDateStamp), 0).UTC()
+		analysis.CompiledAt = &compiledAt
+	}
+
+	var imageBase uint64
+	switch header := file.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		imageBase = uint64(header.ImageBase)
+		analysis.EntryPoint = imageBase + uint64(header.AddressOfEntryPoint)
+	case *pe.OptionalHeader64:
+		imageBase = header.ImageBase
+		analysis.EntryPoint = imageBase + uint64(header.AddressOfEntryPoint)
+	}
+
+	for _, section := range file.Sections {
+		if len(analysis.Sections) == maxListed {
+			break
+		}
+		analysis.Sections = append(analysis.Sections, &drweb.AnalysisSection{
+			Name:    section.Name,
+			Address: imageBase + uint64(section.VirtualAddress),
+			Size:    uint64(section.VirtualSize),
+		})
+	}
+
+	// NOTE: certificate table address is a file offset, not an RVA
+	if security, ok := dataDirectory(file, peSecurityDirectory); ok && security.Size > 0 {
+		analysis.Signed = int64(security.VirtualAddress)+int64(security.Size) <= size
+	}
+
+	symbols, err := file.ImportedSymbols()
+	if err != nil {
+		return err
+	}
+
+	// NOTE: debug/pe does not list libraries, they are collected out of imports
+	libraries := map[string]bool{}
+	normalized := []string{}
+	for _, symbol := range symbols {
+		if len(analysis.Imports) == maxListed {
+			break
+		}
+
+		// NOTE: debug/pe reports imports as "function:library"
+		parts := strings.SplitN(symbol, ":", 2)
+		imported := &drweb.AnalysisImport{Symbol: parts[0]}
+		if len(parts) == 2 {
+			imported.Library = parts[1]
+		}
+
+		if !libraries[imported.Library] {
+			libraries[imported.Library] = true
+			analysis.Libraries = append(analysis.Libraries, imported.Library)
+		}
+
+		analysis.Imports = append(analysis.Imports, imported)
+		normalized = append(normalized, imphashEntry(imported))
+	}
+
+	if len(normalized) > 0 {
+		sum := md5.Sum([]byte(strings.Join(normalized, ",")))
+		analysis.Imphash = hex.EncodeToString(sum[:])
+	}
+
+	analysis.Exports = append(analysis.Exports, peExports(file, size)...)
+	return nil
+}
+
+// imphashEntry follows pefile: lowercase "library.function", where
+// library has its dll, ocx or sys extension stripped.
+func imphashEntry(imported *drweb.AnalysisImport) string {
+	library := strings.ToLower(imported.Library)
+	for _, extension := range []string{".dll", ".ocx", ".sys"} {
+		library = strings.TrimSuffix(library, extension)
+	}
+	return fmt.Sprintf("%s.%s", library, strings.ToLower(imported.Symbol))
+}
+
+func dataDirectory(file *pe.File, index int) (pe.DataDirectory, bool) {
+	switch header := file.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		if uint32(index) < header.NumberOfRvaAndSizes && index < len(header.DataDirectory) {
+			return header.DataDirectory[index], true
+		}
+	case *pe.OptionalHeader64:
+		if uint32(index) < header.NumberOfRvaAndSizes && index < len(header.DataDirectory) {
+			return header.DataDirectory[index], true
+		}
+	}
+	return pe.DataDirectory{}, false
+}
+
+// peData returns contents of the section holding given RVA, starting from it.
+func peData(file *pe.File, size int64, rva uint32) []byte {
+	for _, section := range file.Sections {
+		if rva < section.VirtualAddress || rva-section.VirtualAddress >= section.Size {
+			continue
+		}
+
+		if int64(section.Offset)+int64(section.Size) > size {
+			return nil
+		}
+
+		data, err := section.Data()
+		if err != nil {
+			return nil
+		}
+		return data[rva-section.VirtualAddress:]
+	}
+	return nil
+}
+
+// NOTE: debug/pe knows nothing about exports, so we read export directory
+// ourselves: names are RVAs listed in AddressOfNames.
+func peExports(file *pe.File, size int64) []string {
+	exports := []string{}
+
+	directory, ok := dataDirectory(file, peExportDirectory)
+	if !ok || directory.Size == 0 {
+		return exports
+	}
+
+	header := peData(file, size, directory.VirtualAddress)
+	if len(header) < 40 {
+		return exports
+	}
+
+	count := binary.LittleEndian.Uint32(header[24:28])
+	names := peData(file, size, binary.LittleEndian.Uint32(header[32:36]))
+
+	for i := uint32(0); i < count && i < maxListed && int(i*4+4) <= len(names); i++ {
+		name := peData(file, size, binary.LittleEndian.Uint32(names[i*4:]))
+		if name == nil {
+			continue
+		}
+		exports = append(exports, cString(name))
+	}
+
+	return exports
+}
@@ -0,0 +1,123 @@
+package fulltext
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// MaxTextSize bounds text extracted out of a single file,
+// the rest of a huge log is not worth keeping in the index.
+const MaxTextSize = 1 << 20
+
+// minStringLength is a bit longer than strings(1) default of 4,
+// shorter runs of printable bytes are mostly noise in binaries.
+const minStringLength = 6
+
+// Extract takes text-like files as they are, while binaries
+// are reduced to printable strings, both ASCII and UTF-16LE ones.
+func Extract(body io.Reader) (string, error) {
+	reader := bufio.NewReaderSize(body, 4096)
+	head, err := reader.Peek(512)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return "", err
+	}
+
+	if isText(head) {
+		// NOTE: converting to runes replaces invalid UTF-8 with U+FFFD
+		contents, err := readText(reader)
+		return string([]rune(contents)), err
+	}
+
+	return readStrings(reader)
+}
+
+// isText follows http.DetectContentType, which takes anything
+// with no binary bytes in its head for text.
+func isText(head []byte) bool {
+	return strings.HasPrefix(http.DetectContentType(head), "text/")
+}
+
+func readText(reader io.Reader) (string, error) {
+	var text bytes.Buffer
+	_, err := io.Copy(&text, io.LimitReader(reader, MaxTextSize))
+	return text.String(), err
+}
+
+// stringsWriter collects printable runs of both encodings in a single pass.
+type stringsWriter struct {
+	text      bytes.Buffer
+	ascii     []byte
+	wide      []byte
+	wideOdd   bool
+	truncated bool
+}
+
+func printable(c byte) bool {
+	return c >= 0x20 && c < 0x7f || c == '\t'
+}
+
+func (s *stringsWriter) emit(run []byte) {
+	if len(run) < minStringLength || s.truncated {
+		return
+	}
+
+	if s.text.Len()+len(run)+1 > MaxTextSize {
+		s.truncated = true
+		return
+	}
+
+	s.text.Write(run)
+	s.text.WriteByte('\n')
+}
+
+func (s *stringsWriter) step(c byte) {
+	if printable(c) {
+		s.ascii = append(s.ascii, c)
+	} else {
+		s.emit(s.ascii)
+		s.ascii = s.ascii[:0]
+	}
+
+	// NOTE: UTF-16LE runs are printable bytes interleaved with zeros
+	switch {
+	case s.wideOdd && c == 0:
+		s.wideOdd = false
+	case !s.wideOdd && printable(c):
+		s.wide = append(s.wide, c)
+		s.wideOdd = true
+	default:
+		s.emit(s.wide)
+		s.wide = s.wide[:0]
+		s.wideOdd = false
+		if printable(c) {
+			s.wide = append(s.wide, c)
+			s.wideOdd = true
+		}
+	}
+}
+
+func readStrings(reader io.Reader) (string, error) {
+	s := &stringsWriter{}
+	buffer := make([]byte, 32<<10)
+
+	for !s.truncated {
+		n, err := reader.Read(buffer)
+		for _, c := range buffer[:n] {
+			s.step(c)
+		}
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	s.emit(s.ascii)
+	s.emit(s.wide)
+	return s.text.String(), nil
+}
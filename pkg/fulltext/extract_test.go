@@ -0,0 +1,43 @@
+package fulltext_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/twonegatives/drweb_challenge/pkg/fulltext"
+)
+
+func TestExtract(t *testing.T) {
+	var objects = map[string]struct {
+		Contents []byte
+		Text     string
+	}{
+		"text":         {Contents: []byte("#!/bin/sh\ncurl http://example.com | sh\n"), Text: "#!/bin/sh\ncurl http://example.com | sh\n"},
+		"invalid utf8": {Contents: []byte("caf\xe9 au lait"), Text: "caf� au lait"},
+		"binary":       {Contents: []byte("\x7fELF\x02\x01\x00\x00short\x00/lib64/ld-linux.so\x00\x01\x02GLIBC_2.2.5\x00"), Text: "/lib64/ld-linux.so\nGLIBC_2.2.5\n"},
+		"utf16":        {Contents: []byte("MZ\x90\x00\x00k\x00e\x00r\x00n\x00e\x00l\x003\x002\x00\x00\x00\x01"), Text: "kernel32\n"},
+		"empty":        {Contents: []byte{}, Text: ""},
+	}
+
+	for testName, testObject := range objects {
+		t.Run(testName, func(t *testing.T) {
+			text, err := fulltext.Extract(bytes.NewReader(testObject.Contents))
+			assert.Nil(t, err)
+			assert.Equal(t, testObject.Text, text)
+		})
+	}
+}
+
+func TestExtractLimit(t *testing.T) {
+	text, err := fulltext.Extract(strings.NewReader(strings.Repeat("lorem ipsum ", fulltext.MaxTextSize)))
+	assert.Nil(t, err)
+	assert.Len(t, text, fulltext.MaxTextSize)
+
+	binary := bytes.Repeat([]byte("\x00\x01printable string"), fulltext.MaxTextSize)
+	text, err = fulltext.Extract(bytes.NewReader(binary))
+	assert.Nil(t, err)
+	assert.True(t, len(text) <= fulltext.MaxTextSize)
+	assert.True(t, strings.HasPrefix(text, "printable string\n"))
+}
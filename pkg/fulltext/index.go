@@ -0,0 +1,311 @@
+package fulltext
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+)
+
+const textExt = ".text"
+
+// terms longer than that are mostly encoded blobs nobody searches for
+const (
+	minTermLength = 2
+	maxTermLength = 64
+)
+
+// BM25 parameters, the usual ones
+const (
+	k1 = 1.2
+	b  = 0.75
+)
+
+// Index is an inverted index of extracted texts. Texts are kept on disk
+// (for snippets and for rebuilding the index on start), postings in memory.
+type Index struct {
+	BasePath          string
+	FileMode          os.FileMode
+	FilePathGenerator drweb.FilePathGenerator
+	mutex             sync.RWMutex
+	ids               map[string]uint32
+	documents         []*document
+	postings          map[string]map[uint32]uint32
+	totalLength       int64
+}
+
+type document struct {
+	filename string
+	length   int
+	terms    []string
+}
+
+func (i *Index) filepath(filename string) (string, error) {
+	path, err := i.FilePathGenerator.Generate(filename)
+	return path + textExt, err
+}
+
+// tokenize calls fn with lowercased words of text and their byte offsets.
+func tokenize(text string, fn func(term string, start int, end int)) {
+	start := -1
+	flush := func(end int) {
+		if start < 0 {
+			return
+		}
+		if length := len([]rune(text[start:end])); length >= minTermLength && length <= maxTermLength {
+			fn(strings.ToLower(text[start:end]), start, end)
+		}
+		start = -1
+	}
+
+	for offset, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' {
+			if start < 0 {
+				start = offset
+			}
+			continue
+		}
+		flush(offset)
+	}
+	flush(len(text))
+}
+
+// Load indexes every text kept on disk.
+func (i *Index) Load() error {
+	err := filepath.Walk(i.BasePath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if path == i.BasePath && os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+
+		if info.IsDir() || !strings.HasSuffix(path, textExt) {
+			return nil
+		}
+
+		text, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		i.mutex.Lock()
+		i.add(strings.TrimSuffix(filepath.Base(path), textExt), string(text))
+		i.mutex.Unlock()
+		return nil
+	})
+
+	if err != nil {
+		return errors.Wrap(err, "failed to load full-text index")
+	}
+
+	log.WithField("files", len(i.ids)).Info("full-text index loaded")
+	return nil
+}
+
+// Add keeps text of the file and indexes it, replacing whatever was indexed before.
+func (i *Index) Add(filename string, text string) error {
+	path, err := i.filepath(filename)
+	if err != nil {
+		return errors.Wrap(err, "failed to generate filepath")
+	}
+
+	if err = os.MkdirAll(filepath.Dir(path), i.FileMode); err != nil {
+		return errors.Wrap(err, "failed to create nested folders")
+	}
+
+	tmpPath := path + ".tmp"
+	if err = ioutil.WriteFile(tmpPath, []byte(text), i.FileMode); err != nil {
+		return errors.Wrap(err, "failed to write text")
+	}
+
+	if err = os.Rename(tmpPath, path); err != nil {
+		return errors.Wrap(err, "failed to write text")
+	}
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.add(filename, text)
+	return nil
+}
+
+func (i *Index) add(filename string, text string) {
+	if i.ids == nil {
+		i.ids = map[string]uint32{}
+		i.postings = map[string]map[uint32]uint32{}
+	}
+
+	if _, ok := i.ids[filename]; ok {
+		i.remove(filename)
+	}
+
+	id := uint32(len(i.documents))
+	doc := &document{filename: filename}
+	i.ids[filename] = id
+	i.documents = append(i.documents, doc)
+
+	tokenize(text, func(term string, start int, end int) {
+		doc.length++
+
+		posting, ok := i.postings[term]
+		if !ok {
+			posting = map[uint32]uint32{}
+			i.postings[term] = posting
+		}
+
+		if posting[id] == 0 {
+			doc.terms = append(doc.terms, term)
+		}
+		posting[id]++
+	})
+
+	i.totalLength += int64(doc.length)
+}
+
+// Remove drops the file out of the index along with its text.
+func (i *Index) Remove(filename string) error {
+	i.mutex.Lock()
+	i.remove(filename)
+	i.mutex.Unlock()
+
+	path, err := i.filepath(filename)
+	if err != nil {
+		return errors.Wrap(err, "failed to generate filepath")
+	}
+
+	return os.Remove(path)
+}
+
+// NOTE: ids are never reused, removed documents leave a nil behind
+func (i *Index) remove(filename string) {
+	id, ok := i.ids[filename]
+	if !ok {
+		return
+	}
+
+	doc := i.documents[id]
+	for _, term := range doc.terms {
+		delete(i.postings[term], id)
+		if len(i.postings[term]) == 0 {
+			delete(i.postings, term)
+		}
+	}
+
+	i.totalLength -= int64(doc.length)
+	i.documents[id] = nil
+	delete(i.ids, filename)
+}
+
+// Filenames lists every indexed file.
+func (i *Index) Filenames() []string {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+
+	filenames := make([]string, 0, len(i.ids))
+	for filename := range i.ids {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+	return filenames
+}
+
+func queryTerms(query string) []string {
+	terms := []string{}
+	seen := map[string]bool{}
+
+	tokenize(query, func(term string, start int, end int) {
+		if !seen[term] {
+			seen[term] = true
+			terms = append(terms, term)
+		}
+	})
+
+	return terms
+}
+
+// Search lists up to limit files containing every word of the query,
+// ranked by BM25, along with highlighted snippets of their texts.
+func (i *Index) Search(query string, limit int) ([]*drweb.SearchHit, error) {
+	terms := queryTerms(query)
+	if len(terms) == 0 {
+		return nil, drweb.ErrEmptyQuery
+	}
+
+	hits := i.rank(terms)
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+
+	for _, hit := range hits {
+		path, err := i.filepath(hit.Filename)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to generate filepath")
+		}
+
+		// NOTE: file might be deleted in between, it is just left without snippets then
+		text, err := ioutil.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, errors.Wrap(err, "failed to read text")
+		}
+
+		hit.Snippets = snippets(string(text), terms)
+	}
+
+	return hits, nil
+}
+
+func (i *Index) rank(terms []string) []*drweb.SearchHit {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+
+	hits := []*drweb.SearchHit{}
+	postings := make([]map[uint32]uint32, len(terms))
+	for n, term := range terms {
+		postings[n] = i.postings[term]
+		if len(postings[n]) == 0 {
+			return hits
+		}
+	}
+
+	// NOTE: the rarest term has the least candidates to check others against
+	sort.Slice(postings, func(a, b int) bool { return len(postings[a]) < len(postings[b]) })
+
+	count := float64(len(i.ids))
+	averageLength := float64(i.totalLength) / count
+
+candidates:
+	for id := range postings[0] {
+		doc := i.documents[id]
+		score := 0.0
+
+		for _, posting := range postings {
+			frequency, ok := posting[id]
+			if !ok {
+				continue candidates
+			}
+
+			idf := math.Log(1 + (count-float64(len(posting))+0.5)/(float64(len(posting))+0.5))
+			tf := float64(frequency)
+			score += idf * tf * (k1 + 1) / (tf + k1*(1-b+b*float64(doc.length)/averageLength))
+		}
+
+		hits = append(hits, &drweb.SearchHit{Filename: doc.filename, Score: math.Floor(score*1000+0.5) / 1000})
+	}
+
+	sort.Slice(hits, func(a, b int) bool {
+		if hits[a].Score != hits[b].Score {
+			return hits[a].Score > hits[b].Score
+		}
+		return hits[a].Filename < hits[b].Filename
+	})
+
+	return hits
+}
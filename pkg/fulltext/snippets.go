@@ -0,0 +1,114 @@
+package fulltext
+
+import (
+	"bytes"
+	"html"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	maxSnippets    = 3
+	snippetContext = 60
+)
+
+type match struct {
+	start int
+	end   int
+}
+
+// snippets cuts pieces of text around query terms, terms are wrapped in <mark>
+// and the rest is HTML escaped, so that snippets could be rendered as they are.
+func snippets(text string, terms []string) []string {
+	wanted := map[string]bool{}
+	for _, term := range terms {
+		wanted[term] = true
+	}
+
+	matches := []match{}
+	tokenize(text, func(term string, start int, end int) {
+		if wanted[term] {
+			matches = append(matches, match{start: start, end: end})
+		}
+	})
+
+	result := []string{}
+	covered := 0
+	for n, m := range matches {
+		if len(result) == maxSnippets {
+			break
+		}
+		if m.start < covered {
+			continue
+		}
+
+		start, end := runeStart(text, m.start-snippetContext), runeStart(text, m.end+snippetContext)
+		if start < covered {
+			start = covered
+		}
+
+		result = append(result, highlight(text, start, end, matches[n:]))
+		covered = end
+	}
+
+	return result
+}
+
+// runeStart moves offset back to the beginning of a rune.
+func runeStart(text string, offset int) int {
+	if offset <= 0 {
+		return 0
+	}
+	if offset >= len(text) {
+		return len(text)
+	}
+
+	for offset > 0 && !utf8.RuneStart(text[offset]) {
+		offset--
+	}
+	return offset
+}
+
+func highlight(text string, start int, end int, matches []match) string {
+	var snippet bytes.Buffer
+	if start > 0 {
+		snippet.WriteString("…")
+	}
+
+	position := start
+	for _, m := range matches {
+		if m.end > end {
+			break
+		}
+		snippet.WriteString(plain(text[position:m.start]))
+		snippet.WriteString("<mark>" + html.EscapeString(text[m.start:m.end]) + "</mark>")
+		position = m.end
+	}
+	snippet.WriteString(plain(text[position:end]))
+
+	if end < len(text) {
+		snippet.WriteString("…")
+	}
+	return snippet.String()
+}
+
+// plain escapes text and squeezes line breaks and indentation into single spaces.
+func plain(text string) string {
+	var squeezed bytes.Buffer
+	space := false
+
+	for _, r := range text {
+		if unicode.IsSpace(r) {
+			if !space {
+				squeezed.WriteByte(' ')
+			}
+			space = true
+			continue
+		}
+
+		space = false
+		squeezed.WriteRune(r)
+	}
+
+	return html.EscapeString(squeezed.String())
+}
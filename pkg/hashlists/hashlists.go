@@ -0,0 +1,213 @@
+package hashlists
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+)
+
+// List is a set of sha256 hashes loaded from a local file.
+// Allow lists (NSRL alike) only tag matching files, block lists reject them
+// unless Reject is off, in which case matches are tagged as well.
+type List struct {
+	// NOTE: stays first to keep 64-bit alignment for atomic operations
+	hits     uint64
+	Name     string
+	Kind     string
+	Path     string
+	Format   string
+	Reject   bool
+	mutex    sync.RWMutex
+	hashes   map[string]struct{}
+	modTime  time.Time
+	loadedAt time.Time
+}
+
+// ParseSpec builds a list out of "kind:path" string, where kind is one of
+// allow, block or flag (a block list which tags instead of rejecting).
+func ParseSpec(spec string) (*List, error) {
+	parts := strings.SplitN(spec, ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return nil, fmt.Errorf("hash list should be given as kind:path (given '%s')", spec)
+	}
+
+	list := &List{
+		Name: strings.TrimSuffix(filepath.Base(parts[1]), filepath.Ext(parts[1])),
+		Path: parts[1],
+	}
+
+	switch parts[0] {
+	case "allow":
+		list.Kind = drweb.HashListAllow
+	case "block":
+		list.Kind, list.Reject = drweb.HashListBlock, true
+	case "flag":
+		list.Kind = drweb.HashListBlock
+	default:
+		return nil, fmt.Errorf("unknown hash list kind '%s'", parts[0])
+	}
+
+	return list, nil
+}
+
+// Reload reads the file once again if it was modified since the last load.
+// NOTE: set is swapped as a whole, so lookups never see a partial list.
+func (l *List) Reload() error {
+	stat, err := os.Stat(l.Path)
+	if err != nil {
+		return errors.Wrap(err, "failed to get hash list info")
+	}
+
+	l.mutex.RLock()
+	unchanged := l.hashes != nil && stat.ModTime().Equal(l.modTime)
+	l.mutex.RUnlock()
+
+	if unchanged {
+		return nil
+	}
+
+	file, err := os.Open(l.Path)
+	if err != nil {
+		return errors.Wrap(err, "failed to open hash list")
+	}
+	defer file.Close()
+
+	format := l.Format
+	if format == "" {
+		format = guessFormat(l.Path)
+	}
+
+	hashes, err := parse(file, format)
+	if err != nil {
+		return err
+	}
+
+	l.mutex.Lock()
+	l.hashes = hashes
+	l.modTime = stat.ModTime()
+	l.loadedAt = time.Now().UTC()
+	l.mutex.Unlock()
+
+	log.WithField("list", l.Name).WithField("entries", len(hashes)).Info("hash list loaded")
+	return nil
+}
+
+func (l *List) Contains(hash string) bool {
+	l.mutex.RLock()
+	_, ok := l.hashes[strings.ToLower(hash)]
+	l.mutex.RUnlock()
+
+	if ok {
+		atomic.AddUint64(&l.hits, 1)
+	}
+	return ok
+}
+
+func (l *List) Stats() *drweb.HashListStats {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+
+	return &drweb.HashListStats{
+		List:     l.Name,
+		Kind:     l.Kind,
+		Path:     l.Path,
+		Entries:  len(l.hashes),
+		Hits:     atomic.LoadUint64(&l.hits),
+		LoadedAt: l.loadedAt,
+	}
+}
+
+type Lists struct {
+	Lists []*List
+}
+
+func (c *Lists) Match(filename string) []*drweb.HashListMatch {
+	matches := []*drweb.HashListMatch{}
+
+	for _, list := range c.Lists {
+		if list.Contains(filename) {
+			matches = append(matches, &drweb.HashListMatch{List: list.Name, Kind: list.Kind, Reject: list.Reject})
+		}
+	}
+
+	return matches
+}
+
+func (c *Lists) Stats() []*drweb.HashListStats {
+	stats := []*drweb.HashListStats{}
+	for _, list := range c.Lists {
+		stats = append(stats, list.Stats())
+	}
+	return stats
+}
+
+// Reload reloads every modified list. A broken list keeps its previous contents.
+func (c *Lists) Reload() error {
+	var failed []string
+
+	for _, list := range c.Lists {
+		if err := list.Reload(); err != nil {
+			log.WithError(err).WithField("list", list.Name).Error("failed to reload hash list")
+			failed = append(failed, list.Name)
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to reload hash lists: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// Watch reloads lists as soon as their files are modified.
+func (c *Lists) Watch(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			c.Reload()
+		}
+	}
+}
+
+func (c *Lists) NewInspector() drweb.Inspector {
+	return &inspector{lists: c}
+}
+
+// inspector does not care about contents, hash is all it needs.
+type inspector struct {
+	lists drweb.HashLists
+}
+
+func (i *inspector) Write(p []byte) (int, error) {
+	return ioutil.Discard.Write(p)
+}
+
+func (i *inspector) Inspect(filename string, metadata *drweb.Metadata) error {
+	for _, match := range i.lists.Match(filename) {
+		if match.Reject {
+			return &drweb.RejectionError{
+				Status: http.StatusForbidden,
+				Rule:   fmt.Sprintf("hash list '%s'", match.List),
+				Reason: "file is known to be malicious",
+			}
+		}
+
+		metadata.AddTag(fmt.Sprintf("%slist:%s", match.Kind, match.List))
+	}
+
+	return nil
+}
@@ -0,0 +1,112 @@
+package hashlists_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+	"github.com/twonegatives/drweb_challenge/pkg/hashlists"
+)
+
+const (
+	badHash  = "2f8d2d8dd5ba4f9ca0a0b2a2d0e5d0d7f4f4cbb4c6b3c4d5e6f708192a3b4c5d"
+	goodHash = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+)
+
+func generateLists(t *testing.T) (*hashlists.Lists, string, func()) {
+	base, err := ioutil.TempDir("../../tmp", "hashlists")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = ioutil.WriteFile(path.Join(base, "bad.txt"), []byte(badHash+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(path.Join(base, "nsrl.csv"), []byte("sha256\n"+goodHash+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	block, _ := hashlists.ParseSpec("block:" + path.Join(base, "bad.txt"))
+	allow, _ := hashlists.ParseSpec("allow:" + path.Join(base, "nsrl.csv"))
+	lists := &hashlists.Lists{Lists: []*hashlists.List{block, allow}}
+
+	if err = lists.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	return lists, base, func() { os.RemoveAll(base) }
+}
+
+func TestParseSpec(t *testing.T) {
+	list, err := hashlists.ParseSpec("flag:/etc/drweb/suspicious.json")
+	assert.Nil(t, err)
+	assert.Equal(t, "suspicious", list.Name)
+	assert.Equal(t, drweb.HashListBlock, list.Kind)
+	assert.False(t, list.Reject)
+
+	_, err = hashlists.ParseSpec("/etc/drweb/suspicious.json")
+	assert.NotNil(t, err)
+
+	_, err = hashlists.ParseSpec("maybe:/etc/drweb/suspicious.json")
+	assert.NotNil(t, err)
+}
+
+func TestListsMatch(t *testing.T) {
+	lists, _, cleanup := generateLists(t)
+	defer cleanup()
+
+	assert.Equal(t, []*drweb.HashListMatch{{List: "bad", Kind: drweb.HashListBlock, Reject: true}}, lists.Match(badHash))
+	assert.Equal(t, []*drweb.HashListMatch{{List: "nsrl", Kind: drweb.HashListAllow}}, lists.Match(goodHash))
+	assert.Len(t, lists.Match("unknown"), 0)
+
+	stats := lists.Stats()
+	assert.Equal(t, uint64(1), stats[0].Hits)
+	assert.Equal(t, 1, stats[0].Entries)
+	assert.Equal(t, uint64(1), stats[1].Hits)
+}
+
+func TestListsHotReload(t *testing.T) {
+	lists, base, cleanup := generateLists(t)
+	defer cleanup()
+
+	listPath := path.Join(base, "bad.txt")
+	if err := ioutil.WriteFile(listPath, []byte(goodHash+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(listPath, future, future); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Nil(t, lists.Reload())
+	assert.Len(t, lists.Match(badHash), 0)
+	assert.Len(t, lists.Match(goodHash), 2)
+
+	// NOTE: broken list keeps serving its previous contents
+	os.Remove(listPath)
+	assert.NotNil(t, lists.Reload())
+	assert.Len(t, lists.Match(goodHash), 2)
+}
+
+func TestInspector(t *testing.T) {
+	lists, _, cleanup := generateLists(t)
+	defer cleanup()
+
+	metadata := &drweb.Metadata{}
+	inspector := lists.NewInspector()
+	inspector.Write([]byte("contents"))
+
+	assert.Nil(t, inspector.Inspect(goodHash, metadata))
+	assert.Equal(t, []string{"allowlist:nsrl"}, metadata.Tags)
+
+	err := inspector.Inspect(badHash, metadata)
+	rejection, ok := err.(*drweb.RejectionError)
+	assert.True(t, ok)
+	assert.Equal(t, http.StatusForbidden, rejection.Status)
+	assert.Contains(t, rejection.Error(), "hash list 'bad'")
+}
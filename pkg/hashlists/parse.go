@@ -0,0 +1,148 @@
+package hashlists
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	FormatPlain = "plain"
+	FormatCSV   = "csv"
+	FormatJSON  = "json"
+)
+
+const sha256HexLength = 64
+
+func guessFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return FormatCSV
+	case ".json":
+		return FormatJSON
+	default:
+		return FormatPlain
+	}
+}
+
+// NOTE: lists may carry md5 or sha1 as well (NSRL does), but files
+// are named after their sha256, so anything else is of no use for us.
+func normalize(value string) (string, bool) {
+	hash := strings.ToLower(strings.Trim(strings.TrimSpace(value), `"`))
+	if len(hash) != sha256HexLength {
+		return "", false
+	}
+
+	for _, char := range hash {
+		if !strings.ContainsRune("0123456789abcdef", char) {
+			return "", false
+		}
+	}
+
+	return hash, true
+}
+
+func parse(input io.Reader, format string) (map[string]struct{}, error) {
+	switch format {
+	case FormatPlain:
+		return parsePlain(input)
+	case FormatCSV:
+		return parseCSV(input)
+	case FormatJSON:
+		return parseJSON(input)
+	default:
+		return nil, errors.Errorf("unknown hash list format '%s'", format)
+	}
+}
+
+// parsePlain reads a hash per line, so sha256sum output fits as well.
+func parsePlain(input io.Reader) (map[string]struct{}, error) {
+	hashes := map[string]struct{}{}
+	scanner := bufio.NewScanner(input)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if hash, ok := normalize(strings.Fields(line)[0]); ok {
+			hashes[hash] = struct{}{}
+		}
+	}
+
+	return hashes, errors.Wrap(scanner.Err(), "failed to read plain hash list")
+}
+
+// parseCSV takes the column named sha256 (or sha-256) when there is a header,
+// the first column otherwise.
+func parseCSV(input io.Reader) (map[string]struct{}, error) {
+	hashes := map[string]struct{}{}
+	reader := csv.NewReader(input)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	column := 0
+
+	for line := 0; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read csv hash list")
+		}
+
+		if line == 0 {
+			for i, name := range record {
+				if strings.Replace(strings.ToLower(strings.TrimSpace(name)), "-", "", -1) == "sha256" {
+					column = i
+				}
+			}
+		}
+
+		if column >= len(record) {
+			continue
+		}
+
+		if hash, ok := normalize(record[column]); ok {
+			hashes[hash] = struct{}{}
+		}
+	}
+
+	return hashes, nil
+}
+
+// parseJSON accepts an array of hashes or an array of objects with sha256 key.
+func parseJSON(input io.Reader) (map[string]struct{}, error) {
+	var entries []json.RawMessage
+	hashes := map[string]struct{}{}
+
+	if err := json.NewDecoder(input).Decode(&entries); err != nil {
+		return nil, errors.Wrap(err, "failed to read json hash list")
+	}
+
+	for _, entry := range entries {
+		var value string
+		var object struct {
+			SHA256 string `json:"sha256"`
+		}
+
+		if err := json.Unmarshal(entry, &value); err != nil {
+			if err = json.Unmarshal(entry, &object); err != nil {
+				return nil, errors.Wrap(err, "failed to read json hash list entry")
+			}
+			value = object.SHA256
+		}
+
+		if hash, ok := normalize(value); ok {
+			hashes[hash] = struct{}{}
+		}
+	}
+
+	return hashes, nil
+}
@@ -0,0 +1,75 @@
+package hashlists
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	aliceHash  = "2f8d2d8dd5ba4f9ca0a0b2a2d0e5d0d7f4f4cbb4c6b3c4d5e6f708192a3b4c5d"
+	gopherHash = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+)
+
+type parseCase struct {
+	Format   string
+	Contents string
+	Expected []string
+}
+
+func TestParse(t *testing.T) {
+	var objects = map[string]parseCase{
+		"plain with comments": {
+			Format:   FormatPlain,
+			Contents: "# internal blocklist\n" + strings.ToUpper(aliceHash) + "\n\n" + gopherHash + "  gopher.jpg\nnot-a-hash\n",
+			Expected: []string{aliceHash, gopherHash},
+		},
+		"csv with sha256 column": {
+			Format:   FormatCSV,
+			Contents: "\"SHA-1\",\"SHA-256\",\"FileName\"\n\"da39a3ee5e6b4b0d3255bfef95601890afd80709\",\"" + aliceHash + "\",\"alice.txt\"\n",
+			Expected: []string{aliceHash},
+		},
+		"csv without header": {
+			Format:   FormatCSV,
+			Contents: aliceHash + ",alice.txt\n" + gopherHash + ",gopher.jpg\n",
+			Expected: []string{aliceHash, gopherHash},
+		},
+		"json strings": {
+			Format:   FormatJSON,
+			Contents: `["` + aliceHash + `", "` + gopherHash + `"]`,
+			Expected: []string{aliceHash, gopherHash},
+		},
+		"json objects": {
+			Format:   FormatJSON,
+			Contents: `[{"sha256": "` + aliceHash + `", "name": "alice.txt"}, {"md5": "d41d8cd98f00b204e9800998ecf8427e"}]`,
+			Expected: []string{aliceHash},
+		},
+	}
+
+	for testName, testObject := range objects {
+		t.Run(testName, func(t *testing.T) {
+			hashes, err := parse(strings.NewReader(testObject.Contents), testObject.Format)
+			assert.Nil(t, err)
+			assert.Len(t, hashes, len(testObject.Expected))
+			for _, hash := range testObject.Expected {
+				assert.Contains(t, hashes, hash)
+			}
+		})
+	}
+}
+
+func TestParseFailure(t *testing.T) {
+	_, err := parse(strings.NewReader("{}"), FormatJSON)
+	assert.NotNil(t, err)
+
+	_, err = parse(strings.NewReader(""), "xml")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "unknown hash list format")
+}
+
+func TestGuessFormat(t *testing.T) {
+	assert.Equal(t, FormatCSV, guessFormat("/lists/NSRLFile.CSV"))
+	assert.Equal(t, FormatJSON, guessFormat("/lists/bad.json"))
+	assert.Equal(t, FormatPlain, guessFormat("/lists/bad.sha256"))
+}
@@ -0,0 +1,236 @@
+package imagemeta
+
+import (
+	"encoding/binary"
+	"strings"
+
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+)
+
+const (
+	tagMake             = 0x010f
+	tagModel            = 0x0110
+	tagSoftware         = 0x0131
+	tagDateTime         = 0x0132
+	tagExifIFD          = 0x8769
+	tagGPSIFD           = 0x8825
+	tagDateTimeOriginal = 0x9003
+	tagSerialNumber     = 0xa431
+	tagLensModel        = 0xa434
+
+	tagGPSLatitudeRef  = 0x0001
+	tagGPSLatitude     = 0x0002
+	tagGPSLongitudeRef = 0x0003
+	tagGPSLongitude    = 0x0004
+	tagGPSAltitudeRef  = 0x0005
+	tagGPSAltitude     = 0x0006
+
+	typeASCII    = 2
+	typeRational = 5
+)
+
+// maxEntries bounds IFD entries we look at, malformed files may claim 65535 of them.
+const maxEntries = 1024
+
+type tiff struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+type ifdEntry struct {
+	tag   uint16
+	kind  uint16
+	count uint32
+	value []byte
+}
+
+// parseExif fills image metadata out of TIFF structure EXIF consists of.
+// NOTE: malformed data is not an error, whatever could be read is kept.
+func parseExif(data []byte, image *drweb.ImageMetadata) {
+	if len(data) < 8 {
+		return
+	}
+
+	t := &tiff{data: data}
+	switch string(data[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return
+	}
+
+	var exifOffset, gpsOffset uint32
+	for _, entry := range t.ifd(t.order.Uint32(data[4:8])) {
+		switch entry.tag {
+		case tagMake:
+			image.Make = t.ascii(entry)
+		case tagModel:
+			image.Model = t.ascii(entry)
+		case tagSoftware:
+			image.Software = t.ascii(entry)
+		case tagDateTime:
+			if image.TakenAt == "" {
+				image.TakenAt = t.ascii(entry)
+			}
+		case tagExifIFD:
+			exifOffset = t.long(entry)
+		case tagGPSIFD:
+			gpsOffset = t.long(entry)
+		}
+	}
+
+	if exifOffset > 0 {
+		for _, entry := range t.ifd(exifOffset) {
+			switch entry.tag {
+			case tagDateTimeOriginal:
+				image.TakenAt = t.ascii(entry)
+			case tagSerialNumber:
+				image.Serial = t.ascii(entry)
+			case tagLensModel:
+				image.Lens = t.ascii(entry)
+			}
+		}
+	}
+
+	if gpsOffset > 0 {
+		image.GPS = t.gps(gpsOffset)
+	}
+}
+
+func (t *tiff) ifd(offset uint32) []*ifdEntry {
+	if int64(offset)+2 > int64(len(t.data)) {
+		return nil
+	}
+
+	count := int(t.order.Uint16(t.data[offset:]))
+	if count > maxEntries {
+		count = maxEntries
+	}
+
+	entries := []*ifdEntry{}
+	for i := 0; i < count; i++ {
+		start := int64(offset) + 2 + int64(i)*12
+		if start+12 > int64(len(t.data)) {
+			break
+		}
+
+		raw := t.data[start : start+12]
+		entry := &ifdEntry{tag: t.order.Uint16(raw[0:2]), kind: t.order.Uint16(raw[2:4]), count: t.order.Uint32(raw[4:8])}
+
+		size := int64(entry.count) * int64(typeSize(entry.kind))
+		if size <= 4 {
+			entry.value = raw[8 : 8+size]
+		} else {
+			valueOffset := int64(t.order.Uint32(raw[8:12]))
+			if valueOffset+size > int64(len(t.data)) {
+				continue
+			}
+			entry.value = t.data[valueOffset : valueOffset+size]
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+func typeSize(kind uint16) int {
+	switch kind {
+	case 3, 8:
+		return 2
+	case 4, 9, 11:
+		return 4
+	case 5, 10, 12:
+		return 8
+	}
+	return 1
+}
+
+func (t *tiff) ascii(entry *ifdEntry) string {
+	if entry.kind != typeASCII {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimRight(string(entry.value), "\x00"))
+}
+
+func (t *tiff) long(entry *ifdEntry) uint32 {
+	if len(entry.value) < 4 {
+		return 0
+	}
+	return t.order.Uint32(entry.value)
+}
+
+func (t *tiff) rationals(entry *ifdEntry) []float64 {
+	if entry.kind != typeRational {
+		return nil
+	}
+
+	values := []float64{}
+	for start := 0; start+8 <= len(entry.value); start += 8 {
+		numerator, denominator := t.order.Uint32(entry.value[start:]), t.order.Uint32(entry.value[start+4:])
+		if denominator == 0 {
+			return nil
+		}
+		values = append(values, float64(numerator)/float64(denominator))
+	}
+	return values
+}
+
+// degrees takes degrees, minutes and seconds.
+func degrees(values []float64) (float64, bool) {
+	if len(values) != 3 {
+		return 0, false
+	}
+	return values[0] + values[1]/60 + values[2]/3600, true
+}
+
+func (t *tiff) gps(offset uint32) *drweb.GPSPosition {
+	var latitude, longitude, altitude []float64
+	var latitudeRef, longitudeRef string
+	var altitudeBelow bool
+
+	for _, entry := range t.ifd(offset) {
+		switch entry.tag {
+		case tagGPSLatitudeRef:
+			latitudeRef = t.ascii(entry)
+		case tagGPSLatitude:
+			latitude = t.rationals(entry)
+		case tagGPSLongitudeRef:
+			longitudeRef = t.ascii(entry)
+		case tagGPSLongitude:
+			longitude = t.rationals(entry)
+		case tagGPSAltitudeRef:
+			altitudeBelow = len(entry.value) > 0 && entry.value[0] == 1
+		case tagGPSAltitude:
+			altitude = t.rationals(entry)
+		}
+	}
+
+	position := &drweb.GPSPosition{}
+	var ok bool
+	if position.Latitude, ok = degrees(latitude); !ok {
+		return nil
+	}
+	if position.Longitude, ok = degrees(longitude); !ok {
+		return nil
+	}
+
+	if latitudeRef == "S" {
+		position.Latitude = -position.Latitude
+	}
+	if longitudeRef == "W" {
+		position.Longitude = -position.Longitude
+	}
+
+	if len(altitude) == 1 {
+		value := altitude[0]
+		if altitudeBelow {
+			value = -value
+		}
+		position.Altitude = &value
+	}
+
+	return position
+}
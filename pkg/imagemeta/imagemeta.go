@@ -0,0 +1,134 @@
+package imagemeta
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+)
+
+// maxHeadSize is how much of a file metadata is looked for in. JPEG keeps it
+// ahead of pixels anyway, PNG might have it after them, which is left alone.
+const maxHeadSize = 1 << 20
+
+// NewInspector fits drweb.InspectorFactory.
+func NewInspector() drweb.Inspector {
+	return &inspector{}
+}
+
+type inspector struct {
+	head []byte
+	skip bool
+}
+
+func (i *inspector) Write(p []byte) (int, error) {
+	if i.skip {
+		return len(p), nil
+	}
+
+	if missing := maxHeadSize - len(i.head); missing > 0 {
+		if missing > len(p) {
+			missing = len(p)
+		}
+		i.head = append(i.head, p[:missing]...)
+	}
+
+	// NOTE: anything but images is not buffered any further
+	if len(i.head) >= len(pngMagic) && !bytes.HasPrefix(i.head, jpegMagic) && !bytes.HasPrefix(i.head, pngMagic) {
+		i.head, i.skip = nil, true
+	}
+
+	return len(p), nil
+}
+
+func (i *inspector) Inspect(filename string, metadata *drweb.Metadata) error {
+	if image := Extract(i.head); image != nil {
+		metadata.Image = image
+	}
+	return nil
+}
+
+// Extract reads EXIF and XMP out of JPEG or PNG data, nil means there is none.
+func Extract(data []byte) *drweb.ImageMetadata {
+	image := &drweb.ImageMetadata{XMP: map[string]string{}}
+	found := false
+
+	exif := func(payload []byte) {
+		parseExif(payload, image)
+		found = true
+	}
+
+	xmp := func(payload []byte) {
+		parseXMP(payload, image.XMP)
+		found = true
+	}
+
+	switch {
+	case bytes.HasPrefix(data, jpegMagic):
+		walkJPEG(data[len(jpegMagic):], func(marker byte, payload []byte) {
+			if marker != markerAPP1 {
+				return
+			}
+			switch {
+			case bytes.HasPrefix(payload, exifPrefix):
+				exif(payload[len(exifPrefix):])
+			case bytes.HasPrefix(payload, xmpPrefix):
+				xmp(payload[len(xmpPrefix):])
+			}
+		})
+	case bytes.HasPrefix(data, pngMagic):
+		walkPNG(data[len(pngMagic):], func(kind string, payload []byte) {
+			switch {
+			case kind == "eXIf":
+				exif(payload)
+			case kind == "iTXt" && bytes.HasPrefix(payload, xmpKeyword):
+				// NOTE: keyword is followed by compression flag and method,
+				// language and translated keyword, compressed packets are left alone
+				rest := payload[len(xmpKeyword):]
+				if len(rest) < 2 || rest[0] != 0 {
+					return
+				}
+				if fields := bytes.SplitN(rest[2:], []byte{0}, 3); len(fields) == 3 {
+					xmp(fields[2])
+				}
+			}
+		})
+	}
+
+	if !found {
+		return nil
+	}
+	if len(image.XMP) == 0 {
+		image.XMP = nil
+	}
+	return image
+}
+
+func walkJPEG(data []byte, fn func(marker byte, payload []byte)) {
+	for len(data) >= 4 && data[0] == 0xff {
+		marker := data[1]
+		if marker == markerSOS || marker == markerEOI {
+			return
+		}
+
+		length := int(binary.BigEndian.Uint16(data[2:4]))
+		if length < 2 || 2+length > len(data) {
+			return
+		}
+
+		fn(marker, data[4:2+length])
+		data = data[2+length:]
+	}
+}
+
+func walkPNG(data []byte, fn func(kind string, payload []byte)) {
+	for len(data) >= 12 {
+		length := int64(binary.BigEndian.Uint32(data[0:4]))
+		if 12+length > int64(len(data)) {
+			return
+		}
+
+		fn(string(data[4:8]), data[8:8+length])
+		data = data[12+length:]
+	}
+}
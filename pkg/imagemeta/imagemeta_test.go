@@ -0,0 +1,189 @@
+package imagemeta_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+	"github.com/twonegatives/drweb_challenge/pkg/imagemeta"
+)
+
+type tag struct {
+	id    uint16
+	kind  uint16
+	count uint32
+	value []byte
+}
+
+func ascii(id uint16, value string) tag {
+	return tag{id: id, kind: 2, count: uint32(len(value) + 1), value: append([]byte(value), 0)}
+}
+
+func rationals(id uint16, values ...uint32) tag {
+	raw := []byte{}
+	for _, value := range values {
+		raw = append(raw, byte(value>>24), byte(value>>16), byte(value>>8), byte(value), 0, 0, 0, 1)
+	}
+	return tag{id: id, kind: 5, count: uint32(len(values)), value: raw}
+}
+
+// tiffData lays out big endian IFD0 and GPS IFD, values go right after each IFD.
+func tiffData() []byte {
+	var data bytes.Buffer
+	data.WriteString("MM\x00\x2a")
+	binary.Write(&data, binary.BigEndian, uint32(8))
+
+	writeIFD := func(tags []tag) {
+		start := uint32(data.Len())
+		values := start + 2 + uint32(len(tags))*12 + 4
+		var extra bytes.Buffer
+
+		binary.Write(&data, binary.BigEndian, uint16(len(tags)))
+		for _, t := range tags {
+			binary.Write(&data, binary.BigEndian, t.id)
+			binary.Write(&data, binary.BigEndian, t.kind)
+			binary.Write(&data, binary.BigEndian, t.count)
+			if len(t.value) <= 4 {
+				data.Write(append(t.value, make([]byte, 4-len(t.value))...))
+				continue
+			}
+			binary.Write(&data, binary.BigEndian, values+uint32(extra.Len()))
+			extra.Write(t.value)
+		}
+		binary.Write(&data, binary.BigEndian, uint32(0))
+		data.Write(extra.Bytes())
+	}
+
+	gpsOffset := []byte{0, 0, 0, 0}
+	ifd0 := []tag{ascii(0x010f, "Canon"), ascii(0x0110, "Canon EOS 5D"), {id: 0x8825, kind: 4, count: 1, value: gpsOffset}}
+	// NOTE: GPS IFD follows IFD0 and its values
+	size := 8 + 2 + 3*12 + 4 + 6 + 13
+	binary.BigEndian.PutUint32(gpsOffset, uint32(size))
+	writeIFD(ifd0)
+
+	writeIFD([]tag{
+		ascii(0x0001, "N"), rationals(0x0002, 55, 45, 0),
+		ascii(0x0003, "W"), rationals(0x0004, 37, 36, 36),
+		{id: 0x0005, kind: 1, count: 1, value: []byte{0}}, rationals(0x0006, 150),
+	})
+
+	return data.Bytes()
+}
+
+const xmpPacket = `<?xpacket begin="" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about="" xmlns:xmp="http://ns.adobe.com/xap/1.0/" xmlns:dc="http://purl.org/dc/elements/1.1/" xmp:CreatorTool="GIMP 2.10">
+   <dc:creator><rdf:Seq><rdf:li>alice</rdf:li><rdf:li>bob</rdf:li></rdf:Seq></dc:creator>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>`
+
+func segment(marker byte, payload []byte) []byte {
+	header := []byte{0xff, marker, 0, 0}
+	binary.BigEndian.PutUint16(header[2:], uint16(len(payload)+2))
+	return append(header, payload...)
+}
+
+// photo is gopher.jpg with EXIF and XMP inserted after SOI.
+func photo(t *testing.T) ([]byte, []byte) {
+	gopher, err := ioutil.ReadFile("../testdata/gopher.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contents := append([]byte{}, gopher[:2]...)
+	contents = append(contents, segment(0xe1, append([]byte("Exif\x00\x00"), tiffData()...))...)
+	contents = append(contents, segment(0xe1, append([]byte("http://ns.adobe.com/xap/1.0/\x00"), xmpPacket...))...)
+	contents = append(contents, gopher[2:]...)
+	return contents, gopher
+}
+
+func chunk(kind string, payload []byte) []byte {
+	var data bytes.Buffer
+	binary.Write(&data, binary.BigEndian, uint32(len(payload)))
+	data.WriteString(kind)
+	data.Write(payload)
+	binary.Write(&data, binary.BigEndian, crc32.ChecksumIEEE(append([]byte(kind), payload...)))
+	return data.Bytes()
+}
+
+// screenshot is a PNG with EXIF, XMP and a comment inserted after IHDR.
+func screenshot(t *testing.T) ([]byte, []byte) {
+	var plain bytes.Buffer
+	if err := png.Encode(&plain, image.NewGray(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+
+	// NOTE: signature and IHDR chunk go first
+	head := plain.Bytes()[:8+25]
+	contents := append([]byte{}, head...)
+	contents = append(contents, chunk("eXIf", tiffData())...)
+	contents = append(contents, chunk("iTXt", append([]byte("XML:com.adobe.xmp\x00\x00\x00\x00\x00"), xmpPacket...))...)
+	contents = append(contents, chunk("tEXt", []byte("Comment\x00taken at home"))...)
+	contents = append(contents, plain.Bytes()[len(head):]...)
+	return contents, plain.Bytes()
+}
+
+func TestExtract(t *testing.T) {
+	jpeg, _ := photo(t)
+	png, _ := screenshot(t)
+	altitude := 150.0
+
+	expected := &drweb.ImageMetadata{
+		Make:  "Canon",
+		Model: "Canon EOS 5D",
+		GPS:   &drweb.GPSPosition{Latitude: 55.75, Longitude: -37.61, Altitude: &altitude},
+		XMP:   map[string]string{"xmp:CreatorTool": "GIMP 2.10", "dc:creator": "alice, bob"},
+	}
+
+	for name, contents := range map[string][]byte{"jpeg": jpeg, "png": png} {
+		t.Run(name, func(t *testing.T) {
+			inspector := imagemeta.NewInspector()
+			inspector.Write(contents[:100])
+			inspector.Write(contents[100:])
+
+			metadata := &drweb.Metadata{}
+			assert.Nil(t, inspector.Inspect("abcdef", metadata))
+			assert.Equal(t, expected, metadata.Image)
+		})
+	}
+
+	assert.Nil(t, imagemeta.Extract([]byte("not an image at all")))
+	assert.Nil(t, imagemeta.Extract(segment(0xe1, []byte("Exif\x00\x00MM"))))
+}
+
+func TestStripper(t *testing.T) {
+	jpeg, gopher := photo(t)
+	png, plain := screenshot(t)
+	text := []byte("just some text, nothing to strip")
+
+	var objects = map[string]struct {
+		Contents []byte
+		Stripped []byte
+		Kinds    []string
+	}{
+		"jpeg":      {Contents: jpeg, Stripped: append(gopher[:20:20], gopher[20+2*100:]...), Kinds: []string{"exif", "xmp", "iptc"}},
+		"png":       {Contents: png, Stripped: plain, Kinds: []string{"exif", "xmp", "text"}},
+		"text":      {Contents: text, Stripped: text},
+		"truncated": {Contents: jpeg[:30], Stripped: gopher[:2], Kinds: []string{"exif"}},
+	}
+
+	for testName, testObject := range objects {
+		t.Run(testName, func(t *testing.T) {
+			reader := (&imagemeta.Stripper{}).NewReader(bytes.NewReader(testObject.Contents))
+			stripped, err := ioutil.ReadAll(reader)
+
+			assert.Nil(t, err)
+			assert.Equal(t, testObject.Stripped, stripped)
+			assert.Equal(t, testObject.Kinds, reader.Stripped())
+		})
+	}
+}
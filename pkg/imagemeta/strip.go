@@ -0,0 +1,214 @@
+package imagemeta
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+)
+
+var (
+	jpegMagic    = []byte{0xff, 0xd8}
+	pngMagic     = []byte("\x89PNG\r\n\x1a\n")
+	exifPrefix   = []byte("Exif\x00\x00")
+	xmpPrefix    = []byte("http://ns.adobe.com/xap/1.0/\x00")
+	xmpExtPrefix = []byte("http://ns.adobe.com/xmp/extension/\x00")
+	xmpKeyword   = []byte("XML:com.adobe.xmp\x00")
+)
+
+const (
+	markerSOS  = 0xda
+	markerEOI  = 0xd9
+	markerAPP1 = 0xe1
+	// NOTE: Photoshop resources, IPTC records (captions, authors, locations) live there
+	markerAPP13 = 0xed
+)
+
+// Stripper fits drweb.Stripper.
+type Stripper struct{}
+
+func (s *Stripper) NewReader(body io.Reader) drweb.StrippingReader {
+	return &stripper{input: bufio.NewReaderSize(body, 64<<10)}
+}
+
+// stripper drops EXIF, XMP and IPTC segments of JPEG files and EXIF, XMP and text
+// chunks of PNG files while they are streamed, anything else goes through as is.
+// NOTE: pixel data is never touched, so images are not re-encoded.
+type stripper struct {
+	input    *bufio.Reader
+	next     func() error
+	pending  []byte
+	pass     int64
+	rest     bool
+	done     bool
+	stripped []string
+}
+
+func (s *stripper) Stripped() []string {
+	return s.stripped
+}
+
+func (s *stripper) strip(kind string) {
+	for _, existing := range s.stripped {
+		if existing == kind {
+			return
+		}
+	}
+	s.stripped = append(s.stripped, kind)
+}
+
+func (s *stripper) Read(p []byte) (int, error) {
+	for {
+		if len(s.pending) > 0 {
+			n := copy(p, s.pending)
+			s.pending = s.pending[n:]
+			return n, nil
+		}
+
+		if s.rest {
+			return s.input.Read(p)
+		}
+
+		if s.pass > 0 {
+			if int64(len(p)) > s.pass {
+				p = p[:s.pass]
+			}
+			// NOTE: truncated files are passed as they are, it is not our job to validate them
+			n, err := s.input.Read(p)
+			s.pass -= int64(n)
+			if err == io.EOF {
+				s.pass, s.done, err = 0, true, nil
+			}
+			if n > 0 || err != nil {
+				return n, err
+			}
+			continue
+		}
+
+		if s.done {
+			return 0, io.EOF
+		}
+
+		if err := s.advance(); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// advance sets up what to do with the next segment (chunk).
+func (s *stripper) advance() error {
+	if s.next == nil {
+		magic, _ := s.input.Peek(len(pngMagic))
+		switch {
+		case bytes.HasPrefix(magic, jpegMagic):
+			s.next, s.pass = s.nextJPEG, int64(len(jpegMagic))
+		case bytes.HasPrefix(magic, pngMagic):
+			s.next, s.pass = s.nextPNG, int64(len(pngMagic))
+		default:
+			s.rest = true
+		}
+		return nil
+	}
+
+	return s.next()
+}
+
+// passRest gives up on parsing, whatever follows goes through as is.
+func (s *stripper) passRest() error {
+	s.rest = true
+	return nil
+}
+
+func (s *stripper) nextJPEG() error {
+	header, err := s.input.Peek(4)
+	if err == io.EOF && len(header) == 0 {
+		s.done = true
+		return nil
+	}
+
+	// NOTE: entropy coded data follows SOS, there is nothing but pixels from there
+	if len(header) < 2 || header[0] != 0xff || header[1] == markerSOS || header[1] == markerEOI || len(header) < 4 {
+		return s.passRest()
+	}
+
+	marker := header[1]
+	length := int(binary.BigEndian.Uint16(header[2:4]))
+	if length < 2 {
+		return s.passRest()
+	}
+
+	if marker != markerAPP1 && marker != markerAPP13 {
+		s.pass = int64(2 + length)
+		return nil
+	}
+
+	segment, _ := s.input.Peek(4 + len(xmpExtPrefix))
+	payload := segment[4:]
+	switch {
+	case marker == markerAPP13:
+		s.strip("iptc")
+	case bytes.HasPrefix(payload, exifPrefix):
+		s.strip("exif")
+	case bytes.HasPrefix(payload, xmpPrefix), bytes.HasPrefix(payload, xmpExtPrefix):
+		s.strip("xmp")
+	default:
+		s.strip("app1")
+	}
+
+	return s.discard(int64(2 + length))
+}
+
+func (s *stripper) nextPNG() error {
+	header, err := s.input.Peek(8)
+	if err == io.EOF && len(header) == 0 {
+		s.done = true
+		return nil
+	}
+	if len(header) < 8 {
+		return s.passRest()
+	}
+
+	// NOTE: chunk is its length, type, data and crc
+	length := int64(binary.BigEndian.Uint32(header[0:4])) + 12
+
+	switch string(header[4:8]) {
+	case "eXIf":
+		s.strip("exif")
+	case "iTXt":
+		keyword, _ := s.input.Peek(8 + len(xmpKeyword))
+		if bytes.HasPrefix(keyword[8:], xmpKeyword) {
+			s.strip("xmp")
+		} else {
+			s.strip("text")
+		}
+	case "tEXt", "zTXt":
+		s.strip("text")
+	default:
+		s.pass = length
+		return nil
+	}
+
+	return s.discard(length)
+}
+
+func (s *stripper) discard(n int64) error {
+	for n > 0 {
+		chunk := n
+		if chunk > 1<<30 {
+			chunk = 1 << 30
+		}
+
+		discarded, err := s.input.Discard(int(chunk))
+		n -= int64(discarded)
+		if err == io.EOF {
+			s.done = true
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package imagemeta
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+)
+
+// maxXMPProperties bounds what is kept of a packet, it is meant as a summary.
+const maxXMPProperties = 64
+
+// rdfNamespace attributes are structure, not properties.
+const (
+	rdfNamespace = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	xmlNamespace = "http://www.w3.org/XML/1998/namespace"
+)
+
+var xmpPrefixes = map[string]string{
+	"http://purl.org/dc/elements/1.1/":               "dc",
+	"http://ns.adobe.com/xap/1.0/":                   "xmp",
+	"http://ns.adobe.com/xap/1.0/mm/":                "xmpMM",
+	"http://ns.adobe.com/photoshop/1.0/":             "photoshop",
+	"http://ns.adobe.com/exif/1.0/":                  "exif",
+	"http://ns.adobe.com/tiff/1.0/":                  "tiff",
+	"http://iptc.org/std/Iptc4xmpCore/1.0/xmlns/":    "Iptc4xmpCore",
+	"http://ns.adobe.com/xap/1.0/rights/":            "xmpRights",
+	"http://ns.adobe.com/camera-raw-settings/1.0/":   "crs",
+	"http://ns.adobe.com/lightroom/1.0/":             "lr",
+	"http://cipa.jp/exif/1.0/":                       "exifEX",
+	"http://ns.adobe.com/xmp/1.0/DynamicMedia/":      "xmpDM",
+	"http://ns.google.com/photos/1.0/camera/":        "GCamera",
+	"http://ns.adobe.com/xap/1.0/sType/ResourceRef#": "stRef",
+}
+
+func propertyName(name xml.Name) string {
+	prefix, ok := xmpPrefixes[name.Space]
+	if !ok {
+		prefix = name.Space
+	}
+	return prefix + ":" + name.Local
+}
+
+// parseXMP flattens an XMP packet into "prefix:name" properties: attributes
+// of rdf:Description and text of simple elements, list items are joined.
+// NOTE: malformed packets are not an error, whatever could be read is kept.
+func parseXMP(packet []byte, properties map[string]string) {
+	decoder := xml.NewDecoder(bytes.NewReader(packet))
+	decoder.Strict = false
+
+	var path []xml.Name
+	var text bytes.Buffer
+
+	set := func(name string, value string) {
+		value = strings.TrimSpace(value)
+		if value == "" || len(properties) >= maxXMPProperties && properties[name] == "" {
+			return
+		}
+		if existing := properties[name]; existing != "" {
+			value = existing + ", " + value
+		}
+		properties[name] = value
+	}
+
+	// property is the innermost element which is not rdf structure
+	property := func() string {
+		for i := len(path) - 1; i >= 0; i-- {
+			if path[i].Space != rdfNamespace {
+				return propertyName(path[i])
+			}
+		}
+		return ""
+	}
+
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return
+		}
+
+		switch token := token.(type) {
+		case xml.StartElement:
+			path = append(path, token.Name)
+			text.Reset()
+
+			if token.Name.Space == rdfNamespace && token.Name.Local == "Description" {
+				for _, attr := range token.Attr {
+					if attr.Name.Space == rdfNamespace || attr.Name.Space == xmlNamespace || attr.Name.Space == "xmlns" || attr.Name.Space == "" {
+						continue
+					}
+					set(propertyName(attr.Name), attr.Value)
+				}
+			}
+		case xml.CharData:
+			text.Write(token)
+		case xml.EndElement:
+			if name := property(); name != "" {
+				set(name, text.String())
+			}
+			text.Reset()
+
+			if len(path) > 0 {
+				path = path[:len(path)-1]
+			}
+		}
+	}
+}
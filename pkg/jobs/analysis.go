@@ -0,0 +1,111 @@
+package jobs
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+	"github.com/twonegatives/drweb_challenge/pkg/executables"
+)
+
+// Analysis extracts metadata of stored executables in background,
+// so that uploads never wait for it. Results go to the analysis store,
+// anything which is not an executable is skipped.
+// NOTE: files of storages without random access are read in memory,
+// those larger than MaxBufferSize are skipped instead.
+type Analysis struct {
+	Storage       drweb.Storage
+	Store         drweb.AnalysisStore
+	Workers       int
+	QueueSize     int
+	MaxBufferSize int64
+	once          sync.Once
+	queue         chan string
+}
+
+func (a *Analysis) init() {
+	a.once.Do(func() {
+		a.queue = make(chan string, a.QueueSize)
+	})
+}
+
+// Enqueue never blocks: once the queue is full, file is left unanalysed.
+func (a *Analysis) Enqueue(filename string) {
+	a.init()
+
+	select {
+	case a.queue <- filename:
+	default:
+		log.WithField("hashstring", filename).Warn("analysis queue is full, file is skipped")
+	}
+}
+
+func (a *Analysis) Forget(filename string) error {
+	return a.Store.Delete(filename)
+}
+
+// Run analyses enqueued files with Workers goroutines until stop is closed.
+func (a *Analysis) Run(stop <-chan struct{}) {
+	a.init()
+
+	var wg sync.WaitGroup
+	for i := 0; i < a.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				case filename := <-a.queue:
+					if err := a.Analyze(filename); err != nil {
+						log.WithError(err).WithField("hashstring", filename).Error("failed to analyse file")
+					}
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+// Analyze analyses a single stored file right away.
+func (a *Analysis) Analyze(filename string) error {
+	file, err := a.Storage.Load(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// NOTE: debug/* packages need random access, storages
+	// which can not provide it have the file read in memory
+	input, ok := file.Body.(io.ReaderAt)
+	if !ok {
+		var contents []byte
+		if file.Size <= a.MaxBufferSize {
+			if contents, err = ioutil.ReadAll(io.LimitReader(file.Body, a.MaxBufferSize+1)); err != nil {
+				return errors.Wrap(err, "failed to read file")
+			}
+		}
+		if file.Size > a.MaxBufferSize || int64(len(contents)) > a.MaxBufferSize {
+			log.WithField("hashstring", filename).Warn("file is too large to be read for analysis, file is skipped")
+			return nil
+		}
+		input = bytes.NewReader(contents)
+	}
+
+	analysis, err := executables.Analyze(input, file.Size)
+	if err == executables.ErrNotExecutable {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	analysis.Filename = filename
+	return errors.Wrap(a.Store.Put(analysis), "failed to store analysis")
+}
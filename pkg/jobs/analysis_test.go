@@ -0,0 +1,155 @@
+package jobs_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	pkgerrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+	"github.com/twonegatives/drweb_challenge/pkg/jobs"
+	"github.com/twonegatives/drweb_challenge/pkg/pathgenerators"
+	"github.com/twonegatives/drweb_challenge/pkg/storages"
+	"github.com/twonegatives/drweb_challenge/pkg/testutils"
+)
+
+func generateAnalysis(t *testing.T, files map[string]string) (*jobs.Analysis, func()) {
+	base, err := ioutil.TempDir("../../tmp", "analysis")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pathgen := &pathgenerators.NestedGenerator{BasePath: base, Levels: 1, FolderLength: 2}
+	storage := &storages.FileSystemStorage{BasePath: base, FileMode: 0700, FilePathGenerator: pathgen}
+
+	for name, fixture := range files {
+		contents, err := ioutil.ReadFile(fixture)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		filepath, _ := pathgen.Generate(name)
+		if err = testutils.CreateFile(filepath, contents, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	analysis := &jobs.Analysis{
+		Storage: storage,
+		Store: &storages.FileSystemAnalysisStore{
+			FileMode:          0700,
+			FilePathGenerator: &pathgenerators.NestedGenerator{BasePath: path.Join(base, "analysis"), Levels: 1, FolderLength: 2},
+		},
+		Workers:       2,
+		QueueSize:     10,
+		MaxBufferSize: 1 << 20,
+	}
+
+	return analysis, func() { os.RemoveAll(base) }
+}
+
+func TestAnalysisAnalyze(t *testing.T) {
+	analysis, cleanup := generateAnalysis(t, map[string]string{
+		"aaaa": "../testdata/hello.dll",
+		"bbbb": "../testdata/alice.txt",
+	})
+	defer cleanup()
+
+	assert.Nil(t, analysis.Analyze("aaaa"))
+	result, err := analysis.Store.Get("aaaa")
+	assert.Nil(t, err)
+	assert.Equal(t, "aaaa", result.Filename)
+	assert.Equal(t, "pe", result.Format)
+
+	// NOTE: anything but executables is left alone
+	assert.Nil(t, analysis.Analyze("bbbb"))
+	_, err = analysis.Store.Get("bbbb")
+	assert.True(t, os.IsNotExist(pkgerrors.Cause(err)))
+
+	assert.NotNil(t, analysis.Analyze("cccc"))
+
+	assert.Nil(t, analysis.Forget("aaaa"))
+	_, err = analysis.Store.Get("aaaa")
+	assert.True(t, os.IsNotExist(pkgerrors.Cause(err)))
+}
+
+// streamingStorage gives files without random access, as remote storages do.
+type streamingStorage struct {
+	drweb.Storage
+}
+
+func (s *streamingStorage) Load(filename string) (*drweb.File, error) {
+	file, err := s.Storage.Load(filename)
+	if err != nil {
+		return nil, err
+	}
+	return &drweb.File{Body: ioutil.NopCloser(file.Body), Size: file.Size}, nil
+}
+
+func TestAnalysisAnalyzeStreamed(t *testing.T) {
+	analysis, cleanup := generateAnalysis(t, map[string]string{"aaaa": "../testdata/hello.dll"})
+	defer cleanup()
+	analysis.Storage = &streamingStorage{analysis.Storage}
+
+	stat, err := os.Stat("../testdata/hello.dll")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// NOTE: files larger than the buffer are skipped rather than read in memory
+	analysis.MaxBufferSize = stat.Size() - 1
+	assert.Nil(t, analysis.Analyze("aaaa"))
+	_, err = analysis.Store.Get("aaaa")
+	assert.True(t, os.IsNotExist(pkgerrors.Cause(err)))
+
+	analysis.MaxBufferSize = stat.Size()
+	assert.Nil(t, analysis.Analyze("aaaa"))
+	result, err := analysis.Store.Get("aaaa")
+	assert.Nil(t, err)
+	assert.Equal(t, "pe", result.Format)
+}
+
+func TestAnalysisRun(t *testing.T) {
+	analysis, cleanup := generateAnalysis(t, map[string]string{
+		"aaaa": "../testdata/hello.elf",
+		"bbbb": "../testdata/hello.macho",
+	})
+	defer cleanup()
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		analysis.Run(stop)
+		close(done)
+	}()
+
+	analysis.Enqueue("aaaa")
+	analysis.Enqueue("bbbb")
+
+	for _, filename := range []string{"aaaa", "bbbb"} {
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			if _, err := analysis.Store.Get(filename); err == nil || time.Now().After(deadline) {
+				assert.Nil(t, err, filename)
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	close(stop)
+	<-done
+}
+
+func TestAnalysisEnqueueOverflow(t *testing.T) {
+	analysis, cleanup := generateAnalysis(t, nil)
+	defer cleanup()
+
+	// NOTE: nobody runs the queue, yet enqueueing should never block
+	for i := 0; i < analysis.QueueSize*2; i++ {
+		analysis.Enqueue("aaaa")
+	}
+}
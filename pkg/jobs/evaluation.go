@@ -0,0 +1,149 @@
+package jobs
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+	"github.com/twonegatives/drweb_challenge/pkg/rules"
+)
+
+// Evaluation reloads rules and runs them over every stored file,
+// replacing rule tags in file metadata with the fresh matches.
+type Evaluation struct {
+	Storage  drweb.WalkableStorage
+	Metadata drweb.MetadataStore
+	Engine   *rules.Engine
+	mutex    sync.Mutex
+	report   *drweb.RuleEvaluationReport
+}
+
+// Start launches evaluation in background, see Run.
+func (e *Evaluation) Start(actor string) error {
+	report, err := e.begin(actor)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		if err := e.run(report); err != nil {
+			log.WithError(err).Error("rules evaluation failed")
+		}
+	}()
+
+	return nil
+}
+
+// Run evaluates rules over the whole storage and returns a report.
+func (e *Evaluation) Run(actor string) (*drweb.RuleEvaluationReport, error) {
+	report, err := e.begin(actor)
+	if err != nil {
+		return nil, err
+	}
+
+	err = e.run(report)
+	return e.Status(), err
+}
+
+// Status returns a snapshot of the running or the last finished evaluation.
+func (e *Evaluation) Status() *drweb.RuleEvaluationReport {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.report == nil {
+		return nil
+	}
+
+	report := *e.report
+	report.Matches = map[string]int{}
+	for name, count := range e.report.Matches {
+		report.Matches[name] = count
+	}
+	return &report
+}
+
+func (e *Evaluation) begin(actor string) (*drweb.RuleEvaluationReport, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.report != nil && e.report.Running {
+		return nil, drweb.ErrEvaluationRunning
+	}
+
+	if err := e.Engine.Reload(); err != nil {
+		return nil, err
+	}
+
+	e.report = &drweb.RuleEvaluationReport{
+		Actor:     actor,
+		Running:   true,
+		StartedAt: time.Now().UTC(),
+		Rules:     len(e.Engine.Rules()),
+		Matches:   map[string]int{},
+	}
+
+	return e.report, nil
+}
+
+func (e *Evaluation) run(report *drweb.RuleEvaluationReport) error {
+	err := e.Storage.Walk(func(filename string) error {
+		matches, err := e.evaluate(filename)
+
+		e.mutex.Lock()
+		defer e.mutex.Unlock()
+
+		if err != nil {
+			log.WithError(err).WithField("hashstring", filename).Error("failed to evaluate rules")
+			report.Failed++
+			return nil
+		}
+
+		report.Evaluated++
+		for _, name := range matches {
+			report.Matches[name]++
+		}
+		return nil
+	})
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	report.Running = false
+	report.FinishedAt = time.Now().UTC()
+	return errors.Wrap(err, "failed to walk storage")
+}
+
+func (e *Evaluation) evaluate(filename string) ([]string, error) {
+	file, err := e.Storage.Load(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	matches, err := e.Engine.Evaluate(file.Body)
+	file.Close()
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = e.Metadata.Update(filename, func(metadata *drweb.Metadata) error {
+		tags := []string{}
+		for _, tag := range metadata.Tags {
+			if !strings.HasPrefix(tag, rules.TagPrefix) {
+				tags = append(tags, tag)
+			}
+		}
+
+		metadata.Tags = tags
+		for _, name := range matches {
+			metadata.AddTag(fmt.Sprintf("%s%s", rules.TagPrefix, name))
+		}
+		return nil
+	})
+
+	return matches, errors.Wrap(err, "failed to update metadata")
+}
@@ -0,0 +1,103 @@
+package jobs_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+	"github.com/twonegatives/drweb_challenge/pkg/jobs"
+	"github.com/twonegatives/drweb_challenge/pkg/pathgenerators"
+	"github.com/twonegatives/drweb_challenge/pkg/rules"
+	"github.com/twonegatives/drweb_challenge/pkg/storages"
+	"github.com/twonegatives/drweb_challenge/pkg/testutils"
+)
+
+func generateEvaluation(t *testing.T, files map[string]string) (*jobs.Evaluation, func()) {
+	base, err := ioutil.TempDir("../../tmp", "evaluation")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	storage := &storages.FileSystemStorage{
+		BasePath:          path.Join(base, "store"),
+		FileMode:          0700,
+		FilePathGenerator: &pathgenerators.NestedGenerator{BasePath: path.Join(base, "store"), Levels: 1, FolderLength: 2},
+	}
+
+	metadata := &storages.FileSystemMetadataStore{
+		BasePath:          path.Join(base, "metadata"),
+		FileMode:          0700,
+		FilePathGenerator: &pathgenerators.NestedGenerator{BasePath: path.Join(base, "metadata"), Levels: 1, FolderLength: 2},
+	}
+
+	for name, contents := range files {
+		filepath, _ := storage.FilePathGenerator.Generate(name)
+		if err = testutils.CreateFile(filepath, []byte(contents), 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = os.MkdirAll(path.Join(base, "rules"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	evaluation := &jobs.Evaluation{
+		Storage:  storage,
+		Metadata: metadata,
+		Engine:   &rules.Engine{Path: path.Join(base, "rules")},
+	}
+
+	return evaluation, func() { os.RemoveAll(base) }
+}
+
+func TestEvaluationRun(t *testing.T) {
+	evaluation, cleanup := generateEvaluation(t, map[string]string{
+		"aaaa": "MZ with some EVIL inside",
+		"bbbb": "plain text",
+	})
+	defer cleanup()
+
+	source := `rule evil { strings: $a = "evil" nocase condition: $a } rule mz { strings: $a = { 4D 5A } condition: $a at 0 }`
+	if err := ioutil.WriteFile(path.Join(evaluation.Engine.Path, "default.yar"), []byte(source), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// NOTE: stale rule tags go away, other tags stay
+	evaluation.Metadata.Update("bbbb", func(metadata *drweb.Metadata) error {
+		metadata.AddTag("rule:evil")
+		metadata.AddTag("allowlist:nsrl")
+		return nil
+	})
+
+	report, err := evaluation.Run("alice")
+	assert.Nil(t, err)
+	assert.False(t, report.Running)
+	assert.Equal(t, "alice", report.Actor)
+	assert.Equal(t, 2, report.Rules)
+	assert.Equal(t, 2, report.Evaluated)
+	assert.Equal(t, map[string]int{"evil": 1, "mz": 1}, report.Matches)
+
+	evil, err := evaluation.Metadata.Get("aaaa")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"rule:evil", "rule:mz"}, evil.Tags)
+
+	plain, err := evaluation.Metadata.Get("bbbb")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"allowlist:nsrl"}, plain.Tags)
+}
+
+func TestEvaluationBrokenRules(t *testing.T) {
+	evaluation, cleanup := generateEvaluation(t, map[string]string{"aaaa": "contents"})
+	defer cleanup()
+
+	if err := ioutil.WriteFile(path.Join(evaluation.Engine.Path, "broken.yar"), []byte("rule broken {"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := evaluation.Run("alice")
+	assert.NotNil(t, err)
+	assert.Nil(t, evaluation.Status())
+}
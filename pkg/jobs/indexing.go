@@ -0,0 +1,110 @@
+package jobs
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+	"github.com/twonegatives/drweb_challenge/pkg/fulltext"
+)
+
+// Indexing extracts text out of stored files in background
+// and puts it to the full-text index.
+type Indexing struct {
+	Storage   drweb.WalkableStorage
+	Index     *fulltext.Index
+	Workers   int
+	QueueSize int
+	once      sync.Once
+	queue     chan string
+}
+
+func (i *Indexing) init() {
+	i.once.Do(func() {
+		i.queue = make(chan string, i.QueueSize)
+	})
+}
+
+// Enqueue never blocks: once the queue is full, file is left unindexed
+// until the next reindex.
+func (i *Indexing) Enqueue(filename string) {
+	i.init()
+
+	select {
+	case i.queue <- filename:
+	default:
+		log.WithField("hashstring", filename).Warn("indexing queue is full, file is skipped")
+	}
+}
+
+func (i *Indexing) Forget(filename string) error {
+	return i.Index.Remove(filename)
+}
+
+// Run indexes enqueued files with Workers goroutines until stop is closed.
+func (i *Indexing) Run(stop <-chan struct{}) {
+	i.init()
+
+	var wg sync.WaitGroup
+	for n := 0; n < i.Workers; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				case filename := <-i.queue:
+					if err := i.IndexFile(filename); err != nil {
+						log.WithError(err).WithField("hashstring", filename).Error("failed to index file")
+					}
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+// IndexFile indexes a single stored file right away.
+func (i *Indexing) IndexFile(filename string) error {
+	file, err := i.Storage.Load(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	text, err := fulltext.Extract(file.Body)
+	if err != nil {
+		return errors.Wrap(err, "failed to extract text")
+	}
+
+	return errors.Wrap(i.Index.Add(filename, text), "failed to index text")
+}
+
+// Reindex indexes every stored file anew and drops
+// whatever is indexed for files which are gone.
+func (i *Indexing) Reindex() (int, error) {
+	stored := map[string]bool{}
+
+	err := i.Storage.Walk(func(filename string) error {
+		stored[filename] = true
+		return i.IndexFile(filename)
+	})
+	if err != nil {
+		return len(stored), err
+	}
+
+	for _, filename := range i.Index.Filenames() {
+		if stored[filename] {
+			continue
+		}
+
+		if err = i.Index.Remove(filename); err != nil {
+			return len(stored), errors.Wrap(err, "failed to drop stale text")
+		}
+	}
+
+	return len(stored), nil
+}
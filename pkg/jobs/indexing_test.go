@@ -0,0 +1,121 @@
+package jobs_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+	"github.com/twonegatives/drweb_challenge/pkg/fulltext"
+	"github.com/twonegatives/drweb_challenge/pkg/jobs"
+	"github.com/twonegatives/drweb_challenge/pkg/pathgenerators"
+	"github.com/twonegatives/drweb_challenge/pkg/similarity"
+	"github.com/twonegatives/drweb_challenge/pkg/storages"
+	"github.com/twonegatives/drweb_challenge/pkg/testutils"
+)
+
+func TestIndexingReindex(t *testing.T) {
+	base, err := ioutil.TempDir("../../tmp", "indexing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(base)
+
+	pathgen := &pathgenerators.NestedGenerator{BasePath: base + "/files", Levels: 1, FolderLength: 2}
+	searchPathgen := &pathgenerators.NestedGenerator{BasePath: base + "/search", Levels: 1, FolderLength: 2}
+
+	for name, fixture := range map[string]string{"aaaa": "../testdata/alice.txt", "bbbb": "../testdata/hello.dll"} {
+		contents, err := ioutil.ReadFile(fixture)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		filepath, _ := pathgen.Generate(name)
+		if err = testutils.CreateFile(filepath, contents, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	indexing := &jobs.Indexing{
+		Storage: &storages.FileSystemStorage{BasePath: base + "/files", FileMode: 0700, FilePathGenerator: pathgen},
+		Index:   &fulltext.Index{BasePath: base + "/search", FileMode: 0700, FilePathGenerator: searchPathgen},
+	}
+
+	// NOTE: text of a file which is gone by now
+	assert.Nil(t, indexing.Index.Add("cccc", "alice"))
+
+	count, err := indexing.Reindex()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+	assert.Equal(t, []string{"aaaa", "bbbb"}, indexing.Index.Filenames())
+
+	hits, err := indexing.Index.Search("alice", 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(hits))
+	assert.Equal(t, "aaaa", hits[0].Filename)
+
+	// NOTE: strings of the binary get indexed
+	hits, err = indexing.Index.Search("kernel32", 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(hits))
+
+	assert.Nil(t, indexing.Forget("aaaa"))
+	assert.Equal(t, []string{"bbbb"}, indexing.Index.Filenames())
+	assert.NotNil(t, indexing.IndexFile("dddd"))
+}
+
+func TestIndexingQuarantine(t *testing.T) {
+	base, err := ioutil.TempDir("../../tmp", "indexing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(base)
+
+	contents, err := ioutil.ReadFile("../testdata/alice.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pathgen := &pathgenerators.NestedGenerator{BasePath: base + "/files", Levels: 1, FolderLength: 2}
+	filepath, _ := pathgen.Generate("aaaa")
+	if err = testutils.CreateFile(filepath, contents, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	storage := &storages.FileSystemStorage{BasePath: base + "/files", FileMode: 0700, FilePathGenerator: pathgen}
+	indexing := &jobs.Indexing{
+		Storage: storage,
+		Index: &fulltext.Index{
+			BasePath:          base + "/search",
+			FileMode:          0700,
+			FilePathGenerator: &pathgenerators.NestedGenerator{BasePath: base + "/search", Levels: 1, FolderLength: 2},
+		},
+	}
+	similar := &similarity.Index{}
+
+	quarantine := &storages.FileSystemQuarantine{
+		BasePath:          base + "/quarantine",
+		FileMode:          0700,
+		FilePathGenerator: &pathgenerators.NestedGenerator{BasePath: base + "/quarantine", Levels: 1, FolderLength: 2},
+		Storage:           storage,
+		Jobs:              []drweb.PostSaveJob{indexing, similar},
+	}
+
+	hasher := similarity.NewHasher()
+	hasher.Write(contents)
+	assert.Nil(t, similar.Add("aaaa", hasher.Sum()))
+	assert.Nil(t, indexing.IndexFile("aaaa"))
+
+	hits, err := indexing.Index.Search("alice", 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(hits))
+
+	assert.Nil(t, quarantine.Isolate("aaaa", drweb.QuarantineInfected, "alice", "Evil.Generic"))
+
+	hits, err = indexing.Index.Search("alice", 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(hits))
+	_, err = similar.Similar("aaaa", 0, 10)
+	assert.Equal(t, drweb.ErrNotIndexed, err)
+}
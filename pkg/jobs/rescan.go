@@ -0,0 +1,274 @@
+package jobs
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+)
+
+const rescanActor = "rescan"
+
+// Rescan walks the whole storage through the scanner once again,
+// moving newly detected files to quarantine. Progress is checkpointed
+// after every file, so an interrupted rescan resumes where it stopped
+// as long as signatures version stays the same.
+type Rescan struct {
+	Storage        drweb.WalkableStorage
+	Scanner        drweb.Scanner
+	Quarantine     drweb.Quarantine
+	Interval       time.Duration
+	CheckpointPath string
+	mutex          sync.Mutex
+	checkpoint     *rescanCheckpoint
+	running        bool
+}
+
+type rescanCheckpoint struct {
+	Report       *drweb.RescanReport `json:"report"`
+	LastFilename string              `json:"last_hashstring"`
+}
+
+// Start launches rescan in background, see Run.
+func (r *Rescan) Start(actor string) error {
+	checkpoint, err := r.begin(actor)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		if err := r.run(checkpoint); err != nil {
+			log.WithError(err).Error("rescan failed")
+		}
+	}()
+
+	return nil
+}
+
+// Run rescans the storage and returns a report listing files detected this time.
+func (r *Rescan) Run(actor string) (*drweb.RescanReport, error) {
+	checkpoint, err := r.begin(actor)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.run(checkpoint)
+	return r.Status(), err
+}
+
+// Status returns a snapshot of the running or the last finished rescan.
+func (r *Rescan) Status() *drweb.RescanReport {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if err := r.load(); err != nil || r.checkpoint == nil {
+		return nil
+	}
+
+	report := *r.checkpoint.Report
+	report.Detections = append([]*drweb.RescanDetection{}, report.Detections...)
+	return &report
+}
+
+// Watch polls scanner for signatures version and starts rescan once it changes.
+// It also resumes a rescan which was interrupted by restart.
+func (r *Rescan) Watch(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		r.poll()
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Rescan) poll() {
+	version, err := r.Scanner.Version()
+	if err != nil {
+		log.WithError(err).Error("failed to check signatures version")
+		return
+	}
+
+	if last := r.Status(); last != nil && last.SignatureVersion == version && !last.Running && last.Error == "" {
+		return
+	}
+
+	if err = r.Start(rescanActor); err != nil && err != drweb.ErrRescanRunning {
+		log.WithError(err).Error("failed to start rescan")
+	}
+}
+
+func (r *Rescan) begin(actor string) (*rescanCheckpoint, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+
+	if r.running {
+		return nil, drweb.ErrRescanRunning
+	}
+
+	version, err := r.Scanner.Version()
+	if err != nil {
+		return nil, err
+	}
+
+	r.running = true
+
+	// NOTE: checkpoint says Running when previous process got interrupted
+	// and keeps an Error when the walk failed, both resume where they stopped
+	if r.checkpoint != nil && (r.checkpoint.Report.Running || r.checkpoint.Report.Error != "") && r.checkpoint.Report.SignatureVersion == version {
+		r.checkpoint.Report.Running = true
+		r.checkpoint.Report.Error = ""
+		if err = r.save(); err != nil {
+			r.running = false
+			return nil, err
+		}
+		return r.checkpoint, nil
+	}
+
+	r.checkpoint = &rescanCheckpoint{
+		Report: &drweb.RescanReport{
+			SignatureVersion: version,
+			Actor:            actor,
+			Running:          true,
+			StartedAt:        time.Now().UTC(),
+			Detections:       []*drweb.RescanDetection{},
+		},
+	}
+
+	if err = r.save(); err != nil {
+		r.running = false
+		return nil, err
+	}
+
+	return r.checkpoint, nil
+}
+
+func (r *Rescan) run(checkpoint *rescanCheckpoint) error {
+	var throttle <-chan time.Time
+
+	if r.Interval > 0 {
+		ticker := time.NewTicker(r.Interval)
+		defer ticker.Stop()
+		throttle = ticker.C
+	}
+
+	err := r.Storage.Walk(func(filename string) error {
+		if filename <= checkpoint.LastFilename {
+			return nil
+		}
+
+		if throttle != nil {
+			<-throttle
+		}
+
+		detection, err := r.scan(filename)
+
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		checkpoint.LastFilename = filename
+		switch {
+		case err != nil:
+			log.WithError(err).WithField("hashstring", filename).Error("failed to rescan file")
+			checkpoint.Report.Failed++
+		case detection != nil:
+			checkpoint.Report.Detections = append(checkpoint.Report.Detections, detection)
+			fallthrough
+		default:
+			checkpoint.Report.Scanned++
+		}
+
+		return r.save()
+	})
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.running = false
+	checkpoint.Report.Running = false
+	checkpoint.Report.FinishedAt = time.Now().UTC()
+
+	if err != nil {
+		err = errors.Wrap(err, "failed to walk storage")
+		checkpoint.Report.Error = err.Error()
+		if saveErr := r.save(); saveErr != nil {
+			log.WithError(saveErr).Error("failed to save rescan checkpoint")
+		}
+		return err
+	}
+
+	checkpoint.LastFilename = ""
+	return r.save()
+}
+
+func (r *Rescan) scan(filename string) (*drweb.RescanDetection, error) {
+	file, err := r.Storage.Load(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := r.Scanner.Scan(file.Body)
+	file.Close()
+
+	if err != nil || !result.Infected {
+		return nil, err
+	}
+
+	if err = r.Quarantine.Isolate(filename, drweb.QuarantineInfected, rescanActor, result.Threat); err != nil {
+		return nil, errors.Wrap(err, "failed to quarantine detected file")
+	}
+
+	return &drweb.RescanDetection{Filename: filename, Threat: result.Threat}, nil
+}
+
+func (r *Rescan) load() error {
+	if r.checkpoint != nil {
+		return nil
+	}
+
+	contents, err := ioutil.ReadFile(r.CheckpointPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to read rescan checkpoint")
+	}
+
+	var checkpoint rescanCheckpoint
+	if err = json.Unmarshal(contents, &checkpoint); err != nil {
+		return errors.Wrap(err, "failed to decode rescan checkpoint")
+	}
+
+	r.checkpoint = &checkpoint
+	return nil
+}
+
+func (r *Rescan) save() error {
+	contents, err := json.Marshal(r.checkpoint)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode rescan checkpoint")
+	}
+
+	// NOTE: write-then-rename keeps the previous checkpoint intact
+	// if we happen to crash in the middle of writing
+	tmpPath := r.CheckpointPath + ".tmp"
+	if err = ioutil.WriteFile(tmpPath, contents, 0644); err != nil {
+		return errors.Wrap(err, "failed to write rescan checkpoint")
+	}
+
+	return errors.Wrap(os.Rename(tmpPath, r.CheckpointPath), "failed to write rescan checkpoint")
+}
@@ -0,0 +1,202 @@
+package jobs_test
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+	"github.com/twonegatives/drweb_challenge/pkg/jobs"
+	"github.com/twonegatives/drweb_challenge/pkg/pathgenerators"
+	"github.com/twonegatives/drweb_challenge/pkg/storages"
+	"github.com/twonegatives/drweb_challenge/pkg/testutils"
+)
+
+// NOTE: detects anything containing "EVIL" and counts scanned files
+type substringScanner struct {
+	Signatures string
+	Scanned    int
+	mutex      sync.Mutex
+}
+
+func (s *substringScanner) Scan(input io.Reader) (*drweb.ScanResult, error) {
+	contents, err := ioutil.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	s.Scanned++
+	s.mutex.Unlock()
+
+	if strings.Contains(string(contents), "EVIL") {
+		return &drweb.ScanResult{Infected: true, Threat: "Evil.Generic"}, nil
+	}
+	return &drweb.ScanResult{}, nil
+}
+
+func (s *substringScanner) Version() (string, error) {
+	return s.Signatures, nil
+}
+
+func generateRescan(t *testing.T, files map[string]string) (*jobs.Rescan, func()) {
+	base, err := ioutil.TempDir("../../tmp", "rescan")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	storage := &storages.FileSystemStorage{
+		BasePath:          path.Join(base, "store"),
+		FileMode:          0700,
+		FilePathGenerator: &pathgenerators.NestedGenerator{BasePath: path.Join(base, "store"), Levels: 1, FolderLength: 2},
+	}
+
+	quarantine := &storages.FileSystemQuarantine{
+		BasePath:          path.Join(base, "quarantine"),
+		FileMode:          0700,
+		FilePathGenerator: &pathgenerators.NestedGenerator{BasePath: path.Join(base, "quarantine"), Levels: 1, FolderLength: 2},
+		Storage:           storage,
+	}
+
+	for name, contents := range files {
+		filepath, _ := storage.FilePathGenerator.Generate(name)
+		if err = testutils.CreateFile(filepath, []byte(contents), 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rescan := &jobs.Rescan{
+		Storage:        storage,
+		Scanner:        &substringScanner{Signatures: "v1"},
+		Quarantine:     quarantine,
+		CheckpointPath: path.Join(base, "rescan.json"),
+	}
+
+	return rescan, func() { os.RemoveAll(base) }
+}
+
+func TestRescanRun(t *testing.T) {
+	rescan, cleanup := generateRescan(t, map[string]string{
+		"aa01": "clean",
+		"aa02": "EVIL inside",
+		"bb01": "clean as well",
+	})
+	defer cleanup()
+
+	report, err := rescan.Run("alice")
+	assert.Nil(t, err)
+	assert.False(t, report.Running)
+	assert.Equal(t, "v1", report.SignatureVersion)
+	assert.Equal(t, "alice", report.Actor)
+	assert.Equal(t, 3, report.Scanned)
+	assert.Equal(t, []*drweb.RescanDetection{{Filename: "aa02", Threat: "Evil.Generic"}}, report.Detections)
+
+	record, err := rescan.Quarantine.Inspect("aa02")
+	assert.Nil(t, err)
+	assert.Equal(t, "Evil.Generic", record.Reason)
+
+	// NOTE: detected file is gone from storage, so it is not reported twice
+	report, err = rescan.Run("alice")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, report.Scanned)
+	assert.Len(t, report.Detections, 0)
+}
+
+func TestRescanResume(t *testing.T) {
+	rescan, cleanup := generateRescan(t, map[string]string{
+		"aa01": "clean",
+		"bb01": "EVIL",
+		"cc01": "clean",
+	})
+	defer cleanup()
+
+	checkpoint := `{"report": {"signature_version": "v1", "running": true, "scanned": 1, "detections": []}, "last_hashstring": "aa01"}`
+	if err := ioutil.WriteFile(rescan.CheckpointPath, []byte(checkpoint), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := rescan.Run("alice")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, report.Scanned)
+	assert.Equal(t, 2, rescan.Scanner.(*substringScanner).Scanned)
+	assert.Len(t, report.Detections, 1)
+}
+
+func TestRescanRestartsOnNewSignatures(t *testing.T) {
+	rescan, cleanup := generateRescan(t, map[string]string{
+		"aa01": "clean",
+		"bb01": "clean",
+	})
+	defer cleanup()
+
+	checkpoint := `{"report": {"signature_version": "v0", "running": true, "scanned": 1, "detections": []}, "last_hashstring": "aa01"}`
+	if err := ioutil.WriteFile(rescan.CheckpointPath, []byte(checkpoint), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := rescan.Run("alice")
+	assert.Nil(t, err)
+	assert.Equal(t, "v1", report.SignatureVersion)
+	assert.Equal(t, 2, report.Scanned)
+}
+
+func TestRescanStatus(t *testing.T) {
+	rescan, cleanup := generateRescan(t, map[string]string{})
+	defer cleanup()
+
+	assert.Nil(t, rescan.Status())
+
+	_, err := rescan.Run("alice")
+	assert.Nil(t, err)
+	assert.NotNil(t, rescan.Status())
+	assert.False(t, rescan.Status().Running)
+}
+
+// NOTE: fails the walk once the given file is reached
+type brokenWalkStorage struct {
+	drweb.WalkableStorage
+	BrokenAt string
+}
+
+func (s *brokenWalkStorage) Walk(fn func(filename string) error) error {
+	return s.WalkableStorage.Walk(func(filename string) error {
+		if filename == s.BrokenAt {
+			return errors.New("disk is gone")
+		}
+		return fn(filename)
+	})
+}
+
+func TestRescanWalkFailure(t *testing.T) {
+	rescan, cleanup := generateRescan(t, map[string]string{
+		"aa01": "clean",
+		"bb01": "EVIL",
+		"cc01": "clean",
+	})
+	defer cleanup()
+
+	storage := rescan.Storage
+	rescan.Storage = &brokenWalkStorage{WalkableStorage: storage, BrokenAt: "bb01"}
+
+	report, err := rescan.Run("alice")
+	assert.NotNil(t, err)
+	assert.False(t, report.Running)
+	assert.Contains(t, report.Error, "disk is gone")
+	assert.Equal(t, 1, report.Scanned)
+
+	// NOTE: failed rescan resumes past the last checkpointed file
+	rescan.Storage = storage
+	report, err = rescan.Run("alice")
+	assert.Nil(t, err)
+	assert.False(t, report.Running)
+	assert.Equal(t, "", report.Error)
+	assert.Equal(t, 3, report.Scanned)
+	assert.Equal(t, 3, rescan.Scanner.(*substringScanner).Scanned)
+	assert.Len(t, report.Detections, 1)
+}
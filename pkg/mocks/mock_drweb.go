@@ -215,3 +215,841 @@ func (m *MockFilePathGenerator) Generate(filename string) (string, error) {
 func (mr *MockFilePathGeneratorMockRecorder) Generate(filename interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Generate", reflect.TypeOf((*MockFilePathGenerator)(nil).Generate), filename)
 }
+
+// MockQuarantine is a mock of Quarantine interface
+type MockQuarantine struct {
+	ctrl     *gomock.Controller
+	recorder *MockQuarantineMockRecorder
+}
+
+// MockQuarantineMockRecorder is the mock recorder for MockQuarantine
+type MockQuarantineMockRecorder struct {
+	mock *MockQuarantine
+}
+
+// NewMockQuarantine creates a new mock instance
+func NewMockQuarantine(ctrl *gomock.Controller) *MockQuarantine {
+	mock := &MockQuarantine{ctrl: ctrl}
+	mock.recorder = &MockQuarantineMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockQuarantine) EXPECT() *MockQuarantineMockRecorder {
+	return m.recorder
+}
+
+// Inspect mocks base method
+func (m *MockQuarantine) Inspect(filename string) (*drweb.QuarantineRecord, error) {
+	ret := m.ctrl.Call(m, "Inspect", filename)
+	ret0, _ := ret[0].(*drweb.QuarantineRecord)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Inspect indicates an expected call of Inspect
+func (mr *MockQuarantineMockRecorder) Inspect(filename interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Inspect", reflect.TypeOf((*MockQuarantine)(nil).Inspect), filename)
+}
+
+// Isolate mocks base method
+func (m *MockQuarantine) Isolate(filename, category, actor, reason string) error {
+	ret := m.ctrl.Call(m, "Isolate", filename, category, actor, reason)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Isolate indicates an expected call of Isolate
+func (mr *MockQuarantineMockRecorder) Isolate(filename, category, actor, reason interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Isolate", reflect.TypeOf((*MockQuarantine)(nil).Isolate), filename, category, actor, reason)
+}
+
+// List mocks base method
+func (m *MockQuarantine) List() ([]*drweb.QuarantineRecord, error) {
+	ret := m.ctrl.Call(m, "List")
+	ret0, _ := ret[0].([]*drweb.QuarantineRecord)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List
+func (mr *MockQuarantineMockRecorder) List() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockQuarantine)(nil).List))
+}
+
+// Load mocks base method
+func (m *MockQuarantine) Load(filename string) (*drweb.File, error) {
+	ret := m.ctrl.Call(m, "Load", filename)
+	ret0, _ := ret[0].(*drweb.File)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Load indicates an expected call of Load
+func (mr *MockQuarantineMockRecorder) Load(filename interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Load", reflect.TypeOf((*MockQuarantine)(nil).Load), filename)
+}
+
+// Purge mocks base method
+func (m *MockQuarantine) Purge(filename, actor, reason string) error {
+	ret := m.ctrl.Call(m, "Purge", filename, actor, reason)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Purge indicates an expected call of Purge
+func (mr *MockQuarantineMockRecorder) Purge(filename, actor, reason interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Purge", reflect.TypeOf((*MockQuarantine)(nil).Purge), filename, actor, reason)
+}
+
+// Release mocks base method
+func (m *MockQuarantine) Release(filename, actor, reason string) error {
+	ret := m.ctrl.Call(m, "Release", filename, actor, reason)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Release indicates an expected call of Release
+func (mr *MockQuarantineMockRecorder) Release(filename, actor, reason interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Release", reflect.TypeOf((*MockQuarantine)(nil).Release), filename, actor, reason)
+}
+
+// MockScanner is a mock of Scanner interface
+type MockScanner struct {
+	ctrl     *gomock.Controller
+	recorder *MockScannerMockRecorder
+}
+
+// MockScannerMockRecorder is the mock recorder for MockScanner
+type MockScannerMockRecorder struct {
+	mock *MockScanner
+}
+
+// NewMockScanner creates a new mock instance
+func NewMockScanner(ctrl *gomock.Controller) *MockScanner {
+	mock := &MockScanner{ctrl: ctrl}
+	mock.recorder = &MockScannerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockScanner) EXPECT() *MockScannerMockRecorder {
+	return m.recorder
+}
+
+// Scan mocks base method
+func (m *MockScanner) Scan(input io.Reader) (*drweb.ScanResult, error) {
+	ret := m.ctrl.Call(m, "Scan", input)
+	ret0, _ := ret[0].(*drweb.ScanResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Scan indicates an expected call of Scan
+func (mr *MockScannerMockRecorder) Scan(input interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Scan", reflect.TypeOf((*MockScanner)(nil).Scan), input)
+}
+
+// Version mocks base method
+func (m *MockScanner) Version() (string, error) {
+	ret := m.ctrl.Call(m, "Version")
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Version indicates an expected call of Version
+func (mr *MockScannerMockRecorder) Version() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Version", reflect.TypeOf((*MockScanner)(nil).Version))
+}
+
+// MockRescanner is a mock of Rescanner interface
+type MockRescanner struct {
+	ctrl     *gomock.Controller
+	recorder *MockRescannerMockRecorder
+}
+
+// MockRescannerMockRecorder is the mock recorder for MockRescanner
+type MockRescannerMockRecorder struct {
+	mock *MockRescanner
+}
+
+// NewMockRescanner creates a new mock instance
+func NewMockRescanner(ctrl *gomock.Controller) *MockRescanner {
+	mock := &MockRescanner{ctrl: ctrl}
+	mock.recorder = &MockRescannerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockRescanner) EXPECT() *MockRescannerMockRecorder {
+	return m.recorder
+}
+
+// Start mocks base method
+func (m *MockRescanner) Start(actor string) error {
+	ret := m.ctrl.Call(m, "Start", actor)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Start indicates an expected call of Start
+func (mr *MockRescannerMockRecorder) Start(actor interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Start", reflect.TypeOf((*MockRescanner)(nil).Start), actor)
+}
+
+// Status mocks base method
+func (m *MockRescanner) Status() *drweb.RescanReport {
+	ret := m.ctrl.Call(m, "Status")
+	ret0, _ := ret[0].(*drweb.RescanReport)
+	return ret0
+}
+
+// Status indicates an expected call of Status
+func (mr *MockRescannerMockRecorder) Status() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Status", reflect.TypeOf((*MockRescanner)(nil).Status))
+}
+
+// MockInspector is a mock of Inspector interface
+type MockInspector struct {
+	ctrl     *gomock.Controller
+	recorder *MockInspectorMockRecorder
+}
+
+// MockInspectorMockRecorder is the mock recorder for MockInspector
+type MockInspectorMockRecorder struct {
+	mock *MockInspector
+}
+
+// NewMockInspector creates a new mock instance
+func NewMockInspector(ctrl *gomock.Controller) *MockInspector {
+	mock := &MockInspector{ctrl: ctrl}
+	mock.recorder = &MockInspectorMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockInspector) EXPECT() *MockInspectorMockRecorder {
+	return m.recorder
+}
+
+// Inspect mocks base method
+func (m *MockInspector) Inspect(filename string, metadata *drweb.Metadata) error {
+	ret := m.ctrl.Call(m, "Inspect", filename, metadata)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Inspect indicates an expected call of Inspect
+func (mr *MockInspectorMockRecorder) Inspect(filename, metadata interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Inspect", reflect.TypeOf((*MockInspector)(nil).Inspect), filename, metadata)
+}
+
+// Write mocks base method
+func (m *MockInspector) Write(p []byte) (int, error) {
+	ret := m.ctrl.Call(m, "Write", p)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Write indicates an expected call of Write
+func (mr *MockInspectorMockRecorder) Write(p interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Write", reflect.TypeOf((*MockInspector)(nil).Write), p)
+}
+
+// MockMetadataStore is a mock of MetadataStore interface
+type MockMetadataStore struct {
+	ctrl     *gomock.Controller
+	recorder *MockMetadataStoreMockRecorder
+}
+
+// MockMetadataStoreMockRecorder is the mock recorder for MockMetadataStore
+type MockMetadataStoreMockRecorder struct {
+	mock *MockMetadataStore
+}
+
+// NewMockMetadataStore creates a new mock instance
+func NewMockMetadataStore(ctrl *gomock.Controller) *MockMetadataStore {
+	mock := &MockMetadataStore{ctrl: ctrl}
+	mock.recorder = &MockMetadataStoreMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockMetadataStore) EXPECT() *MockMetadataStoreMockRecorder {
+	return m.recorder
+}
+
+// Delete mocks base method
+func (m *MockMetadataStore) Delete(filename string) error {
+	ret := m.ctrl.Call(m, "Delete", filename)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete
+func (mr *MockMetadataStoreMockRecorder) Delete(filename interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockMetadataStore)(nil).Delete), filename)
+}
+
+// Get mocks base method
+func (m *MockMetadataStore) Get(filename string) (*drweb.Metadata, error) {
+	ret := m.ctrl.Call(m, "Get", filename)
+	ret0, _ := ret[0].(*drweb.Metadata)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get
+func (mr *MockMetadataStoreMockRecorder) Get(filename interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockMetadataStore)(nil).Get), filename)
+}
+
+// List mocks base method
+func (m *MockMetadataStore) List() ([]*drweb.Metadata, error) {
+	ret := m.ctrl.Call(m, "List")
+	ret0, _ := ret[0].([]*drweb.Metadata)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List
+func (mr *MockMetadataStoreMockRecorder) List() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockMetadataStore)(nil).List))
+}
+
+// Update mocks base method
+func (m *MockMetadataStore) Update(filename string, fn func(*drweb.Metadata) error) error {
+	ret := m.ctrl.Call(m, "Update", filename, fn)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Update indicates an expected call of Update
+func (mr *MockMetadataStoreMockRecorder) Update(filename, fn interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockMetadataStore)(nil).Update), filename, fn)
+}
+
+// MockHashLists is a mock of HashLists interface
+type MockHashLists struct {
+	ctrl     *gomock.Controller
+	recorder *MockHashListsMockRecorder
+}
+
+// MockHashListsMockRecorder is the mock recorder for MockHashLists
+type MockHashListsMockRecorder struct {
+	mock *MockHashLists
+}
+
+// NewMockHashLists creates a new mock instance
+func NewMockHashLists(ctrl *gomock.Controller) *MockHashLists {
+	mock := &MockHashLists{ctrl: ctrl}
+	mock.recorder = &MockHashListsMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockHashLists) EXPECT() *MockHashListsMockRecorder {
+	return m.recorder
+}
+
+// Match mocks base method
+func (m *MockHashLists) Match(filename string) []*drweb.HashListMatch {
+	ret := m.ctrl.Call(m, "Match", filename)
+	ret0, _ := ret[0].([]*drweb.HashListMatch)
+	return ret0
+}
+
+// Match indicates an expected call of Match
+func (mr *MockHashListsMockRecorder) Match(filename interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Match", reflect.TypeOf((*MockHashLists)(nil).Match), filename)
+}
+
+// Stats mocks base method
+func (m *MockHashLists) Stats() []*drweb.HashListStats {
+	ret := m.ctrl.Call(m, "Stats")
+	ret0, _ := ret[0].([]*drweb.HashListStats)
+	return ret0
+}
+
+// Stats indicates an expected call of Stats
+func (mr *MockHashListsMockRecorder) Stats() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stats", reflect.TypeOf((*MockHashLists)(nil).Stats))
+}
+
+// MockRuleEvaluator is a mock of RuleEvaluator interface
+type MockRuleEvaluator struct {
+	ctrl     *gomock.Controller
+	recorder *MockRuleEvaluatorMockRecorder
+}
+
+// MockRuleEvaluatorMockRecorder is the mock recorder for MockRuleEvaluator
+type MockRuleEvaluatorMockRecorder struct {
+	mock *MockRuleEvaluator
+}
+
+// NewMockRuleEvaluator creates a new mock instance
+func NewMockRuleEvaluator(ctrl *gomock.Controller) *MockRuleEvaluator {
+	mock := &MockRuleEvaluator{ctrl: ctrl}
+	mock.recorder = &MockRuleEvaluatorMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockRuleEvaluator) EXPECT() *MockRuleEvaluatorMockRecorder {
+	return m.recorder
+}
+
+// Start mocks base method
+func (m *MockRuleEvaluator) Start(actor string) error {
+	ret := m.ctrl.Call(m, "Start", actor)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Start indicates an expected call of Start
+func (mr *MockRuleEvaluatorMockRecorder) Start(actor interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Start", reflect.TypeOf((*MockRuleEvaluator)(nil).Start), actor)
+}
+
+// Status mocks base method
+func (m *MockRuleEvaluator) Status() *drweb.RuleEvaluationReport {
+	ret := m.ctrl.Call(m, "Status")
+	ret0, _ := ret[0].(*drweb.RuleEvaluationReport)
+	return ret0
+}
+
+// Status indicates an expected call of Status
+func (mr *MockRuleEvaluatorMockRecorder) Status() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Status", reflect.TypeOf((*MockRuleEvaluator)(nil).Status))
+}
+
+// MockPostSaveJob is a mock of PostSaveJob interface
+type MockPostSaveJob struct {
+	ctrl     *gomock.Controller
+	recorder *MockPostSaveJobMockRecorder
+}
+
+// MockPostSaveJobMockRecorder is the mock recorder for MockPostSaveJob
+type MockPostSaveJobMockRecorder struct {
+	mock *MockPostSaveJob
+}
+
+// NewMockPostSaveJob creates a new mock instance
+func NewMockPostSaveJob(ctrl *gomock.Controller) *MockPostSaveJob {
+	mock := &MockPostSaveJob{ctrl: ctrl}
+	mock.recorder = &MockPostSaveJobMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockPostSaveJob) EXPECT() *MockPostSaveJobMockRecorder {
+	return m.recorder
+}
+
+// Enqueue mocks base method
+func (m *MockPostSaveJob) Enqueue(filename string) {
+	m.ctrl.Call(m, "Enqueue", filename)
+}
+
+// Enqueue indicates an expected call of Enqueue
+func (mr *MockPostSaveJobMockRecorder) Enqueue(filename interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Enqueue", reflect.TypeOf((*MockPostSaveJob)(nil).Enqueue), filename)
+}
+
+// Forget mocks base method
+func (m *MockPostSaveJob) Forget(filename string) error {
+	ret := m.ctrl.Call(m, "Forget", filename)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Forget indicates an expected call of Forget
+func (mr *MockPostSaveJobMockRecorder) Forget(filename interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Forget", reflect.TypeOf((*MockPostSaveJob)(nil).Forget), filename)
+}
+
+// MockAnalysisStore is a mock of AnalysisStore interface
+type MockAnalysisStore struct {
+	ctrl     *gomock.Controller
+	recorder *MockAnalysisStoreMockRecorder
+}
+
+// MockAnalysisStoreMockRecorder is the mock recorder for MockAnalysisStore
+type MockAnalysisStoreMockRecorder struct {
+	mock *MockAnalysisStore
+}
+
+// NewMockAnalysisStore creates a new mock instance
+func NewMockAnalysisStore(ctrl *gomock.Controller) *MockAnalysisStore {
+	mock := &MockAnalysisStore{ctrl: ctrl}
+	mock.recorder = &MockAnalysisStoreMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockAnalysisStore) EXPECT() *MockAnalysisStoreMockRecorder {
+	return m.recorder
+}
+
+// Delete mocks base method
+func (m *MockAnalysisStore) Delete(filename string) error {
+	ret := m.ctrl.Call(m, "Delete", filename)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete
+func (mr *MockAnalysisStoreMockRecorder) Delete(filename interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockAnalysisStore)(nil).Delete), filename)
+}
+
+// Get mocks base method
+func (m *MockAnalysisStore) Get(filename string) (*drweb.Analysis, error) {
+	ret := m.ctrl.Call(m, "Get", filename)
+	ret0, _ := ret[0].(*drweb.Analysis)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get
+func (mr *MockAnalysisStoreMockRecorder) Get(filename interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockAnalysisStore)(nil).Get), filename)
+}
+
+// Put mocks base method
+func (m *MockAnalysisStore) Put(analysis *drweb.Analysis) error {
+	ret := m.ctrl.Call(m, "Put", analysis)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Put indicates an expected call of Put
+func (mr *MockAnalysisStoreMockRecorder) Put(analysis interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Put", reflect.TypeOf((*MockAnalysisStore)(nil).Put), analysis)
+}
+
+// MockSimilarityIndex is a mock of SimilarityIndex interface
+type MockSimilarityIndex struct {
+	ctrl     *gomock.Controller
+	recorder *MockSimilarityIndexMockRecorder
+}
+
+// MockSimilarityIndexMockRecorder is the mock recorder for MockSimilarityIndex
+type MockSimilarityIndexMockRecorder struct {
+	mock *MockSimilarityIndex
+}
+
+// NewMockSimilarityIndex creates a new mock instance
+func NewMockSimilarityIndex(ctrl *gomock.Controller) *MockSimilarityIndex {
+	mock := &MockSimilarityIndex{ctrl: ctrl}
+	mock.recorder = &MockSimilarityIndexMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockSimilarityIndex) EXPECT() *MockSimilarityIndexMockRecorder {
+	return m.recorder
+}
+
+// Similar mocks base method
+func (m *MockSimilarityIndex) Similar(filename string, threshold, limit int) ([]*drweb.SimilarFile, error) {
+	ret := m.ctrl.Call(m, "Similar", filename, threshold, limit)
+	ret0, _ := ret[0].([]*drweb.SimilarFile)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Similar indicates an expected call of Similar
+func (mr *MockSimilarityIndexMockRecorder) Similar(filename, threshold, limit interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Similar", reflect.TypeOf((*MockSimilarityIndex)(nil).Similar), filename, threshold, limit)
+}
+
+// MockArchives is a mock of Archives interface
+type MockArchives struct {
+	ctrl     *gomock.Controller
+	recorder *MockArchivesMockRecorder
+}
+
+// MockArchivesMockRecorder is the mock recorder for MockArchives
+type MockArchivesMockRecorder struct {
+	mock *MockArchives
+}
+
+// NewMockArchives creates a new mock instance
+func NewMockArchives(ctrl *gomock.Controller) *MockArchives {
+	mock := &MockArchives{ctrl: ctrl}
+	mock.recorder = &MockArchivesMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockArchives) EXPECT() *MockArchivesMockRecorder {
+	return m.recorder
+}
+
+// Entries mocks base method
+func (m *MockArchives) Entries(filename string) ([]*drweb.ArchiveEntry, error) {
+	ret := m.ctrl.Call(m, "Entries", filename)
+	ret0, _ := ret[0].([]*drweb.ArchiveEntry)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Entries indicates an expected call of Entries
+func (mr *MockArchivesMockRecorder) Entries(filename interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Entries", reflect.TypeOf((*MockArchives)(nil).Entries), filename)
+}
+
+// Explode mocks base method
+func (m *MockArchives) Explode(filename string) (*drweb.Explosion, error) {
+	ret := m.ctrl.Call(m, "Explode", filename)
+	ret0, _ := ret[0].(*drweb.Explosion)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Explode indicates an expected call of Explode
+func (mr *MockArchivesMockRecorder) Explode(filename interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Explode", reflect.TypeOf((*MockArchives)(nil).Explode), filename)
+}
+
+// MockWrapper is a mock of Wrapper interface
+type MockWrapper struct {
+	ctrl     *gomock.Controller
+	recorder *MockWrapperMockRecorder
+}
+
+// MockWrapperMockRecorder is the mock recorder for MockWrapper
+type MockWrapperMockRecorder struct {
+	mock *MockWrapper
+}
+
+// NewMockWrapper creates a new mock instance
+func NewMockWrapper(ctrl *gomock.Controller) *MockWrapper {
+	mock := &MockWrapper{ctrl: ctrl}
+	mock.recorder = &MockWrapperMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockWrapper) EXPECT() *MockWrapperMockRecorder {
+	return m.recorder
+}
+
+// Wrap mocks base method
+func (m *MockWrapper) Wrap(w io.Writer, filename string, body io.Reader) error {
+	ret := m.ctrl.Call(m, "Wrap", w, filename, body)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Wrap indicates an expected call of Wrap
+func (mr *MockWrapperMockRecorder) Wrap(w, filename, body interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Wrap", reflect.TypeOf((*MockWrapper)(nil).Wrap), w, filename, body)
+}
+
+// MockFullTextIndex is a mock of FullTextIndex interface
+type MockFullTextIndex struct {
+	ctrl     *gomock.Controller
+	recorder *MockFullTextIndexMockRecorder
+}
+
+// MockFullTextIndexMockRecorder is the mock recorder for MockFullTextIndex
+type MockFullTextIndexMockRecorder struct {
+	mock *MockFullTextIndex
+}
+
+// NewMockFullTextIndex creates a new mock instance
+func NewMockFullTextIndex(ctrl *gomock.Controller) *MockFullTextIndex {
+	mock := &MockFullTextIndex{ctrl: ctrl}
+	mock.recorder = &MockFullTextIndexMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockFullTextIndex) EXPECT() *MockFullTextIndexMockRecorder {
+	return m.recorder
+}
+
+// Search mocks base method
+func (m *MockFullTextIndex) Search(query string, limit int) ([]*drweb.SearchHit, error) {
+	ret := m.ctrl.Call(m, "Search", query, limit)
+	ret0, _ := ret[0].([]*drweb.SearchHit)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Search indicates an expected call of Search
+func (mr *MockFullTextIndexMockRecorder) Search(query, limit interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Search", reflect.TypeOf((*MockFullTextIndex)(nil).Search), query, limit)
+}
+
+// MockThumbnails is a mock of Thumbnails interface
+type MockThumbnails struct {
+	ctrl     *gomock.Controller
+	recorder *MockThumbnailsMockRecorder
+}
+
+// MockThumbnailsMockRecorder is the mock recorder for MockThumbnails
+type MockThumbnailsMockRecorder struct {
+	mock *MockThumbnails
+}
+
+// NewMockThumbnails creates a new mock instance
+func NewMockThumbnails(ctrl *gomock.Controller) *MockThumbnails {
+	mock := &MockThumbnails{ctrl: ctrl}
+	mock.recorder = &MockThumbnailsMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockThumbnails) EXPECT() *MockThumbnailsMockRecorder {
+	return m.recorder
+}
+
+// Thumbnail mocks base method
+func (m *MockThumbnails) Thumbnail(filename string, spec *drweb.ThumbnailSpec) (*drweb.File, error) {
+	ret := m.ctrl.Call(m, "Thumbnail", filename, spec)
+	ret0, _ := ret[0].(*drweb.File)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Thumbnail indicates an expected call of Thumbnail
+func (mr *MockThumbnailsMockRecorder) Thumbnail(filename, spec interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Thumbnail", reflect.TypeOf((*MockThumbnails)(nil).Thumbnail), filename, spec)
+}
+
+// MockWalkableStorage is a mock of WalkableStorage interface
+type MockWalkableStorage struct {
+	ctrl     *gomock.Controller
+	recorder *MockWalkableStorageMockRecorder
+}
+
+// MockWalkableStorageMockRecorder is the mock recorder for MockWalkableStorage
+type MockWalkableStorageMockRecorder struct {
+	mock *MockWalkableStorage
+}
+
+// NewMockWalkableStorage creates a new mock instance
+func NewMockWalkableStorage(ctrl *gomock.Controller) *MockWalkableStorage {
+	mock := &MockWalkableStorage{ctrl: ctrl}
+	mock.recorder = &MockWalkableStorageMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockWalkableStorage) EXPECT() *MockWalkableStorageMockRecorder {
+	return m.recorder
+}
+
+// Delete mocks base method
+func (m *MockWalkableStorage) Delete(filename string) error {
+	ret := m.ctrl.Call(m, "Delete", filename)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete
+func (mr *MockWalkableStorageMockRecorder) Delete(filename interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockWalkableStorage)(nil).Delete), filename)
+}
+
+// Load mocks base method
+func (m *MockWalkableStorage) Load(filename string) (*drweb.File, error) {
+	ret := m.ctrl.Call(m, "Load", filename)
+	ret0, _ := ret[0].(*drweb.File)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Load indicates an expected call of Load
+func (mr *MockWalkableStorageMockRecorder) Load(filename interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Load", reflect.TypeOf((*MockWalkableStorage)(nil).Load), filename)
+}
+
+// Save mocks base method
+func (m *MockWalkableStorage) Save(f *drweb.FileCreateRequest) (string, error) {
+	ret := m.ctrl.Call(m, "Save", f)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Save indicates an expected call of Save
+func (mr *MockWalkableStorageMockRecorder) Save(f interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Save", reflect.TypeOf((*MockWalkableStorage)(nil).Save), f)
+}
+
+// Walk mocks base method
+func (m *MockWalkableStorage) Walk(fn func(string) error) error {
+	ret := m.ctrl.Call(m, "Walk", fn)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Walk indicates an expected call of Walk
+func (mr *MockWalkableStorageMockRecorder) Walk(fn interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Walk", reflect.TypeOf((*MockWalkableStorage)(nil).Walk), fn)
+}
+
+// MockCache is a mock of Cache interface
+type MockCache struct {
+	ctrl     *gomock.Controller
+	recorder *MockCacheMockRecorder
+}
+
+// MockCacheMockRecorder is the mock recorder for MockCache
+type MockCacheMockRecorder struct {
+	mock *MockCache
+}
+
+// NewMockCache creates a new mock instance
+func NewMockCache(ctrl *gomock.Controller) *MockCache {
+	mock := &MockCache{ctrl: ctrl}
+	mock.recorder = &MockCacheMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockCache) EXPECT() *MockCacheMockRecorder {
+	return m.recorder
+}
+
+// Pin mocks base method
+func (m *MockCache) Pin(filename string) error {
+	ret := m.ctrl.Call(m, "Pin", filename)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Pin indicates an expected call of Pin
+func (mr *MockCacheMockRecorder) Pin(filename interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Pin", reflect.TypeOf((*MockCache)(nil).Pin), filename)
+}
+
+// Unpin mocks base method
+func (m *MockCache) Unpin(filename string) error {
+	ret := m.ctrl.Call(m, "Unpin", filename)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Unpin indicates an expected call of Unpin
+func (mr *MockCacheMockRecorder) Unpin(filename interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Unpin", reflect.TypeOf((*MockCache)(nil).Unpin), filename)
+}
+
+// Stats mocks base method
+func (m *MockCache) Stats() *drweb.CacheStats {
+	ret := m.ctrl.Call(m, "Stats")
+	ret0, _ := ret[0].(*drweb.CacheStats)
+	return ret0
+}
+
+// Stats indicates an expected call of Stats
+func (mr *MockCacheMockRecorder) Stats() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stats", reflect.TypeOf((*MockCache)(nil).Stats))
+}
@@ -0,0 +1,275 @@
+package reedsolomon
+
+import (
+	"github.com/pkg/errors"
+)
+
+// ErrTooFewShards is returned when lost shards can not be told anymore.
+var ErrTooFewShards = errors.New("too few shards to reconstruct")
+
+// NOTE: GF(2^8) with 0x11d polynomial, as most Reed-Solomon codes use
+var expTable [510]byte
+var logTable [256]byte
+var mulTable [256][256]byte
+
+func init() {
+	x := 1
+	for i := 0; i < 255; i++ {
+		expTable[i] = byte(x)
+		expTable[i+255] = byte(x)
+		logTable[x] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11d
+		}
+	}
+
+	for a := 1; a < 256; a++ {
+		for b := 1; b < 256; b++ {
+			mulTable[a][b] = expTable[int(logTable[a])+int(logTable[b])]
+		}
+	}
+}
+
+func pow(a byte, n int) byte {
+	if n == 0 {
+		return 1
+	}
+	if a == 0 {
+		return 0
+	}
+	return expTable[int(logTable[a])*n%255]
+}
+
+func inverse(a byte) byte {
+	return expTable[255-int(logTable[a])]
+}
+
+// mulAdd adds c*in to out, addition being xor in GF(2^8).
+func mulAdd(c byte, in, out []byte) {
+	table := &mulTable[c]
+	for i, b := range in {
+		out[i] ^= table[b]
+	}
+}
+
+type matrix [][]byte
+
+func newMatrix(rows, cols int) matrix {
+	m := make(matrix, rows)
+	for r := range m {
+		m[r] = make([]byte, cols)
+	}
+	return m
+}
+
+func (m matrix) multiply(other matrix) matrix {
+	result := newMatrix(len(m), len(other[0]))
+	for r := range m {
+		for c := range other[0] {
+			var value byte
+			for i := range other {
+				value ^= mulTable[m[r][i]][other[i][c]]
+			}
+			result[r][c] = value
+		}
+	}
+	return result
+}
+
+// invert goes Gauss-Jordan on m augmented with identity matrix.
+func (m matrix) invert() (matrix, error) {
+	size := len(m)
+	work := newMatrix(size, size*2)
+	for r := range m {
+		copy(work[r], m[r])
+		work[r][size+r] = 1
+	}
+
+	for c := 0; c < size; c++ {
+		pivot := c
+		for pivot < size && work[pivot][c] == 0 {
+			pivot++
+		}
+		if pivot == size {
+			return nil, errors.New("matrix is singular")
+		}
+		work[c], work[pivot] = work[pivot], work[c]
+
+		scale := inverse(work[c][c])
+		for i := range work[c] {
+			work[c][i] = mulTable[work[c][i]][scale]
+		}
+
+		for r := 0; r < size; r++ {
+			if r != c && work[r][c] != 0 {
+				factor := work[r][c]
+				for i := range work[r] {
+					work[r][i] ^= mulTable[factor][work[c][i]]
+				}
+			}
+		}
+	}
+
+	result := newMatrix(size, size)
+	for r := range work {
+		copy(result[r], work[r][size:])
+	}
+	return result, nil
+}
+
+// Encoder splits data into data and parity shards, any data shards of which
+// are enough to get the rest back. Data shards hold data itself.
+// NOTE: encoding matrix is Vandermonde one, turned to have identity on top,
+// so that any of its square submatrices is invertible.
+type Encoder struct {
+	data   int
+	parity int
+	matrix matrix
+}
+
+func New(data, parity int) (*Encoder, error) {
+	if data < 1 || parity < 0 || data+parity > 256 {
+		return nil, errors.New("shards count should be within 1 and 256")
+	}
+
+	vandermonde := newMatrix(data+parity, data)
+	for r := range vandermonde {
+		for c := range vandermonde[r] {
+			vandermonde[r][c] = pow(byte(r), c)
+		}
+	}
+
+	top, err := vandermonde[:data].invert()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build encoding matrix")
+	}
+
+	return &Encoder{data: data, parity: parity, matrix: vandermonde.multiply(top)}, nil
+}
+
+func (e *Encoder) DataShards() int {
+	return e.data
+}
+
+func (e *Encoder) ParityShards() int {
+	return e.parity
+}
+
+func (e *Encoder) check(shards [][]byte) (int, error) {
+	if len(shards) != e.data+e.parity {
+		return 0, errors.Errorf("expected %d shards, got %d", e.data+e.parity, len(shards))
+	}
+
+	size := 0
+	for _, shard := range shards {
+		if len(shard) == 0 {
+			continue
+		}
+		if size != 0 && len(shard) != size {
+			return 0, errors.New("shards should be of the same size")
+		}
+		size = len(shard)
+	}
+	return size, nil
+}
+
+// Encode fills parity shards out of data shards.
+func (e *Encoder) Encode(shards [][]byte) error {
+	size, err := e.check(shards)
+	if err != nil {
+		return err
+	}
+
+	for i := range shards {
+		if len(shards[i]) == 0 {
+			if i < e.data {
+				return errors.New("data shards should be given")
+			}
+			shards[i] = make([]byte, size)
+		}
+	}
+
+	e.encode(shards, e.data, e.data+e.parity)
+	return nil
+}
+
+// encode fills shards from first to last out of data shards.
+func (e *Encoder) encode(shards [][]byte, first, last int) {
+	for i := first; i < last; i++ {
+		out := shards[i]
+		for j := range out {
+			out[j] = 0
+		}
+		for d := 0; d < e.data; d++ {
+			mulAdd(e.matrix[i][d], shards[d], out)
+		}
+	}
+}
+
+// Reconstruct fills shards which are empty out of the rest.
+// NOTE: capacity of empty shards is reused, pass shard[:0] to keep buffers
+func (e *Encoder) Reconstruct(shards [][]byte) error {
+	size, err := e.check(shards)
+	if err != nil {
+		return err
+	}
+
+	present := []int{}
+	missing := []int{}
+	for i, shard := range shards {
+		if len(shard) != 0 {
+			present = append(present, i)
+		} else {
+			missing = append(missing, i)
+		}
+	}
+
+	if len(present) < e.data {
+		return ErrTooFewShards
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	for _, i := range missing {
+		if cap(shards[i]) >= size {
+			shards[i] = shards[i][:size]
+		} else {
+			shards[i] = make([]byte, size)
+		}
+	}
+
+	// NOTE: any data rows of encoding matrix give data shards back once inverted
+	present = present[:e.data]
+	if present[e.data-1] >= e.data {
+		rows := make(matrix, e.data)
+		for r, i := range present {
+			rows[r] = e.matrix[i]
+		}
+		decoding, err := rows.invert()
+		if err != nil {
+			return errors.Wrap(err, "failed to build decoding matrix")
+		}
+
+		for _, d := range missing {
+			if d >= e.data {
+				break
+			}
+			out := shards[d]
+			for j := range out {
+				out[j] = 0
+			}
+			for r, i := range present {
+				mulAdd(decoding[d][r], shards[i], out)
+			}
+		}
+	}
+
+	for _, i := range missing {
+		if i >= e.data {
+			e.encode(shards, i, i+1)
+		}
+	}
+	return nil
+}
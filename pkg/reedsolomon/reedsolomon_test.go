@@ -0,0 +1,125 @@
+package reedsolomon_test
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/twonegatives/drweb_challenge/pkg/reedsolomon"
+)
+
+func encoded(t *testing.T, encoder *reedsolomon.Encoder, size int) [][]byte {
+	random := rand.New(rand.NewSource(int64(size)))
+	shards := make([][]byte, encoder.DataShards()+encoder.ParityShards())
+	for i := 0; i < encoder.DataShards(); i++ {
+		shards[i] = make([]byte, size)
+		random.Read(shards[i])
+	}
+
+	if err := encoder.Encode(shards); err != nil {
+		t.Fatal(err)
+	}
+	return shards
+}
+
+func copyShards(shards [][]byte) [][]byte {
+	copied := make([][]byte, len(shards))
+	for i, shard := range shards {
+		copied[i] = append([]byte{}, shard...)
+	}
+	return copied
+}
+
+func TestReconstruct(t *testing.T) {
+	var codes = map[string]struct {
+		Data   int
+		Parity int
+	}{
+		"4+2":  {Data: 4, Parity: 2},
+		"6+3":  {Data: 6, Parity: 3},
+		"1+1":  {Data: 1, Parity: 1},
+		"10+4": {Data: 10, Parity: 4},
+	}
+
+	for testName, code := range codes {
+		t.Run(testName, func(t *testing.T) {
+			encoder, err := reedsolomon.New(code.Data, code.Parity)
+			if err != nil {
+				t.Fatal(err)
+			}
+			original := encoded(t, encoder, 1000)
+			total := code.Data + code.Parity
+
+			// NOTE: every way of losing up to parity shards
+			for lost := 0; lost < 1<<uint(total); lost++ {
+				shards := copyShards(original)
+				count := 0
+				for i := range shards {
+					if lost&(1<<uint(i)) != 0 {
+						shards[i] = shards[i][:0]
+						count++
+					}
+				}
+				if count > code.Parity {
+					continue
+				}
+
+				assert.Nil(t, encoder.Reconstruct(shards))
+				assert.Equal(t, original, shards)
+			}
+		})
+	}
+}
+
+func TestReconstructTooFew(t *testing.T) {
+	encoder, _ := reedsolomon.New(4, 2)
+	shards := encoded(t, encoder, 100)
+	shards[0], shards[3], shards[5] = nil, nil, nil
+
+	assert.Equal(t, reedsolomon.ErrTooFewShards, encoder.Reconstruct(shards))
+}
+
+func TestEncode(t *testing.T) {
+	encoder, _ := reedsolomon.New(3, 2)
+
+	t.Run("data kept as is", func(t *testing.T) {
+		data := [][]byte{[]byte("abcd"), []byte("efgh"), []byte("ijkl")}
+		shards := append(copyShards(data), nil, nil)
+
+		assert.Nil(t, encoder.Encode(shards))
+		assert.Equal(t, data, shards[:3])
+		assert.Equal(t, 4, len(shards[4]))
+	})
+
+	t.Run("uneven shards", func(t *testing.T) {
+		shards := [][]byte{[]byte("abcd"), []byte("ef"), []byte("ijkl"), nil, nil}
+		assert.NotNil(t, encoder.Encode(shards))
+	})
+
+	t.Run("missing data", func(t *testing.T) {
+		shards := [][]byte{[]byte("abcd"), nil, []byte("ijkl"), nil, nil}
+		assert.NotNil(t, encoder.Encode(shards))
+	})
+
+	t.Run("wrong count", func(t *testing.T) {
+		assert.NotNil(t, encoder.Encode([][]byte{[]byte("abcd")}))
+	})
+
+	t.Run("zeroes", func(t *testing.T) {
+		shards := [][]byte{make([]byte, 8), make([]byte, 8), make([]byte, 8), nil, nil}
+		assert.Nil(t, encoder.Encode(shards))
+		assert.Equal(t, make([]byte, 8), shards[3])
+		assert.True(t, bytes.Equal(shards[3], shards[4]))
+	})
+}
+
+func TestNew(t *testing.T) {
+	for _, code := range [][2]int{{0, 2}, {4, -1}, {200, 57}} {
+		_, err := reedsolomon.New(code[0], code[1])
+		assert.NotNil(t, err)
+	}
+
+	_, err := reedsolomon.New(200, 56)
+	assert.Nil(t, err)
+}
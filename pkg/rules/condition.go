@@ -0,0 +1,158 @@
+package rules
+
+// state is what conditions are evaluated against once the whole file was seen.
+type state struct {
+	size    int64
+	matches map[string]*hits
+}
+
+type hits struct {
+	count   int64
+	offsets []int64
+	// NOTE: start of the latest match, kept apart from offsets which stop growing
+	last int64
+}
+
+func (s *state) lookup(name string) *hits {
+	if found, ok := s.matches[name]; ok {
+		return found
+	}
+	return &hits{}
+}
+
+type condition interface {
+	eval(s *state) bool
+}
+
+type value interface {
+	value(s *state) int64
+}
+
+type constantCondition bool
+
+func (c constantCondition) eval(*state) bool {
+	return bool(c)
+}
+
+type orCondition struct {
+	left, right condition
+}
+
+func (c *orCondition) eval(s *state) bool {
+	return c.left.eval(s) || c.right.eval(s)
+}
+
+type andCondition struct {
+	left, right condition
+}
+
+func (c *andCondition) eval(s *state) bool {
+	return c.left.eval(s) && c.right.eval(s)
+}
+
+type notCondition struct {
+	operand condition
+}
+
+func (c *notCondition) eval(s *state) bool {
+	return !c.operand.eval(s)
+}
+
+type matchCondition struct {
+	name string
+}
+
+func (c *matchCondition) eval(s *state) bool {
+	return s.lookup(c.name).count > 0
+}
+
+type atCondition struct {
+	name   string
+	offset int64
+}
+
+func (c *atCondition) eval(s *state) bool {
+	for _, offset := range s.lookup(c.name).offsets {
+		if offset == c.offset {
+			return true
+		}
+	}
+	return false
+}
+
+type inCondition struct {
+	name         string
+	lower, upper int64
+}
+
+func (c *inCondition) eval(s *state) bool {
+	for _, offset := range s.lookup(c.name).offsets {
+		if offset >= c.lower && offset <= c.upper {
+			return true
+		}
+	}
+	return false
+}
+
+// ofCondition stands for "any of", "all of" and "N of", min is -1 for all.
+type ofCondition struct {
+	min   int
+	names []string
+}
+
+func (c *ofCondition) eval(s *state) bool {
+	matched := 0
+	for _, name := range c.names {
+		if s.lookup(name).count > 0 {
+			matched++
+		}
+	}
+
+	if c.min < 0 {
+		return matched == len(c.names)
+	}
+	return matched >= c.min
+}
+
+type comparisonCondition struct {
+	left     value
+	operator string
+	right    value
+}
+
+func (c *comparisonCondition) eval(s *state) bool {
+	left, right := c.left.value(s), c.right.value(s)
+
+	switch c.operator {
+	case "<":
+		return left < right
+	case "<=":
+		return left <= right
+	case ">":
+		return left > right
+	case ">=":
+		return left >= right
+	case "==":
+		return left == right
+	default:
+		return left != right
+	}
+}
+
+type numberValue int64
+
+func (v numberValue) value(*state) int64 {
+	return int64(v)
+}
+
+type countValue string
+
+func (v countValue) value(s *state) int64 {
+	return s.lookup(string(v)).count
+}
+
+type filesizeValue struct{}
+
+func (filesizeValue) value(s *state) int64 {
+	return s.size
+}
@@ -0,0 +1,98 @@
+package rules
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+)
+
+var ruleExtensions = []string{".rule", ".rules", ".yar", ".yara"}
+
+// Engine holds rules loaded from a directory, every file there
+// having one of ruleExtensions is read in lexical order.
+type Engine struct {
+	Path  string
+	mutex sync.RWMutex
+	rules []*Rule
+}
+
+// Reload replaces rules at once, broken directory keeps previous rules intact.
+func (e *Engine) Reload() error {
+	var rules []*Rule
+
+	paths, err := filepath.Glob(filepath.Join(e.Path, "*"))
+	if err != nil {
+		return errors.Wrap(err, "failed to list rules directory")
+	}
+	sort.Strings(paths)
+
+	names := map[string]string{}
+	for _, path := range paths {
+		if !hasRuleExtension(path) {
+			continue
+		}
+
+		source, err := ioutil.ReadFile(path)
+		if err != nil {
+			return errors.Wrap(err, "failed to read rules file")
+		}
+
+		parsed, err := Parse(string(source))
+		if err != nil {
+			return errors.Wrapf(err, "failed to parse %s", filepath.Base(path))
+		}
+
+		for _, rule := range parsed {
+			if previous, ok := names[rule.Name]; ok {
+				return fmt.Errorf("rule '%s' from %s is already defined in %s", rule.Name, filepath.Base(path), previous)
+			}
+			names[rule.Name] = filepath.Base(path)
+		}
+
+		rules = append(rules, parsed...)
+	}
+
+	e.mutex.Lock()
+	e.rules = rules
+	e.mutex.Unlock()
+
+	log.WithField("rules", len(rules)).Info("rules loaded")
+	return nil
+}
+
+func (e *Engine) Rules() []*Rule {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+	return e.rules
+}
+
+func (e *Engine) NewInspector() drweb.Inspector {
+	return NewMatcher(e.Rules())
+}
+
+// Evaluate runs rules over contents which are already stored.
+func (e *Engine) Evaluate(input io.Reader) ([]string, error) {
+	matcher := NewMatcher(e.Rules())
+	if _, err := io.Copy(matcher, input); err != nil {
+		return nil, errors.Wrap(err, "failed to read contents")
+	}
+	return matcher.Matches(), nil
+}
+
+func hasRuleExtension(path string) bool {
+	extension := strings.ToLower(filepath.Ext(path))
+	for _, known := range ruleExtensions {
+		if extension == known {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package rules_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/twonegatives/drweb_challenge/pkg/rules"
+)
+
+func generateEngine(t *testing.T, files map[string]string) (*rules.Engine, func()) {
+	base, err := ioutil.TempDir("../../tmp", "rules")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, contents := range files {
+		if err = ioutil.WriteFile(path.Join(base, name), []byte(contents), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return &rules.Engine{Path: base}, func() { os.RemoveAll(base) }
+}
+
+func TestEngineReload(t *testing.T) {
+	engine, cleanup := generateEngine(t, map[string]string{
+		"images.yar":  `rule jpeg { strings: $magic = { FF D8 FF } condition: $magic at 0 }`,
+		"text.rules":  `rule alice { strings: $a = "Alice" condition: $a } rule empty { condition: filesize == 0 }`,
+		"README.md":   `rule ignored { condition: true }`,
+		"broken.yar~": `rule {`,
+	})
+	defer cleanup()
+
+	assert.Nil(t, engine.Reload())
+	assert.Len(t, engine.Rules(), 3)
+
+	matches, err := engine.Evaluate(strings.NewReader("Alice was beginning to get very tired"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"alice"}, matches)
+}
+
+func TestEngineReloadFailure(t *testing.T) {
+	engine, cleanup := generateEngine(t, map[string]string{
+		"a.yar": `rule same { condition: true }`,
+	})
+	defer cleanup()
+
+	assert.Nil(t, engine.Reload())
+
+	if err := ioutil.WriteFile(path.Join(engine.Path, "b.yar"), []byte(`rule same { condition: false }`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	err := engine.Reload()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "already defined in a.yar")
+
+	// NOTE: previous rules stay in place
+	assert.Len(t, engine.Rules(), 1)
+}
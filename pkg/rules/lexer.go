@@ -0,0 +1,253 @@
+package rules
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenVariable
+	tokenCount
+	tokenNumber
+	tokenText
+	tokenHex
+	tokenRegex
+	tokenPunct
+)
+
+type token struct {
+	Kind  tokenKind
+	Value string
+	Flags string
+	Line  int
+}
+
+func (t token) String() string {
+	if t.Kind == tokenEOF {
+		return "end of input"
+	}
+	return fmt.Sprintf("'%s'", t.Value)
+}
+
+type lexer struct {
+	input []rune
+	pos   int
+	line  int
+	prev  token
+}
+
+func tokenize(source string) ([]token, error) {
+	l := &lexer{input: []rune(source), line: 1}
+	tokens := []token{}
+
+	for {
+		tok, err := l.next()
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", l.line, err)
+		}
+
+		l.prev = tok
+		tokens = append(tokens, tok)
+		if tok.Kind == tokenEOF {
+			return tokens, nil
+		}
+	}
+}
+
+func (l *lexer) peek(offset int) rune {
+	if l.pos+offset >= len(l.input) {
+		return 0
+	}
+	return l.input[l.pos+offset]
+}
+
+func (l *lexer) skipSpaceAndComments() error {
+	for l.pos < len(l.input) {
+		char := l.peek(0)
+
+		switch {
+		case char == '\n':
+			l.line++
+			l.pos++
+		case unicode.IsSpace(char):
+			l.pos++
+		case char == '/' && l.peek(1) == '/':
+			for l.pos < len(l.input) && l.peek(0) != '\n' {
+				l.pos++
+			}
+		case char == '/' && l.peek(1) == '*':
+			end := strings.Index(string(l.input[l.pos+2:]), "*/")
+			if end < 0 {
+				return fmt.Errorf("unterminated comment")
+			}
+			comment := string(l.input[l.pos : l.pos+2+end+2])
+			l.line += strings.Count(comment, "\n")
+			l.pos += len([]rune(comment))
+		default:
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func (l *lexer) next() (token, error) {
+	if err := l.skipSpaceAndComments(); err != nil {
+		return token{}, err
+	}
+
+	if l.pos >= len(l.input) {
+		return token{Kind: tokenEOF, Line: l.line}, nil
+	}
+
+	// NOTE: hex and regex strings may only follow pattern assignment,
+	// anywhere else braces delimit rule body and slash is a comment
+	assignment := l.prev.Kind == tokenPunct && l.prev.Value == "="
+
+	char := l.peek(0)
+	switch {
+	case char == '$' || char == '#':
+		l.pos++
+		name := l.readWhile(isIdentRune)
+		kind := tokenVariable
+		if char == '#' {
+			kind = tokenCount
+		}
+		return token{Kind: kind, Value: name, Line: l.line}, nil
+	case unicode.IsLetter(char) || char == '_':
+		return token{Kind: tokenIdent, Value: l.readWhile(isIdentRune), Line: l.line}, nil
+	case unicode.IsDigit(char):
+		return l.readNumber()
+	case char == '"':
+		return l.readText()
+	case char == '{' && assignment:
+		return l.readDelimited(tokenHex, '}')
+	case char == '/' && assignment:
+		tok, err := l.readDelimited(tokenRegex, '/')
+		if err == nil {
+			tok.Flags = l.readWhile(func(r rune) bool { return r == 'i' || r == 's' })
+		}
+		return tok, err
+	}
+
+	for _, punct := range []string{"..", "<=", ">=", "==", "!=", "(", ")", "{", "}", "=", ":", "<", ">", ","} {
+		if strings.HasPrefix(string(l.input[l.pos:]), punct) {
+			l.pos += len(punct)
+			return token{Kind: tokenPunct, Value: punct, Line: l.line}, nil
+		}
+	}
+
+	return token{}, fmt.Errorf("unexpected character '%c'", char)
+}
+
+func isIdentRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+func (l *lexer) readWhile(fn func(rune) bool) string {
+	start := l.pos
+	for l.pos < len(l.input) && fn(l.peek(0)) {
+		l.pos++
+	}
+	return string(l.input[start:l.pos])
+}
+
+// readNumber understands decimals, 0x prefixed hexadecimals and KB/MB suffixes.
+func (l *lexer) readNumber() (token, error) {
+	var value int64
+	var err error
+
+	raw := l.readWhile(func(r rune) bool { return isIdentRune(r) })
+	multiplier := int64(1)
+
+	switch {
+	case strings.HasSuffix(raw, "KB"):
+		raw, multiplier = strings.TrimSuffix(raw, "KB"), 1024
+	case strings.HasSuffix(raw, "MB"):
+		raw, multiplier = strings.TrimSuffix(raw, "MB"), 1024*1024
+	}
+
+	if value, err = strconv.ParseInt(raw, 0, 64); err != nil {
+		return token{}, fmt.Errorf("malformed number '%s'", raw)
+	}
+
+	return token{Kind: tokenNumber, Value: strconv.FormatInt(value*multiplier, 10), Line: l.line}, nil
+}
+
+func (l *lexer) readText() (token, error) {
+	var value []byte
+
+	l.pos++
+	for l.pos < len(l.input) {
+		char := l.peek(0)
+		l.pos++
+
+		switch char {
+		case '"':
+			return token{Kind: tokenText, Value: string(value), Line: l.line}, nil
+		case '\n':
+			return token{}, fmt.Errorf("unterminated text string")
+		case '\\':
+			escaped := l.peek(0)
+			l.pos++
+			switch escaped {
+			case 'n':
+				value = append(value, '\n')
+			case 't':
+				value = append(value, '\t')
+			case 'x':
+				code, err := strconv.ParseUint(string(l.input[l.pos:min(l.pos+2, len(l.input))]), 16, 8)
+				if err != nil {
+					return token{}, fmt.Errorf("malformed \\x escape")
+				}
+				value = append(value, byte(code))
+				l.pos += 2
+			default:
+				value = append(value, string(escaped)...)
+			}
+		default:
+			value = append(value, string(char)...)
+		}
+	}
+
+	return token{}, fmt.Errorf("unterminated text string")
+}
+
+// NOTE: regex delimiter may be escaped within the regex itself,
+// escape is kept as is since regexp understands it too.
+func (l *lexer) readDelimited(kind tokenKind, end rune) (token, error) {
+	start := l.line
+	l.pos++
+	begin := l.pos
+
+	for l.pos < len(l.input) {
+		char := l.peek(0)
+		switch {
+		case char == '\\' && kind == tokenRegex:
+			l.pos += 2
+			continue
+		case char == '\n':
+			l.line++
+		case char == end:
+			value := string(l.input[begin:l.pos])
+			l.pos++
+			return token{Kind: kind, Value: value, Line: start}, nil
+		}
+		l.pos++
+	}
+
+	return token{}, fmt.Errorf("unterminated string starting on line %d", start)
+}
+
+func min(x, y int) int {
+	if x < y {
+		return x
+	}
+	return y
+}
@@ -0,0 +1,91 @@
+package rules
+
+import (
+	"fmt"
+
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+)
+
+// TagPrefix marks tags which came from rules, so that they could be
+// told apart from the other ones when rules get re-evaluated.
+const TagPrefix = "rule:"
+
+// maxOffsets bounds memory spent on a pattern matching all over the file,
+// counts are kept precise regardless.
+const maxOffsets = 1024
+
+// Matcher runs rules over contents written into it chunk by chunk.
+// NOTE: a tail of previous chunk is kept so that matches spanning
+// across chunks are not missed.
+type Matcher struct {
+	rules  []*Rule
+	window int
+	offset int64
+	tail   []byte
+	hits   map[*Rule]map[string]*hits
+}
+
+func NewMatcher(rules []*Rule) *Matcher {
+	matcher := &Matcher{rules: rules, hits: map[*Rule]map[string]*hits{}}
+
+	for _, rule := range rules {
+		matcher.hits[rule] = map[string]*hits{}
+		for _, pattern := range rule.Patterns {
+			matcher.hits[rule][pattern.Name] = &hits{}
+			matcher.window = maxInt(matcher.window, pattern.maxLength-1)
+		}
+	}
+
+	return matcher
+}
+
+func (m *Matcher) Write(chunk []byte) (int, error) {
+	buf := append(m.tail, chunk...)
+	boundary := len(m.tail)
+	base := m.offset - int64(boundary)
+
+	for _, rule := range m.rules {
+		for _, pattern := range rule.Patterns {
+			found := m.hits[rule][pattern.Name]
+			pattern.find(buf, boundary, func(start int) {
+				offset := base + int64(start)
+
+				// NOTE: regex may report a match which started within tail
+				// once again, as leftmost match depends on the window
+				if found.count > 0 && found.last >= offset {
+					return
+				}
+
+				found.count++
+				found.last = offset
+				if len(found.offsets) < maxOffsets {
+					found.offsets = append(found.offsets, offset)
+				}
+			})
+		}
+	}
+
+	m.offset += int64(len(chunk))
+	m.tail = append([]byte{}, buf[maxInt(0, len(buf)-m.window):]...)
+	return len(chunk), nil
+}
+
+// Matches lists names of the rules which hold for contents written so far.
+func (m *Matcher) Matches() []string {
+	matches := []string{}
+
+	for _, rule := range m.rules {
+		if rule.Condition.eval(&state{size: m.offset, matches: m.hits[rule]}) {
+			matches = append(matches, rule.Name)
+		}
+	}
+
+	return matches
+}
+
+func (m *Matcher) Inspect(filename string, metadata *drweb.Metadata) error {
+	for _, name := range m.Matches() {
+		metadata.AddTag(fmt.Sprintf("%s%s", TagPrefix, name))
+	}
+	return nil
+}
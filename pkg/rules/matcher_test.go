@@ -0,0 +1,136 @@
+package rules_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+	"github.com/twonegatives/drweb_challenge/pkg/rules"
+)
+
+type matchCase struct {
+	Rule     string
+	Contents []byte
+	Matches  bool
+}
+
+func match(t *testing.T, source string, contents []byte, chunkSize int) []string {
+	parsed, err := rules.Parse(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	matcher := rules.NewMatcher(parsed)
+	for len(contents) > 0 {
+		size := chunkSize
+		if size > len(contents) {
+			size = len(contents)
+		}
+		matcher.Write(contents[:size])
+		contents = contents[size:]
+	}
+
+	return matcher.Matches()
+}
+
+func TestMatcher(t *testing.T) {
+	gopher, err := ioutil.ReadFile("../testdata/gopher.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alice, err := ioutil.ReadFile("../testdata/alice.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var objects = map[string]matchCase{
+		"jpeg magic at zero": {
+			Rule:     `rule r { strings: $jpeg = { FF D8 FF } condition: $jpeg at 0 }`,
+			Contents: gopher,
+			Matches:  true,
+		},
+		"jpeg magic elsewhere": {
+			Rule:     `rule r { strings: $jpeg = { FF D8 FF } condition: $jpeg in (1..100) }`,
+			Contents: gopher,
+			Matches:  false,
+		},
+		"hex nibbles and jumps": {
+			Rule:     `rule r { strings: $a = { 4? 4C [1-3] 43 45 } condition: $a }`,
+			Contents: []byte("xxALxICE"),
+			Matches:  true,
+		},
+		"text nocase": {
+			Rule:     `rule r { strings: $a = "white RABBIT" nocase condition: $a }`,
+			Contents: alice,
+			Matches:  true,
+		},
+		"text case sensitive": {
+			Rule:     `rule r { strings: $a = "white RABBIT" condition: $a }`,
+			Contents: alice,
+			Matches:  false,
+		},
+		"count comparison": {
+			Rule:     `rule r { strings: $a = "Alice" condition: #a == 9 and #a != 10 }`,
+			Contents: alice,
+			Matches:  true,
+		},
+		"regex": {
+			Rule:     `rule r { strings: $a = /Rabbit[- ]Hole/i condition: $a }`,
+			Contents: alice,
+			Matches:  true,
+		},
+		"all of them": {
+			Rule:     `rule r { strings: $a = "Alice" $b = "Cheshire Cat" condition: all of them }`,
+			Contents: alice,
+			Matches:  false,
+		},
+		"n of list": {
+			Rule:     `rule r { strings: $a = "Alice" $b = "Cheshire Cat" $c = "Rabbit" condition: 2 of ($a, $b, $c) }`,
+			Contents: alice,
+			Matches:  true,
+		},
+		"filesize and not": {
+			Rule:     `rule r { condition: filesize == 4094 and not filesize > 4KB }`,
+			Contents: alice,
+			Matches:  true,
+		},
+	}
+
+	for testName, testObject := range objects {
+		t.Run(testName, func(t *testing.T) {
+			// NOTE: tiny chunks make sure matches spanning across writes are found
+			for _, chunkSize := range []int{1, 7, 512, 1 << 20} {
+				matches := match(t, testObject.Rule, testObject.Contents, chunkSize)
+				assert.Equal(t, testObject.Matches, len(matches) == 1, "chunk size %d", chunkSize)
+			}
+		})
+	}
+}
+
+func TestMatcherCountsAcrossChunks(t *testing.T) {
+	contents := bytes.Repeat([]byte("abcab"), 100)
+	for _, chunkSize := range []int{1, 2, 3, 64} {
+		matches := match(t, `rule r { strings: $a = "cab" condition: #a == 100 }`, contents, chunkSize)
+		assert.Equal(t, []string{"r"}, matches, "chunk size %d", chunkSize)
+	}
+}
+
+func TestMatcherCountsPastOffsetsBound(t *testing.T) {
+	contents := bytes.Repeat([]byte("baa"), 2000)
+	for _, chunkSize := range []int{1, 2, 3, 64} {
+		matches := match(t, `rule r { strings: $a = /ba+/ condition: #a == 2000 }`, contents, chunkSize)
+		assert.Equal(t, []string{"r"}, matches, "chunk size %d", chunkSize)
+	}
+}
+
+func TestMatcherInspect(t *testing.T) {
+	parsed, _ := rules.Parse(`rule first { condition: true } rule second { condition: false }`)
+	matcher := rules.NewMatcher(parsed)
+	metadata := &drweb.Metadata{}
+
+	assert.Nil(t, matcher.Inspect("filename", metadata))
+	assert.Equal(t, []string{"rule:first"}, metadata.Tags)
+}
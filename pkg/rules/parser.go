@@ -0,0 +1,421 @@
+package rules
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Rule is a named set of patterns along with a condition over their matches.
+// Syntax follows YARA closely enough for simple rules:
+//
+//	rule eicar {
+//	  meta:
+//	    author = "alice"
+//	  strings:
+//	    $text = "EICAR-STANDARD-ANTIVIRUS-TEST-FILE" nocase
+//	    $hex = { 58 35 4F 21 ?? 40 [0-4] 50 }
+//	    $regex = /X5O!P%@AP\[4\\PZX54/
+//	  condition:
+//	    $hex at 0 and ($text or $regex) and filesize < 1KB
+//	}
+type Rule struct {
+	Name      string
+	Patterns  []*Pattern
+	Condition condition
+}
+
+type parser struct {
+	tokens   []token
+	pos      int
+	patterns map[string]*Pattern
+}
+
+// Parse reads every rule out of source.
+func Parse(source string) ([]*Rule, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	rules := []*Rule{}
+	names := map[string]bool{}
+
+	for p.peek().Kind != tokenEOF {
+		rule, err := p.parseRule()
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", p.peek().Line, err)
+		}
+
+		if names[rule.Name] {
+			return nil, fmt.Errorf("rule '%s' is defined twice", rule.Name)
+		}
+
+		names[rule.Name] = true
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) lookahead(offset int) token {
+	if p.pos+offset >= len(p.tokens) {
+		return p.tokens[len(p.tokens)-1]
+	}
+	return p.tokens[p.pos+offset]
+}
+
+func (p *parser) advance() token {
+	tok := p.tokens[p.pos]
+	if tok.Kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) is(kind tokenKind, value string) bool {
+	tok := p.peek()
+	return tok.Kind == kind && tok.Value == value
+}
+
+func (p *parser) accept(kind tokenKind, value string) bool {
+	if p.is(kind, value) {
+		p.advance()
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(kind tokenKind, value string) error {
+	if !p.accept(kind, value) {
+		return fmt.Errorf("expected '%s', got %s", value, p.peek())
+	}
+	return nil
+}
+
+func (p *parser) expectNumber() (int64, error) {
+	tok := p.advance()
+	if tok.Kind != tokenNumber {
+		return 0, fmt.Errorf("expected number, got %s", tok)
+	}
+	return strconv.ParseInt(tok.Value, 10, 64)
+}
+
+func (p *parser) parseRule() (*Rule, error) {
+	var err error
+
+	if err = p.expect(tokenIdent, "rule"); err != nil {
+		return nil, err
+	}
+
+	name := p.advance()
+	if name.Kind != tokenIdent {
+		return nil, fmt.Errorf("expected rule name, got %s", name)
+	}
+
+	rule := &Rule{Name: name.Value}
+	p.patterns = map[string]*Pattern{}
+
+	if err = p.expect(tokenPunct, "{"); err != nil {
+		return nil, err
+	}
+
+	if p.accept(tokenIdent, "meta") {
+		if err = p.parseMeta(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.accept(tokenIdent, "strings") {
+		if rule.Patterns, err = p.parsePatterns(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = p.expect(tokenIdent, "condition"); err != nil {
+		return nil, err
+	}
+
+	if err = p.expect(tokenPunct, ":"); err != nil {
+		return nil, err
+	}
+
+	if rule.Condition, err = p.parseOr(); err != nil {
+		return nil, err
+	}
+
+	return rule, p.expect(tokenPunct, "}")
+}
+
+// NOTE: meta is allowed for compatibility sake, we do not make use of it
+func (p *parser) parseMeta() error {
+	if err := p.expect(tokenPunct, ":"); err != nil {
+		return err
+	}
+
+	for p.peek().Kind == tokenIdent && !p.is(tokenIdent, "strings") && !p.is(tokenIdent, "condition") {
+		p.advance()
+		if err := p.expect(tokenPunct, "="); err != nil {
+			return err
+		}
+
+		switch value := p.advance(); value.Kind {
+		case tokenText, tokenNumber, tokenIdent:
+		default:
+			return fmt.Errorf("unexpected meta value %s", value)
+		}
+	}
+
+	return nil
+}
+
+func (p *parser) parsePatterns() ([]*Pattern, error) {
+	patterns := []*Pattern{}
+
+	if err := p.expect(tokenPunct, ":"); err != nil {
+		return nil, err
+	}
+
+	for p.peek().Kind == tokenVariable {
+		var pattern *Pattern
+		var err error
+
+		name := p.advance().Value
+		if _, ok := p.patterns[name]; ok {
+			return nil, fmt.Errorf("pattern $%s is defined twice", name)
+		}
+
+		if err = p.expect(tokenPunct, "="); err != nil {
+			return nil, err
+		}
+
+		switch value := p.advance(); value.Kind {
+		case tokenText:
+			nocase := p.accept(tokenIdent, "nocase")
+			pattern = newTextPattern(name, []byte(value.Value), nocase)
+		case tokenHex:
+			pattern, err = newHexPattern(name, value.Value)
+		case tokenRegex:
+			pattern, err = newRegexPattern(name, value.Value, value.Flags)
+		default:
+			err = fmt.Errorf("expected text, hex or regex string, got %s", value)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("pattern $%s: %s", name, err)
+		}
+
+		p.patterns[name] = pattern
+		patterns = append(patterns, pattern)
+	}
+
+	return patterns, nil
+}
+
+func (p *parser) parseOr() (condition, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.accept(tokenIdent, "or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orCondition{left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseAnd() (condition, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.accept(tokenIdent, "and") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &andCondition{left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseNot() (condition, error) {
+	if p.accept(tokenIdent, "not") {
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notCondition{operand: operand}, nil
+	}
+
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (condition, error) {
+	tok := p.peek()
+
+	switch {
+	case p.accept(tokenPunct, "("):
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return inner, p.expect(tokenPunct, ")")
+	case p.accept(tokenIdent, "true"):
+		return constantCondition(true), nil
+	case p.accept(tokenIdent, "false"):
+		return constantCondition(false), nil
+	case tok.Kind == tokenIdent && (tok.Value == "any" || tok.Value == "all"),
+		tok.Kind == tokenNumber && p.lookahead(1).Kind == tokenIdent && p.lookahead(1).Value == "of":
+		return p.parseOf()
+	case tok.Kind == tokenVariable:
+		return p.parseVariable()
+	}
+
+	return p.parseComparison()
+}
+
+func (p *parser) parseOf() (condition, error) {
+	quantifier := p.advance()
+	of := &ofCondition{}
+
+	switch quantifier.Value {
+	case "any":
+		of.min = 1
+	case "all":
+		of.min = -1
+	default:
+		of.min, _ = strconv.Atoi(quantifier.Value)
+	}
+
+	if err := p.expect(tokenIdent, "of"); err != nil {
+		return nil, err
+	}
+
+	if p.accept(tokenIdent, "them") {
+		for _, pattern := range p.patterns {
+			of.names = append(of.names, pattern.Name)
+		}
+		return of, nil
+	}
+
+	if err := p.expect(tokenPunct, "("); err != nil {
+		return nil, err
+	}
+
+	for {
+		name, err := p.parsePatternReference(tokenVariable)
+		if err != nil {
+			return nil, err
+		}
+		of.names = append(of.names, name)
+
+		if !p.accept(tokenPunct, ",") {
+			break
+		}
+	}
+
+	return of, p.expect(tokenPunct, ")")
+}
+
+func (p *parser) parsePatternReference(kind tokenKind) (string, error) {
+	tok := p.advance()
+	if tok.Kind != kind {
+		return "", fmt.Errorf("expected pattern reference, got %s", tok)
+	}
+
+	if _, ok := p.patterns[tok.Value]; !ok {
+		return "", fmt.Errorf("pattern $%s is not defined", tok.Value)
+	}
+
+	return tok.Value, nil
+}
+
+func (p *parser) parseVariable() (condition, error) {
+	name, err := p.parsePatternReference(tokenVariable)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case p.accept(tokenIdent, "at"):
+		offset, err := p.expectNumber()
+		return &atCondition{name: name, offset: offset}, err
+	case p.accept(tokenIdent, "in"):
+		var lower, upper int64
+
+		if err = p.expect(tokenPunct, "("); err != nil {
+			return nil, err
+		}
+		if lower, err = p.expectNumber(); err != nil {
+			return nil, err
+		}
+		if err = p.expect(tokenPunct, ".."); err != nil {
+			return nil, err
+		}
+		if upper, err = p.expectNumber(); err != nil {
+			return nil, err
+		}
+		return &inCondition{name: name, lower: lower, upper: upper}, p.expect(tokenPunct, ")")
+	}
+
+	return &matchCondition{name: name}, nil
+}
+
+func (p *parser) parseValue() (value, error) {
+	tok := p.peek()
+
+	switch tok.Kind {
+	case tokenNumber:
+		number, err := p.expectNumber()
+		return numberValue(number), err
+	case tokenCount:
+		name, err := p.parsePatternReference(tokenCount)
+		return countValue(name), err
+	case tokenIdent:
+		if tok.Value == "filesize" {
+			p.advance()
+			return filesizeValue{}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unexpected %s in condition", tok)
+}
+
+func (p *parser) parseComparison() (condition, error) {
+	left, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+
+	operator := p.advance()
+	if operator.Kind != tokenPunct || !isComparison(operator.Value) {
+		return nil, fmt.Errorf("expected comparison, got %s", operator)
+	}
+
+	right, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+
+	return &comparisonCondition{left: left, operator: operator.Value, right: right}, nil
+}
+
+func isComparison(operator string) bool {
+	switch operator {
+	case "<", "<=", ">", ">=", "==", "!=":
+		return true
+	}
+	return false
+}
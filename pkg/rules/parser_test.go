@@ -0,0 +1,58 @@
+package rules_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/twonegatives/drweb_challenge/pkg/rules"
+)
+
+func TestParse(t *testing.T) {
+	source := `
+// common test file
+rule eicar {
+  meta:
+    author = "alice"
+    severity = 3
+  strings:
+    $text = "EICAR-STANDARD-ANTIVIRUS-TEST-FILE" nocase
+    $hex = { 58 35 4F 21 ?? 40 [0-4] 50 }
+    $regex = /X5O!P%@AP\[4\\PZX54/i
+  condition:
+    $hex at 0 and ($text or $regex) and filesize < 1KB
+}
+
+/* no patterns at all */
+rule huge { condition: filesize > 10MB }
+`
+	parsed, err := rules.Parse(source)
+	assert.Nil(t, err)
+	assert.Len(t, parsed, 2)
+	assert.Equal(t, "eicar", parsed[0].Name)
+	assert.Len(t, parsed[0].Patterns, 3)
+	assert.Equal(t, "huge", parsed[1].Name)
+	assert.Len(t, parsed[1].Patterns, 0)
+}
+
+func TestParseFailure(t *testing.T) {
+	var objects = map[string]string{
+		"undefined pattern":   `rule a { strings: $a = "x" condition: $b }`,
+		"duplicated pattern":  `rule a { strings: $a = "x" $a = "y" condition: $a }`,
+		"duplicated rule":     `rule a { condition: true } rule a { condition: false }`,
+		"missing condition":   `rule a { strings: $a = "x" }`,
+		"odd hex":             `rule a { strings: $a = { 4D 5 } condition: $a }`,
+		"leading jump":        `rule a { strings: $a = { [2] 4D } condition: $a }`,
+		"huge jump":           `rule a { strings: $a = { 4D [0-100000] 5A } condition: $a }`,
+		"broken regex":        `rule a { strings: $a = /(unclosed/ condition: $a }`,
+		"unterminated string": "rule a { strings: $a = \"x\n condition: $a }",
+		"dangling operator":   `rule a { condition: filesize < }`,
+		"unknown character":   `rule a { condition: filesize ~ 1 }`,
+	}
+
+	for testName, source := range objects {
+		t.Run(testName, func(t *testing.T) {
+			_, err := rules.Parse(source)
+			assert.NotNil(t, err)
+		})
+	}
+}
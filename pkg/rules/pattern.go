@@ -0,0 +1,220 @@
+package rules
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// RegexWindow bounds how far a regex match may stretch.
+// Content is matched chunk by chunk while being uploaded,
+// so longer regex matches spanning across chunks would be missed.
+const RegexWindow = 4096
+
+const maxJump = 1024
+
+// Pattern is either a sequence of byte matchers (text and hex strings)
+// or a regex. Byte matchers support wildcards, nibbles, case folding and jumps.
+type Pattern struct {
+	Name      string
+	matchers  []byteMatcher
+	regex     *regexp.Regexp
+	maxLength int
+}
+
+type byteMatcher struct {
+	value       byte
+	alternative byte
+	mask        byte
+	jump        bool
+	jumpMin     int
+	jumpMax     int
+}
+
+func (m byteMatcher) matches(b byte) bool {
+	return b&m.mask == m.value || b&m.mask == m.alternative
+}
+
+func newTextPattern(name string, text []byte, nocase bool) *Pattern {
+	pattern := &Pattern{Name: name, maxLength: len(text)}
+
+	for _, char := range text {
+		matcher := byteMatcher{value: char, alternative: char, mask: 0xFF}
+		if nocase && char >= 'a' && char <= 'z' || nocase && char >= 'A' && char <= 'Z' {
+			matcher.value, matcher.alternative = char|0x20, char&^0x20
+		}
+		pattern.matchers = append(pattern.matchers, matcher)
+	}
+
+	return pattern
+}
+
+// newHexPattern parses hex strings like "4D 5A ?? 9? [2-4] 50 45".
+func newHexPattern(name string, hex string) (*Pattern, error) {
+	pattern := &Pattern{Name: name}
+	hex = strings.Join(strings.Fields(hex), "")
+
+	for i := 0; i < len(hex); {
+		if hex[i] == '[' {
+			end := strings.IndexByte(hex[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated jump")
+			}
+
+			matcher, err := parseJump(hex[i+1 : i+end])
+			if err != nil {
+				return nil, err
+			}
+
+			if len(pattern.matchers) == 0 {
+				return nil, fmt.Errorf("hex string should not start with a jump")
+			}
+
+			pattern.matchers = append(pattern.matchers, matcher)
+			pattern.maxLength += matcher.jumpMax
+			i += end + 1
+			continue
+		}
+
+		if i+1 >= len(hex) {
+			return nil, fmt.Errorf("odd number of hex digits")
+		}
+
+		matcher, err := parseHexByte(hex[i : i+2])
+		if err != nil {
+			return nil, err
+		}
+
+		pattern.matchers = append(pattern.matchers, matcher)
+		pattern.maxLength++
+		i += 2
+	}
+
+	if len(pattern.matchers) == 0 {
+		return nil, fmt.Errorf("hex string is empty")
+	}
+
+	if pattern.matchers[len(pattern.matchers)-1].jump {
+		return nil, fmt.Errorf("hex string should not end with a jump")
+	}
+
+	return pattern, nil
+}
+
+func parseHexByte(pair string) (byteMatcher, error) {
+	var matcher byteMatcher
+
+	for i, char := range pair {
+		shift := uint(4 * (1 - i))
+		if char == '?' {
+			continue
+		}
+
+		digit, err := strconv.ParseUint(string(char), 16, 8)
+		if err != nil {
+			return matcher, fmt.Errorf("malformed hex byte '%s'", pair)
+		}
+
+		matcher.value |= byte(digit) << shift
+		matcher.mask |= 0x0F << shift
+	}
+
+	matcher.alternative = matcher.value
+	return matcher, nil
+}
+
+func parseJump(spec string) (byteMatcher, error) {
+	var err error
+
+	matcher := byteMatcher{jump: true}
+	bounds := strings.SplitN(spec, "-", 2)
+
+	if matcher.jumpMin, err = strconv.Atoi(bounds[0]); err != nil {
+		return matcher, fmt.Errorf("malformed jump '[%s]'", spec)
+	}
+
+	matcher.jumpMax = matcher.jumpMin
+	if len(bounds) == 2 {
+		if matcher.jumpMax, err = strconv.Atoi(bounds[1]); err != nil {
+			return matcher, fmt.Errorf("malformed jump '[%s]'", spec)
+		}
+	}
+
+	if matcher.jumpMin < 0 || matcher.jumpMax < matcher.jumpMin || matcher.jumpMax > maxJump {
+		return matcher, fmt.Errorf("jump '[%s]' should be within 0..%d", spec, maxJump)
+	}
+
+	return matcher, nil
+}
+
+func newRegexPattern(name string, expr string, flags string) (*Pattern, error) {
+	if flags != "" {
+		expr = fmt.Sprintf("(?%s)%s", flags, expr)
+	}
+
+	regex, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Pattern{Name: name, regex: regex, maxLength: RegexWindow}, nil
+}
+
+// find reports matches within buf which end after boundary,
+// the ones ending before it were reported during previous chunk.
+func (p *Pattern) find(buf []byte, boundary int, report func(start int)) {
+	if p.regex != nil {
+		for _, match := range p.regex.FindAllIndex(buf, -1) {
+			if match[1] > boundary && match[1] > match[0] {
+				report(match[0])
+			}
+		}
+		return
+	}
+
+	first := p.matchers[0]
+	exact := first.mask == 0xFF && first.value == first.alternative
+
+	for start := maxInt(0, boundary-p.maxLength+1); start < len(buf); start++ {
+		if exact {
+			next := bytes.IndexByte(buf[start:], first.value)
+			if next < 0 {
+				return
+			}
+			start += next
+		}
+
+		if end, ok := matchAt(p.matchers, buf, start); ok && end > boundary {
+			report(start)
+		}
+	}
+}
+
+func matchAt(matchers []byteMatcher, buf []byte, pos int) (int, bool) {
+	for i, matcher := range matchers {
+		if matcher.jump {
+			for skip := matcher.jumpMin; skip <= matcher.jumpMax; skip++ {
+				if end, ok := matchAt(matchers[i+1:], buf, pos+skip); ok {
+					return end, true
+				}
+			}
+			return 0, false
+		}
+
+		if pos >= len(buf) || !matcher.matches(buf[pos]) {
+			return 0, false
+		}
+		pos++
+	}
+
+	return pos, true
+}
+
+func maxInt(x, y int) int {
+	if x > y {
+		return x
+	}
+	return y
+}
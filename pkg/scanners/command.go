@@ -0,0 +1,58 @@
+package scanners
+
+import (
+	"bytes"
+	"io"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+)
+
+// CommandScanner pipes file contents to an external antivirus command
+// (drweb-ctl, clamdscan and alike) and judges the verdict by its exit code.
+// Whatever the command prints to stdout is treated as a threat name.
+type CommandScanner struct {
+	Path             string
+	Args             []string
+	VersionArgs      []string
+	InfectedExitCode int
+}
+
+func (s *CommandScanner) Scan(input io.Reader) (*drweb.ScanResult, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.Command(s.Path, s.Args...)
+	cmd.Stdin = input
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err == nil {
+		return &drweb.ScanResult{}, nil
+	}
+
+	if exitErr, ok := err.(*exec.ExitError); ok && exitCode(exitErr) == s.InfectedExitCode {
+		return &drweb.ScanResult{Infected: true, Threat: strings.TrimSpace(stdout.String())}, nil
+	}
+
+	return nil, errors.Wrapf(err, "failed to scan input: %s", strings.TrimSpace(stderr.String()))
+}
+
+func (s *CommandScanner) Version() (string, error) {
+	output, err := exec.Command(s.Path, s.VersionArgs...).Output()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get signatures version")
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
+
+func exitCode(err *exec.ExitError) int {
+	if status, ok := err.Sys().(syscall.WaitStatus); ok {
+		return status.ExitStatus()
+	}
+	return -1
+}
@@ -0,0 +1,46 @@
+package scanners_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/twonegatives/drweb_challenge/pkg/scanners"
+)
+
+func generateScanner() *scanners.CommandScanner {
+	return &scanners.CommandScanner{
+		Path:             "sh",
+		Args:             []string{"-c", "if grep -q EICAR; then echo EICAR-Test-File; exit 1; fi"},
+		VersionArgs:      []string{"-c", "echo 2018.07.31"},
+		InfectedExitCode: 1,
+	}
+}
+
+func TestCommandScannerScan(t *testing.T) {
+	scanner := generateScanner()
+
+	result, err := scanner.Scan(strings.NewReader("harmless contents"))
+	assert.Nil(t, err)
+	assert.False(t, result.Infected)
+
+	result, err = scanner.Scan(strings.NewReader("X5O!P%@AP EICAR STANDARD ANTIVIRUS TEST FILE"))
+	assert.Nil(t, err)
+	assert.True(t, result.Infected)
+	assert.Equal(t, "EICAR-Test-File", result.Threat)
+}
+
+func TestCommandScannerFailure(t *testing.T) {
+	scanner := generateScanner()
+	scanner.Args = []string{"-c", "echo database is missing >&2; exit 2"}
+
+	_, err := scanner.Scan(strings.NewReader("contents"))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "database is missing")
+}
+
+func TestCommandScannerVersion(t *testing.T) {
+	version, err := generateScanner().Version()
+	assert.Nil(t, err)
+	assert.Equal(t, "2018.07.31", version)
+}
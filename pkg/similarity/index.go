@@ -0,0 +1,230 @@
+package similarity
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+)
+
+// Index looks up similar files without comparing against every stored one.
+// ssdeep scores digests having no common substring of rollingWindow length
+// as zero, so digests are indexed by such substrings (n-grams) along with
+// their block size, and only the ones sharing an n-gram get compared.
+type Index struct {
+	Metadata drweb.MetadataStore
+	mutex    sync.RWMutex
+	ids      map[string]uint32
+	entries  []*entry
+	postings map[uint64][]uint32
+}
+
+type entry struct {
+	filename string
+	ssdeep   string
+	digest   *Digest
+}
+
+// Load indexes every file known to metadata store.
+func (i *Index) Load() error {
+	list, err := i.Metadata.List()
+	if err != nil {
+		return err
+	}
+
+	for _, metadata := range list {
+		if metadata.Ssdeep == "" {
+			continue
+		}
+
+		if err = i.Add(metadata.Filename, metadata.Ssdeep); err != nil {
+			log.WithError(err).WithField("hashstring", metadata.Filename).Warn("failed to index file")
+		}
+	}
+
+	log.WithField("files", len(i.ids)).Info("similarity index loaded")
+	return nil
+}
+
+func (i *Index) Add(filename string, ssdeep string) error {
+	digest, err := ParseDigest(ssdeep)
+	if err != nil {
+		return err
+	}
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	if i.ids == nil {
+		i.ids = map[string]uint32{}
+		i.postings = map[uint64][]uint32{}
+	}
+
+	if _, ok := i.ids[filename]; ok {
+		i.remove(filename)
+	}
+
+	id := uint32(len(i.entries))
+	i.ids[filename] = id
+	i.entries = append(i.entries, &entry{filename: filename, ssdeep: ssdeep, digest: digest})
+
+	for _, key := range keys(digest) {
+		i.postings[key] = append(i.postings[key], id)
+	}
+
+	return nil
+}
+
+func (i *Index) Remove(filename string) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.remove(filename)
+}
+
+// NOTE: ids are never reused, removed entries leave a nil behind
+func (i *Index) remove(filename string) {
+	id, ok := i.ids[filename]
+	if !ok {
+		return
+	}
+
+	for _, key := range keys(i.entries[id].digest) {
+		posting := i.postings[key][:0]
+		for _, other := range i.postings[key] {
+			if other != id {
+				posting = append(posting, other)
+			}
+		}
+
+		if len(posting) == 0 {
+			delete(i.postings, key)
+		} else {
+			i.postings[key] = posting
+		}
+	}
+
+	i.entries[id] = nil
+	delete(i.ids, filename)
+}
+
+// Similar lists up to limit files scoring at least threshold against
+// the given one, the most similar go first.
+func (i *Index) Similar(filename string, threshold int, limit int) ([]*drweb.SimilarFile, error) {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+
+	id, ok := i.ids[filename]
+	if !ok {
+		return nil, drweb.ErrNotIndexed
+	}
+
+	query := i.entries[id].digest
+	similar := []*drweb.SimilarFile{}
+	seen := map[uint32]bool{id: true}
+
+	for _, key := range keys(query) {
+		for _, candidate := range i.postings[key] {
+			if seen[candidate] {
+				continue
+			}
+			seen[candidate] = true
+
+			found := i.entries[candidate]
+			if score := Compare(query, found.digest); score > 0 && score >= threshold {
+				similar = append(similar, &drweb.SimilarFile{Filename: found.filename, Ssdeep: found.ssdeep, Score: score})
+			}
+		}
+	}
+
+	sort.Slice(similar, func(a, b int) bool {
+		if similar[a].Score != similar[b].Score {
+			return similar[a].Score > similar[b].Score
+		}
+		return similar[a].Filename < similar[b].Filename
+	})
+
+	if limit > 0 && len(similar) > limit {
+		similar = similar[:limit]
+	}
+
+	return similar, nil
+}
+
+// Enqueue indexes freshly stored file, digest is computed by the inspector.
+func (i *Index) Enqueue(filename string) {
+	metadata, err := i.Metadata.Get(filename)
+	if err != nil {
+		log.WithError(err).WithField("hashstring", filename).Error("failed to index file")
+		return
+	}
+
+	if metadata.Ssdeep == "" {
+		return
+	}
+
+	if err = i.Add(filename, metadata.Ssdeep); err != nil {
+		log.WithError(err).WithField("hashstring", filename).Error("failed to index file")
+	}
+}
+
+func (i *Index) Forget(filename string) error {
+	i.Remove(filename)
+	return nil
+}
+
+func (i *Index) NewInspector() drweb.Inspector {
+	return &inspector{hasher: NewHasher()}
+}
+
+type inspector struct {
+	hasher *Hasher
+}
+
+func (i *inspector) Write(p []byte) (int, error) {
+	return i.hasher.Write(p)
+}
+
+func (i *inspector) Inspect(filename string, metadata *drweb.Metadata) error {
+	metadata.Ssdeep = i.hasher.Sum()
+	return nil
+}
+
+// keys lists unique n-grams of both digest parts, the second part
+// being computed with twice as big block size.
+func keys(digest *Digest) []uint64 {
+	unique := map[uint64]bool{}
+	result := []uint64{}
+
+	level := blockLevel(digest.BlockSize)
+	for part, s := range []string{digest.First, digest.Second} {
+		for start := 0; start+rollingWindow <= len(s); start++ {
+			key := gramKey(level+part, s[start:start+rollingWindow])
+			if !unique[key] {
+				unique[key] = true
+				result = append(result, key)
+			}
+		}
+	}
+
+	return result
+}
+
+// gramKey packs block size level along with 7 base64 characters
+// (6 bits each) into a single integer.
+func gramKey(level int, gram string) uint64 {
+	key := uint64(level)
+	for _, c := range []byte(gram) {
+		key = key<<6 | uint64(strings.IndexByte(base64Alphabet, c))
+	}
+	return key
+}
+
+func blockLevel(size uint32) int {
+	level := 0
+	for minBlockSize<<uint(level) < size {
+		level++
+	}
+	return level
+}
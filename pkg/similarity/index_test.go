@@ -0,0 +1,128 @@
+package similarity_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+	"github.com/twonegatives/drweb_challenge/pkg/pathgenerators"
+	"github.com/twonegatives/drweb_challenge/pkg/similarity"
+	"github.com/twonegatives/drweb_challenge/pkg/storages"
+)
+
+func generateIndex(t *testing.T) (*similarity.Index, func()) {
+	base, err := ioutil.TempDir("../../tmp", "similarity")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metadata := &storages.FileSystemMetadataStore{
+		BasePath:          base,
+		FileMode:          0700,
+		FilePathGenerator: &pathgenerators.NestedGenerator{BasePath: base, Levels: 1, FolderLength: 2},
+	}
+
+	return &similarity.Index{Metadata: metadata}, func() { os.RemoveAll(base) }
+}
+
+func similarNames(found []*drweb.SimilarFile) []string {
+	names := []string{}
+	for _, file := range found {
+		names = append(names, fmt.Sprintf("%s:%d", file.Filename, file.Score))
+	}
+	return names
+}
+
+func TestIndexSimilar(t *testing.T) {
+	index, cleanup := generateIndex(t)
+	defer cleanup()
+
+	alice := readFixture(t, "alice.txt")
+	edited := []byte(strings.Replace(string(alice), "Rabbit", "Hare", -1))
+
+	assert.Nil(t, index.Add("alice", digest(alice, 512)))
+	assert.Nil(t, index.Add("edited", digest(edited, 512)))
+	assert.Nil(t, index.Add("prefix", digest(alice[:2000], 512)))
+	assert.Nil(t, index.Add("gopher", digest(readFixture(t, "gopher.jpg"), 512)))
+	assert.NotNil(t, index.Add("broken", "not a digest"))
+
+	// NOTE: noise which should never be even compared against
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		contents := make([]byte, 4096+random.Intn(4096))
+		random.Read(contents)
+		assert.Nil(t, index.Add(fmt.Sprintf("random%d", i), digest(contents, 512)))
+	}
+
+	found, err := index.Similar("alice", 1, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"edited:97", "prefix:65"}, similarNames(found))
+
+	found, err = index.Similar("alice", 70, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"edited:97"}, similarNames(found))
+
+	found, err = index.Similar("alice", 1, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"edited:97"}, similarNames(found))
+
+	found, err = index.Similar("prefix", 1, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"alice:65", "edited:60"}, similarNames(found))
+
+	index.Remove("edited")
+	found, err = index.Similar("alice", 1, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"prefix:65"}, similarNames(found))
+
+	_, err = index.Similar("edited", 1, 10)
+	assert.Equal(t, drweb.ErrNotIndexed, err)
+}
+
+func TestIndexLoad(t *testing.T) {
+	index, cleanup := generateIndex(t)
+	defer cleanup()
+
+	alice := readFixture(t, "alice.txt")
+	for filename, contents := range map[string][]byte{"aaaa": alice, "bbbb": alice[:2000], "cccc": nil} {
+		inspector := index.NewInspector()
+		inspector.Write(contents)
+
+		metadata := &drweb.Metadata{}
+		assert.Nil(t, inspector.Inspect(filename, metadata))
+		if contents == nil {
+			metadata.Ssdeep = ""
+		}
+
+		index.Metadata.Update(filename, func(stored *drweb.Metadata) error {
+			stored.Merge(metadata)
+			return nil
+		})
+	}
+
+	// NOTE: freshly stored files get indexed as post-save job
+	index.Enqueue("aaaa")
+	found, err := index.Similar("aaaa", 1, 10)
+	assert.Nil(t, err)
+	assert.Empty(t, found)
+
+	loaded := &similarity.Index{Metadata: index.Metadata}
+	assert.Nil(t, loaded.Load())
+
+	found, err = loaded.Similar("aaaa", 1, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"bbbb:65"}, similarNames(found))
+
+	_, err = loaded.Similar("cccc", 1, 10)
+	assert.Equal(t, drweb.ErrNotIndexed, err)
+
+	assert.Nil(t, loaded.Forget("bbbb"))
+	found, err = loaded.Similar("aaaa", 1, 10)
+	assert.Nil(t, err)
+	assert.Empty(t, found)
+}
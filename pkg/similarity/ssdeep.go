@@ -0,0 +1,353 @@
+package similarity
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// NOTE: constants and the algorithm follow ssdeep (spamsum) closely,
+// so that digests are interchangeable with the ones ssdeep tool produces.
+const (
+	rollingWindow  = 7
+	minBlockSize   = 3
+	digestLength   = 64
+	blockHashCount = 31
+	hashInit       = 0x27
+	hashPrime      = 0x93
+	base64Alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+)
+
+type rollingHash struct {
+	window     [rollingWindow]byte
+	h1, h2, h3 uint32
+	n          int
+}
+
+func (r *rollingHash) roll(c byte) {
+	r.h2 -= r.h1
+	r.h2 += rollingWindow * uint32(c)
+
+	r.h1 += uint32(c)
+	r.h1 -= uint32(r.window[r.n])
+
+	r.window[r.n] = c
+	r.n = (r.n + 1) % rollingWindow
+
+	r.h3 <<= 5
+	r.h3 ^= uint32(c)
+}
+
+func (r *rollingHash) sum() uint32 {
+	return r.h1 + r.h2 + r.h3
+}
+
+// NOTE: only the lowest 6 bits of FNV hash ever make it into a digest,
+// so it is computed modulo 64 right away.
+func sumHash(c byte, h byte) byte {
+	return (h*hashPrime ^ c) % 64
+}
+
+// blockHash keeps digest of a single block size. Once digest is full
+// its last character keeps changing, tail holds the latest one.
+type blockHash struct {
+	h, half          byte
+	digest           []byte
+	tail, halfTail   byte
+	hasTail, hasHalf bool
+}
+
+// Hasher computes ssdeep digest of contents written into it,
+// digests of every block size are computed at once in a single pass.
+type Hasher struct {
+	roll   rollingHash
+	size   uint64
+	start  int
+	end    int
+	blocks [blockHashCount]blockHash
+}
+
+func NewHasher() *Hasher {
+	hasher := &Hasher{end: 1}
+	hasher.blocks[0] = blockHash{h: hashInit, half: hashInit}
+	return hasher
+}
+
+func blockSize(index int) uint32 {
+	return minBlockSize << uint(index)
+}
+
+func (s *Hasher) Write(p []byte) (int, error) {
+	for _, c := range p {
+		s.step(c)
+	}
+	return len(p), nil
+}
+
+func (s *Hasher) step(c byte) {
+	s.size++
+	s.roll.roll(c)
+	sum := s.roll.sum()
+
+	for i := s.start; i < s.end; i++ {
+		s.blocks[i].h = sumHash(c, s.blocks[i].h)
+		s.blocks[i].half = sumHash(c, s.blocks[i].half)
+	}
+
+	for i := s.start; i < s.end; i++ {
+		// NOTE: block sizes double, so once a trigger misses
+		// the smaller block size it misses the bigger ones too
+		if sum%blockSize(i) != blockSize(i)-1 {
+			break
+		}
+
+		block := &s.blocks[i]
+		if len(block.digest) == 0 {
+			s.fork()
+		}
+
+		block.halfTail, block.hasHalf = block.half, true
+		if len(block.digest) < digestLength-1 {
+			block.digest = append(block.digest, block.h)
+			block.h = hashInit
+			if len(block.digest) < digestLength/2 {
+				block.half = hashInit
+				block.hasHalf = false
+			}
+		} else {
+			block.tail, block.hasTail = block.h, true
+			s.reduce()
+		}
+	}
+}
+
+// fork starts digest of the next block size.
+func (s *Hasher) fork() {
+	if s.end >= blockHashCount {
+		return
+	}
+
+	previous := s.blocks[s.end-1]
+	s.blocks[s.end] = blockHash{h: previous.h, half: previous.half}
+	s.end++
+}
+
+// reduce drops the smallest block size once it can not be chosen anymore.
+func (s *Hasher) reduce() {
+	if s.end-s.start < 2 {
+		return
+	}
+
+	if uint64(blockSize(s.start))*digestLength >= s.size {
+		return
+	}
+
+	if len(s.blocks[s.start+1].digest) < digestLength/2 {
+		return
+	}
+
+	s.blocks[s.start].digest = nil
+	s.start++
+}
+
+// Sum returns digest of contents written so far.
+func (s *Hasher) Sum() string {
+	i := s.start
+	for uint64(blockSize(i))*digestLength < s.size && i < blockHashCount-1 {
+		i++
+	}
+
+	if i >= s.end {
+		i = s.end - 1
+	}
+
+	for i > s.start && len(s.blocks[i].digest) < digestLength/2 {
+		i--
+	}
+
+	var second blockHash
+	first, hasSecond := s.blocks[i], i+1 < s.end
+	if hasSecond {
+		second = s.blocks[i+1]
+	}
+
+	firstDigest := append([]byte{}, first.digest...)
+	secondDigest := append([]byte{}, second.digest...)
+	if len(secondDigest) > digestLength/2-1 {
+		secondDigest = secondDigest[:digestLength/2-1]
+	}
+
+	if s.roll.sum() != 0 {
+		firstDigest = append(firstDigest, first.h)
+		if hasSecond {
+			secondDigest = append(secondDigest, second.half)
+		} else {
+			secondDigest = append(secondDigest, first.h)
+		}
+	} else {
+		if first.hasTail {
+			firstDigest = append(firstDigest, first.tail)
+		}
+		if second.hasHalf {
+			secondDigest = append(secondDigest, second.halfTail)
+		}
+	}
+
+	return fmt.Sprintf("%d:%s:%s", blockSize(i), encode(firstDigest), encode(secondDigest))
+}
+
+func encode(digest []byte) string {
+	encoded := make([]byte, len(digest))
+	for i, c := range digest {
+		encoded[i] = base64Alphabet[c]
+	}
+	return string(encoded)
+}
+
+// Digest is a parsed ssdeep digest, runs of more than three equal
+// characters are cut down to three as they carry little information.
+type Digest struct {
+	BlockSize uint32
+	First     string
+	Second    string
+}
+
+func ParseDigest(digest string) (*Digest, error) {
+	parts := strings.SplitN(digest, ":", 3)
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed ssdeep digest '%s'", digest)
+	}
+
+	size, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil || size < minBlockSize || !isBlockSize(uint32(size)) {
+		return nil, fmt.Errorf("malformed ssdeep digest '%s'", digest)
+	}
+
+	for _, c := range []byte(parts[1] + parts[2]) {
+		if strings.IndexByte(base64Alphabet, c) < 0 {
+			return nil, fmt.Errorf("malformed ssdeep digest '%s'", digest)
+		}
+	}
+
+	return &Digest{
+		BlockSize: uint32(size),
+		First:     eliminateSequences(parts[1]),
+		Second:    eliminateSequences(parts[2]),
+	}, nil
+}
+
+func isBlockSize(size uint32) bool {
+	for i := 0; i < blockHashCount; i++ {
+		if blockSize(i) == size {
+			return true
+		}
+	}
+	return false
+}
+
+func eliminateSequences(s string) string {
+	result := []byte{}
+	for i := 0; i < len(s); i++ {
+		if i >= 3 && s[i] == s[i-1] && s[i] == s[i-2] && s[i] == s[i-3] {
+			continue
+		}
+		result = append(result, s[i])
+	}
+	return string(result)
+}
+
+// Compare scores similarity of two digests from 0 (nothing alike) to 100.
+func Compare(a, b *Digest) int {
+	switch {
+	case a.BlockSize == b.BlockSize && a.First == b.First:
+		return 100
+	case a.BlockSize == b.BlockSize:
+		return maxInt(scoreStrings(a.First, b.First, a.BlockSize), scoreStrings(a.Second, b.Second, a.BlockSize*2))
+	case a.BlockSize == b.BlockSize*2:
+		return scoreStrings(a.First, b.Second, a.BlockSize)
+	case b.BlockSize == a.BlockSize*2:
+		return scoreStrings(a.Second, b.First, b.BlockSize)
+	}
+	return 0
+}
+
+func scoreStrings(a, b string, blockSize uint32) int {
+	if !hasCommonSubstring(a, b) {
+		return 0
+	}
+
+	score := editDistance(a, b) * digestLength / (len(a) + len(b))
+	score = 100 * score / digestLength
+	if score >= 100 {
+		return 0
+	}
+	score = 100 - score
+
+	// NOTE: digests of small block sizes are short and match way too easily,
+	// so their score is capped
+	if blockSize >= (99+rollingWindow)/rollingWindow*minBlockSize {
+		return score
+	}
+
+	limit := int(blockSize) / minBlockSize * minInt(len(a), len(b))
+	return minInt(score, limit)
+}
+
+// NOTE: digests having no common substring of rollingWindow length
+// are considered unrelated, which is what makes n-gram index possible.
+func hasCommonSubstring(a, b string) bool {
+	if len(a) < rollingWindow || len(b) < rollingWindow {
+		return false
+	}
+
+	grams := map[string]bool{}
+	for i := 0; i+rollingWindow <= len(a); i++ {
+		grams[a[i:i+rollingWindow]] = true
+	}
+
+	for i := 0; i+rollingWindow <= len(b); i++ {
+		if grams[b[i:i+rollingWindow]] {
+			return true
+		}
+	}
+	return false
+}
+
+// editDistance is Levenshtein distance where substitution costs
+// as much as deletion followed by insertion.
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			substitution := previous[j-1]
+			if a[i-1] != b[j-1] {
+				substitution += 2
+			}
+			current[j] = minInt(substitution, minInt(previous[j]+1, current[j-1]+1))
+		}
+		previous, current = current, previous
+	}
+
+	return previous[len(b)]
+}
+
+func minInt(x, y int) int {
+	if x < y {
+		return x
+	}
+	return y
+}
+
+func maxInt(x, y int) int {
+	if x > y {
+		return x
+	}
+	return y
+}
@@ -0,0 +1,96 @@
+package similarity_test
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/twonegatives/drweb_challenge/pkg/similarity"
+)
+
+func readFixture(t *testing.T, name string) []byte {
+	contents, err := ioutil.ReadFile("../testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return contents
+}
+
+func digest(contents []byte, chunkSize int) string {
+	hasher := similarity.NewHasher()
+	for len(contents) > 0 {
+		size := chunkSize
+		if size > len(contents) {
+			size = len(contents)
+		}
+		hasher.Write(contents[:size])
+		contents = contents[size:]
+	}
+	return hasher.Sum()
+}
+
+func TestHasher(t *testing.T) {
+	alice := readFixture(t, "alice.txt")
+
+	// NOTE: expected digests are the ones ssdeep tool gives
+	var objects = map[string]struct {
+		Contents []byte
+		Digest   string
+	}{
+		"empty":  {Contents: []byte{}, Digest: "3::"},
+		"text":   {Contents: alice, Digest: "96:DfpmV2DLQputhj+2SqQ8fo/lSXnVDXW6xa:NmM42SGVDW6Y"},
+		"prefix": {Contents: alice[:2000], Digest: "48:DPEQpRkhD2uGxkCB/zID9fKBthkDQj63n:DfpmV2DLQputhj+X"},
+		"image":  {Contents: readFixture(t, "gopher.jpg"), Digest: "192:RAXPdvoeJ4rVOQHqBCbutr3Dohl+zeBCrjgJgFWd+:Rm1voxYymCO3yl+zeBcjgJiWA"},
+	}
+
+	for testName, testObject := range objects {
+		t.Run(testName, func(t *testing.T) {
+			for _, chunkSize := range []int{1, 7, 512, 1024 * 1024} {
+				assert.Equal(t, testObject.Digest, digest(testObject.Contents, chunkSize), chunkSize)
+			}
+		})
+	}
+}
+
+func TestCompare(t *testing.T) {
+	alice := readFixture(t, "alice.txt")
+	edited := []byte(strings.Replace(string(alice), "Rabbit", "Hare", -1))
+
+	var objects = map[string]struct {
+		First  string
+		Second string
+		Score  int
+	}{
+		"identical":          {First: digest(alice, 512), Second: digest(alice, 512), Score: 100},
+		"edited":             {First: digest(alice, 512), Second: digest(edited, 512), Score: 97},
+		"half block size":    {First: digest(alice, 512), Second: digest(alice[:2000], 512), Score: 65},
+		"unrelated":          {First: digest(alice, 512), Second: digest(readFixture(t, "gopher.jpg"), 512), Score: 0},
+		"block size too far": {First: "3:abcdefgh:abcdefgh", Second: "12:abcdefgh:abcdefgh", Score: 0},
+	}
+
+	for testName, testObject := range objects {
+		t.Run(testName, func(t *testing.T) {
+			first, err := similarity.ParseDigest(testObject.First)
+			assert.Nil(t, err)
+			second, err := similarity.ParseDigest(testObject.Second)
+			assert.Nil(t, err)
+
+			assert.Equal(t, testObject.Score, similarity.Compare(first, second))
+			assert.Equal(t, testObject.Score, similarity.Compare(second, first))
+		})
+	}
+}
+
+func TestParseDigest(t *testing.T) {
+	digest, err := similarity.ParseDigest("6:aaaaaabc:xyyyyyy")
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(6), digest.BlockSize)
+	assert.Equal(t, "aaabc", digest.First)
+	assert.Equal(t, "xyyy", digest.Second)
+
+	for _, malformed := range []string{"", "6:abc", "x:abc:abc", "5:abc:abc", "6:ab!c:abc"} {
+		_, err = similarity.ParseDigest(malformed)
+		assert.NotNil(t, err, malformed)
+	}
+}
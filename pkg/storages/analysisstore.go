@@ -0,0 +1,82 @@
+package storages
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+)
+
+const analysisExt = ".analysis.json"
+
+// FileSystemAnalysisStore keeps executable analyses as json documents.
+// NOTE: analyses have a folder of their own, as files may be kept anywhere but on local disk.
+type FileSystemAnalysisStore struct {
+	FileMode          os.FileMode
+	FilePathGenerator drweb.FilePathGenerator
+}
+
+func (s *FileSystemAnalysisStore) filepath(filename string) (string, error) {
+	path, err := s.FilePathGenerator.Generate(filename)
+	return path + analysisExt, err
+}
+
+func (s *FileSystemAnalysisStore) Get(filename string) (*drweb.Analysis, error) {
+	var analysis drweb.Analysis
+	var contents []byte
+	var path string
+	var err error
+
+	if path, err = s.filepath(filename); err != nil {
+		return nil, errors.Wrap(err, "failed to generate filepath")
+	}
+
+	if contents, err = ioutil.ReadFile(path); err != nil {
+		return nil, errors.Wrap(err, "failed to read analysis")
+	}
+
+	if err = json.Unmarshal(contents, &analysis); err != nil {
+		return nil, errors.Wrap(err, "failed to decode analysis")
+	}
+
+	return &analysis, nil
+}
+
+func (s *FileSystemAnalysisStore) Put(analysis *drweb.Analysis) error {
+	var contents []byte
+	var path string
+	var err error
+
+	if path, err = s.filepath(analysis.Filename); err != nil {
+		return errors.Wrap(err, "failed to generate filepath")
+	}
+
+	if contents, err = json.Marshal(analysis); err != nil {
+		return errors.Wrap(err, "failed to encode analysis")
+	}
+
+	if err = os.MkdirAll(filepath.Dir(path), s.FileMode); err != nil {
+		return errors.Wrap(err, "failed to create nested folders")
+	}
+
+	tmpPath := path + ".tmp"
+	if err = ioutil.WriteFile(tmpPath, contents, s.FileMode); err != nil {
+		return errors.Wrap(err, "failed to write analysis")
+	}
+
+	return errors.Wrap(os.Rename(tmpPath, path), "failed to write analysis")
+}
+
+func (s *FileSystemAnalysisStore) Delete(filename string) error {
+	var path string
+	var err error
+
+	if path, err = s.filepath(filename); err != nil {
+		return errors.Wrap(err, "failed to generate filepath")
+	}
+
+	return os.Remove(path)
+}
@@ -0,0 +1,46 @@
+package storages_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	pkgerrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+	"github.com/twonegatives/drweb_challenge/pkg/pathgenerators"
+	"github.com/twonegatives/drweb_challenge/pkg/storages"
+)
+
+func TestAnalysisStore(t *testing.T) {
+	base, err := ioutil.TempDir("../../tmp", "analysis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(base)
+
+	store := &storages.FileSystemAnalysisStore{
+		FileMode:          0700,
+		FilePathGenerator: &pathgenerators.NestedGenerator{BasePath: base, Levels: 1, FolderLength: 2},
+	}
+
+	_, err = store.Get("abcdef")
+	assert.True(t, os.IsNotExist(pkgerrors.Cause(err)))
+
+	err = store.Put(&drweb.Analysis{Filename: "abcdef", Format: "pe", Exports: []string{"hello"}})
+	assert.Nil(t, err)
+
+	// NOTE: analysis lies right next to where the blob would be
+	_, err = os.Stat(path.Join(base, "ab", "abcdef.analysis.json"))
+	assert.Nil(t, err)
+
+	analysis, err := store.Get("abcdef")
+	assert.Nil(t, err)
+	assert.Equal(t, "pe", analysis.Format)
+	assert.Equal(t, []string{"hello"}, analysis.Exports)
+
+	assert.Nil(t, store.Delete("abcdef"))
+	_, err = store.Get("abcdef")
+	assert.True(t, os.IsNotExist(pkgerrors.Cause(err)))
+}
@@ -0,0 +1,565 @@
+package storages
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+)
+
+const (
+	cacheOpPut    = "put"
+	cacheOpUse    = "use"
+	cacheOpDelete = "delete"
+	cacheOpPin    = "pin"
+	cacheOpUnpin  = "unpin"
+)
+
+// NOTE: ledger is compacted once it has that many more records than needed
+const cacheLedgerSlack = 4096
+
+// CacheStorage keeps Storage within MaxSize bytes in total, evicting the least
+// recently (drweb.CachePolicyLRU) or the least frequently (drweb.CachePolicyLFU)
+// used files to make room for uploads. Pinned files are never evicted, an upload
+// which does not fit next to them fails with drweb.ErrStorageFull.
+// Sizes, uses and pins are appended to a ledger at LedgerPath and replayed by Open,
+// which recounts files of Storage if there is no ledger yet.
+// Evicted files are forgotten by Jobs and have their Metadata deleted, as if
+// they were deleted through the storages above, either may be left unset.
+type CacheStorage struct {
+	Storage    drweb.WalkableStorage
+	MaxSize    int64
+	Policy     string
+	LedgerPath string
+	FileMode   os.FileMode
+	Metadata   drweb.MetadataStore
+	Jobs       []drweb.PostSaveJob
+
+	mutex   sync.Mutex
+	entries map[string]*cacheEntry
+	pins    map[string]bool
+	queue   *cacheQueue
+	clock   uint64
+	size    int64
+	ledger  *os.File
+	records int
+	stats   drweb.CacheStats
+	evicted []string
+}
+
+type cacheEntry struct {
+	filename string
+	size     int64
+	uses     uint64
+	// NOTE: clock tick of the last use, which keeps uses in order across restarts
+	used uint64
+	// NOTE: position in eviction queue, -1 for pinned files
+	index int
+}
+
+type cacheRecord struct {
+	Op       string `json:"op"`
+	Filename string `json:"filename"`
+	Size     int64  `json:"size,omitempty"`
+	Uses     uint64 `json:"uses,omitempty"`
+}
+
+// cacheQueue is a heap of files which may be evicted, the next one to go first.
+type cacheQueue struct {
+	entries  []*cacheEntry
+	frequent bool
+}
+
+func (q *cacheQueue) Len() int {
+	return len(q.entries)
+}
+
+func (q *cacheQueue) Less(i, j int) bool {
+	a, b := q.entries[i], q.entries[j]
+	if q.frequent && a.uses != b.uses {
+		return a.uses < b.uses
+	}
+	return a.used < b.used
+}
+
+func (q *cacheQueue) Swap(i, j int) {
+	q.entries[i], q.entries[j] = q.entries[j], q.entries[i]
+	q.entries[i].index = i
+	q.entries[j].index = j
+}
+
+func (q *cacheQueue) Push(x interface{}) {
+	entry := x.(*cacheEntry)
+	entry.index = len(q.entries)
+	q.entries = append(q.entries, entry)
+}
+
+func (q *cacheQueue) Pop() interface{} {
+	last := len(q.entries) - 1
+	entry := q.entries[last]
+	q.entries = q.entries[:last]
+	entry.index = -1
+	return entry
+}
+
+// Open replays the ledger, it has to be called before the storage is used.
+func (s *CacheStorage) Open() error {
+	switch s.Policy {
+	case drweb.CachePolicyLRU, drweb.CachePolicyLFU:
+	default:
+		return fmt.Errorf("unknown cache policy '%s'", s.Policy)
+	}
+
+	defer s.forgetEvicted()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.entries = map[string]*cacheEntry{}
+	s.pins = map[string]bool{}
+	s.queue = &cacheQueue{frequent: s.Policy == drweb.CachePolicyLFU}
+	s.clock, s.size = 0, 0
+
+	ledger, err := os.Open(s.LedgerPath)
+	if err == nil {
+		err = s.replay(ledger)
+		ledger.Close()
+	} else if os.IsNotExist(err) {
+		err = s.recount()
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to open cache ledger")
+	}
+
+	if err = s.compact(); err != nil {
+		return err
+	}
+
+	// NOTE: MaxSize might have been lowered since
+	return s.evict("")
+}
+
+func (s *CacheStorage) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.ledger == nil {
+		return nil
+	}
+	err := s.ledger.Close()
+	s.ledger = nil
+	return err
+}
+
+func (s *CacheStorage) replay(ledger io.Reader) error {
+	scanner := bufio.NewScanner(ledger)
+	for scanner.Scan() {
+		var record cacheRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			// NOTE: last record is torn if the process died while writing it
+			log.WithError(err).Warn("skipping malformed cache ledger record")
+			continue
+		}
+		s.apply(&record)
+	}
+	return scanner.Err()
+}
+
+// recount puts every file of Storage to the ledger, as if it was just uploaded.
+func (s *CacheStorage) recount() error {
+	return s.Storage.Walk(func(filename string) error {
+		size, err := s.measure(filename)
+		if os.IsNotExist(errors.Cause(err)) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		s.apply(&cacheRecord{Op: cacheOpPut, Filename: filename, Size: size})
+		return nil
+	})
+}
+
+// measure tells size of the file stored in Storage, reading it through if Storage does not know.
+func (s *CacheStorage) measure(filename string) (int64, error) {
+	file, err := s.Storage.Load(filename)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	size := file.Size
+	if size <= 0 {
+		if size, err = io.Copy(ioutil.Discard, file.Body); err != nil {
+			return 0, errors.Wrapf(err, "failed to count size of file '%s'", filename)
+		}
+	}
+	return size, nil
+}
+
+// compact rewrites the ledger with just enough records to restore the state.
+func (s *CacheStorage) compact() error {
+	if s.ledger != nil {
+		s.ledger.Close()
+		s.ledger = nil
+	}
+
+	records := []*cacheRecord{}
+	for filename := range s.pins {
+		records = append(records, &cacheRecord{Op: cacheOpPin, Filename: filename})
+	}
+	entries := make([]*cacheEntry, 0, len(s.entries))
+	for _, entry := range s.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].used < entries[j].used
+	})
+	for _, entry := range entries {
+		records = append(records, &cacheRecord{Op: cacheOpPut, Filename: entry.filename, Size: entry.size, Uses: entry.uses})
+	}
+
+	temp := s.LedgerPath + ".tmp"
+	compacted, err := os.OpenFile(temp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, s.FileMode)
+	if err != nil {
+		return errors.Wrap(err, "failed to create cache ledger")
+	}
+
+	writer := bufio.NewWriter(compacted)
+	encoder := json.NewEncoder(writer)
+	for _, record := range records {
+		if err = encoder.Encode(record); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = compacted.Sync()
+	}
+	compacted.Close()
+	if err != nil {
+		os.Remove(temp)
+		return errors.Wrap(err, "failed to write cache ledger")
+	}
+
+	if err = os.Rename(temp, s.LedgerPath); err != nil {
+		return errors.Wrap(err, "failed to replace cache ledger")
+	}
+
+	if s.ledger, err = os.OpenFile(s.LedgerPath, os.O_APPEND|os.O_WRONLY, s.FileMode); err != nil {
+		return errors.Wrap(err, "failed to open cache ledger")
+	}
+	s.records = len(records)
+	return nil
+}
+
+// apply changes the state as the record tells.
+func (s *CacheStorage) apply(record *cacheRecord) {
+	entry := s.entries[record.Filename]
+
+	switch record.Op {
+	case cacheOpPut:
+		if entry != nil {
+			s.remove(entry)
+		}
+		entry = &cacheEntry{filename: record.Filename, size: record.Size, uses: record.Uses, index: -1}
+		if entry.uses == 0 {
+			entry.uses = 1
+		}
+		s.clock++
+		entry.used = s.clock
+		s.entries[entry.filename] = entry
+		s.size += entry.size
+		if !s.pins[entry.filename] {
+			heap.Push(s.queue, entry)
+		}
+	case cacheOpUse:
+		if entry == nil {
+			return
+		}
+		s.clock++
+		entry.used = s.clock
+		entry.uses++
+		if entry.index >= 0 {
+			heap.Fix(s.queue, entry.index)
+		}
+	case cacheOpDelete:
+		if entry != nil {
+			s.remove(entry)
+		}
+	case cacheOpPin:
+		s.pins[record.Filename] = true
+		if entry != nil && entry.index >= 0 {
+			heap.Remove(s.queue, entry.index)
+		}
+	case cacheOpUnpin:
+		delete(s.pins, record.Filename)
+		if entry != nil && entry.index < 0 {
+			heap.Push(s.queue, entry)
+		}
+	}
+}
+
+func (s *CacheStorage) remove(entry *cacheEntry) {
+	if entry.index >= 0 {
+		heap.Remove(s.queue, entry.index)
+	}
+	delete(s.entries, entry.filename)
+	s.size -= entry.size
+}
+
+// record applies the record and appends it to the ledger.
+func (s *CacheStorage) record(record *cacheRecord) error {
+	s.apply(record)
+
+	if s.ledger == nil {
+		return errors.New("failed to record to closed cache ledger")
+	}
+	if err := json.NewEncoder(s.ledger).Encode(record); err != nil {
+		return errors.Wrap(err, "failed to write cache ledger")
+	}
+	s.records++
+
+	if s.records > len(s.entries)+len(s.pins)+cacheLedgerSlack {
+		return s.compact()
+	}
+	return nil
+}
+
+// evict removes files until the rest fits MaxSize, sparing the kept one.
+func (s *CacheStorage) evict(keep string) error {
+	if s.MaxSize <= 0 {
+		return nil
+	}
+
+	kept := s.entries[keep]
+	if kept != nil && kept.index >= 0 {
+		heap.Remove(s.queue, kept.index)
+	} else {
+		kept = nil
+	}
+
+	for s.size > s.MaxSize && s.queue.Len() > 0 {
+		victim := s.queue.entries[0]
+		if err := s.Storage.Delete(victim.filename); err != nil && !os.IsNotExist(errors.Cause(err)) {
+			if kept != nil {
+				heap.Push(s.queue, kept)
+			}
+			return errors.Wrapf(err, "failed to evict file '%s'", victim.filename)
+		}
+
+		s.stats.Evictions++
+		s.stats.EvictedBytes += uint64(victim.size)
+		s.evicted = append(s.evicted, victim.filename)
+		if err := s.record(&cacheRecord{Op: cacheOpDelete, Filename: victim.filename}); err != nil {
+			log.WithError(err).WithField("filename", victim.filename).Warn("failed to record eviction")
+		}
+	}
+
+	if kept == nil {
+		return nil
+	}
+	if s.size <= s.MaxSize {
+		heap.Push(s.queue, kept)
+		return nil
+	}
+
+	// NOTE: the upload does not fit next to pinned files
+	if err := s.Storage.Delete(kept.filename); err != nil && !os.IsNotExist(errors.Cause(err)) {
+		heap.Push(s.queue, kept)
+		return errors.Wrapf(err, "failed to delete file '%s' which does not fit", kept.filename)
+	}
+	if err := s.record(&cacheRecord{Op: cacheOpDelete, Filename: kept.filename}); err != nil {
+		log.WithError(err).WithField("filename", kept.filename).Warn("failed to record deletion")
+	}
+	return errors.Wrap(drweb.ErrStorageFull, "failed to fit file next to pinned ones")
+}
+
+// forgetEvicted has Jobs forget files evicted so far and deletes their Metadata.
+// NOTE: should be called without mutex held, as jobs may go through the storage
+func (s *CacheStorage) forgetEvicted() {
+	s.mutex.Lock()
+	evicted := []string{}
+	for _, filename := range s.evicted {
+		// NOTE: uploaded again since
+		if _, ok := s.entries[filename]; !ok {
+			evicted = append(evicted, filename)
+		}
+	}
+	s.evicted = nil
+	s.mutex.Unlock()
+
+	for _, filename := range evicted {
+		for _, job := range s.Jobs {
+			if err := job.Forget(filename); err != nil && !os.IsNotExist(errors.Cause(err)) {
+				log.WithError(err).WithField("filename", filename).Warn("failed to forget evicted file")
+			}
+		}
+
+		if s.Metadata == nil {
+			continue
+		}
+		if err := s.Metadata.Delete(filename); err != nil && !os.IsNotExist(errors.Cause(err)) {
+			log.WithError(err).WithField("filename", filename).Warn("failed to delete metadata of evicted file")
+		}
+	}
+}
+
+func (s *CacheStorage) Save(file *drweb.FileCreateRequest) (string, error) {
+	body := &countingReader{ReadCloser: file.Body}
+	file.Body = body
+
+	filename, err := s.Storage.Save(file)
+	if err != nil {
+		return filename, err
+	}
+
+	defer s.forgetEvicted()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// NOTE: same contents are stored already
+	if _, ok := s.entries[filename]; ok {
+		return filename, s.record(&cacheRecord{Op: cacheOpUse, Filename: filename})
+	}
+
+	// NOTE: same contents might have been stored already and evicted since they were saved
+	stored, err := s.Storage.Load(filename)
+	if os.IsNotExist(errors.Cause(err)) {
+		return filename, errors.Errorf("file '%s' was evicted while being saved", filename)
+	}
+	if err != nil {
+		return filename, errors.Wrap(err, "failed to check saved file")
+	}
+	stored.Close()
+
+	if err = s.record(&cacheRecord{Op: cacheOpPut, Filename: filename, Size: body.Count}); err != nil {
+		return filename, err
+	}
+	return filename, s.evict(filename)
+}
+
+func (s *CacheStorage) Load(filename string) (*drweb.File, error) {
+	file, err := s.Storage.Load(filename)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err != nil {
+		if os.IsNotExist(errors.Cause(err)) {
+			s.stats.Misses++
+		}
+		return nil, err
+	}
+	s.stats.Hits++
+
+	if _, ok := s.entries[filename]; ok {
+		if err = s.record(&cacheRecord{Op: cacheOpUse, Filename: filename}); err != nil {
+			log.WithError(err).WithField("filename", filename).Warn("failed to record cache use")
+		}
+	}
+	return file, nil
+}
+
+func (s *CacheStorage) Delete(filename string) error {
+	if err := s.Storage.Delete(filename); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.entries[filename]; !ok {
+		return nil
+	}
+	return s.record(&cacheRecord{Op: cacheOpDelete, Filename: filename})
+}
+
+// Enqueue counts the file put to Storage past the cache, e.g. released from quarantine,
+// evicting others if it does not fit.
+func (s *CacheStorage) Enqueue(filename string) {
+	size, err := s.measure(filename)
+	if err != nil {
+		log.WithError(err).WithField("filename", filename).Warn("failed to count file put past cache")
+		return
+	}
+
+	defer s.forgetEvicted()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.entries[filename]; ok {
+		return
+	}
+	if err = s.record(&cacheRecord{Op: cacheOpPut, Filename: filename, Size: size}); err == nil {
+		err = s.evict("")
+	}
+	if err != nil {
+		log.WithError(err).WithField("filename", filename).Warn("failed to count file put past cache")
+	}
+}
+
+// Forget stops counting the file taken out of Storage past the cache, e.g. isolated to quarantine.
+func (s *CacheStorage) Forget(filename string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.entries[filename]; !ok {
+		return nil
+	}
+	return s.record(&cacheRecord{Op: cacheOpDelete, Filename: filename})
+}
+
+// Walk calls fn for every stored file in lexical order of their names.
+func (s *CacheStorage) Walk(fn func(filename string) error) error {
+	return s.Storage.Walk(fn)
+}
+
+// Pin protects the file from eviction, whether it is stored yet or not.
+func (s *CacheStorage) Pin(filename string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.pins[filename] {
+		return nil
+	}
+	return s.record(&cacheRecord{Op: cacheOpPin, Filename: filename})
+}
+
+func (s *CacheStorage) Unpin(filename string) error {
+	defer s.forgetEvicted()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.pins[filename] {
+		return errors.Wrap(os.ErrNotExist, "failed to find pin")
+	}
+	if err := s.record(&cacheRecord{Op: cacheOpUnpin, Filename: filename}); err != nil {
+		return err
+	}
+	return s.evict("")
+}
+
+func (s *CacheStorage) Stats() *drweb.CacheStats {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stats := s.stats
+	stats.Policy = s.Policy
+	stats.MaxSize = s.MaxSize
+	stats.Size = s.size
+	stats.Files = len(s.entries)
+	stats.Pinned = len(s.pins)
+	return &stats
+}
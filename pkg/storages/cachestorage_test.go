@@ -0,0 +1,306 @@
+package storages_test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+	"github.com/twonegatives/drweb_challenge/pkg/mocks"
+	"github.com/twonegatives/drweb_challenge/pkg/namegenerators"
+	"github.com/twonegatives/drweb_challenge/pkg/pathgenerators"
+	"github.com/twonegatives/drweb_challenge/pkg/storages"
+	"github.com/twonegatives/drweb_challenge/pkg/testutils"
+)
+
+// NOTE: files saved by testutils.SaveFiles take 7 bytes each, three of them fit
+func newCacheStorage(t *testing.T, policy string) (*storages.CacheStorage, func()) {
+	disks, cleanup := testutils.GenerateDisks(t, 1)
+	storage := &storages.CacheStorage{
+		Storage:    disks[0],
+		MaxSize:    21,
+		Policy:     policy,
+		LedgerPath: filepath.Join(filepath.Dir(disks[0].BasePath), "cache.ledger"),
+		FileMode:   0700,
+	}
+	if err := storage.Open(); err != nil {
+		t.Fatal(err)
+	}
+	return storage, func() {
+		storage.Close()
+		cleanup()
+	}
+}
+
+// reopen gives the storage as it is after restart.
+func reopen(t *testing.T, storage *storages.CacheStorage) *storages.CacheStorage {
+	if err := storage.Close(); err != nil {
+		t.Fatal(err)
+	}
+	reopened := &storages.CacheStorage{
+		Storage:    storage.Storage,
+		MaxSize:    storage.MaxSize,
+		Policy:     storage.Policy,
+		LedgerPath: storage.LedgerPath,
+		FileMode:   storage.FileMode,
+	}
+	if err := reopened.Open(); err != nil {
+		t.Fatal(err)
+	}
+	return reopened
+}
+
+// saveNth saves the same file testutils.SaveFiles saves n-th.
+func saveNth(t *testing.T, storage drweb.Storage, n int) string {
+	filename, err := testutils.SaveFile(storage, []byte(fmt.Sprintf("file #%d", n)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+// stored tells which of the files are still there.
+func stored(storage *storages.CacheStorage, filenames []string) []bool {
+	found := []bool{}
+	for _, filename := range filenames {
+		file, err := storage.Storage.Load(filename)
+		if err == nil {
+			file.Close()
+		}
+		found = append(found, err == nil)
+	}
+	return found
+}
+
+func TestCacheStorageEviction(t *testing.T) {
+	var objects = map[string]struct {
+		Policy string
+		Loads  []int
+		Stored []bool
+	}{
+		"least recently used":    {Policy: drweb.CachePolicyLRU, Loads: []int{0}, Stored: []bool{true, false, true, true}},
+		"lru with no loads":      {Policy: drweb.CachePolicyLRU, Stored: []bool{false, true, true, true}},
+		"least frequently used":  {Policy: drweb.CachePolicyLFU, Loads: []int{0, 0, 1, 1, 2}, Stored: []bool{true, true, false, true}},
+		"lfu ties by recent use": {Policy: drweb.CachePolicyLFU, Loads: []int{1, 2, 0}, Stored: []bool{true, false, true, true}},
+	}
+
+	for testName, testObject := range objects {
+		t.Run(testName, func(t *testing.T) {
+			storage, cleanup := newCacheStorage(t, testObject.Policy)
+			defer cleanup()
+
+			filenames := testutils.SaveFiles(t, storage, 3)
+			for _, i := range testObject.Loads {
+				testutils.LoadFile(t, storage, filenames[i])
+			}
+			filenames = append(filenames, saveNth(t, storage, 3))
+
+			assert.Equal(t, testObject.Stored, stored(storage, filenames))
+			stats := storage.Stats()
+			assert.Equal(t, int64(21), stats.Size)
+			assert.Equal(t, 3, stats.Files)
+			assert.Equal(t, uint64(1), stats.Evictions)
+			assert.Equal(t, uint64(7), stats.EvictedBytes)
+		})
+	}
+}
+
+func TestCacheStoragePinning(t *testing.T) {
+	storage, cleanup := newCacheStorage(t, drweb.CachePolicyLRU)
+	defer cleanup()
+
+	filenames := testutils.SaveFiles(t, storage, 3)
+	for _, filename := range filenames {
+		assert.Nil(t, storage.Pin(filename))
+	}
+
+	_, err := testutils.SaveFile(storage, []byte("file #3"))
+	assert.Equal(t, drweb.ErrStorageFull, errors.Cause(err))
+	assert.Equal(t, []bool{true, true, true}, stored(storage, filenames))
+	assert.Equal(t, int64(21), storage.Stats().Size)
+
+	// NOTE: hashes may be pinned before they are uploaded
+	upcoming, _ := (&namegenerators.SHA256{}).Generate(bytes.NewReader([]byte("file #3")))
+	assert.Nil(t, storage.Unpin(filenames[0]))
+	assert.Nil(t, storage.Pin(upcoming))
+	assert.Equal(t, upcoming, saveNth(t, storage, 3))
+	assert.Equal(t, []bool{false, true, true, true}, stored(storage, append(filenames, upcoming)))
+
+	err = storage.Unpin(filenames[0])
+	assert.True(t, os.IsNotExist(errors.Cause(err)))
+	assert.Equal(t, 3, storage.Stats().Pinned)
+}
+
+func TestCacheStorageRestart(t *testing.T) {
+	storage, cleanup := newCacheStorage(t, drweb.CachePolicyLRU)
+	defer cleanup()
+
+	filenames := testutils.SaveFiles(t, storage, 3)
+	testutils.LoadFile(t, storage, filenames[0])
+	assert.Nil(t, storage.Pin(filenames[1]))
+	assert.Nil(t, storage.Delete(filenames[2]))
+	filenames = append(filenames, saveNth(t, storage, 3))
+
+	storage = reopen(t, storage)
+	stats := storage.Stats()
+	assert.Equal(t, int64(21), stats.Size)
+	assert.Equal(t, 3, stats.Files)
+	assert.Equal(t, 1, stats.Pinned)
+
+	// NOTE: file #0 was used before file #3, file #1 is pinned
+	filenames = append(filenames, saveNth(t, storage, 4))
+	assert.Equal(t, []bool{false, true, false, true, true}, stored(storage, filenames))
+
+	// NOTE: uses recorded after the ledger is compacted on open survive as well
+	testutils.LoadFile(t, storage, filenames[3])
+	storage = reopen(t, storage)
+	filenames = append(filenames, saveNth(t, storage, 5))
+	assert.Equal(t, []bool{false, true, false, true, false, true}, stored(storage, filenames))
+	assert.Equal(t, int64(21), storage.Stats().Size)
+}
+
+func TestCacheStorageRecount(t *testing.T) {
+	disks, cleanup := testutils.GenerateDisks(t, 1)
+	defer cleanup()
+
+	filenames := testutils.SaveFiles(t, disks[0], 4)
+	storage := &storages.CacheStorage{
+		Storage:    disks[0],
+		MaxSize:    21,
+		Policy:     "mru",
+		LedgerPath: filepath.Join(filepath.Dir(disks[0].BasePath), "cache.ledger"),
+		FileMode:   0700,
+	}
+	assert.NotNil(t, storage.Open())
+
+	storage.Policy = drweb.CachePolicyLRU
+	assert.Nil(t, storage.Open())
+	defer storage.Close()
+
+	stats := storage.Stats()
+	assert.Equal(t, int64(21), stats.Size)
+	assert.Equal(t, 3, stats.Files)
+
+	// NOTE: files found without ledger count as used in lexical order of their names
+	first := filenames[0]
+	for _, filename := range filenames {
+		if filename < first {
+			first = filename
+		}
+	}
+	for i, found := range stored(storage, filenames) {
+		assert.Equal(t, filenames[i] != first, found)
+	}
+}
+
+func TestCacheStorageQuarantine(t *testing.T) {
+	storage, cleanup := newCacheStorage(t, drweb.CachePolicyLRU)
+	defer cleanup()
+
+	base := filepath.Join(filepath.Dir(storage.LedgerPath), "quarantine")
+	quarantine := &storages.FileSystemQuarantine{
+		BasePath:          base,
+		FileMode:          0700,
+		FilePathGenerator: &pathgenerators.NestedGenerator{BasePath: base, Levels: 1, FolderLength: 2},
+		Storage:           storage.Storage.(*storages.FileSystemStorage),
+		Jobs:              []drweb.PostSaveJob{storage},
+	}
+
+	filenames := testutils.SaveFiles(t, storage, 3)
+	assert.Nil(t, quarantine.Isolate(filenames[0], "malware", "admin", "test"))
+	assert.Equal(t, int64(14), storage.Stats().Size)
+
+	// NOTE: isolated file makes room, released one takes it back
+	filenames = append(filenames, saveNth(t, storage, 3))
+	assert.Equal(t, []bool{false, true, true, true}, stored(storage, filenames))
+
+	assert.Nil(t, quarantine.Release(filenames[0], "admin", "test"))
+	assert.Equal(t, []bool{true, false, true, true}, stored(storage, filenames))
+	assert.Equal(t, int64(21), storage.Stats().Size)
+	assert.Equal(t, 3, storage.Stats().Files)
+}
+
+func TestCacheStorageEvictionForgotten(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	storage, cleanup := newCacheStorage(t, drweb.CachePolicyLRU)
+	defer cleanup()
+	metadata, cleanupMetadata := testutils.GenerateMetadataStore(t)
+	defer cleanupMetadata()
+
+	job := mocks.NewMockPostSaveJob(mockCtrl)
+	storage.Metadata = metadata
+	storage.Jobs = []drweb.PostSaveJob{job}
+	indexed := &storages.IndexedStorage{Storage: storage, Metadata: metadata}
+
+	filenames := testutils.SaveFiles(t, indexed, 3)
+
+	// NOTE: evicted file is gone from metadata and jobs, as if it was deleted
+	job.EXPECT().Forget(filenames[0]).Return(nil)
+	filenames = append(filenames, saveNth(t, indexed, 3))
+	assert.Equal(t, []bool{false, true, true, true}, stored(storage, filenames))
+
+	_, err := metadata.Get(filenames[0])
+	assert.True(t, os.IsNotExist(errors.Cause(err)))
+	for _, filename := range filenames[1:] {
+		_, err = metadata.Get(filename)
+		assert.Nil(t, err)
+	}
+}
+
+// NOTE: deletes what it saves, as if the file was evicted right after
+type vanishingStorage struct {
+	drweb.WalkableStorage
+}
+
+func (s *vanishingStorage) Save(file *drweb.FileCreateRequest) (string, error) {
+	filename, err := s.WalkableStorage.Save(file)
+	if err == nil {
+		s.WalkableStorage.Delete(filename)
+	}
+	return filename, err
+}
+
+func TestCacheStorageEvictedWhileSaved(t *testing.T) {
+	storage, cleanup := newCacheStorage(t, drweb.CachePolicyLRU)
+	defer cleanup()
+	storage.Storage = &vanishingStorage{storage.Storage}
+
+	_, err := testutils.SaveFile(storage, []byte("File contents"))
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, storage.Stats().Files)
+	assert.Equal(t, int64(0), storage.Stats().Size)
+}
+
+func TestCacheStorageStats(t *testing.T) {
+	storage, cleanup := newCacheStorage(t, drweb.CachePolicyLFU)
+	defer cleanup()
+
+	filenames := testutils.SaveFiles(t, storage, 2)
+	testutils.LoadFile(t, storage, filenames[0])
+	testutils.LoadFile(t, storage, filenames[1])
+	_, err := storage.Load("0000")
+	assert.True(t, os.IsNotExist(errors.Cause(err)))
+
+	stats := storage.Stats()
+	assert.Equal(t, drweb.CachePolicyLFU, stats.Policy)
+	assert.Equal(t, int64(21), stats.MaxSize)
+	assert.Equal(t, int64(14), stats.Size)
+	assert.Equal(t, uint64(2), stats.Hits)
+	assert.Equal(t, uint64(1), stats.Misses)
+	assert.Equal(t, uint64(0), stats.Evictions)
+}
+
+func TestCacheStorageSuite(t *testing.T) {
+	testStorageSuite(t, func(t *testing.T) (drweb.WalkableStorage, func()) {
+		storage, cleanup := newCacheStorage(t, drweb.CachePolicyLRU)
+		storage.MaxSize = 1 << 30
+		return storage, cleanup
+	})
+}
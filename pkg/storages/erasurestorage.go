@@ -0,0 +1,686 @@
+package storages
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+	"github.com/twonegatives/drweb_challenge/pkg/reedsolomon"
+)
+
+var erasureMagic = []byte("DWRS")
+
+const erasureVersion = 1
+const erasureHeaderSize = 20
+
+// erasureHeader opens every shard file, telling what the shard is.
+type erasureHeader struct {
+	data      int
+	parity    int
+	index     int
+	chunkSize int
+	size      int64
+}
+
+func (h *erasureHeader) encode() []byte {
+	header := make([]byte, erasureHeaderSize)
+	copy(header, erasureMagic)
+	header[4], header[5], header[6], header[7] = erasureVersion, byte(h.data), byte(h.parity), byte(h.index)
+	binary.BigEndian.PutUint32(header[8:], uint32(h.chunkSize))
+	binary.BigEndian.PutUint64(header[12:], uint64(h.size))
+	return header
+}
+
+func decodeErasureHeader(input io.Reader) (*erasureHeader, error) {
+	header := make([]byte, erasureHeaderSize)
+	if _, err := io.ReadFull(input, header); err != nil {
+		return nil, errors.Wrap(err, "failed to read shard header")
+	}
+	if !bytes.Equal(header[:4], erasureMagic) || header[4] != erasureVersion {
+		return nil, errors.New("unknown shard header")
+	}
+
+	return &erasureHeader{
+		data:      int(header[5]),
+		parity:    int(header[6]),
+		index:     int(header[7]),
+		chunkSize: int(binary.BigEndian.Uint32(header[8:])),
+		size:      int64(binary.BigEndian.Uint64(header[12:])),
+	}, nil
+}
+
+// stripe tells how many bytes of file go to the stripe, which are split
+// between data chunks of chunk bytes each. Last stripe has shorter chunks.
+func (h *erasureHeader) stripe(stripe int64) (size int64, chunk int) {
+	full := int64(h.data * h.chunkSize)
+	size = h.size - stripe*full
+	if size > full {
+		size = full
+	}
+	return size, int((size + int64(h.data) - 1) / int64(h.data))
+}
+
+// ErasureStorage splits every file into DataShards and ParityShards kept
+// in their own Targets, e.g. file system storages on different disks.
+// Files are read as long as any DataShards of them are left, missing
+// and corrupt shards are rebuilt in background once found. Saves, rebuilds
+// and deletions of a file never interleave, so that no stray shards are left.
+// NOTE: files are striped into chunks of ChunkSize, every chunk is followed
+// by its CRC32, so that corrupt ones are told and reconstructed on reads.
+// Shard layout is set by path generators of targets.
+type ErasureStorage struct {
+	Targets      []*FileSystemStorage
+	DataShards   int
+	ParityShards int
+	ChunkSize    int
+
+	mutex   sync.Mutex
+	encoder *reedsolomon.Encoder
+	locked  map[string]chan struct{}
+}
+
+func (s *ErasureStorage) coder() (*reedsolomon.Encoder, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.encoder != nil {
+		return s.encoder, nil
+	}
+	if len(s.Targets) != s.DataShards+s.ParityShards {
+		return nil, errors.Errorf("expected %d targets, got %d", s.DataShards+s.ParityShards, len(s.Targets))
+	}
+	if s.ChunkSize < 1 {
+		return nil, errors.New("chunk size should be positive")
+	}
+
+	encoder, err := reedsolomon.New(s.DataShards, s.ParityShards)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create encoder")
+	}
+	s.encoder = encoder
+	return encoder, nil
+}
+
+// lock takes the file over for a commit, a rebuild or a deletion. Unless wait
+// is set, it gives up on a file which is taken over already.
+func (s *ErasureStorage) lock(filename string, wait bool) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.locked == nil {
+		s.locked = map[string]chan struct{}{}
+	}
+
+	for {
+		done, ok := s.locked[filename]
+		if !ok {
+			break
+		}
+		if !wait {
+			return false
+		}
+
+		s.mutex.Unlock()
+		<-done
+		s.mutex.Lock()
+	}
+
+	s.locked[filename] = make(chan struct{})
+	return true
+}
+
+func (s *ErasureStorage) unlock(filename string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	close(s.locked[filename])
+	delete(s.locked, filename)
+}
+
+// erasureWriter cuts what is written into stripes, encoding them into shards.
+type erasureWriter struct {
+	encoder *reedsolomon.Encoder
+	outputs []io.Writer
+	stripe  []byte
+	parity  [][]byte
+	shards  [][]byte
+	size    int64
+}
+
+func newErasureWriter(encoder *reedsolomon.Encoder, outputs []io.Writer, chunkSize int) *erasureWriter {
+	w := &erasureWriter{
+		encoder: encoder,
+		outputs: outputs,
+		stripe:  make([]byte, 0, encoder.DataShards()*chunkSize),
+		shards:  make([][]byte, len(outputs)),
+	}
+	for i := 0; i < encoder.ParityShards(); i++ {
+		w.parity = append(w.parity, make([]byte, chunkSize))
+	}
+	return w
+}
+
+func (w *erasureWriter) Write(p []byte) (int, error) {
+	written := len(p)
+	for len(p) > 0 {
+		taken := cap(w.stripe) - len(w.stripe)
+		if taken > len(p) {
+			taken = len(p)
+		}
+		w.stripe = append(w.stripe, p[:taken]...)
+		p = p[taken:]
+
+		if len(w.stripe) == cap(w.stripe) {
+			if err := w.Flush(); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	w.size += int64(written)
+	return written, nil
+}
+
+// Flush encodes what is left of the stripe, padded with zeroes.
+func (w *erasureWriter) Flush() error {
+	if len(w.stripe) == 0 {
+		return nil
+	}
+
+	data := w.encoder.DataShards()
+	chunk := (len(w.stripe) + data - 1) / data
+	padded := w.stripe[:chunk*data]
+	for i := len(w.stripe); i < len(padded); i++ {
+		padded[i] = 0
+	}
+
+	for i := range w.shards {
+		if i < data {
+			w.shards[i] = padded[i*chunk : (i+1)*chunk]
+		} else {
+			w.shards[i] = w.parity[i-data][:chunk]
+		}
+	}
+	if err := w.encoder.Encode(w.shards); err != nil {
+		return errors.Wrap(err, "failed to encode stripe")
+	}
+
+	for i, output := range w.outputs {
+		if err := writeErasureChunk(output, w.shards[i]); err != nil {
+			return err
+		}
+	}
+
+	w.stripe = w.stripe[:0]
+	return nil
+}
+
+func writeErasureChunk(output io.Writer, chunk []byte) error {
+	checksum := make([]byte, 4)
+	binary.BigEndian.PutUint32(checksum, crc32.ChecksumIEEE(chunk))
+
+	if _, err := output.Write(chunk); err != nil {
+		return errors.Wrap(err, "failed to write shard")
+	}
+	if _, err := output.Write(checksum); err != nil {
+		return errors.Wrap(err, "failed to write shard")
+	}
+	return nil
+}
+
+// createShards opens temp files for shards of given targets, past their headers.
+func (s *ErasureStorage) createShards(targets []int) (map[int]*os.File, error) {
+	temps := map[int]*os.File{}
+	for _, target := range targets {
+		temp, err := ioutil.TempFile(s.Targets[target].TempPath, "shard")
+		if err == nil {
+			temps[target] = temp
+			err = temp.Chmod(s.Targets[target].FileMode)
+		}
+		if err == nil {
+			_, err = temp.Seek(erasureHeaderSize, io.SeekStart)
+		}
+		if err != nil {
+			discardShards(temps)
+			return nil, errors.Wrap(err, "failed to create shard")
+		}
+	}
+	return temps, nil
+}
+
+func discardShards(temps map[int]*os.File) {
+	for _, temp := range temps {
+		temp.Close()
+		os.Remove(temp.Name())
+	}
+}
+
+// commitShards puts temp files of shards in place, once their headers are written.
+func (s *ErasureStorage) commitShards(temps map[int]*os.File, filename string, header erasureHeader) error {
+	for target, temp := range temps {
+		header.index = target
+		if _, err := temp.WriteAt(header.encode(), 0); err != nil {
+			return errors.Wrap(err, "failed to write shard header")
+		}
+		if err := temp.Close(); err != nil {
+			return errors.Wrap(err, "failed to write shard")
+		}
+
+		path, err := s.Targets[target].filepath(filename)
+		if err != nil {
+			return errors.Wrap(err, "failed to generate filepath")
+		}
+		if err = os.MkdirAll(filepath.Dir(path), s.Targets[target].FileMode); err != nil {
+			return errors.Wrap(err, "failed to create nested folders")
+		}
+		if err = os.Rename(temp.Name(), path); err != nil {
+			return errors.Wrap(err, "failed to write shard")
+		}
+		delete(temps, target)
+	}
+	return nil
+}
+
+func (s *ErasureStorage) Save(file *drweb.FileCreateRequest) (string, error) {
+	if file.NameGenerator == nil {
+		return "", errors.New("failed to save file without name generator")
+	}
+
+	encoder, err := s.coder()
+	if err != nil {
+		return "", err
+	}
+
+	targets := []int{}
+	for target := range s.Targets {
+		targets = append(targets, target)
+	}
+	temps, err := s.createShards(targets)
+	if err != nil {
+		return "", err
+	}
+	defer discardShards(temps)
+
+	outputs := make([]io.Writer, len(s.Targets))
+	for target, temp := range temps {
+		outputs[target] = temp
+	}
+	striper := newErasureWriter(encoder, outputs, s.ChunkSize)
+
+	writers := []io.Writer{striper}
+	for _, inspector := range file.Inspectors {
+		writers = append(writers, inspector)
+	}
+
+	filename, err := file.NameGenerator.Generate(io.TeeReader(file.Body, io.MultiWriter(writers...)))
+	if err != nil {
+		return filename, errors.Wrap(err, "failed to generate filename")
+	}
+	if err = striper.Flush(); err != nil {
+		return filename, err
+	}
+	if err = inspect(file, filename); err != nil {
+		return filename, err
+	}
+
+	s.lock(filename, true)
+	defer s.unlock(filename)
+
+	header := erasureHeader{data: s.DataShards, parity: s.ParityShards, chunkSize: s.ChunkSize, size: striper.size}
+	return filename, s.commitShards(temps, filename, header)
+}
+
+// erasureReader reads file out of its shards, reconstructing lost ones.
+type erasureReader struct {
+	encoder *reedsolomon.Encoder
+	header  *erasureHeader
+	shards  []*os.File
+	damaged func()
+
+	mutex   sync.Mutex
+	offset  int64
+	stripe  int64
+	data    []byte
+	buffers [][]byte
+	chunks  [][]byte
+}
+
+// open finds shards of the file, listing targets which lack them.
+func (s *ErasureStorage) open(filename string) (*erasureReader, []int, error) {
+	encoder, err := s.coder()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	r := &erasureReader{encoder: encoder, shards: make([]*os.File, len(s.Targets)), stripe: -1}
+	var failure error
+	missing := []int{}
+
+	for target := range s.Targets {
+		shard, header, err := s.openShard(target, filename)
+		if err == nil && r.header != nil && *header != (erasureHeader{r.header.data, r.header.parity, target, r.header.chunkSize, r.header.size}) {
+			err = errors.New("shard header does not match others")
+		}
+		if err != nil {
+			if shard != nil {
+				shard.Close()
+			}
+			if !os.IsNotExist(errors.Cause(err)) {
+				failure = err
+			}
+			missing = append(missing, target)
+			continue
+		}
+
+		r.shards[target] = shard
+		if r.header == nil {
+			r.header = header
+		}
+	}
+
+	if len(missing) == len(s.Targets) {
+		if failure != nil {
+			return nil, nil, errors.Wrap(failure, "failed to open shards")
+		}
+		return nil, nil, errors.Wrap(os.ErrNotExist, "failed to find file")
+	}
+	if len(s.Targets)-len(missing) < s.DataShards {
+		r.Close()
+		return nil, nil, errors.Wrap(reedsolomon.ErrTooFewShards, "failed to load file")
+	}
+
+	for range r.shards {
+		r.buffers = append(r.buffers, make([]byte, r.header.chunkSize+4))
+	}
+	r.chunks = make([][]byte, len(r.shards))
+	return r, missing, nil
+}
+
+func (s *ErasureStorage) openShard(target int, filename string) (*os.File, *erasureHeader, error) {
+	path, err := s.Targets[target].filepath(filename)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to generate filepath")
+	}
+
+	shard, err := os.Open(path)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to open shard")
+	}
+
+	header, err := decodeErasureHeader(shard)
+	if err == nil && (header.data != s.DataShards || header.parity != s.ParityShards || header.index != target) {
+		err = errors.New("shard does not belong to target")
+	}
+	return shard, header, err
+}
+
+// read fills chunks of the stripe, reading all of shards or just enough
+// to reconstruct data ones. Lost and corrupt shards are listed.
+func (r *erasureReader) read(stripe int64, all bool) ([]int, error) {
+	_, chunk := r.header.stripe(stripe)
+	offset := erasureHeaderSize + stripe*int64(r.header.chunkSize+4)
+	data := r.encoder.DataShards()
+
+	lost := []int{}
+	present := 0
+	for i, shard := range r.shards {
+		r.chunks[i] = r.buffers[i][:0]
+		if shard == nil {
+			lost = append(lost, i)
+			continue
+		}
+		if !all && present == data {
+			continue
+		}
+
+		buffer := r.buffers[i][:chunk+4]
+		if _, err := shard.ReadAt(buffer, offset); err != nil || crc32.ChecksumIEEE(buffer[:chunk]) != binary.BigEndian.Uint32(buffer[chunk:]) {
+			lost = append(lost, i)
+			continue
+		}
+		r.chunks[i] = buffer[:chunk]
+		present++
+	}
+
+	if present < data {
+		return lost, reedsolomon.ErrTooFewShards
+	}
+	if len(lost) > 0 {
+		if err := r.encoder.Reconstruct(r.chunks); err != nil {
+			return lost, errors.Wrap(err, "failed to reconstruct stripe")
+		}
+	}
+	return lost, nil
+}
+
+// load decodes stripe holding the data unless it is decoded already.
+func (r *erasureReader) load(stripe int64) error {
+	if stripe == r.stripe {
+		return nil
+	}
+
+	lost, err := r.read(stripe, false)
+	for _, i := range lost {
+		if r.shards[i] != nil {
+			r.damaged()
+			break
+		}
+	}
+	if err != nil {
+		r.stripe = -1
+		return errors.Wrap(err, "failed to read stripe")
+	}
+
+	size, _ := r.header.stripe(stripe)
+	r.data = r.data[:0]
+	for i := 0; i < r.encoder.DataShards(); i++ {
+		r.data = append(r.data, r.chunks[i]...)
+	}
+	r.data = r.data[:size]
+	r.stripe = stripe
+	return nil
+}
+
+func (r *erasureReader) ReadAt(p []byte, offset int64) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	stripeSize := int64(r.encoder.DataShards() * r.header.chunkSize)
+	read := 0
+	for read < len(p) && offset < r.header.size {
+		stripe := offset / stripeSize
+		if err := r.load(stripe); err != nil {
+			return read, err
+		}
+
+		copied := copy(p[read:], r.data[offset-stripe*stripeSize:])
+		read += copied
+		offset += int64(copied)
+	}
+
+	if read < len(p) {
+		return read, io.EOF
+	}
+	return read, nil
+}
+
+func (r *erasureReader) Read(p []byte) (int, error) {
+	read, err := r.ReadAt(p, r.offset)
+	r.offset += int64(read)
+	if err == io.EOF && read > 0 {
+		err = nil
+	}
+	return read, err
+}
+
+func (r *erasureReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.header.size
+	}
+	if offset < 0 {
+		return r.offset, errors.New("failed to seek before start of file")
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+func (r *erasureReader) Close() error {
+	for _, shard := range r.shards {
+		if shard != nil {
+			shard.Close()
+		}
+	}
+	return nil
+}
+
+func (s *ErasureStorage) Load(filename string) (*drweb.File, error) {
+	r, missing, err := s.open(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var once sync.Once
+	r.damaged = func() {
+		once.Do(func() { s.rebuildLater(filename) })
+	}
+	if len(missing) > 0 {
+		r.damaged()
+	}
+
+	return &drweb.File{Body: r, Size: r.header.size}, nil
+}
+
+// rebuildLater rebuilds the file in background, unless it is being
+// rebuilt, saved or deleted already.
+func (s *ErasureStorage) rebuildLater(filename string) {
+	if !s.lock(filename, false) {
+		return
+	}
+
+	go func() {
+		defer s.unlock(filename)
+
+		// NOTE: file might have been deleted since it was read
+		if err := s.rebuild(filename); err != nil && !os.IsNotExist(errors.Cause(err)) {
+			log.WithError(err).WithField("filename", filename).Error("failed to rebuild shards")
+		}
+	}()
+}
+
+// Rebuild checks every shard of the file, rewriting lost and corrupt ones.
+func (s *ErasureStorage) Rebuild(filename string) error {
+	s.lock(filename, true)
+	defer s.unlock(filename)
+
+	return s.rebuild(filename)
+}
+
+// NOTE: should be called with the file locked
+func (s *ErasureStorage) rebuild(filename string) error {
+	r, missing, err := s.open(filename)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	stripes := int64(0)
+	if r.header.size > 0 {
+		stripeSize := int64(r.header.data * r.header.chunkSize)
+		stripes = (r.header.size + stripeSize - 1) / stripeSize
+	}
+
+	// NOTE: shards are checked through first, as corrupt ones are rewritten whole
+	damaged := map[int]bool{}
+	for _, target := range missing {
+		damaged[target] = true
+	}
+	for stripe := int64(0); stripe < stripes; stripe++ {
+		lost, err := r.read(stripe, true)
+		if err != nil {
+			return errors.Wrap(err, "failed to read stripe")
+		}
+		for _, target := range lost {
+			damaged[target] = true
+		}
+	}
+
+	if len(damaged) == 0 {
+		return nil
+	}
+
+	targets := []int{}
+	for target := range damaged {
+		targets = append(targets, target)
+	}
+	temps, err := s.createShards(targets)
+	if err != nil {
+		return err
+	}
+	defer discardShards(temps)
+
+	for stripe := int64(0); stripe < stripes; stripe++ {
+		if _, err := r.read(stripe, true); err != nil {
+			return errors.Wrap(err, "failed to read stripe")
+		}
+		for target, temp := range temps {
+			if err := writeErasureChunk(temp, r.chunks[target]); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err = s.commitShards(temps, filename, *r.header); err != nil {
+		return err
+	}
+	log.WithFields(log.Fields{"filename": filename, "shards": len(targets)}).Info("shards rebuilt")
+	return nil
+}
+
+// Delete removes every shard of the file, once its rebuild in progress is over.
+func (s *ErasureStorage) Delete(filename string) error {
+	var failure error
+	found := false
+
+	s.lock(filename, true)
+	defer s.unlock(filename)
+
+	for _, target := range s.Targets {
+		err := target.Delete(filename)
+		switch {
+		case err == nil:
+			found = true
+		case !os.IsNotExist(errors.Cause(err)):
+			failure = err
+		}
+	}
+
+	if failure != nil {
+		return errors.Wrap(failure, "failed to delete shards")
+	}
+	if !found {
+		return errors.Wrap(os.ErrNotExist, "failed to find file")
+	}
+	return nil
+}
+
+// Walk calls fn for every file any shard of which is found,
+// in lexical order of their names.
+func (s *ErasureStorage) Walk(fn func(filename string) error) error {
+	walkables := []drweb.WalkableStorage{}
+	for _, target := range s.Targets {
+		walkables = append(walkables, target)
+	}
+
+	return mergeWalks(walkables, fn)
+}
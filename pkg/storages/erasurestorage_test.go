@@ -0,0 +1,171 @@
+package storages_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+	"github.com/twonegatives/drweb_challenge/pkg/reedsolomon"
+	"github.com/twonegatives/drweb_challenge/pkg/storages"
+	"github.com/twonegatives/drweb_challenge/pkg/testutils"
+)
+
+func newErasureStorage(t *testing.T) (*storages.ErasureStorage, func()) {
+	targets, cleanup := testutils.GenerateDisks(t, 5)
+	return &storages.ErasureStorage{Targets: targets, DataShards: 3, ParityShards: 2, ChunkSize: 4096}, cleanup
+}
+
+// shards reads shard files of every target, nil for missing ones.
+func shards(storage *storages.ErasureStorage, filename string) [][]byte {
+	contents := [][]byte{}
+	for _, target := range storage.Targets {
+		path, _ := target.FilePathGenerator.Generate(filename)
+		shard, _ := ioutil.ReadFile(path)
+		contents = append(contents, shard)
+	}
+	return contents
+}
+
+func TestErasureStorageShards(t *testing.T) {
+	storage, cleanup := newErasureStorage(t)
+	defer cleanup()
+
+	var objects = map[string]struct {
+		Contents  []byte
+		ShardSize int
+	}{
+		"empty": {Contents: []byte{}, ShardSize: 20},
+		// NOTE: last stripe chunks are just as long as needed, 2 bytes padded
+		"small": {Contents: []byte("File contents"), ShardSize: 20 + 5 + 4},
+		// NOTE: a full stripe takes 12288 bytes, 3712 are left for the last one
+		"striped": {Contents: bytes.Repeat([]byte("0123456789abcdef"), 1000), ShardSize: 20 + (4096 + 4) + (1238 + 4)},
+	}
+
+	for testName, testObject := range objects {
+		t.Run(testName, func(t *testing.T) {
+			filename, err := testutils.SaveFile(storage, testObject.Contents)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, shard := range shards(storage, filename) {
+				assert.Equal(t, testObject.ShardSize, len(shard))
+			}
+			assert.Equal(t, testObject.Contents, testutils.LoadFile(t, storage, filename))
+		})
+	}
+}
+
+func TestErasureStorageReconstruct(t *testing.T) {
+	contents := bytes.Repeat([]byte("0123456789abcdef"), 10000)
+
+	t.Run("missing shards", func(t *testing.T) {
+		storage, cleanup := newErasureStorage(t)
+		defer cleanup()
+
+		filename, _ := testutils.SaveFile(storage, contents)
+		original := shards(storage, filename)
+		storage.Targets[0].Delete(filename)
+		storage.Targets[3].Delete(filename)
+
+		assert.Equal(t, contents, testutils.LoadFile(t, storage, filename))
+
+		// NOTE: lost shards are rebuilt in background
+		deadline := time.Now().Add(5 * time.Second)
+		for rebuilt := shards(storage, filename); time.Now().Before(deadline) && (rebuilt[0] == nil || rebuilt[3] == nil); rebuilt = shards(storage, filename) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		assert.Equal(t, original, shards(storage, filename))
+	})
+
+	t.Run("corrupt shards", func(t *testing.T) {
+		storage, cleanup := newErasureStorage(t)
+		defer cleanup()
+
+		filename, _ := testutils.SaveFile(storage, contents)
+		original := shards(storage, filename)
+
+		for _, target := range []int{1, 4} {
+			corrupt := append([]byte{}, original[target]...)
+			corrupt[len(corrupt)/2] ^= 0xff
+			path, _ := storage.Targets[target].FilePathGenerator.Generate(filename)
+			ioutil.WriteFile(path, corrupt, 0700)
+		}
+
+		assert.Equal(t, contents, testutils.LoadFile(t, storage, filename))
+		assert.Nil(t, storage.Rebuild(filename))
+		assert.Equal(t, original, shards(storage, filename))
+	})
+
+	t.Run("too many lost", func(t *testing.T) {
+		storage, cleanup := newErasureStorage(t)
+		defer cleanup()
+
+		filename, _ := testutils.SaveFile(storage, contents)
+		for _, target := range []int{0, 2, 4} {
+			storage.Targets[target].Delete(filename)
+		}
+
+		_, err := storage.Load(filename)
+		assert.Equal(t, reedsolomon.ErrTooFewShards, errors.Cause(err))
+		assert.Equal(t, reedsolomon.ErrTooFewShards, errors.Cause(storage.Rebuild(filename)))
+	})
+
+	t.Run("deleted meanwhile", func(t *testing.T) {
+		storage, cleanup := newErasureStorage(t)
+		defer cleanup()
+
+		// NOTE: deletions wait for rebuilds in progress, later rebuilds find nothing to do
+		large := bytes.Repeat(contents, 40)
+		for i := 0; i < 5; i++ {
+			filename, _ := testutils.SaveFile(storage, large)
+			storage.Targets[i%5].Delete(filename)
+
+			file, err := storage.Load(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			file.Close()
+			assert.Nil(t, storage.Delete(filename))
+		}
+
+		time.Sleep(100 * time.Millisecond)
+		filenames := []string{}
+		assert.Nil(t, storage.Walk(func(filename string) error {
+			filenames = append(filenames, filename)
+			return nil
+		}))
+		assert.Empty(t, filenames)
+	})
+
+	t.Run("healthy", func(t *testing.T) {
+		storage, cleanup := newErasureStorage(t)
+		defer cleanup()
+
+		filename, _ := testutils.SaveFile(storage, contents)
+		original := shards(storage, filename)
+
+		assert.Nil(t, storage.Rebuild(filename))
+		assert.Equal(t, original, shards(storage, filename))
+	})
+}
+
+func TestErasureStorageMisconfigured(t *testing.T) {
+	storage, cleanup := newErasureStorage(t)
+	defer cleanup()
+	storage.ParityShards = 1
+
+	_, err := testutils.SaveFile(storage, []byte("File contents"))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "expected 4 targets, got 5")
+}
+
+func TestErasureStorageSuite(t *testing.T) {
+	testStorageSuite(t, func(t *testing.T) (drweb.WalkableStorage, func()) {
+		return newErasureStorage(t)
+	})
+}
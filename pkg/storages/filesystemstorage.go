@@ -11,8 +11,12 @@ import (
 )
 
 type FileSystemStorage struct {
+	BasePath          string
 	FileMode          os.FileMode
 	FilePathGenerator drweb.FilePathGenerator
+	// NOTE: uploads are renamed into place, so temp files should be
+	// on the same disk as BasePath. System temp dir is used if blank
+	TempPath string
 }
 
 func (s *FileSystemStorage) filepath(filename string) (string, error) {
@@ -30,24 +34,38 @@ func (s *FileSystemStorage) Save(file *drweb.FileCreateRequest) (string, error)
 
 	// NOTE: temp file solves filename uniqueness issue for us
 	// until we get a final hashsum name. we should chmod/rename it thougth
-	tmpfile, err := ioutil.TempFile(os.TempDir(), "prefix")
+	tmpfile, err := ioutil.TempFile(s.TempPath, "prefix")
 	if err != nil {
 		return filename, errors.Wrap(err, "failed to create file")
 	}
 
 	defer tmpfile.Close()
+	defer func() {
+		if err != nil {
+			os.Remove(tmpfile.Name())
+		}
+	}()
 
 	if err = tmpfile.Chmod(s.FileMode); err != nil {
 		return filename, errors.Wrap(err, "failed to set requested file mode")
 	}
 
-	filenameReader := io.TeeReader(file.Body, tmpfile)
+	writers := []io.Writer{tmpfile}
+	for _, inspector := range file.Inspectors {
+		writers = append(writers, inspector)
+	}
+
+	filenameReader := io.TeeReader(file.Body, io.MultiWriter(writers...))
 	filename, err = file.NameGenerator.Generate(filenameReader)
 
 	if err != nil {
 		return filename, errors.Wrap(err, "failed to generate filename")
 	}
 
+	if err = inspect(file, filename); err != nil {
+		return filename, err
+	}
+
 	if path, err = s.filepath(filename); err != nil {
 		return filename, errors.Wrap(err, "failed to generate filepath")
 	}
@@ -61,6 +79,26 @@ func (s *FileSystemStorage) Save(file *drweb.FileCreateRequest) (string, error)
 	return filename, errors.Wrap(err, "failed to write to file")
 }
 
+// NOTE: rejections are passed through untouched, so that
+// transport could tell them apart from storage failures.
+func inspect(file *drweb.FileCreateRequest, filename string) error {
+	if file.Metadata == nil {
+		file.Metadata = &drweb.Metadata{}
+	}
+	file.Metadata.Filename = filename
+
+	for _, inspector := range file.Inspectors {
+		if err := inspector.Inspect(filename, file.Metadata); err != nil {
+			if _, ok := err.(*drweb.RejectionError); ok {
+				return err
+			}
+			return errors.Wrap(err, "failed to inspect file")
+		}
+	}
+
+	return nil
+}
+
 func (s *FileSystemStorage) Load(filename string) (*drweb.File, error) {
 	var file *os.File
 	var stat os.FileInfo
@@ -92,3 +130,66 @@ func (s *FileSystemStorage) Delete(filename string) error {
 
 	return os.Remove(path)
 }
+
+// Walk calls fn for every stored file in lexical order of their names.
+// NOTE: base path may be shared with other stuff (quarantine, checkpoints),
+// so we only take files which lie exactly where the path generator puts them.
+func (s *FileSystemStorage) Walk(fn func(filename string) error) error {
+	if s.BasePath == "" {
+		return errors.New("failed to walk storage without base path")
+	}
+
+	return filepath.Walk(s.BasePath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// NOTE: nothing was stored yet
+			if path == s.BasePath && os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		// NOTE: stored files are named after their hashes, so anything
+		// having an extension is derived from them (analyses and such)
+		filename := info.Name()
+		if filepath.Ext(filename) != "" {
+			return nil
+		}
+
+		expected, err := s.filepath(filename)
+		if err != nil || filepath.Clean(expected) != filepath.Clean(path) {
+			return nil
+		}
+
+		return fn(filename)
+	})
+}
+
+// copyVerified copies file from one storage to another, naming the copy with gen,
+// which should name files as uploads are named, so that a copy not matching
+// its name is told and dropped.
+func copyVerified(from, to drweb.Storage, filename string, gen drweb.FileNameGenerator) error {
+	if gen == nil {
+		return errors.New("failed to copy file without name generator")
+	}
+
+	file, err := from.Load(filename)
+	if err != nil {
+		return errors.Wrap(err, "failed to load file")
+	}
+	defer file.Close()
+
+	copied, err := to.Save(&drweb.FileCreateRequest{Body: file.Body, NameGenerator: gen})
+	if err != nil {
+		return errors.Wrap(err, "failed to save copy")
+	}
+	if copied != filename {
+		to.Delete(copied)
+		return errors.Wrap(errChecksumMismatch, "failed to copy file which does not match its name")
+	}
+
+	return nil
+}
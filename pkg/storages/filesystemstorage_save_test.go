@@ -116,3 +116,60 @@ func TestSaveSuccess(t *testing.T) {
 	assert.Equal(t, savedFileName, filename)
 	assert.Equal(t, contents, bytes)
 }
+
+type rejectingInspector struct {
+	bytes.Buffer
+}
+
+func (i *rejectingInspector) Inspect(filename string, metadata *drweb.Metadata) error {
+	if i.String() == "bad contents" {
+		return &drweb.RejectionError{Status: 403, Rule: "test", Reason: "bad"}
+	}
+	metadata.AddTag("seen:" + filename)
+	return nil
+}
+
+func TestSaveWithInspectors(t *testing.T) {
+	t.Run("accepted", func(t *testing.T) {
+		filename := "inspected1"
+		path := path.Join("../../tmp", filename)
+		inspector := &rejectingInspector{}
+
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+		pathgen := mocks.NewMockFilePathGenerator(mockCtrl)
+		pathgen.EXPECT().Generate(filename).Return(path, nil)
+
+		storage := storages.FileSystemStorage{FileMode: 0700, FilePathGenerator: pathgen}
+		file := drweb.FileCreateRequest{
+			Body:          ioutil.NopCloser(bytes.NewReader([]byte("good contents"))),
+			NameGenerator: &staticFileNameGenerator{Name: filename},
+			Inspectors:    []drweb.Inspector{inspector},
+		}
+
+		_, err := storage.Save(&file)
+		defer os.Remove(path)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "good contents", inspector.String())
+		assert.Equal(t, []string{"seen:inspected1"}, file.Metadata.Tags)
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+		pathgen := mocks.NewMockFilePathGenerator(mockCtrl)
+		pathgen.EXPECT().Generate(gomock.Any()).Times(0)
+
+		storage := storages.FileSystemStorage{FileMode: 0700, FilePathGenerator: pathgen}
+		file := drweb.FileCreateRequest{
+			Body:          ioutil.NopCloser(bytes.NewReader([]byte("bad contents"))),
+			NameGenerator: &staticFileNameGenerator{Name: "inspected2"},
+			Inspectors:    []drweb.Inspector{&rejectingInspector{}},
+		}
+
+		_, err := storage.Save(&file)
+		_, ok := err.(*drweb.RejectionError)
+		assert.True(t, ok)
+	})
+}
@@ -0,0 +1,61 @@
+package storages_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/twonegatives/drweb_challenge/pkg/pathgenerators"
+	"github.com/twonegatives/drweb_challenge/pkg/storages"
+	"github.com/twonegatives/drweb_challenge/pkg/testutils"
+)
+
+func TestWalk(t *testing.T) {
+	base, err := ioutil.TempDir("../../tmp", "walk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(base)
+
+	storage := storages.FileSystemStorage{
+		BasePath:          base,
+		FileMode:          0700,
+		FilePathGenerator: &pathgenerators.NestedGenerator{BasePath: base, Levels: 1, FolderLength: 2},
+	}
+
+	for _, name := range []string{"cdef", "abcd", "abef"} {
+		path, _ := storage.FilePathGenerator.Generate(name)
+		if err = testutils.CreateFile(path, []byte(name), 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// NOTE: files lying out of generated paths should be skipped
+	if err = testutils.CreateFile(path.Join(base, "rescan.json"), []byte("{}"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err = testutils.CreateFile(path.Join(base, "quarantine", "ab", "abzz"), []byte("abzz"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err = testutils.CreateFile(path.Join(base, "ab", "abcd.analysis.json"), []byte("{}"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	var filenames []string
+	err = storage.Walk(func(filename string) error {
+		filenames = append(filenames, filename)
+		return nil
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"abcd", "abef", "cdef"}, filenames)
+}
+
+func TestWalkFailure(t *testing.T) {
+	storage := storages.FileSystemStorage{}
+	err := storage.Walk(func(string) error { return nil })
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "failed to walk storage without base path")
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+// +build !windows
+
+package storages
+
+import (
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// freeSpace tells how many bytes are left at path for unprivileged users.
+func freeSpace(path string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, errors.Wrap(err, "failed to get free space")
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
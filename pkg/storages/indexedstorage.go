@@ -0,0 +1,112 @@
+package storages
+
+import (
+	"io"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+)
+
+// IndexedStorage keeps metadata store in sync with the underlying storage:
+// metadata collected by inspectors is persisted on save and dropped on delete.
+// Files derived from a deleted one (thumbnails) are deleted as well,
+// unless they are derived from some other file too.
+type IndexedStorage struct {
+	Storage  drweb.Storage
+	Metadata drweb.MetadataStore
+}
+
+type countingReader struct {
+	io.ReadCloser
+	Count int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.Count += int64(n)
+	return n, err
+}
+
+func (s *IndexedStorage) Save(file *drweb.FileCreateRequest) (string, error) {
+	var filename string
+	var err error
+
+	body := &countingReader{ReadCloser: file.Body}
+	file.Body = body
+
+	if filename, err = s.Storage.Save(file); err != nil {
+		return filename, err
+	}
+
+	collected := file.Metadata
+	if collected == nil {
+		collected = &drweb.Metadata{}
+	}
+	collected.Size = body.Count
+	collected.CreatedAt = time.Now().UTC()
+
+	err = s.Metadata.Update(filename, func(metadata *drweb.Metadata) error {
+		metadata.Merge(collected)
+		return nil
+	})
+
+	return filename, errors.Wrap(err, "failed to save metadata")
+}
+
+func (s *IndexedStorage) Load(filename string) (*drweb.File, error) {
+	return s.Storage.Load(filename)
+}
+
+func (s *IndexedStorage) Delete(filename string) error {
+	metadata, err := s.Metadata.Get(filename)
+	if err != nil && !os.IsNotExist(errors.Cause(err)) {
+		return errors.Wrap(err, "failed to get metadata")
+	}
+
+	if err = s.Storage.Delete(filename); err != nil {
+		return err
+	}
+
+	if err = s.Metadata.Delete(filename); err != nil && !os.IsNotExist(errors.Cause(err)) {
+		return errors.Wrap(err, "failed to delete metadata")
+	}
+
+	if metadata == nil {
+		return nil
+	}
+
+	for _, derived := range metadata.Derived {
+		if err = s.deleteDerived(derived, filename); err != nil {
+			return errors.Wrap(err, "failed to delete derived file")
+		}
+	}
+
+	return nil
+}
+
+func (s *IndexedStorage) deleteDerived(filename string, source string) error {
+	// NOTE: Update would create blank metadata for a derived file which is gone
+	if _, err := s.Metadata.Get(filename); err != nil {
+		if os.IsNotExist(errors.Cause(err)) {
+			return nil
+		}
+		return err
+	}
+
+	orphaned := false
+	err := s.Metadata.Update(filename, func(metadata *drweb.Metadata) error {
+		metadata.RemoveDerivedFrom(source)
+		orphaned = len(metadata.DerivedFrom) == 0
+		return nil
+	})
+	if err != nil || !orphaned {
+		return err
+	}
+
+	if err = s.Delete(filename); err != nil && !os.IsNotExist(errors.Cause(err)) {
+		return err
+	}
+	return nil
+}
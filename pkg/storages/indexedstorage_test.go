@@ -0,0 +1,94 @@
+package storages_test
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	pkgerrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+	"github.com/twonegatives/drweb_challenge/pkg/mocks"
+	"github.com/twonegatives/drweb_challenge/pkg/storages"
+	"github.com/twonegatives/drweb_challenge/pkg/testutils"
+)
+
+func TestIndexedStorageSave(t *testing.T) {
+	store, cleanup := testutils.GenerateMetadataStore(t)
+	defer cleanup()
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	underlying := mocks.NewMockStorage(mockCtrl)
+	underlying.EXPECT().Save(gomock.Any()).DoAndReturn(func(file *drweb.FileCreateRequest) (string, error) {
+		ioutil.ReadAll(file.Body)
+		return "abcdef", nil
+	}).Times(2)
+
+	storage := storages.IndexedStorage{Storage: underlying, Metadata: store}
+
+	file := &drweb.FileCreateRequest{
+		Body:     ioutil.NopCloser(bytes.NewReader([]byte("contents"))),
+		Metadata: &drweb.Metadata{Tags: []string{"allowlist:nsrl"}},
+	}
+	filename, err := storage.Save(file)
+	assert.Nil(t, err)
+	assert.Equal(t, "abcdef", filename)
+
+	metadata, err := store.Get("abcdef")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(8), metadata.Size)
+	assert.False(t, metadata.CreatedAt.IsZero())
+	createdAt := metadata.CreatedAt
+
+	file = &drweb.FileCreateRequest{
+		Body:     ioutil.NopCloser(bytes.NewReader([]byte("contents"))),
+		Metadata: &drweb.Metadata{Tags: []string{"blocklist:suspicious"}},
+	}
+	_, err = storage.Save(file)
+	assert.Nil(t, err)
+
+	metadata, err = store.Get("abcdef")
+	assert.Nil(t, err)
+	assert.Equal(t, createdAt, metadata.CreatedAt)
+	assert.Equal(t, []string{"allowlist:nsrl", "blocklist:suspicious"}, metadata.Tags)
+}
+
+func TestIndexedStorageSaveFailure(t *testing.T) {
+	store, cleanup := testutils.GenerateMetadataStore(t)
+	defer cleanup()
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	underlying := mocks.NewMockStorage(mockCtrl)
+	underlying.EXPECT().Save(gomock.Any()).Return("", errors.New("disk is full"))
+
+	storage := storages.IndexedStorage{Storage: underlying, Metadata: store}
+	_, err := storage.Save(&drweb.FileCreateRequest{Body: ioutil.NopCloser(bytes.NewReader(nil))})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "disk is full")
+}
+
+func TestIndexedStorageDelete(t *testing.T) {
+	store, cleanup := testutils.GenerateMetadataStore(t)
+	defer cleanup()
+
+	store.Update("abcdef", func(*drweb.Metadata) error { return nil })
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	underlying := mocks.NewMockStorage(mockCtrl)
+	underlying.EXPECT().Delete("abcdef").Return(nil)
+	underlying.EXPECT().Delete("missing").Return(os.ErrNotExist)
+
+	storage := storages.IndexedStorage{Storage: underlying, Metadata: store}
+	assert.Nil(t, storage.Delete("abcdef"))
+
+	_, err := store.Get("abcdef")
+	assert.True(t, os.IsNotExist(pkgerrors.Cause(err)))
+
+	assert.True(t, os.IsNotExist(storage.Delete("missing")))
+}
@@ -0,0 +1,46 @@
+package storages
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+)
+
+// JobStorage hands every saved file over to post-save jobs
+// and lets them forget about deleted ones.
+type JobStorage struct {
+	Storage drweb.Storage
+	Jobs    []drweb.PostSaveJob
+}
+
+func (s *JobStorage) Save(file *drweb.FileCreateRequest) (string, error) {
+	filename, err := s.Storage.Save(file)
+	if err != nil {
+		return filename, err
+	}
+
+	for _, job := range s.Jobs {
+		job.Enqueue(filename)
+	}
+
+	return filename, nil
+}
+
+func (s *JobStorage) Load(filename string) (*drweb.File, error) {
+	return s.Storage.Load(filename)
+}
+
+func (s *JobStorage) Delete(filename string) error {
+	if err := s.Storage.Delete(filename); err != nil {
+		return err
+	}
+
+	for _, job := range s.Jobs {
+		if err := job.Forget(filename); err != nil && !os.IsNotExist(errors.Cause(err)) {
+			return errors.Wrap(err, "failed to forget deleted file")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,64 @@
+package storages_test
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+	"github.com/twonegatives/drweb_challenge/pkg/mocks"
+	"github.com/twonegatives/drweb_challenge/pkg/storages"
+)
+
+func TestJobStorageSave(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	file := &drweb.FileCreateRequest{}
+	underlying := mocks.NewMockStorage(mockCtrl)
+	underlying.EXPECT().Save(file).Return("abcdef", nil)
+	underlying.EXPECT().Save(file).Return("", errors.New("disk is full"))
+
+	job := mocks.NewMockPostSaveJob(mockCtrl)
+	job.EXPECT().Enqueue("abcdef").Times(1)
+
+	storage := storages.JobStorage{Storage: underlying, Jobs: []drweb.PostSaveJob{job}}
+
+	filename, err := storage.Save(file)
+	assert.Nil(t, err)
+	assert.Equal(t, "abcdef", filename)
+
+	// NOTE: failed saves are not handed over to jobs
+	_, err = storage.Save(file)
+	assert.NotNil(t, err)
+}
+
+func TestJobStorageDelete(t *testing.T) {
+	var objects = map[string]struct {
+		ForgetError error
+		Failed      bool
+	}{
+		"forgotten":           {ForgetError: nil, Failed: false},
+		"nothing to forget":   {ForgetError: os.ErrNotExist, Failed: false},
+		"failed to forget it": {ForgetError: errors.New("disk is gone"), Failed: true},
+	}
+
+	for testName, testObject := range objects {
+		t.Run(testName, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+
+			underlying := mocks.NewMockStorage(mockCtrl)
+			underlying.EXPECT().Delete("abcdef").Return(nil)
+
+			job := mocks.NewMockPostSaveJob(mockCtrl)
+			job.EXPECT().Forget("abcdef").Return(testObject.ForgetError)
+
+			storage := storages.JobStorage{Storage: underlying, Jobs: []drweb.PostSaveJob{job}}
+			err := storage.Delete("abcdef")
+			assert.Equal(t, testObject.Failed, err != nil)
+		})
+	}
+}
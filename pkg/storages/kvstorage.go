@@ -0,0 +1,557 @@
+package storages
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+	bolt "go.etcd.io/bbolt"
+)
+
+const kvInline = 0
+const kvChunked = 1
+const kvWalkPage = 1000
+const kvCompactBatch = 64 << 20
+
+var kvFilesBucket = []byte("files")
+var kvChunksBucket = []byte("chunks")
+
+// KVStorage keeps files in a single bolt database, which spares inodes on
+// millions of tiny files and makes a backup a matter of copying one file.
+// Files up to ChunkSize are kept inline, larger ones are split into chunks.
+// NOTE: bolt allows a single writer at a time, so uploads are written chunk by chunk
+// in short transactions under a random id, and have their name linked to that id
+// once hashed and inspected. Space of deleted files is reused, but it is only
+// given back to the disk by Compact.
+type KVStorage struct {
+	Path      string
+	FileMode  os.FileMode
+	ChunkSize int
+	db        *bolt.DB
+	mutex     sync.RWMutex
+}
+
+// kvEntry heads a stored file: either it has inline contents,
+// or it refers to chunks keyed by id and chunk index.
+type kvEntry struct {
+	contents  []byte
+	id        []byte
+	size      int64
+	chunkSize int64
+}
+
+func (e *kvEntry) encode() []byte {
+	if e.id == nil {
+		return append([]byte{kvInline}, e.contents...)
+	}
+
+	value := make([]byte, 17, 17+len(e.id))
+	value[0] = kvChunked
+	binary.BigEndian.PutUint64(value[1:], uint64(e.size))
+	binary.BigEndian.PutUint64(value[9:], uint64(e.chunkSize))
+	return append(value, e.id...)
+}
+
+func (e *kvEntry) chunks() int64 {
+	if e.id == nil {
+		return 0
+	}
+	return (e.size + e.chunkSize - 1) / e.chunkSize
+}
+
+func decodeKVEntry(value []byte) (*kvEntry, error) {
+	if len(value) > 0 && value[0] == kvInline {
+		return &kvEntry{contents: append([]byte{}, value[1:]...), size: int64(len(value) - 1)}, nil
+	}
+
+	if len(value) < 18 || value[0] != kvChunked {
+		return nil, errors.New("file entry is corrupted")
+	}
+
+	return &kvEntry{
+		size:      int64(binary.BigEndian.Uint64(value[1:])),
+		chunkSize: int64(binary.BigEndian.Uint64(value[9:])),
+		id:        append([]byte{}, value[17:]...),
+	}, nil
+}
+
+func kvChunkKey(id []byte, index int64) []byte {
+	key := make([]byte, len(id)+8)
+	copy(key, id)
+	binary.BigEndian.PutUint64(key[len(id):], uint64(index))
+	return key
+}
+
+func (s *KVStorage) Open() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.open()
+}
+
+func (s *KVStorage) open() error {
+	db, err := bolt.Open(s.Path, s.FileMode, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return errors.Wrap(err, "failed to open database")
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{kvFilesBucket, kvChunksBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return errors.Wrap(err, "failed to create buckets")
+	}
+
+	s.db = db
+	return nil
+}
+
+func (s *KVStorage) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.db == nil {
+		return nil
+	}
+
+	err := s.db.Close()
+	s.db = nil
+	return errors.Wrap(err, "failed to close database")
+}
+
+func (s *KVStorage) chunkSize() int64 {
+	if s.ChunkSize < 1 {
+		return 64 << 10
+	}
+	return int64(s.ChunkSize)
+}
+
+func (s *KVStorage) Save(file *drweb.FileCreateRequest) (string, error) {
+	var filename string
+	var err error
+
+	if file.NameGenerator == nil {
+		return filename, errors.New("failed to save file without name generator")
+	}
+
+	id := make([]byte, 16)
+	if _, err = rand.Read(id); err != nil {
+		return filename, errors.Wrap(err, "failed to generate chunks id")
+	}
+
+	// NOTE: compaction waits for uploads in progress
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if s.db == nil {
+		return filename, errors.New("failed to save file to closed storage")
+	}
+
+	upload := &kvUpload{db: s.db, entry: &kvEntry{id: id, chunkSize: s.chunkSize()}}
+	defer upload.discard()
+
+	writers := []io.Writer{upload}
+	for _, inspector := range file.Inspectors {
+		writers = append(writers, inspector)
+	}
+
+	filenameReader := io.TeeReader(file.Body, io.MultiWriter(writers...))
+	if filename, err = file.NameGenerator.Generate(filenameReader); err != nil {
+		return filename, errors.Wrap(err, "failed to generate filename")
+	}
+
+	if err = inspect(file, filename); err != nil {
+		return filename, err
+	}
+
+	return filename, errors.Wrap(upload.link(filename), "failed to write to storage")
+}
+
+func (s *KVStorage) Load(filename string) (*drweb.File, error) {
+	entry, err := s.entry(filename)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get file entry")
+	}
+
+	return &drweb.File{Body: &kvReader{storage: s, entry: entry}, Size: entry.size}, nil
+}
+
+func (s *KVStorage) Delete(filename string) error {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if s.db == nil {
+		return errors.New("failed to delete file from closed storage")
+	}
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		files := tx.Bucket(kvFilesBucket)
+		value := files.Get([]byte(filename))
+		if value == nil {
+			return os.ErrNotExist
+		}
+
+		entry, err := decodeKVEntry(value)
+		if err != nil {
+			return err
+		}
+
+		chunks := tx.Bucket(kvChunksBucket)
+		for index := int64(0); index < entry.chunks(); index++ {
+			if err = chunks.Delete(kvChunkKey(entry.id, index)); err != nil {
+				return err
+			}
+		}
+
+		return files.Delete([]byte(filename))
+	})
+
+	return errors.Wrap(err, "failed to delete file")
+}
+
+// Walk calls fn for every stored file in lexical order of their names.
+// NOTE: names are taken page by page, so that fn is free to use the storage.
+func (s *KVStorage) Walk(fn func(filename string) error) error {
+	var last []byte
+
+	for {
+		page := []string{}
+		err := s.view(func(tx *bolt.Tx) error {
+			cursor := tx.Bucket(kvFilesBucket).Cursor()
+			key, _ := cursor.First()
+			if last != nil {
+				if key, _ = cursor.Seek(last); bytes.Equal(key, last) {
+					key, _ = cursor.Next()
+				}
+			}
+
+			for ; key != nil && len(page) < kvWalkPage; key, _ = cursor.Next() {
+				page = append(page, string(key))
+			}
+			return nil
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to walk storage")
+		}
+
+		for _, filename := range page {
+			if err = fn(filename); err != nil {
+				return err
+			}
+		}
+
+		if len(page) < kvWalkPage {
+			return nil
+		}
+		last = []byte(page[len(page)-1])
+	}
+}
+
+// Compact rewrites the database into a fresh file, giving space of deleted files
+// back to the disk. It returns database sizes before and after.
+// NOTE: the storage is not available meanwhile.
+func (s *KVStorage) Compact() (int64, int64, error) {
+	var before, after os.FileInfo
+	var err error
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.db == nil {
+		return 0, 0, errors.New("failed to compact closed storage")
+	}
+
+	if before, err = os.Stat(s.Path); err != nil {
+		return 0, 0, errors.Wrap(err, "failed to get database info")
+	}
+
+	compactPath := s.Path + ".compact"
+	os.Remove(compactPath)
+
+	compacted, err := bolt.Open(compactPath, s.FileMode, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "failed to create compacted database")
+	}
+
+	err = s.db.View(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{kvFilesBucket, kvChunksBucket} {
+			if err := compactBucket(tx.Bucket(name), compacted, name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	if closeErr := compacted.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(compactPath)
+		return 0, 0, errors.Wrap(err, "failed to compact database")
+	}
+
+	if err = s.db.Close(); err != nil {
+		return 0, 0, errors.Wrap(err, "failed to close database")
+	}
+	s.db = nil
+
+	// NOTE: the old database is reopened in case of failure
+	if err = os.Rename(compactPath, s.Path); err != nil {
+		err = errors.Wrap(err, "failed to replace database")
+	}
+	if openErr := s.open(); err == nil {
+		err = openErr
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if after, err = os.Stat(s.Path); err != nil {
+		return 0, 0, errors.Wrap(err, "failed to get database info")
+	}
+
+	return before.Size(), after.Size(), nil
+}
+
+// NOTE: pairs are copied in batches, as bolt keeps pages of a write transaction in memory.
+func compactBucket(src *bolt.Bucket, dst *bolt.DB, name []byte) error {
+	cursor := src.Cursor()
+	key, value := cursor.First()
+
+	for {
+		err := dst.Update(func(tx *bolt.Tx) error {
+			bucket, err := tx.CreateBucketIfNotExists(name)
+			if err != nil {
+				return err
+			}
+
+			// NOTE: keys are put in order, so pages may be filled up
+			bucket.FillPercent = 1
+			for batch := 0; key != nil && batch < kvCompactBatch; key, value = cursor.Next() {
+				if err = bucket.Put(key, value); err != nil {
+					return err
+				}
+				batch += len(key) + len(value)
+			}
+			return nil
+		})
+
+		if err != nil || key == nil {
+			return err
+		}
+	}
+}
+
+func (s *KVStorage) view(fn func(tx *bolt.Tx) error) error {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if s.db == nil {
+		return errors.New("storage is closed")
+	}
+	return s.db.View(fn)
+}
+
+func (s *KVStorage) entry(filename string) (*kvEntry, error) {
+	var entry *kvEntry
+
+	err := s.view(func(tx *bolt.Tx) error {
+		value := tx.Bucket(kvFilesBucket).Get([]byte(filename))
+		if value == nil {
+			return os.ErrNotExist
+		}
+
+		var err error
+		entry, err = decodeKVEntry(value)
+		return err
+	})
+
+	return entry, err
+}
+
+func (s *KVStorage) chunk(id []byte, index int64) ([]byte, error) {
+	var chunk []byte
+
+	err := s.view(func(tx *bolt.Tx) error {
+		value := tx.Bucket(kvChunksBucket).Get(kvChunkKey(id, index))
+		if value == nil {
+			return errors.Errorf("chunk %d is missing", index)
+		}
+
+		// NOTE: values are only valid while transaction is open
+		chunk = append([]byte{}, value...)
+		return nil
+	})
+
+	return chunk, err
+}
+
+// kvUpload buffers written contents, putting them to chunks once they
+// outgrow a single one.
+type kvUpload struct {
+	db     *bolt.DB
+	entry  *kvEntry
+	buffer []byte
+	chunks int64
+	linked bool
+}
+
+func (u *kvUpload) Write(p []byte) (int, error) {
+	u.buffer = append(u.buffer, p...)
+	u.entry.size += int64(len(p))
+
+	for int64(len(u.buffer)) >= u.entry.chunkSize {
+		if err := u.flush(u.buffer[:u.entry.chunkSize]); err != nil {
+			return 0, err
+		}
+		u.buffer = u.buffer[:copy(u.buffer, u.buffer[u.entry.chunkSize:])]
+	}
+
+	return len(p), nil
+}
+
+func (u *kvUpload) flush(chunk []byte) error {
+	err := u.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(kvChunksBucket).Put(kvChunkKey(u.entry.id, u.chunks), chunk)
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to write chunk")
+	}
+
+	u.chunks++
+	return nil
+}
+
+func (u *kvUpload) link(filename string) error {
+	entry := u.entry
+	if u.chunks == 0 {
+		entry = &kvEntry{contents: u.buffer, size: int64(len(u.buffer))}
+	} else if len(u.buffer) > 0 {
+		if err := u.flush(u.buffer); err != nil {
+			return err
+		}
+	}
+
+	return u.db.Update(func(tx *bolt.Tx) error {
+		files := tx.Bucket(kvFilesBucket)
+		// NOTE: same contents are stored already, chunks of ours get discarded
+		if files.Get([]byte(filename)) != nil {
+			return nil
+		}
+
+		u.linked = true
+		return files.Put([]byte(filename), entry.encode())
+	})
+}
+
+func (u *kvUpload) discard() error {
+	if u.linked || u.chunks == 0 {
+		return nil
+	}
+
+	return u.db.Update(func(tx *bolt.Tx) error {
+		chunks := tx.Bucket(kvChunksBucket)
+		for index := int64(0); index < u.chunks; index++ {
+			if err := chunks.Delete(kvChunkKey(u.entry.id, index)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// kvReader streams a file chunk by chunk, keeping the last chunk read.
+type kvReader struct {
+	storage *KVStorage
+	entry   *kvEntry
+	offset  int64
+	mutex   sync.Mutex
+	index   int64
+	chunk   []byte
+}
+
+func (r *kvReader) Read(p []byte) (int, error) {
+	n, err := r.ReadAt(p, r.offset)
+	r.offset += int64(n)
+
+	if n > 0 && err == io.EOF {
+		return n, nil
+	}
+	return n, err
+}
+
+func (r *kvReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+
+	if r.entry.id == nil {
+		if off >= r.entry.size {
+			return 0, io.EOF
+		}
+		n := copy(p, r.entry.contents[off:])
+		if n < len(p) {
+			return n, io.EOF
+		}
+		return n, nil
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	n := 0
+	for n < len(p) {
+		if off >= r.entry.size {
+			return n, io.EOF
+		}
+
+		index := off / r.entry.chunkSize
+		if r.chunk == nil || r.index != index {
+			chunk, err := r.storage.chunk(r.entry.id, index)
+			if err != nil {
+				return n, errors.Wrap(err, "failed to read chunk")
+			}
+			r.chunk, r.index = chunk, index
+		}
+
+		copied := copy(p[n:], r.chunk[off-index*r.entry.chunkSize:])
+		n += copied
+		off += int64(copied)
+	}
+
+	return n, nil
+}
+
+func (r *kvReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.entry.size
+	default:
+		return r.offset, errors.New("invalid whence")
+	}
+
+	if offset < 0 {
+		return r.offset, errors.New("negative position")
+	}
+
+	r.offset = offset
+	return offset, nil
+}
+
+func (r *kvReader) Close() error {
+	return nil
+}
@@ -0,0 +1,81 @@
+package storages_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+	"github.com/twonegatives/drweb_challenge/pkg/namegenerators"
+	"github.com/twonegatives/drweb_challenge/pkg/storages"
+)
+
+func TestKVStorageCompact(t *testing.T) {
+	base, err := ioutil.TempDir("../../tmp", "kv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(base)
+
+	storage := &storages.KVStorage{Path: path.Join(base, "files.db"), FileMode: 0600, ChunkSize: 1 << 16}
+	if err = storage.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer storage.Close()
+
+	filenames := []string{}
+	for i := 0; i < 10; i++ {
+		filename, err := storage.Save(&drweb.FileCreateRequest{
+			Body:          ioutil.NopCloser(bytes.NewReader(bytes.Repeat([]byte(fmt.Sprintf("file #%d", i)), 100000))),
+			NameGenerator: &namegenerators.SHA256{},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		filenames = append(filenames, filename)
+	}
+
+	for _, filename := range filenames[1:] {
+		if err = storage.Delete(filename); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// NOTE: files being read are not affected by compaction
+	file, err := storage.Load(filenames[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	before, after, err := storage.Compact()
+	assert.Nil(t, err)
+	assert.True(t, after < before/5, "compacted from %d to %d bytes", before, after)
+
+	contents, err := ioutil.ReadAll(file.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, bytes.Repeat([]byte("file #0"), 100000), contents)
+
+	filename, err := storage.Save(&drweb.FileCreateRequest{
+		Body:          ioutil.NopCloser(bytes.NewReader([]byte("saved after compaction"))),
+		NameGenerator: &namegenerators.SHA256{},
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, storage.Delete(filename))
+}
+
+func TestKVStorageClosed(t *testing.T) {
+	storage := &storages.KVStorage{}
+
+	_, err := storage.Save(&drweb.FileCreateRequest{NameGenerator: &namegenerators.SHA256{}})
+	assert.NotNil(t, err)
+	_, err = storage.Load("abcdef")
+	assert.NotNil(t, err)
+	assert.NotNil(t, storage.Delete("abcdef"))
+	_, _, err = storage.Compact()
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,176 @@
+package storages
+
+import (
+	"bytes"
+	"container/list"
+	"io"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+)
+
+// MemoryStorage keeps files in memory, e.g. for tests or as a short-lived cache.
+// Files may take up to MaxSize bytes in total unless it is zero, a file which does
+// not fit fails with drweb.ErrStorageFull, or has the least recently used files
+// evicted to make room if Evict is set.
+// NOTE: evicted files are gone without a trace, metadata of theirs is left as is.
+type MemoryStorage struct {
+	MaxSize int64
+	Evict   bool
+	mutex   sync.Mutex
+	files   map[string]*list.Element
+	recent  *list.List
+	size    int64
+}
+
+type memoryFile struct {
+	filename string
+	contents []byte
+}
+
+func (s *MemoryStorage) Save(file *drweb.FileCreateRequest) (string, error) {
+	var filename string
+	var err error
+
+	if file.NameGenerator == nil {
+		return filename, errors.New("failed to save file without name generator")
+	}
+
+	buffer := &memoryBuffer{limit: s.MaxSize}
+	writers := []io.Writer{buffer}
+	for _, inspector := range file.Inspectors {
+		writers = append(writers, inspector)
+	}
+
+	filenameReader := io.TeeReader(file.Body, io.MultiWriter(writers...))
+	if filename, err = file.NameGenerator.Generate(filenameReader); err != nil {
+		if buffer.exceeded {
+			return filename, drweb.ErrStorageFull
+		}
+		return filename, errors.Wrap(err, "failed to generate filename")
+	}
+
+	if err = inspect(file, filename); err != nil {
+		return filename, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.init()
+
+	// NOTE: same contents are stored already
+	if element, ok := s.files[filename]; ok {
+		s.recent.MoveToFront(element)
+		return filename, nil
+	}
+
+	contents := buffer.Bytes()
+	if s.MaxSize > 0 && s.size+int64(len(contents)) > s.MaxSize {
+		if !s.Evict {
+			return filename, drweb.ErrStorageFull
+		}
+
+		for s.size+int64(len(contents)) > s.MaxSize {
+			s.remove(s.recent.Back())
+		}
+	}
+
+	s.files[filename] = s.recent.PushFront(&memoryFile{filename: filename, contents: contents})
+	s.size += int64(len(contents))
+	return filename, nil
+}
+
+func (s *MemoryStorage) Load(filename string) (*drweb.File, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.init()
+
+	element, ok := s.files[filename]
+	if !ok {
+		return nil, errors.Wrap(os.ErrNotExist, "failed to get file")
+	}
+	s.recent.MoveToFront(element)
+
+	// NOTE: contents are never modified, so readers may share them
+	contents := element.Value.(*memoryFile).contents
+	return &drweb.File{Body: &memoryReader{bytes.NewReader(contents)}, Size: int64(len(contents))}, nil
+}
+
+func (s *MemoryStorage) Delete(filename string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.init()
+
+	element, ok := s.files[filename]
+	if !ok {
+		return errors.Wrap(os.ErrNotExist, "failed to delete file")
+	}
+
+	s.remove(element)
+	return nil
+}
+
+// Walk calls fn for every stored file in lexical order of their names.
+func (s *MemoryStorage) Walk(fn func(filename string) error) error {
+	s.mutex.Lock()
+	filenames := make([]string, 0, len(s.files))
+	for filename := range s.files {
+		filenames = append(filenames, filename)
+	}
+	s.mutex.Unlock()
+
+	sort.Strings(filenames)
+	for _, filename := range filenames {
+		if err := fn(filename); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Size tells how many bytes stored files take.
+func (s *MemoryStorage) Size() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.size
+}
+
+func (s *MemoryStorage) init() {
+	if s.files == nil {
+		s.files = map[string]*list.Element{}
+		s.recent = list.New()
+	}
+}
+
+func (s *MemoryStorage) remove(element *list.Element) {
+	file := s.recent.Remove(element).(*memoryFile)
+	delete(s.files, file.filename)
+	s.size -= int64(len(file.contents))
+}
+
+// memoryBuffer fails writes beyond limit unless it is zero,
+// so that files larger than the whole storage are not read through.
+type memoryBuffer struct {
+	bytes.Buffer
+	limit    int64
+	exceeded bool
+}
+
+func (b *memoryBuffer) Write(p []byte) (int, error) {
+	if b.limit > 0 && int64(b.Len()+len(p)) > b.limit {
+		b.exceeded = true
+		return 0, drweb.ErrStorageFull
+	}
+	return b.Buffer.Write(p)
+}
+
+type memoryReader struct {
+	*bytes.Reader
+}
+
+func (r *memoryReader) Close() error {
+	return nil
+}
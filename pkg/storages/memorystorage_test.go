@@ -0,0 +1,102 @@
+package storages_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+	"github.com/twonegatives/drweb_challenge/pkg/namegenerators"
+	"github.com/twonegatives/drweb_challenge/pkg/storages"
+)
+
+func saveToMemory(storage *storages.MemoryStorage, contents string) (string, error) {
+	return storage.Save(&drweb.FileCreateRequest{
+		Body:          ioutil.NopCloser(bytes.NewReader([]byte(contents))),
+		NameGenerator: &namegenerators.SHA256{},
+	})
+}
+
+func TestMemoryStorageBudget(t *testing.T) {
+	t.Run("full", func(t *testing.T) {
+		storage := &storages.MemoryStorage{MaxSize: 10}
+
+		_, err := saveToMemory(storage, "123456")
+		assert.Nil(t, err)
+		_, err = saveToMemory(storage, "abcdef")
+		assert.Equal(t, drweb.ErrStorageFull, errors.Cause(err))
+		assert.Equal(t, int64(6), storage.Size())
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		storage := &storages.MemoryStorage{MaxSize: 10, Evict: true}
+
+		_, err := saveToMemory(storage, "123456")
+		assert.Nil(t, err)
+		_, err = saveToMemory(storage, "0123456789abcdef")
+		assert.Equal(t, drweb.ErrStorageFull, errors.Cause(err))
+		assert.Equal(t, int64(6), storage.Size())
+	})
+
+	t.Run("evicted", func(t *testing.T) {
+		storage := &storages.MemoryStorage{MaxSize: 12, Evict: true}
+
+		first, _ := saveToMemory(storage, "1111")
+		second, _ := saveToMemory(storage, "2222")
+		third, _ := saveToMemory(storage, "3333")
+
+		// NOTE: loading the first one makes the second least recently used
+		file, err := storage.Load(first)
+		assert.Nil(t, err)
+		file.Close()
+
+		fourth, err := saveToMemory(storage, "4444")
+		assert.Nil(t, err)
+		assert.Equal(t, int64(12), storage.Size())
+
+		for filename, kept := range map[string]bool{first: true, second: false, third: true, fourth: true} {
+			_, err = storage.Load(filename)
+			assert.Equal(t, !kept, os.IsNotExist(errors.Cause(err)))
+		}
+	})
+}
+
+func TestMemoryStorageConcurrency(t *testing.T) {
+	storage := &storages.MemoryStorage{MaxSize: 1 << 10, Evict: true}
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < 8; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				filename, err := saveToMemory(storage, fmt.Sprintf("worker %d file %d", worker, i))
+				assert.Nil(t, err)
+
+				if file, err := storage.Load(filename); err == nil {
+					file.Close()
+				}
+				if i%3 == 0 {
+					storage.Delete(filename)
+				}
+			}
+		}(worker)
+	}
+	wg.Wait()
+
+	total := int64(0)
+	storage.Walk(func(filename string) error {
+		file, err := storage.Load(filename)
+		assert.Nil(t, err)
+		total += file.Size
+		return nil
+	})
+
+	assert.True(t, total <= 1<<10)
+	assert.Equal(t, total, storage.Size())
+}
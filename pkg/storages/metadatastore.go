@@ -0,0 +1,136 @@
+package storages
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+)
+
+const metadataExt = ".json"
+
+// FileSystemMetadataStore keeps metadata of every file as a json document
+// laid out by its own path generator, separately from file contents.
+type FileSystemMetadataStore struct {
+	BasePath          string
+	FileMode          os.FileMode
+	FilePathGenerator drweb.FilePathGenerator
+	mutex             sync.Mutex
+}
+
+func (s *FileSystemMetadataStore) filepath(filename string) (string, error) {
+	path, err := s.FilePathGenerator.Generate(filename)
+	return path + metadataExt, err
+}
+
+func (s *FileSystemMetadataStore) Get(filename string) (*drweb.Metadata, error) {
+	var path string
+	var err error
+
+	if path, err = s.filepath(filename); err != nil {
+		return nil, errors.Wrap(err, "failed to generate filepath")
+	}
+
+	return readMetadata(path)
+}
+
+// Update applies fn to stored metadata, or to a blank one if there is none yet.
+func (s *FileSystemMetadataStore) Update(filename string, fn func(metadata *drweb.Metadata) error) error {
+	var path string
+	var metadata *drweb.Metadata
+	var contents []byte
+	var err error
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if path, err = s.filepath(filename); err != nil {
+		return errors.Wrap(err, "failed to generate filepath")
+	}
+
+	if metadata, err = readMetadata(path); err != nil {
+		if !os.IsNotExist(errors.Cause(err)) {
+			return err
+		}
+		metadata = &drweb.Metadata{Filename: filename}
+	}
+
+	if err = fn(metadata); err != nil {
+		return err
+	}
+
+	if contents, err = json.Marshal(metadata); err != nil {
+		return errors.Wrap(err, "failed to encode metadata")
+	}
+
+	if err = os.MkdirAll(filepath.Dir(path), s.FileMode); err != nil {
+		return errors.Wrap(err, "failed to create nested folders")
+	}
+
+	// NOTE: readers should never see a half written document
+	tmpPath := path + ".tmp"
+	if err = ioutil.WriteFile(tmpPath, contents, s.FileMode); err != nil {
+		return errors.Wrap(err, "failed to write metadata")
+	}
+
+	return errors.Wrap(os.Rename(tmpPath, path), "failed to write metadata")
+}
+
+func (s *FileSystemMetadataStore) Delete(filename string) error {
+	var path string
+	var err error
+
+	if path, err = s.filepath(filename); err != nil {
+		return errors.Wrap(err, "failed to generate filepath")
+	}
+
+	return os.Remove(path)
+}
+
+// List walks the whole store, so it costs as much as the number of stored files.
+func (s *FileSystemMetadataStore) List() ([]*drweb.Metadata, error) {
+	list := []*drweb.Metadata{}
+
+	err := filepath.Walk(s.BasePath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if path == s.BasePath && os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+
+		if info.IsDir() || !strings.HasSuffix(path, metadataExt) {
+			return nil
+		}
+
+		metadata, err := readMetadata(path)
+		if err != nil {
+			return err
+		}
+
+		list = append(list, metadata)
+		return nil
+	})
+
+	return list, errors.Wrap(err, "failed to list metadata")
+}
+
+func readMetadata(path string) (*drweb.Metadata, error) {
+	var metadata drweb.Metadata
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read metadata")
+	}
+
+	if err = json.Unmarshal(contents, &metadata); err != nil {
+		return nil, errors.Wrap(err, "failed to decode metadata")
+	}
+
+	return &metadata, nil
+}
@@ -0,0 +1,75 @@
+package storages_test
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	pkgerrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+	"github.com/twonegatives/drweb_challenge/pkg/testutils"
+)
+
+func TestMetadataStore(t *testing.T) {
+	store, cleanup := testutils.GenerateMetadataStore(t)
+	defer cleanup()
+
+	_, err := store.Get("abcdef")
+	assert.True(t, os.IsNotExist(pkgerrors.Cause(err)))
+
+	err = store.Update("abcdef", func(metadata *drweb.Metadata) error {
+		metadata.Size = 10
+		metadata.AddTag("allowlist:nsrl")
+		return nil
+	})
+	assert.Nil(t, err)
+
+	err = store.Update("abcdef", func(metadata *drweb.Metadata) error {
+		metadata.AddTag("allowlist:nsrl")
+		metadata.AddTag("rule:eicar")
+		return nil
+	})
+	assert.Nil(t, err)
+
+	metadata, err := store.Get("abcdef")
+	assert.Nil(t, err)
+	assert.Equal(t, "abcdef", metadata.Filename)
+	assert.Equal(t, int64(10), metadata.Size)
+	assert.Equal(t, []string{"allowlist:nsrl", "rule:eicar"}, metadata.Tags)
+
+	err = store.Update("abcdef", func(metadata *drweb.Metadata) error {
+		return errors.New("changed my mind")
+	})
+	assert.NotNil(t, err)
+
+	assert.Nil(t, store.Delete("abcdef"))
+	_, err = store.Get("abcdef")
+	assert.True(t, os.IsNotExist(pkgerrors.Cause(err)))
+}
+
+func TestMetadataStoreList(t *testing.T) {
+	store, cleanup := testutils.GenerateMetadataStore(t)
+	defer cleanup()
+
+	list, err := store.List()
+	assert.Nil(t, err)
+	assert.Empty(t, list)
+
+	for _, filename := range []string{"abcdef", "abcd00", "ffffff"} {
+		err = store.Update(filename, func(metadata *drweb.Metadata) error {
+			metadata.AddTag("rule:" + filename)
+			return nil
+		})
+		assert.Nil(t, err)
+	}
+
+	list, err = store.List()
+	assert.Nil(t, err)
+
+	filenames := []string{}
+	for _, metadata := range list {
+		filenames = append(filenames, metadata.Filename)
+	}
+	assert.Equal(t, []string{"abcd00", "abcdef", "ffffff"}, filenames)
+}
@@ -0,0 +1,416 @@
+package storages
+
+import (
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+)
+
+var errMirrorAborted = errors.New("mirrored save aborted")
+var errChecksumMismatch = errors.New("checksum mismatch")
+
+// MirroredStorage keeps every file in each of its replicas, e.g. file system
+// storages on different disks. Files are read from the fastest healthy replica,
+// falling back to the others, and replicas found missing or corrupt on the way
+// are repaired from the intact one in background. Repairs and deletions of
+// a file never interleave, so that deleted files are not brought back.
+// NOTE: replicas failing with anything but a missing file are marked degraded
+// and left alone for RetryInterval, files saved meanwhile are repaired on reads.
+type MirroredStorage struct {
+	Replicas []drweb.WalkableStorage
+	// NOTE: loaded files are read through once to be checked, nil disables checks and repairs
+	NameGenerator drweb.FileNameGenerator
+	RetryInterval time.Duration
+
+	mutex  sync.Mutex
+	health []mirrorHealth
+	locked map[string]chan struct{}
+}
+
+type mirrorHealth struct {
+	latency  time.Duration
+	degraded time.Time
+}
+
+type mirrorResult struct {
+	replica int
+	err     error
+}
+
+// mirrorWriter feeds replicas being saved, dropping those which failed
+type mirrorWriter struct {
+	writers []*io.PipeWriter
+	failed  []bool
+}
+
+func (w *mirrorWriter) Write(p []byte) (int, error) {
+	alive := 0
+	for i, writer := range w.writers {
+		if w.failed[i] {
+			continue
+		}
+		if _, err := writer.Write(p); err != nil {
+			w.failed[i] = true
+			continue
+		}
+		alive++
+	}
+
+	if alive == 0 {
+		return 0, errors.New("failed to write file to any replica")
+	}
+	return len(p), nil
+}
+
+// NOTE: should be called with mutex held
+func (s *MirroredStorage) grow() {
+	if len(s.health) != len(s.Replicas) {
+		s.health = make([]mirrorHealth, len(s.Replicas))
+	}
+}
+
+// available lists replicas worth trying, fastest first and degraded last.
+func (s *MirroredStorage) available() []int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.grow()
+
+	replicas := []int{}
+	for i, health := range s.health {
+		if health.degraded.IsZero() || time.Since(health.degraded) >= s.RetryInterval {
+			replicas = append(replicas, i)
+		}
+	}
+
+	sort.SliceStable(replicas, func(i, j int) bool {
+		first, second := s.health[replicas[i]], s.health[replicas[j]]
+		if first.degraded.IsZero() != second.degraded.IsZero() {
+			return first.degraded.IsZero()
+		}
+		return first.latency < second.latency
+	})
+	return replicas
+}
+
+func (s *MirroredStorage) succeed(replica int, latency time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.grow()
+
+	health := &s.health[replica]
+	if !health.degraded.IsZero() {
+		log.WithField("replica", replica).Info("mirrored storage replica recovered")
+	}
+	health.degraded = time.Time{}
+
+	switch {
+	case latency == 0:
+	case health.latency == 0:
+		health.latency = latency
+	default:
+		health.latency = (health.latency*3 + latency) / 4
+	}
+}
+
+func (s *MirroredStorage) fail(replica int, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.grow()
+
+	health := &s.health[replica]
+	if health.degraded.IsZero() {
+		log.WithError(err).WithField("replica", replica).Warn("mirrored storage replica degraded")
+	}
+	health.degraded = time.Now()
+}
+
+// degradedAmong tells whether any of replicas failed lately.
+func (s *MirroredStorage) degradedAmong(replicas []int) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.grow()
+
+	for _, replica := range replicas {
+		if !s.health[replica].degraded.IsZero() {
+			return true
+		}
+	}
+	return false
+}
+
+// lock takes the file over for a repair or a deletion. Unless wait is set,
+// it gives up on a file which is taken over already.
+func (s *MirroredStorage) lock(filename string, wait bool) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.locked == nil {
+		s.locked = map[string]chan struct{}{}
+	}
+
+	for {
+		done, ok := s.locked[filename]
+		if !ok {
+			break
+		}
+		if !wait {
+			return false
+		}
+
+		s.mutex.Unlock()
+		<-done
+		s.mutex.Lock()
+	}
+
+	s.locked[filename] = make(chan struct{})
+	return true
+}
+
+func (s *MirroredStorage) unlock(filename string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	close(s.locked[filename])
+	delete(s.locked, filename)
+}
+
+// Degraded lists replicas which failed lately.
+func (s *MirroredStorage) Degraded() []int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	degraded := []int{}
+	for i, health := range s.health {
+		if !health.degraded.IsZero() {
+			degraded = append(degraded, i)
+		}
+	}
+	return degraded
+}
+
+// Save writes file to every available replica at once. File is hashed and
+// inspected once, replicas are only let to finish once it is accepted.
+func (s *MirroredStorage) Save(file *drweb.FileCreateRequest) (string, error) {
+	if file.NameGenerator == nil {
+		return "", errors.New("failed to save file without name generator")
+	}
+
+	replicas := s.available()
+	if len(replicas) == 0 {
+		return "", errors.New("failed to save file without available replicas")
+	}
+
+	fanout := &mirrorWriter{writers: make([]*io.PipeWriter, len(replicas)), failed: make([]bool, len(replicas))}
+	results := make(chan mirrorResult, len(replicas))
+	for i, replica := range replicas {
+		reader, writer := io.Pipe()
+		fanout.writers[i] = writer
+
+		go func(replica int, reader *io.PipeReader) {
+			_, err := s.Replicas[replica].Save(&drweb.FileCreateRequest{Body: reader, NameGenerator: file.NameGenerator})
+			// NOTE: unblocks fanout if replica gave up early
+			reader.CloseWithError(errMirrorAborted)
+			results <- mirrorResult{replica: replica, err: err}
+		}(replica, reader)
+	}
+
+	writers := []io.Writer{fanout}
+	for _, inspector := range file.Inspectors {
+		writers = append(writers, inspector)
+	}
+
+	filename, err := file.NameGenerator.Generate(io.TeeReader(file.Body, io.MultiWriter(writers...)))
+	if err != nil {
+		err = errors.Wrap(err, "failed to generate filename")
+	} else {
+		err = inspect(file, filename)
+	}
+
+	// NOTE: replicas wait for the end of file, so rejected files are never stored
+	for _, writer := range fanout.writers {
+		if err != nil {
+			writer.CloseWithError(errMirrorAborted)
+		} else {
+			writer.Close()
+		}
+	}
+
+	saved := 0
+	for range replicas {
+		switch result := <-results; {
+		case result.err == nil:
+			saved++
+		case errors.Cause(result.err) != errMirrorAborted:
+			s.fail(result.replica, result.err)
+		}
+	}
+
+	if err != nil {
+		return filename, err
+	}
+	if saved == 0 {
+		return filename, errors.New("failed to save file to any replica")
+	}
+	return filename, nil
+}
+
+// verify loads file from replica, making sure it is what its name says.
+func (s *MirroredStorage) verify(replica int, filename string) (*drweb.File, error) {
+	file, err := s.Replicas[replica].Load(filename)
+	if err != nil || s.NameGenerator == nil {
+		return file, err
+	}
+
+	checksum, err := s.NameGenerator.Generate(file.Body)
+	if err == nil && checksum != filename {
+		err = errChecksumMismatch
+	}
+	if err == nil {
+		if seeker, ok := file.Body.(io.Seeker); ok {
+			_, err = seeker.Seek(0, io.SeekStart)
+			if err == nil {
+				return file, nil
+			}
+		}
+	}
+
+	file.Close()
+	if err != nil {
+		return nil, err
+	}
+	return s.Replicas[replica].Load(filename)
+}
+
+// missing lists replicas lacking the file. Unlike verify, it does not read them through.
+func (s *MirroredStorage) missing(filename string, replicas []int) []int {
+	missing := []int{}
+	for _, replica := range replicas {
+		file, err := s.Replicas[replica].Load(filename)
+		switch {
+		case err == nil:
+			file.Close()
+		case os.IsNotExist(errors.Cause(err)):
+			missing = append(missing, replica)
+		default:
+			s.fail(replica, err)
+		}
+	}
+	return missing
+}
+
+// repair copies file out of intact replica to the stale ones.
+// NOTE: should be called with the file locked
+func (s *MirroredStorage) repair(filename string, intact int, stale []int) {
+	// NOTE: file might have been deleted since it was read
+	file, err := s.Replicas[intact].Load(filename)
+	if err != nil {
+		return
+	}
+	file.Close()
+
+	for _, replica := range stale {
+		s.Replicas[replica].Delete(filename)
+		if err := copyVerified(s.Replicas[intact], s.Replicas[replica], filename, s.NameGenerator); err != nil {
+			s.fail(replica, err)
+			continue
+		}
+		s.succeed(replica, 0)
+		log.WithFields(log.Fields{"replica": replica, "filename": filename}).Info("mirrored storage replica repaired")
+	}
+}
+
+// repairLater looks for the file in replicas not tried yet and repairs stale ones
+// in background, so that reads are not held up by it. A file is repaired once at a time,
+// and is left alone while it is being deleted.
+func (s *MirroredStorage) repairLater(filename string, intact int, stale []int, untried []int) {
+	if !s.lock(filename, false) {
+		return
+	}
+
+	go func() {
+		defer s.unlock(filename)
+		s.repair(filename, intact, append(stale, s.missing(filename, untried)...))
+	}()
+}
+
+func (s *MirroredStorage) Load(filename string) (*drweb.File, error) {
+	var failure error
+	stale := []int{}
+
+	replicas := s.available()
+	for i, replica := range replicas {
+		started := time.Now()
+		file, err := s.verify(replica, filename)
+
+		switch {
+		case err == nil:
+			s.succeed(replica, time.Since(started))
+			// NOTE: replica served is verified right away, the others are only looked at
+			// in background once some of them failed, as they might lack the file then
+			untried := replicas[i+1:]
+			if s.NameGenerator != nil && (len(stale) > 0 || s.degradedAmong(untried)) {
+				s.repairLater(filename, replica, stale, untried)
+			}
+			return file, nil
+		case os.IsNotExist(errors.Cause(err)):
+			stale = append(stale, replica)
+		case errors.Cause(err) == errChecksumMismatch:
+			stale = append(stale, replica)
+			failure = err
+		default:
+			s.fail(replica, err)
+			failure = err
+		}
+	}
+
+	if failure != nil {
+		return nil, errors.Wrap(failure, "failed to load file from any replica")
+	}
+	return nil, errors.Wrap(os.ErrNotExist, "failed to find file")
+}
+
+// Delete removes the file out of every replica, degraded ones included.
+// It waits for the file repair to finish, if there is one.
+func (s *MirroredStorage) Delete(filename string) error {
+	var failure error
+	found := false
+
+	s.lock(filename, true)
+	defer s.unlock(filename)
+
+	for replica, storage := range s.Replicas {
+		err := storage.Delete(filename)
+		switch {
+		case err == nil:
+			found = true
+		case !os.IsNotExist(errors.Cause(err)):
+			s.fail(replica, err)
+			failure = err
+		}
+	}
+
+	if failure != nil {
+		return errors.Wrap(failure, "failed to delete file from every replica")
+	}
+	if !found {
+		return errors.Wrap(os.ErrNotExist, "failed to find file")
+	}
+	return nil
+}
+
+// Walk calls fn for every file stored in any of available replicas,
+// in lexical order of their names.
+func (s *MirroredStorage) Walk(fn func(filename string) error) error {
+	walkables := []drweb.WalkableStorage{}
+	for _, replica := range s.available() {
+		walkables = append(walkables, s.Replicas[replica])
+	}
+
+	return mergeWalks(walkables, fn)
+}
@@ -0,0 +1,304 @@
+package storages_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+	"github.com/twonegatives/drweb_challenge/pkg/namegenerators"
+	"github.com/twonegatives/drweb_challenge/pkg/storages"
+	"github.com/twonegatives/drweb_challenge/pkg/testutils"
+)
+
+// NOTE: fails like a dead disk while broken, counts loads
+type brokenStorage struct {
+	drweb.WalkableStorage
+	Broken bool
+	loads  int32
+}
+
+func (s *brokenStorage) Save(file *drweb.FileCreateRequest) (string, error) {
+	if s.Broken {
+		return "", errors.New("input/output error")
+	}
+	return s.WalkableStorage.Save(file)
+}
+
+func (s *brokenStorage) Load(filename string) (*drweb.File, error) {
+	atomic.AddInt32(&s.loads, 1)
+	if s.Broken {
+		return nil, errors.New("input/output error")
+	}
+	return s.WalkableStorage.Load(filename)
+}
+
+// NOTE: holds saves until released
+type heldStorage struct {
+	drweb.WalkableStorage
+	release chan struct{}
+	saves   int32
+}
+
+func (s *heldStorage) Save(file *drweb.FileCreateRequest) (string, error) {
+	atomic.AddInt32(&s.saves, 1)
+	<-s.release
+	return s.WalkableStorage.Save(file)
+}
+
+// eventually tells whether condition is met within a few seconds,
+// as replicas are repaired in background.
+func eventually(condition func() bool) bool {
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if condition() {
+			return true
+		}
+	}
+	return condition()
+}
+
+func holds(replica drweb.Storage, filename string, contents []byte) bool {
+	file, err := replica.Load(filename)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	stored, err := ioutil.ReadAll(file.Body)
+	return err == nil && bytes.Equal(contents, stored)
+}
+
+func TestMirroredStorageSave(t *testing.T) {
+	replicas, cleanup := testutils.GenerateDisks(t, 3)
+	defer cleanup()
+	storage := &storages.MirroredStorage{NameGenerator: &namegenerators.SHA256{}}
+	for _, replica := range replicas {
+		storage.Replicas = append(storage.Replicas, replica)
+	}
+
+	t.Run("stored everywhere", func(t *testing.T) {
+		contents := bytes.Repeat([]byte("0123456789abcdef"), 100000)
+		inspector := &rejectingInspector{}
+
+		filename, err := testutils.SaveFile(storage, contents, inspector)
+		assert.Nil(t, err)
+		assert.Equal(t, fmt.Sprintf("%x", sha256.Sum256(contents)), filename)
+		assert.Equal(t, len(contents), inspector.Len())
+
+		for _, replica := range replicas {
+			file, err := replica.Load(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			stored, _ := ioutil.ReadAll(file.Body)
+			file.Close()
+			assert.Equal(t, contents, stored)
+		}
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		filename, err := testutils.SaveFile(storage, []byte("bad contents"), &rejectingInspector{})
+		_, ok := errors.Cause(err).(*drweb.RejectionError)
+		assert.True(t, ok)
+
+		for _, replica := range replicas {
+			_, err := replica.Load(filename)
+			assert.True(t, os.IsNotExist(errors.Cause(err)))
+		}
+	})
+}
+
+func TestMirroredStorageReadRepair(t *testing.T) {
+	replicas, cleanup := testutils.GenerateDisks(t, 3)
+	defer cleanup()
+	storage := &storages.MirroredStorage{NameGenerator: &namegenerators.SHA256{}}
+	for _, replica := range replicas {
+		storage.Replicas = append(storage.Replicas, replica)
+	}
+
+	contents := []byte("File contents")
+	filename, err := testutils.SaveFile(storage, contents)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// NOTE: first replica lost the file, second one got it corrupt
+	replicas[0].Delete(filename)
+	path, _ := replicas[1].FilePathGenerator.Generate(filename)
+	ioutil.WriteFile(path, []byte("File c0ntents"), 0700)
+
+	file, err := storage.Load(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, _ := ioutil.ReadAll(file.Body)
+	file.Close()
+	assert.Equal(t, contents, loaded)
+
+	for _, replica := range replicas {
+		assert.True(t, eventually(func() bool { return holds(replica, filename, contents) }))
+	}
+	assert.Empty(t, storage.Degraded())
+
+	t.Run("in background, once at a time", func(t *testing.T) {
+		held := &heldStorage{WalkableStorage: replicas[1], release: make(chan struct{})}
+		storage := &storages.MirroredStorage{
+			Replicas:      []drweb.WalkableStorage{held, replicas[0]},
+			NameGenerator: &namegenerators.SHA256{},
+		}
+		replicas[1].Delete(filename)
+
+		// NOTE: reads do not wait for the repair, nor start another one
+		for i := 0; i < 3; i++ {
+			file, err := storage.Load(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			file.Close()
+		}
+
+		close(held.release)
+		assert.True(t, eventually(func() bool { return holds(replicas[1], filename, contents) }))
+		assert.Equal(t, int32(1), atomic.LoadInt32(&held.saves))
+	})
+
+	t.Run("not after deletion", func(t *testing.T) {
+		held := &heldStorage{WalkableStorage: replicas[1], release: make(chan struct{})}
+		storage := &storages.MirroredStorage{
+			Replicas:      []drweb.WalkableStorage{held, replicas[0]},
+			NameGenerator: &namegenerators.SHA256{},
+		}
+		replicas[1].Delete(filename)
+
+		file, err := storage.Load(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.Close()
+		assert.True(t, eventually(func() bool { return atomic.LoadInt32(&held.saves) == 1 }))
+
+		// NOTE: deletion waits for the repair in progress, instead of being undone by it
+		deleted := make(chan error)
+		go func() { deleted <- storage.Delete(filename) }()
+		time.Sleep(50 * time.Millisecond)
+		close(held.release)
+
+		assert.Nil(t, <-deleted)
+		for _, replica := range replicas[:2] {
+			_, err := replica.Load(filename)
+			assert.True(t, os.IsNotExist(errors.Cause(err)))
+		}
+	})
+}
+
+func TestMirroredStorageProbes(t *testing.T) {
+	replicas, cleanup := testutils.GenerateDisks(t, 2)
+	defer cleanup()
+	counted := []*brokenStorage{{WalkableStorage: replicas[0]}, {WalkableStorage: replicas[1]}}
+	storage := &storages.MirroredStorage{
+		Replicas:      []drweb.WalkableStorage{counted[0], counted[1]},
+		NameGenerator: &namegenerators.SHA256{},
+	}
+
+	filename, err := testutils.SaveFile(storage, []byte("File contents"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// NOTE: while replicas serve the file, the others are not looked at
+	for i := 0; i < 5; i++ {
+		file, err := storage.Load(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.Close()
+	}
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(5), atomic.LoadInt32(&counted[0].loads)+atomic.LoadInt32(&counted[1].loads))
+}
+
+func TestMirroredStorageCorrupt(t *testing.T) {
+	replicas, cleanup := testutils.GenerateDisks(t, 2)
+	defer cleanup()
+	storage := &storages.MirroredStorage{
+		Replicas:      []drweb.WalkableStorage{replicas[0], replicas[1]},
+		NameGenerator: &namegenerators.SHA256{},
+	}
+
+	filename, err := testutils.SaveFile(storage, []byte("File contents"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, replica := range replicas {
+		path, _ := replica.FilePathGenerator.Generate(filename)
+		ioutil.WriteFile(path, []byte("File c0ntents"), 0700)
+	}
+
+	_, err = storage.Load(filename)
+	assert.NotNil(t, err)
+	assert.False(t, os.IsNotExist(errors.Cause(err)))
+	assert.Contains(t, err.Error(), "checksum mismatch")
+}
+
+func TestMirroredStorageDegraded(t *testing.T) {
+	replicas, cleanup := testutils.GenerateDisks(t, 2)
+	defer cleanup()
+	broken := &brokenStorage{WalkableStorage: replicas[1], Broken: true}
+	storage := &storages.MirroredStorage{
+		Replicas:      []drweb.WalkableStorage{replicas[0], broken},
+		NameGenerator: &namegenerators.SHA256{},
+		RetryInterval: time.Hour,
+	}
+
+	first, err := testutils.SaveFile(storage, []byte("saved while broken"))
+	assert.Nil(t, err)
+	assert.Equal(t, []int{1}, storage.Degraded())
+
+	// NOTE: degraded replica is left alone until retry interval passes
+	broken.Broken = false
+	second, err := testutils.SaveFile(storage, []byte("saved while degraded"))
+	assert.Nil(t, err)
+	for _, filename := range []string{first, second} {
+		_, err := replicas[1].Load(filename)
+		assert.True(t, os.IsNotExist(errors.Cause(err)))
+	}
+
+	// NOTE: files missed meanwhile are repaired once they are read
+	storage.RetryInterval = 0
+	file, err := storage.Load(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	assert.True(t, eventually(func() bool { return holds(replicas[1], first, []byte("saved while broken")) }))
+	assert.True(t, eventually(func() bool { return len(storage.Degraded()) == 0 }))
+
+	t.Run("all broken", func(t *testing.T) {
+		broken.Broken = true
+		storage.Replicas = []drweb.WalkableStorage{broken}
+
+		_, err := testutils.SaveFile(storage, []byte("File contents"))
+		assert.NotNil(t, err)
+		_, err = storage.Load(second)
+		assert.NotNil(t, err)
+		assert.False(t, os.IsNotExist(errors.Cause(err)))
+	})
+}
+
+func TestMirroredStorageSuite(t *testing.T) {
+	testStorageSuite(t, func(t *testing.T) (drweb.WalkableStorage, func()) {
+		replicas, cleanup := testutils.GenerateDisks(t, 2)
+		return &storages.MirroredStorage{
+			Replicas:      []drweb.WalkableStorage{replicas[0], replicas[1]},
+			NameGenerator: &namegenerators.SHA256{},
+		}, cleanup
+	})
+}
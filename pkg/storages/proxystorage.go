@@ -0,0 +1,197 @@
+package storages
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+)
+
+// ProxyStorage serves files out of Local storage, pulling missing ones from
+// Upstream, e.g. RemoteStorage of the main region, and keeping them locally.
+// Pulled files are only kept once they match their names, and concurrent
+// misses of the same file wait for a single pull, up to PullTimeout if given.
+// Uploads are stored locally and passed on to Upstream, so that other
+// regions see them, while Walk only goes through files kept locally.
+type ProxyStorage struct {
+	Local    drweb.WalkableStorage
+	Upstream drweb.Storage
+	// NOTE: checks pulled files, should name them as uploads are named
+	NameGenerator drweb.FileNameGenerator
+	// NOTE: the pull itself is bounded by the client of Upstream
+	PullTimeout time.Duration
+
+	mutex sync.Mutex
+	pulls map[string]*proxyPull
+}
+
+type proxyPull struct {
+	done chan struct{}
+	err  error
+}
+
+// nameCheck rejects files not matching the expected name, before they are stored.
+type nameCheck struct {
+	expected string
+}
+
+func (c *nameCheck) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (c *nameCheck) Inspect(filename string, metadata *drweb.Metadata) error {
+	if filename != c.expected {
+		return errors.Wrapf(errChecksumMismatch, "upstream sent '%s' for file '%s'", filename, c.expected)
+	}
+	return nil
+}
+
+// presenceCheck tells whether the file was stored before, once the upload is named.
+type presenceCheck struct {
+	storage drweb.Storage
+	found   bool
+}
+
+func (c *presenceCheck) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (c *presenceCheck) Inspect(filename string, metadata *drweb.Metadata) error {
+	if file, err := c.storage.Load(filename); err == nil {
+		file.Close()
+		c.found = true
+	}
+	return nil
+}
+
+func (s *ProxyStorage) Save(file *drweb.FileCreateRequest) (string, error) {
+	presence := &presenceCheck{storage: s.Local}
+	file.Inspectors = append(append([]drweb.Inspector{}, file.Inspectors...), presence)
+
+	filename, err := s.Local.Save(file)
+	if err != nil {
+		return filename, err
+	}
+
+	local, err := s.Local.Load(filename)
+	if err != nil {
+		return filename, err
+	}
+	defer local.Close()
+
+	if _, err = s.Upstream.Save(&drweb.FileCreateRequest{Body: local.Body, NameGenerator: file.NameGenerator}); err != nil {
+		// NOTE: files are only kept locally once upstream has them, unless they were kept before
+		if !presence.found {
+			if deleted := s.Local.Delete(filename); deleted != nil {
+				log.WithError(deleted).WithField("filename", filename).Warn("failed to delete file not saved upstream")
+			}
+		}
+		return filename, errors.Wrap(err, "failed to save file upstream")
+	}
+	return filename, nil
+}
+
+func (s *ProxyStorage) Load(filename string) (*drweb.File, error) {
+	file, err := s.Local.Load(filename)
+	if err == nil || !os.IsNotExist(errors.Cause(err)) {
+		return file, err
+	}
+
+	if err = s.pull(filename); err != nil {
+		return nil, err
+	}
+	return s.Local.Load(filename)
+}
+
+// pull copies the file from Upstream, or waits for a pull of it already going.
+func (s *ProxyStorage) pull(filename string) error {
+	s.mutex.Lock()
+	if s.pulls == nil {
+		s.pulls = map[string]*proxyPull{}
+	}
+	if pull, ok := s.pulls[filename]; ok {
+		s.mutex.Unlock()
+		return s.wait(pull)
+	}
+
+	pull := &proxyPull{done: make(chan struct{})}
+	s.pulls[filename] = pull
+	s.mutex.Unlock()
+
+	pull.err = s.copy(filename)
+
+	s.mutex.Lock()
+	delete(s.pulls, filename)
+	s.mutex.Unlock()
+	close(pull.done)
+
+	return pull.err
+}
+
+func (s *ProxyStorage) wait(pull *proxyPull) error {
+	if s.PullTimeout <= 0 {
+		<-pull.done
+		return pull.err
+	}
+
+	timer := time.NewTimer(s.PullTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-pull.done:
+		return pull.err
+	case <-timer.C:
+		return errors.New("timed out waiting for file being pulled")
+	}
+}
+
+func (s *ProxyStorage) copy(filename string) error {
+	if s.NameGenerator == nil {
+		return errors.New("failed to pull file without name generator")
+	}
+
+	// NOTE: the miss might have come just before another pull finished
+	if local, err := s.Local.Load(filename); err == nil {
+		local.Close()
+		return nil
+	}
+
+	remote, err := s.Upstream.Load(filename)
+	if err != nil {
+		return err
+	}
+	defer remote.Close()
+
+	_, err = s.Local.Save(&drweb.FileCreateRequest{
+		Body:          remote.Body,
+		NameGenerator: s.NameGenerator,
+		Inspectors:    []drweb.Inspector{&nameCheck{expected: filename}},
+	})
+	return errors.Wrap(err, "failed to pull file")
+}
+
+// Delete removes the file both upstream and locally.
+func (s *ProxyStorage) Delete(filename string) error {
+	found := false
+
+	for _, storage := range []drweb.Storage{s.Upstream, s.Local} {
+		err := storage.Delete(filename)
+		if err != nil && !os.IsNotExist(errors.Cause(err)) {
+			return err
+		}
+		found = found || err == nil
+	}
+
+	if !found {
+		return errors.Wrap(os.ErrNotExist, "failed to find file")
+	}
+	return nil
+}
+
+// Walk calls fn for every file kept locally in lexical order of their names.
+func (s *ProxyStorage) Walk(fn func(filename string) error) error {
+	return s.Local.Walk(fn)
+}
@@ -0,0 +1,336 @@
+package storages
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+)
+
+const quarantineRecordExt = ".json"
+const quarantineJournalName = "journal.log"
+
+// FileSystemQuarantine keeps flagged files away from the regular storage tree.
+// Blobs are moved (not copied) between FileSystemStorage and the quarantine area,
+// each quarantined blob is accompanied by a json record and every transition
+// is appended to a journal which outlives released and purged files.
+// Jobs forget isolated files and have released ones enqueued, as if
+// those were deleted out of Storage and saved back into it.
+type FileSystemQuarantine struct {
+	BasePath          string
+	FileMode          os.FileMode
+	FilePathGenerator drweb.FilePathGenerator
+	Storage           *FileSystemStorage
+	Jobs              []drweb.PostSaveJob
+	mutex             sync.Mutex
+}
+
+func (q *FileSystemQuarantine) filepath(filename string) (string, error) {
+	return q.FilePathGenerator.Generate(filename)
+}
+
+func (q *FileSystemQuarantine) Isolate(filename string, category string, actor string, reason string) error {
+	var src, dst string
+	var stat os.FileInfo
+	var err error
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if dst, err = q.filepath(filename); err != nil {
+		return errors.Wrap(err, "failed to generate quarantine filepath")
+	}
+
+	if _, err = os.Stat(dst); err == nil {
+		return errors.Errorf("file '%s' is already quarantined", filename)
+	} else if !os.IsNotExist(err) {
+		return errors.Wrap(err, "failed to check quarantined file")
+	}
+
+	if src, err = q.Storage.filepath(filename); err != nil {
+		return errors.Wrap(err, "failed to generate filepath")
+	}
+
+	if stat, err = os.Stat(src); err != nil {
+		return errors.Wrap(err, "failed to get file info")
+	}
+
+	if err = os.MkdirAll(filepath.Dir(dst), q.FileMode); err != nil {
+		return errors.Wrap(err, "failed to create nested folders")
+	}
+
+	if err = moveFile(src, dst, q.FileMode); err != nil {
+		return errors.Wrap(err, "failed to move file to quarantine")
+	}
+
+	record := &drweb.QuarantineRecord{
+		Filename:  filename,
+		Category:  category,
+		Reason:    reason,
+		Size:      stat.Size(),
+		CreatedAt: time.Now().UTC(),
+	}
+
+	if err = q.transit(record, dst, drweb.QuarantineActionIsolate, actor, reason); err != nil {
+		return err
+	}
+
+	// NOTE: the file is isolated by now, so failures are not told to the caller
+	for _, job := range q.Jobs {
+		if err = job.Forget(filename); err != nil && !os.IsNotExist(errors.Cause(err)) {
+			log.WithError(err).WithField("hashstring", filename).Error("failed to forget quarantined file")
+		}
+	}
+	return nil
+}
+
+func (q *FileSystemQuarantine) Inspect(filename string) (*drweb.QuarantineRecord, error) {
+	var path string
+	var err error
+
+	if path, err = q.filepath(filename); err != nil {
+		return nil, errors.Wrap(err, "failed to generate quarantine filepath")
+	}
+
+	return readQuarantineRecord(path + quarantineRecordExt)
+}
+
+// Load opens a quarantined blob, e.g. to serve it wrapped into an encrypted archive.
+func (q *FileSystemQuarantine) Load(filename string) (*drweb.File, error) {
+	var file *os.File
+	var stat os.FileInfo
+	var path string
+	var err error
+
+	if path, err = q.filepath(filename); err != nil {
+		return nil, errors.Wrap(err, "failed to generate quarantine filepath")
+	}
+
+	if stat, err = os.Stat(path); err != nil {
+		return nil, errors.Wrap(err, "failed to get file info")
+	}
+
+	if file, err = os.Open(path); err != nil {
+		return nil, errors.Wrap(err, "failed to open file")
+	}
+
+	return &drweb.File{Body: file, Size: stat.Size()}, nil
+}
+
+func (q *FileSystemQuarantine) List() ([]*drweb.QuarantineRecord, error) {
+	records := []*drweb.QuarantineRecord{}
+
+	err := filepath.Walk(q.BasePath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() || !strings.HasSuffix(path, quarantineRecordExt) {
+			return nil
+		}
+
+		record, err := readQuarantineRecord(path)
+		if err != nil {
+			return err
+		}
+
+		records = append(records, record)
+		return nil
+	})
+
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "failed to list quarantined files")
+	}
+
+	return records, nil
+}
+
+func (q *FileSystemQuarantine) Release(filename string, actor string, reason string) error {
+	var src, dst string
+	var record *drweb.QuarantineRecord
+	var err error
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if src, err = q.filepath(filename); err != nil {
+		return errors.Wrap(err, "failed to generate quarantine filepath")
+	}
+
+	if record, err = readQuarantineRecord(src + quarantineRecordExt); err != nil {
+		return err
+	}
+
+	if dst, err = q.Storage.filepath(filename); err != nil {
+		return errors.Wrap(err, "failed to generate filepath")
+	}
+
+	if err = os.MkdirAll(filepath.Dir(dst), q.Storage.FileMode); err != nil {
+		return errors.Wrap(err, "failed to create nested folders")
+	}
+
+	if err = moveFile(src, dst, q.Storage.FileMode); err != nil {
+		return errors.Wrap(err, "failed to move file out of quarantine")
+	}
+
+	if err = q.transit(record, "", drweb.QuarantineActionRelease, actor, reason); err != nil {
+		return err
+	}
+
+	for _, job := range q.Jobs {
+		job.Enqueue(filename)
+	}
+
+	return errors.Wrap(os.Remove(src+quarantineRecordExt), "failed to remove quarantine record")
+}
+
+func (q *FileSystemQuarantine) Purge(filename string, actor string, reason string) error {
+	var path string
+	var record *drweb.QuarantineRecord
+	var err error
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if path, err = q.filepath(filename); err != nil {
+		return errors.Wrap(err, "failed to generate quarantine filepath")
+	}
+
+	if record, err = readQuarantineRecord(path + quarantineRecordExt); err != nil {
+		return err
+	}
+
+	if err = os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "failed to remove quarantined file")
+	}
+
+	if err = q.transit(record, "", drweb.QuarantineActionPurge, actor, reason); err != nil {
+		return err
+	}
+
+	return errors.Wrap(os.Remove(path+quarantineRecordExt), "failed to remove quarantine record")
+}
+
+// NOTE: transit records a transition both in the journal and, when blobPath
+// is given, in the record lying next to the blob. released and purged files have their record
+// removed right after, so we only keep the journal entry for them.
+func (q *FileSystemQuarantine) transit(record *drweb.QuarantineRecord, blobPath string, action string, actor string, reason string) error {
+	transition := &drweb.QuarantineTransition{
+		Filename: record.Filename,
+		Action:   action,
+		Actor:    actor,
+		Reason:   reason,
+		At:       time.Now().UTC(),
+	}
+
+	if err := q.appendJournal(transition); err != nil {
+		return err
+	}
+
+	if blobPath == "" {
+		return nil
+	}
+
+	record.Transitions = append(record.Transitions, transition)
+	contents, err := json.Marshal(record)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode quarantine record")
+	}
+
+	return errors.Wrap(ioutil.WriteFile(blobPath+quarantineRecordExt, contents, q.FileMode), "failed to write quarantine record")
+}
+
+func (q *FileSystemQuarantine) appendJournal(transition *drweb.QuarantineTransition) error {
+	if err := os.MkdirAll(q.BasePath, q.FileMode); err != nil {
+		return errors.Wrap(err, "failed to create quarantine folder")
+	}
+
+	journal, err := os.OpenFile(filepath.Join(q.BasePath, quarantineJournalName), os.O_APPEND|os.O_CREATE|os.O_WRONLY, q.FileMode)
+	if err != nil {
+		return errors.Wrap(err, "failed to open quarantine journal")
+	}
+	defer journal.Close()
+
+	return errors.Wrap(json.NewEncoder(journal).Encode(transition), "failed to write quarantine journal")
+}
+
+// Journal returns every transition ever recorded, oldest first.
+func (q *FileSystemQuarantine) Journal() ([]*drweb.QuarantineTransition, error) {
+	transitions := []*drweb.QuarantineTransition{}
+
+	journal, err := os.Open(filepath.Join(q.BasePath, quarantineJournalName))
+	if os.IsNotExist(err) {
+		return transitions, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open quarantine journal")
+	}
+	defer journal.Close()
+
+	scanner := bufio.NewScanner(journal)
+	for scanner.Scan() {
+		var transition drweb.QuarantineTransition
+		if err = json.Unmarshal(scanner.Bytes(), &transition); err != nil {
+			return nil, errors.Wrap(err, "failed to decode quarantine journal")
+		}
+		transitions = append(transitions, &transition)
+	}
+
+	return transitions, errors.Wrap(scanner.Err(), "failed to read quarantine journal")
+}
+
+func readQuarantineRecord(path string) (*drweb.QuarantineRecord, error) {
+	var record drweb.QuarantineRecord
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read quarantine record")
+	}
+
+	if err = json.Unmarshal(contents, &record); err != nil {
+		return nil, errors.Wrap(err, "failed to decode quarantine record")
+	}
+
+	return &record, nil
+}
+
+// NOTE: quarantine may live on a separate disk, in which case rename
+// fails with EXDEV and we have to fall back to copying contents over.
+func moveFile(src string, dst string, fileMode os.FileMode) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, fileMode)
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+
+	if err = out.Close(); err != nil {
+		os.Remove(dst)
+		return err
+	}
+
+	return os.Remove(src)
+}
@@ -0,0 +1,193 @@
+package storages_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+	"github.com/twonegatives/drweb_challenge/pkg/mocks"
+	"github.com/twonegatives/drweb_challenge/pkg/pathgenerators"
+	"github.com/twonegatives/drweb_challenge/pkg/storages"
+	"github.com/twonegatives/drweb_challenge/pkg/testutils"
+)
+
+func generateQuarantine(t *testing.T) (*storages.FileSystemQuarantine, func()) {
+	base, err := ioutil.TempDir("../../tmp", "quarantine")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	storage := &storages.FileSystemStorage{
+		FileMode:          0700,
+		FilePathGenerator: &pathgenerators.NestedGenerator{BasePath: path.Join(base, "store"), Levels: 1, FolderLength: 2},
+	}
+
+	quarantine := &storages.FileSystemQuarantine{
+		BasePath:          path.Join(base, "quarantine"),
+		FileMode:          0700,
+		FilePathGenerator: &pathgenerators.NestedGenerator{BasePath: path.Join(base, "quarantine"), Levels: 1, FolderLength: 2},
+		Storage:           storage,
+	}
+
+	return quarantine, func() { os.RemoveAll(base) }
+}
+
+func TestQuarantineIsolate(t *testing.T) {
+	quarantine, cleanup := generateQuarantine(t)
+	defer cleanup()
+
+	storedPath, _ := quarantine.Storage.FilePathGenerator.Generate("abcdef")
+	if err := testutils.CreateFile(storedPath, []byte("EICAR"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	err := quarantine.Isolate("abcdef", drweb.QuarantineInfected, "scanner", "EICAR-Test-File")
+	assert.Nil(t, err)
+
+	_, err = quarantine.Storage.Load("abcdef")
+	assert.True(t, os.IsNotExist(errors.Cause(err)))
+
+	file, err := quarantine.Load("abcdef")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), file.Size)
+	file.Close()
+
+	record, err := quarantine.Inspect("abcdef")
+	assert.Nil(t, err)
+	assert.Equal(t, drweb.QuarantineInfected, record.Category)
+	assert.Equal(t, "EICAR-Test-File", record.Reason)
+	assert.Equal(t, int64(5), record.Size)
+	assert.Len(t, record.Transitions, 1)
+	assert.Equal(t, "scanner", record.Transitions[0].Actor)
+
+	records, err := quarantine.List()
+	assert.Nil(t, err)
+	assert.Len(t, records, 1)
+
+	err = quarantine.Isolate("abcdef", drweb.QuarantineInfected, "scanner", "twice")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "already quarantined")
+}
+
+func TestQuarantineIsolateFailure(t *testing.T) {
+	quarantine, cleanup := generateQuarantine(t)
+	defer cleanup()
+
+	err := quarantine.Isolate("abcdef", drweb.QuarantineInfected, "scanner", "reason")
+	assert.NotNil(t, err)
+	assert.True(t, os.IsNotExist(errors.Cause(err)))
+}
+
+func TestQuarantineIsolateUncheckable(t *testing.T) {
+	quarantine, cleanup := generateQuarantine(t)
+	defer cleanup()
+
+	storedPath, _ := quarantine.Storage.FilePathGenerator.Generate("abcdef")
+	if err := testutils.CreateFile(storedPath, []byte("EICAR"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	// NOTE: quarantine folder taken by a file, so it can not be told whether the file is there
+	if err := testutils.CreateFile(quarantine.BasePath, []byte{}, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	err := quarantine.Isolate("abcdef", drweb.QuarantineInfected, "scanner", "reason")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "failed to check quarantined file")
+
+	file, err := quarantine.Storage.Load("abcdef")
+	assert.Nil(t, err)
+	file.Close()
+}
+
+func TestQuarantineRelease(t *testing.T) {
+	quarantine, cleanup := generateQuarantine(t)
+	defer cleanup()
+
+	storedPath, _ := quarantine.Storage.FilePathGenerator.Generate("abcdef")
+	if err := testutils.CreateFile(storedPath, []byte("false positive"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := quarantine.Isolate("abcdef", drweb.QuarantineInfected, "scanner", "heuristics"); err != nil {
+		t.Fatal(err)
+	}
+
+	err := quarantine.Release("abcdef", "alice", "false positive")
+	assert.Nil(t, err)
+
+	contents, err := ioutil.ReadFile(storedPath)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("false positive"), contents)
+
+	_, err = quarantine.Inspect("abcdef")
+	assert.True(t, os.IsNotExist(errors.Cause(err)))
+
+	journal, err := quarantine.Journal()
+	assert.Nil(t, err)
+	assert.Len(t, journal, 2)
+	assert.Equal(t, drweb.QuarantineActionRelease, journal[1].Action)
+	assert.Equal(t, "alice", journal[1].Actor)
+	assert.Equal(t, "false positive", journal[1].Reason)
+}
+
+func TestQuarantineJobs(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	quarantine, cleanup := generateQuarantine(t)
+	defer cleanup()
+
+	storedPath, _ := quarantine.Storage.FilePathGenerator.Generate("abcdef")
+	if err := testutils.CreateFile(storedPath, []byte("EICAR"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	job := mocks.NewMockPostSaveJob(mockCtrl)
+	quarantine.Jobs = []drweb.PostSaveJob{job}
+
+	// NOTE: isolation is done by the time jobs are told, so their failures are only logged
+	job.EXPECT().Forget("abcdef").Return(errors.New("disk is gone"))
+	assert.Nil(t, quarantine.Isolate("abcdef", drweb.QuarantinePolicy, "alice", "takedown"))
+
+	job.EXPECT().Enqueue("abcdef")
+	assert.Nil(t, quarantine.Release("abcdef", "alice", "appealed"))
+}
+
+func TestQuarantinePurge(t *testing.T) {
+	quarantine, cleanup := generateQuarantine(t)
+	defer cleanup()
+
+	storedPath, _ := quarantine.Storage.FilePathGenerator.Generate("abcdef")
+	if err := testutils.CreateFile(storedPath, []byte("malware"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := quarantine.Isolate("abcdef", drweb.QuarantinePolicy, "alice", "copyright"); err != nil {
+		t.Fatal(err)
+	}
+
+	err := quarantine.Purge("abcdef", "bob", "confirmed")
+	assert.Nil(t, err)
+
+	quarantinedPath, _ := quarantine.FilePathGenerator.Generate("abcdef")
+	_, err = os.Stat(quarantinedPath)
+	assert.True(t, os.IsNotExist(err))
+
+	records, err := quarantine.List()
+	assert.Nil(t, err)
+	assert.Len(t, records, 0)
+
+	journal, err := quarantine.Journal()
+	assert.Nil(t, err)
+	assert.Len(t, journal, 2)
+	assert.Equal(t, drweb.QuarantineActionPurge, journal[1].Action)
+
+	err = quarantine.Purge("abcdef", "bob", "again")
+	assert.True(t, os.IsNotExist(errors.Cause(err)))
+}
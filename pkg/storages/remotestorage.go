@@ -0,0 +1,272 @@
+package storages
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+)
+
+var errRemoteAborted = errors.New("remote save aborted")
+
+// RemoteStorage keeps files on another drweb server found at Endpoint,
+// e.g. `https://eu.files.example.com`, through its /files API.
+// NOTE: uploads are hashed and inspected here while being streamed upstream,
+// files listed by GET /files are walked, whether they are there or not.
+type RemoteStorage struct {
+	Endpoint string
+	Client   *http.Client
+}
+
+// RemoteTransport gives up on connecting to upstream and on waiting for its
+// response after timeout, as well as on uploads and downloads stalled for that
+// long. Transfers which go on steadily are never cut, however long they take.
+func RemoteTransport(timeout time.Duration) *http.Transport {
+	dialer := &net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}
+
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+			conn, err := dialer.DialContext(ctx, network, address)
+			if err != nil {
+				return nil, err
+			}
+			return &idleConn{Conn: conn, timeout: timeout}, nil
+		},
+		TLSHandshakeTimeout:   timeout,
+		ResponseHeaderTimeout: timeout,
+		ExpectContinueTimeout: time.Second,
+		IdleConnTimeout:       90 * time.Second,
+	}
+}
+
+// idleConn fails reads and writes once nothing was read or written for timeout.
+// NOTE: both directions share the deadline, as the response is being waited
+// for while the upload is written
+type idleConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *idleConn) Read(p []byte) (int, error) {
+	c.Conn.SetDeadline(time.Now().Add(c.timeout))
+	return c.Conn.Read(p)
+}
+
+func (c *idleConn) Write(p []byte) (int, error) {
+	c.Conn.SetDeadline(time.Now().Add(c.timeout))
+	return c.Conn.Write(p)
+}
+
+// RemoteError is an error response of upstream server.
+type RemoteError struct {
+	Status  int    `json:"-"`
+	Message string `json:"error"`
+}
+
+func (e *RemoteError) Error() string {
+	return fmt.Sprintf("upstream responded with %d: %s", e.Status, e.Message)
+}
+
+type remoteResult struct {
+	filename string
+	err      error
+}
+
+func (s *RemoteStorage) Save(file *drweb.FileCreateRequest) (string, error) {
+	var filename string
+
+	if file.NameGenerator == nil {
+		return filename, errors.New("failed to save file without name generator")
+	}
+
+	reader, writer := io.Pipe()
+	form := multipart.NewWriter(writer)
+	results := make(chan remoteResult, 1)
+	go func() {
+		// NOTE: client closes bodies of failed requests, the reason is told here instead
+		uploaded, err := s.upload(form.FormDataContentType(), ioutil.NopCloser(reader))
+		// NOTE: unblocks hashing if upstream gave up early
+		reader.CloseWithError(errRemoteAborted)
+		results <- remoteResult{filename: uploaded, err: err}
+	}()
+
+	part, err := form.CreateFormFile("file", "file")
+	if err == nil {
+		writers := []io.Writer{part}
+		for _, inspector := range file.Inspectors {
+			writers = append(writers, inspector)
+		}
+
+		filename, err = file.NameGenerator.Generate(io.TeeReader(file.Body, io.MultiWriter(writers...)))
+		if err != nil {
+			err = errors.Wrap(err, "failed to generate filename")
+		} else {
+			err = inspect(file, filename)
+		}
+	}
+	if err == nil {
+		err = form.Close()
+	}
+
+	// NOTE: upstream waits for the end of form, so rejected files are never stored
+	if err != nil {
+		writer.CloseWithError(errRemoteAborted)
+	} else {
+		writer.Close()
+	}
+
+	result := <-results
+	if err != nil {
+		if errors.Cause(err) == errRemoteAborted && result.err != nil {
+			return filename, result.err
+		}
+		return filename, err
+	}
+	if result.err != nil {
+		return filename, result.err
+	}
+
+	if result.filename != filename {
+		return filename, fmt.Errorf("upstream named file '%s' rather than '%s'", result.filename, filename)
+	}
+	return filename, nil
+}
+
+// upload posts the form, telling the name upstream gave the file.
+func (s *RemoteStorage) upload(contentType string, body io.Reader) (string, error) {
+	req, err := http.NewRequest("POST", s.url("/files"), body)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create request")
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := s.client().Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to upload file")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		err = remoteFailure(resp)
+		// NOTE: rejections are passed on, so that clients get the same status
+		if failure, ok := err.(*RemoteError); ok && failure.Status >= 400 && failure.Status < 500 && failure.Status != http.StatusBadRequest {
+			return "", &drweb.RejectionError{Status: failure.Status, Rule: "upstream", Reason: failure.Message}
+		}
+		return "", errors.Wrap(err, "failed to upload file")
+	}
+
+	var created struct {
+		Filename string `json:"hashstring"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		return "", errors.Wrap(err, "failed to decode response")
+	}
+	return created.Filename, nil
+}
+
+func (s *RemoteStorage) Load(filename string) (*drweb.File, error) {
+	resp, err := s.client().Get(s.url("/files/" + url.PathEscape(filename)))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get file")
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, errors.Wrap(remoteFailure(resp), "failed to get file")
+	}
+	if resp.ContentLength < 0 {
+		resp.Body.Close()
+		return nil, errors.New("upstream did not tell file size")
+	}
+
+	return &drweb.File{Body: resp.Body, Size: resp.ContentLength}, nil
+}
+
+func (s *RemoteStorage) Delete(filename string) error {
+	req, err := http.NewRequest("DELETE", s.url("/files/"+url.PathEscape(filename)), nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to create request")
+	}
+
+	resp, err := s.client().Do(req)
+	if err != nil {
+		return errors.Wrap(err, "failed to delete file")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return errors.Wrap(remoteFailure(resp), "failed to delete file")
+	}
+	return nil
+}
+
+// Walk calls fn for every file upstream lists, in lexical order of their names.
+func (s *RemoteStorage) Walk(fn func(filename string) error) error {
+	resp, err := s.client().Get(s.url("/files"))
+	if err != nil {
+		return errors.Wrap(err, "failed to list files")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Wrap(remoteFailure(resp), "failed to list files")
+	}
+
+	var listed []struct {
+		Filename string `json:"hashstring"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&listed); err != nil {
+		return errors.Wrap(err, "failed to decode response")
+	}
+
+	filenames := make([]string, 0, len(listed))
+	for _, item := range listed {
+		filenames = append(filenames, item.Filename)
+	}
+	sort.Strings(filenames)
+
+	for _, filename := range filenames {
+		if err = fn(filename); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *RemoteStorage) url(path string) string {
+	return strings.TrimRight(s.Endpoint, "/") + path
+}
+
+func (s *RemoteStorage) client() *http.Client {
+	if s.Client == nil {
+		return http.DefaultClient
+	}
+	return s.Client
+}
+
+func remoteFailure(resp *http.Response) error {
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return os.ErrNotExist
+	case http.StatusInsufficientStorage:
+		return drweb.ErrStorageFull
+	}
+
+	failure := &RemoteError{Status: resp.StatusCode}
+	contents, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	json.Unmarshal(contents, failure)
+	return failure
+}
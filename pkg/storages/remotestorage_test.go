@@ -0,0 +1,299 @@
+package storages_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+	"github.com/twonegatives/drweb_challenge/pkg/namegenerators"
+	"github.com/twonegatives/drweb_challenge/pkg/storages"
+	"github.com/twonegatives/drweb_challenge/pkg/testutils"
+)
+
+// upstream is a drweb server keeping files on disk, counting downloads.
+type upstream struct {
+	*httptest.Server
+	Storage   *storages.FileSystemStorage
+	Delay     time.Duration
+	downloads int32
+}
+
+func (u *upstream) Downloads() int {
+	return int(atomic.LoadInt32(&u.downloads))
+}
+
+func newUpstream(t *testing.T, inspectors ...drweb.InspectorFactory) (*upstream, func()) {
+	disks, cleanup := testutils.GenerateDisks(t, 1)
+	metadata, cleanupMetadata := testutils.GenerateMetadataStore(t)
+	indexed := &storages.IndexedStorage{Storage: disks[0], Metadata: metadata}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/files", drweb.CreateFileHandler(indexed, &namegenerators.SHA256{}, inspectors...)).Methods("POST")
+	router.HandleFunc("/files", drweb.ListFilesHandler(metadata)).Methods("GET")
+	router.HandleFunc("/files/{hashstring}", drweb.RetrieveFileHandler(indexed)).Methods("GET")
+	router.HandleFunc("/files/{hashstring}", drweb.DeleteFileHandler(indexed)).Methods("DELETE")
+
+	server := &upstream{Storage: disks[0]}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" && r.URL.Path != "/files" {
+			atomic.AddInt32(&server.downloads, 1)
+			time.Sleep(server.Delay)
+		}
+		router.ServeHTTP(w, r)
+	}))
+
+	return server, func() {
+		server.Close()
+		cleanup()
+		cleanupMetadata()
+	}
+}
+
+func TestRemoteStorageErrors(t *testing.T) {
+	var objects = map[string]struct {
+		Status  int
+		Body    string
+		Closed  bool
+		Check   func(err error) bool
+		Message string
+	}{
+		"rejected": {Status: http.StatusUnsupportedMediaType, Body: `{"error": "type is not allowed"}`, Check: func(err error) bool {
+			rejection, ok := errors.Cause(err).(*drweb.RejectionError)
+			return ok && rejection.Status == http.StatusUnsupportedMediaType
+		}, Message: "type is not allowed"},
+		"full": {Status: http.StatusInsufficientStorage, Check: func(err error) bool {
+			return errors.Cause(err) == drweb.ErrStorageFull
+		}},
+		"broken": {Status: http.StatusInternalServerError, Body: `{"error": "disk is gone"}`, Check: func(err error) bool {
+			failure, ok := errors.Cause(err).(*storages.RemoteError)
+			return ok && failure.Status == http.StatusInternalServerError
+		}, Message: "disk is gone"},
+		"malformed": {Status: http.StatusBadRequest, Check: func(err error) bool {
+			_, ok := errors.Cause(err).(*storages.RemoteError)
+			return ok
+		}},
+		"unreachable": {Closed: true, Check: func(err error) bool {
+			return err != nil
+		}, Message: "failed to upload file"},
+	}
+
+	for testName, testObject := range objects {
+		t.Run(testName, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ioutil.ReadAll(r.Body)
+				w.WriteHeader(testObject.Status)
+				w.Write([]byte(testObject.Body))
+			}))
+			defer server.Close()
+			if testObject.Closed {
+				server.Close()
+			}
+
+			storage := &storages.RemoteStorage{Endpoint: server.URL}
+			_, err := testutils.SaveFile(storage, bytes.Repeat([]byte("0123456789abcdef"), 10000))
+			assert.True(t, testObject.Check(err), "%v", err)
+			if err != nil {
+				assert.Contains(t, err.Error(), testObject.Message)
+			}
+		})
+	}
+}
+
+func TestRemoteStorageSuite(t *testing.T) {
+	testStorageSuite(t, func(t *testing.T) (drweb.WalkableStorage, func()) {
+		server, cleanup := newUpstream(t)
+		return &storages.RemoteStorage{Endpoint: server.URL + "/"}, cleanup
+	})
+}
+
+func newProxyStorage(t *testing.T) (*storages.ProxyStorage, *upstream, func()) {
+	server, cleanupUpstream := newUpstream(t)
+	disks, cleanup := testutils.GenerateDisks(t, 1)
+
+	storage := &storages.ProxyStorage{
+		Local:         disks[0],
+		Upstream:      &storages.RemoteStorage{Endpoint: server.URL},
+		NameGenerator: &namegenerators.SHA256{},
+	}
+	return storage, server, func() {
+		cleanupUpstream()
+		cleanup()
+	}
+}
+
+func TestProxyStoragePull(t *testing.T) {
+	storage, server, cleanup := newProxyStorage(t)
+	defer cleanup()
+	server.Delay = 100 * time.Millisecond
+
+	contents := bytes.Repeat([]byte("0123456789abcdef"), 10000)
+	filename, err := testutils.SaveFile(storage.Upstream, contents)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// NOTE: misses coming while the file is pulled wait for it
+	var wg sync.WaitGroup
+	loaded := make([][]byte, 10)
+	for i := range loaded {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			file, err := storage.Load(filename)
+			if err != nil {
+				return
+			}
+			defer file.Close()
+			loaded[i], _ = ioutil.ReadAll(file.Body)
+		}(i)
+	}
+	wg.Wait()
+
+	for _, body := range loaded {
+		assert.Equal(t, contents, body)
+	}
+	assert.Equal(t, 1, server.Downloads())
+
+	assert.Equal(t, contents, testutils.LoadFile(t, storage.Local, filename))
+	assert.Equal(t, contents, testutils.LoadFile(t, storage, filename))
+	assert.Equal(t, 1, server.Downloads())
+}
+
+func TestProxyStorageMismatch(t *testing.T) {
+	storage, server, cleanup := newProxyStorage(t)
+	defer cleanup()
+
+	filename, err := testutils.SaveFile(storage.Upstream, []byte("File contents"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, _ := server.Storage.FilePathGenerator.Generate(filename)
+	ioutil.WriteFile(path, []byte("Tampered contents"), 0700)
+
+	_, err = storage.Load(filename)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), fmt.Sprintf("for file '%s'", filename))
+
+	// NOTE: nothing is kept, so the file is pulled again once upstream is fixed
+	assert.Nil(t, storage.Local.Walk(func(filename string) error {
+		return fmt.Errorf("unexpected file '%s'", filename)
+	}))
+	ioutil.WriteFile(path, []byte("File contents"), 0700)
+	assert.Equal(t, []byte("File contents"), testutils.LoadFile(t, storage, filename))
+	assert.Equal(t, 2, server.Downloads())
+}
+
+func TestProxyStorageSave(t *testing.T) {
+	storage, server, cleanup := newProxyStorage(t)
+	defer cleanup()
+
+	filename, err := testutils.SaveFile(storage, []byte("File contents"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("File contents"), testutils.LoadFile(t, server.Storage, filename))
+	assert.Equal(t, []byte("File contents"), testutils.LoadFile(t, storage.Local, filename))
+
+	// NOTE: files upstream refuses are not kept locally either, unless they were before
+	server.Close()
+	filename, err = testutils.SaveFile(storage, []byte("Other contents"))
+	assert.NotNil(t, err)
+	_, err = storage.Local.Load(filename)
+	assert.True(t, os.IsNotExist(errors.Cause(err)))
+
+	filename, err = testutils.SaveFile(storage, []byte("File contents"))
+	assert.NotNil(t, err)
+	assert.Equal(t, []byte("File contents"), testutils.LoadFile(t, storage.Local, filename))
+}
+
+func TestProxyStorageTimeouts(t *testing.T) {
+	storage, server, cleanup := newProxyStorage(t)
+	defer cleanup()
+	server.Delay = 500 * time.Millisecond
+	storage.PullTimeout = 50 * time.Millisecond
+
+	filename, err := testutils.SaveFile(storage.Upstream, []byte("File contents"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// NOTE: the pull goes on, while misses waiting for it give up
+	pulled := make(chan error)
+	go func() {
+		_, err := storage.Load(filename)
+		pulled <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	started := time.Now()
+	_, err = storage.Load(filename)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "timed out")
+	assert.True(t, time.Since(started) < 300*time.Millisecond)
+	assert.Nil(t, <-pulled)
+
+	t.Run("upstream", func(t *testing.T) {
+		remote := &storages.RemoteStorage{Endpoint: server.URL, Client: &http.Client{Transport: storages.RemoteTransport(50 * time.Millisecond)}}
+		_, err := remote.Load(filename)
+		assert.NotNil(t, err)
+	})
+}
+
+func TestRemoteTransport(t *testing.T) {
+	var objects = map[string]struct {
+		Pauses []time.Duration
+		Fails  bool
+	}{
+		"steady":           {Pauses: []time.Duration{0, 30 * time.Millisecond, 30 * time.Millisecond, 30 * time.Millisecond, 30 * time.Millisecond}},
+		"stalled":          {Pauses: []time.Duration{0, 30 * time.Millisecond, 300 * time.Millisecond}, Fails: true},
+		"no response head": {Pauses: []time.Duration{300 * time.Millisecond}, Fails: true},
+	}
+
+	for testName, testObject := range objects {
+		t.Run(testName, func(t *testing.T) {
+			done := make(chan struct{})
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// NOTE: headers are sent along with the first chunk
+				w.Header().Set("Content-Length", fmt.Sprintf("%d", len(testObject.Pauses)))
+				for _, pause := range testObject.Pauses {
+					select {
+					case <-time.After(pause):
+					case <-done:
+						return
+					}
+					w.Write([]byte("x"))
+					w.(http.Flusher).Flush()
+				}
+			}))
+			defer server.Close()
+			defer close(done)
+
+			client := &http.Client{Transport: storages.RemoteTransport(100 * time.Millisecond)}
+			started := time.Now()
+			resp, err := client.Get(server.URL)
+			if err == nil {
+				_, err = ioutil.ReadAll(resp.Body)
+				resp.Body.Close()
+			}
+
+			assert.Equal(t, testObject.Fails, err != nil, "%v", err)
+			assert.True(t, time.Since(started) < 250*time.Millisecond)
+		})
+	}
+}
+
+func TestProxyStorageSuite(t *testing.T) {
+	testStorageSuite(t, func(t *testing.T) (drweb.WalkableStorage, func()) {
+		storage, _, cleanup := newProxyStorage(t)
+		return storage, cleanup
+	})
+}
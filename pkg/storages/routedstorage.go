@@ -0,0 +1,215 @@
+package storages
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+)
+
+var errWalkStopped = errors.New("walk stopped")
+
+// SizeRoute takes files up to MaxSize bytes, or of any size if it is zero.
+type SizeRoute struct {
+	MaxSize int64
+	Storage drweb.Storage
+}
+
+// SizeRoutedStorage stores every file in the first route it fits, e.g. small
+// files in KVStorage and the rest in FileSystemStorage. Routes go by MaxSize
+// ascending, the last one takes files of any size.
+// NOTE: uploads are buffered up to the largest MaxSize to tell where they go,
+// and are hashed and inspected by the chosen storage in a single pass. Files are
+// looked up by probing routes in order, so that changes of routes do not lose them.
+type SizeRoutedStorage struct {
+	Routes []SizeRoute
+}
+
+// ParseSizeRoutes parses space separated `maxsize:backend` routes, where the last
+// one is just a `backend` taking the rest, e.g. `65536:kv filesystem`.
+func ParseSizeRoutes(spec string, backend func(name string) (drweb.Storage, error)) ([]SizeRoute, error) {
+	routes := []SizeRoute{}
+
+	fields := strings.Fields(spec)
+	for i, field := range fields {
+		route := SizeRoute{}
+		name := field
+
+		if i < len(fields)-1 {
+			parts := strings.SplitN(field, ":", 2)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("route '%s' should be given as maxsize:backend", field)
+			}
+
+			size, err := strconv.ParseInt(parts[0], 10, 64)
+			if err != nil || size < 1 {
+				return nil, fmt.Errorf("route '%s' should have a positive size", field)
+			}
+			if len(routes) > 0 && size <= routes[len(routes)-1].MaxSize {
+				return nil, fmt.Errorf("route '%s' should have a size larger than the previous one", field)
+			}
+			route.MaxSize, name = size, parts[1]
+		}
+
+		storage, err := backend(name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to create storage of route '%s'", field)
+		}
+		route.Storage = storage
+		routes = append(routes, route)
+	}
+
+	if len(routes) == 0 {
+		return nil, errors.New("no storage routes given")
+	}
+
+	return routes, nil
+}
+
+func (s *SizeRoutedStorage) Save(file *drweb.FileCreateRequest) (string, error) {
+	if len(s.Routes) == 0 {
+		return "", errors.New("failed to save file without storage routes")
+	}
+
+	last := s.Routes[len(s.Routes)-1]
+	if len(s.Routes) == 1 {
+		return last.Storage.Save(file)
+	}
+
+	threshold := s.Routes[len(s.Routes)-2].MaxSize
+	head, err := ioutil.ReadAll(io.LimitReader(file.Body, threshold+1))
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read file")
+	}
+
+	body := file.Body
+	defer func() { file.Body = body }()
+
+	if int64(len(head)) > threshold {
+		file.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(head), body))
+		return last.Storage.Save(file)
+	}
+
+	file.Body = ioutil.NopCloser(bytes.NewReader(head))
+	for _, route := range s.Routes {
+		if route.MaxSize == 0 || int64(len(head)) <= route.MaxSize {
+			return route.Storage.Save(file)
+		}
+	}
+	return last.Storage.Save(file)
+}
+
+func (s *SizeRoutedStorage) Load(filename string) (*drweb.File, error) {
+	for _, route := range s.Routes {
+		file, err := route.Storage.Load(filename)
+		if err == nil || !os.IsNotExist(errors.Cause(err)) {
+			return file, err
+		}
+	}
+
+	return nil, errors.Wrap(os.ErrNotExist, "failed to find file")
+}
+
+// Delete removes the file out of every route it is found in.
+func (s *SizeRoutedStorage) Delete(filename string) error {
+	found := false
+
+	for _, route := range s.Routes {
+		err := route.Storage.Delete(filename)
+		if err != nil && !os.IsNotExist(errors.Cause(err)) {
+			return err
+		}
+		found = found || err == nil
+	}
+
+	if !found {
+		return errors.Wrap(os.ErrNotExist, "failed to find file")
+	}
+	return nil
+}
+
+// Walk calls fn for every stored file in lexical order of their names,
+// all of the routes should lead to walkable storages.
+func (s *SizeRoutedStorage) Walk(fn func(filename string) error) error {
+	walkables := []drweb.WalkableStorage{}
+	for _, route := range s.Routes {
+		walkable, ok := route.Storage.(drweb.WalkableStorage)
+		if !ok {
+			return errors.New("failed to walk storage which can not enumerate files")
+		}
+		walkables = append(walkables, walkable)
+	}
+
+	return mergeWalks(walkables, fn)
+}
+
+// mergeWalks walks storages at once, calling fn for every file in lexical
+// order of their names. Files kept by several storages are walked once.
+func mergeWalks(walkables []drweb.WalkableStorage, fn func(filename string) error) error {
+	done := make(chan struct{})
+	defer close(done)
+
+	names := make([]chan string, len(walkables))
+	results := make([]chan error, len(walkables))
+	for i, walkable := range walkables {
+		names[i] = make(chan string, 64)
+		results[i] = make(chan error, 1)
+
+		go func(walkable drweb.WalkableStorage, names chan string, result chan error) {
+			result <- walkable.Walk(func(filename string) error {
+				select {
+				case names <- filename:
+					return nil
+				case <-done:
+					return errWalkStopped
+				}
+			})
+			close(names)
+		}(walkable, names[i], results[i])
+	}
+
+	heads := make([]string, len(walkables))
+	open := make([]bool, len(walkables))
+	for i := range names {
+		heads[i], open[i] = <-names[i]
+	}
+
+	var last string
+	walked := false
+	for {
+		next := -1
+		for i := range heads {
+			if open[i] && (next < 0 || heads[i] < heads[next]) {
+				next = i
+			}
+		}
+		if next < 0 {
+			break
+		}
+
+		filename := heads[next]
+		heads[next], open[next] = <-names[next]
+
+		if walked && filename == last {
+			continue
+		}
+		last, walked = filename, true
+
+		if err := fn(filename); err != nil {
+			return err
+		}
+	}
+
+	for _, result := range results {
+		if err := <-result; err != nil {
+			return errors.Wrap(err, "failed to walk storage")
+		}
+	}
+	return nil
+}
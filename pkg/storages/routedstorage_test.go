@@ -0,0 +1,159 @@
+package storages_test
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+	"github.com/twonegatives/drweb_challenge/pkg/namegenerators"
+	"github.com/twonegatives/drweb_challenge/pkg/storages"
+)
+
+func TestSizeRoutedStorageSave(t *testing.T) {
+	var objects = map[string]struct {
+		Contents []byte
+		Route    int
+	}{
+		"empty":          {Contents: []byte{}, Route: 0},
+		"tiny":           {Contents: []byte("tiny"), Route: 0},
+		"at threshold":   {Contents: bytes.Repeat([]byte("s"), 16), Route: 0},
+		"above":          {Contents: bytes.Repeat([]byte("m"), 17), Route: 1},
+		"at threshold 2": {Contents: bytes.Repeat([]byte("m"), 64), Route: 1},
+		"large":          {Contents: bytes.Repeat([]byte("l"), 100000), Route: 2},
+	}
+
+	for testName, testObject := range objects {
+		t.Run(testName, func(t *testing.T) {
+			routes := []*storages.MemoryStorage{{}, {}, {}}
+			storage := &storages.SizeRoutedStorage{Routes: []storages.SizeRoute{
+				{MaxSize: 16, Storage: routes[0]},
+				{MaxSize: 64, Storage: routes[1]},
+				{Storage: routes[2]},
+			}}
+
+			inspector := &rejectingInspector{}
+			filename, err := storage.Save(&drweb.FileCreateRequest{
+				Body:          ioutil.NopCloser(bytes.NewReader(testObject.Contents)),
+				NameGenerator: &namegenerators.SHA256{},
+				Inspectors:    []drweb.Inspector{inspector},
+			})
+			assert.Nil(t, err)
+			assert.Equal(t, string(testObject.Contents), inspector.String())
+
+			for i, route := range routes {
+				_, err := route.Load(filename)
+				assert.Equal(t, i == testObject.Route, err == nil)
+			}
+
+			file, err := storage.Load(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			loaded, _ := ioutil.ReadAll(file.Body)
+			assert.Equal(t, testObject.Contents, loaded)
+		})
+	}
+}
+
+func TestSizeRoutedStorageRerouted(t *testing.T) {
+	small, large := &storages.MemoryStorage{}, &storages.MemoryStorage{}
+	storage := &storages.SizeRoutedStorage{Routes: []storages.SizeRoute{{Storage: large}}}
+
+	save := func(contents string) string {
+		filename, err := storage.Save(&drweb.FileCreateRequest{
+			Body:          ioutil.NopCloser(bytes.NewReader([]byte(contents))),
+			NameGenerator: &namegenerators.SHA256{},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return filename
+	}
+
+	before := save("saved before small files were routed")
+	storage.Routes = []storages.SizeRoute{{MaxSize: 1024, Storage: small}, {Storage: large}}
+	after := save("saved after small files were routed")
+
+	for _, filename := range []string{before, after} {
+		_, err := storage.Load(filename)
+		assert.Nil(t, err)
+		assert.Nil(t, storage.Delete(filename))
+	}
+	assert.Zero(t, small.Size())
+	assert.Zero(t, large.Size())
+}
+
+func TestSizeRoutedStorageWalkStopped(t *testing.T) {
+	routes := []storages.SizeRoute{{MaxSize: 8, Storage: &storages.MemoryStorage{}}, {Storage: &storages.MemoryStorage{}}}
+	storage := &storages.SizeRoutedStorage{Routes: routes}
+
+	for _, contents := range []string{"a", "b", "longer contents", "other longer contents"} {
+		storage.Save(&drweb.FileCreateRequest{
+			Body:          ioutil.NopCloser(bytes.NewReader([]byte(contents))),
+			NameGenerator: &namegenerators.SHA256{},
+		})
+	}
+
+	stop := errors.New("stop")
+	walked := 0
+	err := storage.Walk(func(filename string) error {
+		walked++
+		return stop
+	})
+	assert.Equal(t, stop, err)
+	assert.Equal(t, 1, walked)
+}
+
+func TestParseSizeRoutes(t *testing.T) {
+	backends := map[string]drweb.Storage{
+		"memory": &storages.MemoryStorage{},
+		"kv":     &storages.MemoryStorage{},
+	}
+	backend := func(name string) (drweb.Storage, error) {
+		if storage, ok := backends[name]; ok {
+			return storage, nil
+		}
+		return nil, os.ErrNotExist
+	}
+
+	var specs = map[string]struct {
+		Spec   string
+		Routes []storages.SizeRoute
+		Error  string
+	}{
+		"single": {Spec: "memory", Routes: []storages.SizeRoute{{Storage: backends["memory"]}}},
+		"routed": {Spec: " 1024:memory  65536:kv memory ", Routes: []storages.SizeRoute{
+			{MaxSize: 1024, Storage: backends["memory"]},
+			{MaxSize: 65536, Storage: backends["kv"]},
+			{Storage: backends["memory"]},
+		}},
+		"empty":         {Spec: " ", Error: "no storage routes given"},
+		"no size":       {Spec: "kv memory", Error: "should be given as maxsize:backend"},
+		"bad size":      {Spec: "64k:kv memory", Error: "should have a positive size"},
+		"zero size":     {Spec: "0:kv memory", Error: "should have a positive size"},
+		"not ascending": {Spec: "1024:kv 1024:memory memory", Error: "should have a size larger than the previous one"},
+		"unknown":       {Spec: "1024:kv disk", Error: "failed to create storage of route 'disk'"},
+	}
+
+	for testName, testSpec := range specs {
+		t.Run(testName, func(t *testing.T) {
+			routes, err := storages.ParseSizeRoutes(testSpec.Spec, backend)
+			if testSpec.Error != "" {
+				assert.NotNil(t, err)
+				assert.Contains(t, err.Error(), testSpec.Error)
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.Equal(t, len(testSpec.Routes), len(routes))
+			for i := range routes {
+				assert.Equal(t, testSpec.Routes[i].MaxSize, routes[i].MaxSize)
+				assert.True(t, testSpec.Routes[i].Storage == routes[i].Storage)
+			}
+		})
+	}
+}
@@ -0,0 +1,694 @@
+package storages
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+)
+
+// NOTE: S3 rejects multipart uploads having parts smaller than that, but the last one
+const s3MinPartSize = 5 << 20
+
+// NOTE: S3 refuses to copy objects larger than that at once
+const s3MaxCopySize = 5 << 30
+const s3TempPrefix = "tmp/"
+const s3ReadAhead = 64 << 10
+const s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+
+// S3Storage keeps files in a bucket of S3 compatible object storage (AWS, MinIO, Ceph
+// and alike), objects are keyed by FilePathGenerator and addressed path-style,
+// i.e. Endpoint/Bucket/key. Requests are signed with AWS signature v4 unless
+// AccessKey is blank.
+// NOTE: uploads are streamed to a temporary key while being hashed, in parts of
+// PartSize once they outgrow it, and copied server-side to the final key afterwards,
+// in parts of MaxCopySize (5GB unless set) once they outgrow that.
+// Bodies of loaded files implement io.Seeker and io.ReaderAt by range reads.
+type S3Storage struct {
+	Endpoint          string
+	Bucket            string
+	Region            string
+	AccessKey         string
+	SecretKey         string
+	PartSize          int64
+	MaxCopySize       int64
+	FilePathGenerator drweb.FilePathGenerator
+	Client            *http.Client
+}
+
+// S3Error is an error response of object storage.
+type S3Error struct {
+	Status  int    `xml:"-"`
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func (e *S3Error) Error() string {
+	return fmt.Sprintf("object storage responded with %d %s: %s", e.Status, e.Code, e.Message)
+}
+
+func (s *S3Storage) key(filename string) (string, error) {
+	key, err := s.FilePathGenerator.Generate(filename)
+	return strings.TrimPrefix(key, "/"), err
+}
+
+func (s *S3Storage) Save(file *drweb.FileCreateRequest) (string, error) {
+	var filename string
+	var key string
+	var err error
+
+	if file.NameGenerator == nil {
+		return filename, errors.New("failed to save file without name generator")
+	}
+
+	upload := &s3Upload{storage: s, key: s3TempPrefix + randomName()}
+	// NOTE: temp object is of no use even after a successful copy. leftovers
+	// of failed discards are best swept by a lifecycle rule on the prefix
+	defer upload.discard()
+
+	writers := []io.Writer{upload}
+	for _, inspector := range file.Inspectors {
+		writers = append(writers, inspector)
+	}
+
+	filenameReader := io.TeeReader(file.Body, io.MultiWriter(writers...))
+	if filename, err = file.NameGenerator.Generate(filenameReader); err != nil {
+		return filename, errors.Wrap(err, "failed to generate filename")
+	}
+
+	if err = upload.Close(); err != nil {
+		return filename, errors.Wrap(err, "failed to upload file")
+	}
+
+	if err = inspect(file, filename); err != nil {
+		return filename, err
+	}
+
+	if key, err = s.key(filename); err != nil {
+		return filename, errors.Wrap(err, "failed to generate object key")
+	}
+
+	return filename, errors.Wrap(s.copy(upload.key, key, upload.size), "failed to write to object")
+}
+
+func (s *S3Storage) Load(filename string) (*drweb.File, error) {
+	var key string
+	var body io.ReadCloser
+	var size int64
+	var err error
+
+	if key, err = s.key(filename); err != nil {
+		return nil, errors.Wrap(err, "failed to generate object key")
+	}
+
+	if body, size, err = s.get(key, 0, -1); err != nil {
+		return nil, errors.Wrap(err, "failed to get object")
+	}
+
+	return &drweb.File{Body: &s3Object{storage: s, key: key, size: size, body: body}, Size: size}, nil
+}
+
+// Delete fails with os.ErrNotExist for missing files like FileSystemStorage does,
+// NOTE: S3 itself reports nothing on deletion of missing objects, hence the check.
+func (s *S3Storage) Delete(filename string) error {
+	var key string
+	var resp *http.Response
+	var err error
+
+	if key, err = s.key(filename); err != nil {
+		return errors.Wrap(err, "failed to generate object key")
+	}
+
+	if resp, err = s.do("HEAD", key, nil, nil, nil); err != nil {
+		return errors.Wrap(err, "failed to stat object")
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Wrap(s3Failure(resp), "failed to stat object")
+	}
+
+	return errors.Wrap(s.remove(key, nil), "failed to delete object")
+}
+
+// Walk calls fn for every stored file in lexical order of their names.
+// NOTE: the bucket may be shared with other stuff (temp objects included),
+// so we only take objects which lie exactly where the path generator puts them.
+func (s *S3Storage) Walk(fn func(filename string) error) error {
+	var token string
+
+	for {
+		var page struct {
+			Contents []struct {
+				Key string `xml:"Key"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+
+		query := url.Values{"list-type": {"2"}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		if err := s.call("GET", "", query, nil, nil, &page); err != nil {
+			return errors.Wrap(err, "failed to list objects")
+		}
+
+		for _, object := range page.Contents {
+			filename := path.Base(object.Key)
+			expected, err := s.key(filename)
+			if err != nil || expected != object.Key {
+				continue
+			}
+
+			if err = fn(filename); err != nil {
+				return err
+			}
+		}
+
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+// get reads an object starting at first byte, up to the last one or till the end if negative.
+func (s *S3Storage) get(key string, first int64, last int64) (io.ReadCloser, int64, error) {
+	header := http.Header{}
+	if first > 0 || last >= 0 {
+		rng := fmt.Sprintf("bytes=%d-", first)
+		if last >= 0 {
+			rng += fmt.Sprintf("%d", last)
+		}
+		header.Set("Range", rng)
+	}
+
+	resp, err := s.do("GET", key, nil, header, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// NOTE: servers are free to ignore range and respond with the whole object
+	if resp.StatusCode == http.StatusOK && first == 0 || resp.StatusCode == http.StatusPartialContent {
+		return resp.Body, resp.ContentLength, nil
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil, 0, errors.New("object storage does not support range reads")
+	}
+	return nil, 0, s3Failure(resp)
+}
+
+// copy copies an object of given size server-side, by UploadPartCopy once it is too large for a single copy.
+func (s *S3Storage) copy(src string, dst string, size int64) error {
+	header := http.Header{}
+	header.Set("X-Amz-Copy-Source", "/"+s.Bucket+"/"+escapePath(src))
+
+	partSize := s.maxCopySize()
+	if size <= partSize {
+		return s.call("PUT", dst, nil, header, nil, nil)
+	}
+
+	upload := &s3Upload{storage: s, key: dst}
+	if err := upload.initiate(); err != nil {
+		return err
+	}
+
+	for first := int64(0); first < size; first += partSize {
+		last := first + partSize - 1
+		if last >= size {
+			last = size - 1
+		}
+		header.Set("X-Amz-Copy-Source-Range", fmt.Sprintf("bytes=%d-%d", first, last))
+
+		var copied struct {
+			ETag string `xml:"ETag"`
+		}
+		number := len(upload.parts) + 1
+		query := url.Values{"partNumber": {fmt.Sprintf("%d", number)}, "uploadId": {upload.uploadID}}
+		if err := s.call("PUT", dst, query, header, nil, &copied); err != nil {
+			upload.discard()
+			return errors.Wrap(err, "failed to copy part")
+		}
+		upload.parts = append(upload.parts, s3Part{Number: number, ETag: copied.ETag})
+	}
+
+	if err := upload.complete(); err != nil {
+		upload.discard()
+		return err
+	}
+	return nil
+}
+
+func (s *S3Storage) remove(key string, query url.Values) error {
+	resp, err := s.do("DELETE", key, query, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return s3Failure(resp)
+	}
+	return nil
+}
+
+// call performs a request having a small xml response, which is decoded into result unless it is nil.
+// NOTE: copies and multipart completions may fail after 200 OK was sent, so errors are looked for in body too.
+func (s *S3Storage) call(method string, key string, query url.Values, header http.Header, body []byte, result interface{}) error {
+	resp, err := s.do(method, key, query, header, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return s3Failure(resp)
+	}
+
+	contents, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrap(err, "failed to read response")
+	}
+
+	if bytes.Contains(contents, []byte("<Error>")) {
+		failure := &S3Error{Status: resp.StatusCode}
+		xml.Unmarshal(contents, failure)
+		return failure
+	}
+
+	if result == nil {
+		return nil
+	}
+	return errors.Wrap(xml.Unmarshal(contents, result), "failed to decode response")
+}
+
+func (s *S3Storage) do(method string, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	endpoint, err := url.Parse(s.Endpoint)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse endpoint")
+	}
+
+	endpoint.Path = "/" + s.Bucket
+	if key != "" {
+		endpoint.Path += "/" + key
+	}
+	endpoint.RawPath = escapePath(endpoint.Path)
+	endpoint.RawQuery = canonicalQuery(query)
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequest(method, endpoint.String(), reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create request")
+	}
+
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	s.sign(req, time.Now())
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return client.Do(req)
+}
+
+// sign signs request with AWS signature v4, see
+// https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-header-based-auth.html
+// NOTE: payloads are left unsigned unless the hash is set already, TLS takes care of their integrity.
+func (s *S3Storage) sign(req *http.Request, at time.Time) {
+	stamp := at.UTC().Format("20060102T150405Z")
+	date := stamp[:8]
+
+	req.Header.Set("X-Amz-Date", stamp)
+	if req.Header.Get("X-Amz-Content-Sha256") == "" {
+		req.Header.Set("X-Amz-Content-Sha256", s3UnsignedPayload)
+	}
+
+	if s.AccessKey == "" {
+		return
+	}
+
+	region := s.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if name == "range" || strings.HasPrefix(name, "x-amz-") {
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	canonical := []string{req.Method, req.URL.EscapedPath(), req.URL.RawQuery}
+	for _, name := range names {
+		canonical = append(canonical, name+":"+headers[name])
+	}
+	signed := strings.Join(names, ";")
+	canonical = append(canonical, "", signed, req.Header.Get("X-Amz-Content-Sha256"))
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	digest := sha256.Sum256([]byte(strings.Join(canonical, "\n")))
+	toSign := "AWS4-HMAC-SHA256\n" + stamp + "\n" + scope + "\n" + hex.EncodeToString(digest[:])
+
+	key := []byte("AWS4" + s.SecretKey)
+	for _, part := range []string{date, region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, scope, signed, hex.EncodeToString(hmacSHA256(key, toSign)),
+	))
+}
+
+func (s *S3Storage) partSize() int64 {
+	if s.PartSize < s3MinPartSize {
+		return s3MinPartSize
+	}
+	return s.PartSize
+}
+
+func (s *S3Storage) maxCopySize() int64 {
+	if s.MaxCopySize <= 0 || s.MaxCopySize > s3MaxCopySize {
+		return s3MaxCopySize
+	}
+	if s.MaxCopySize < s3MinPartSize {
+		return s3MinPartSize
+	}
+	return s.MaxCopySize
+}
+
+// s3Upload buffers written contents, switching over to multipart upload
+// once they do not fit in a single part.
+type s3Upload struct {
+	storage   *S3Storage
+	key       string
+	size      int64
+	buffer    []byte
+	uploadID  string
+	parts     []s3Part
+	completed bool
+}
+
+type s3Part struct {
+	Number int    `xml:"PartNumber"`
+	ETag   string `xml:"ETag"`
+}
+
+func (u *s3Upload) Write(p []byte) (int, error) {
+	size := u.storage.partSize()
+	u.buffer = append(u.buffer, p...)
+	u.size += int64(len(p))
+
+	for int64(len(u.buffer)) >= size {
+		if err := u.flush(u.buffer[:size]); err != nil {
+			return 0, err
+		}
+		u.buffer = u.buffer[:copy(u.buffer, u.buffer[size:])]
+	}
+
+	return len(p), nil
+}
+
+func (u *s3Upload) initiate() error {
+	var initiated struct {
+		UploadID string `xml:"UploadId"`
+	}
+
+	if err := u.storage.call("POST", u.key, url.Values{"uploads": {""}}, nil, nil, &initiated); err != nil {
+		return errors.Wrap(err, "failed to initiate multipart upload")
+	}
+	u.uploadID = initiated.UploadID
+	return nil
+}
+
+func (u *s3Upload) flush(part []byte) error {
+	if u.uploadID == "" {
+		if err := u.initiate(); err != nil {
+			return err
+		}
+	}
+
+	number := len(u.parts) + 1
+	query := url.Values{"partNumber": {fmt.Sprintf("%d", number)}, "uploadId": {u.uploadID}}
+	resp, err := u.storage.do("PUT", u.key, query, nil, part)
+	if err != nil {
+		return errors.Wrap(err, "failed to upload part")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Wrap(s3Failure(resp), "failed to upload part")
+	}
+
+	u.parts = append(u.parts, s3Part{Number: number, ETag: resp.Header.Get("ETag")})
+	return nil
+}
+
+func (u *s3Upload) Close() error {
+	if u.uploadID == "" {
+		if err := u.storage.call("PUT", u.key, nil, nil, u.buffer, nil); err != nil {
+			return err
+		}
+		u.completed = true
+		return nil
+	}
+
+	if len(u.buffer) > 0 {
+		if err := u.flush(u.buffer); err != nil {
+			return err
+		}
+	}
+	return u.complete()
+}
+
+func (u *s3Upload) complete() error {
+	completion, err := xml.Marshal(struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Parts   []s3Part `xml:"Part"`
+	}{Parts: u.parts})
+	if err != nil {
+		return errors.Wrap(err, "failed to encode multipart completion")
+	}
+
+	query := url.Values{"uploadId": {u.uploadID}}
+	if err = u.storage.call("POST", u.key, query, nil, completion, nil); err != nil {
+		return errors.Wrap(err, "failed to complete multipart upload")
+	}
+	u.completed = true
+	return nil
+}
+
+func (u *s3Upload) discard() error {
+	if u.completed {
+		return u.storage.remove(u.key, nil)
+	}
+	if u.uploadID != "" {
+		return u.storage.remove(u.key, url.Values{"uploadId": {u.uploadID}})
+	}
+	return nil
+}
+
+// s3Object reads an object sequentially through a single response, which is
+// reopened at another offset on seek. ReadAt requests ranges of s3ReadAhead
+// at least and keeps the last one, as readers of executables and archives
+// tend to take small pieces lying close to each other.
+type s3Object struct {
+	storage *S3Storage
+	key     string
+	size    int64
+	offset  int64
+	body    io.ReadCloser
+	mutex   sync.Mutex
+	block   []byte
+	at      int64
+}
+
+func (o *s3Object) Read(p []byte) (int, error) {
+	if o.offset >= o.size {
+		return 0, io.EOF
+	}
+
+	if o.body == nil {
+		body, _, err := o.storage.get(o.key, o.offset, -1)
+		if err != nil {
+			return 0, errors.Wrap(err, "failed to get object")
+		}
+		o.body = body
+	}
+
+	n, err := o.body.Read(p)
+	o.offset += int64(n)
+	return n, err
+}
+
+func (o *s3Object) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += o.offset
+	case io.SeekEnd:
+		offset += o.size
+	default:
+		return o.offset, errors.New("invalid whence")
+	}
+
+	if offset < 0 {
+		return o.offset, errors.New("negative position")
+	}
+
+	if offset != o.offset && o.body != nil {
+		o.body.Close()
+		o.body = nil
+	}
+	o.offset = offset
+	return offset, nil
+}
+
+func (o *s3Object) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if off >= o.size {
+		return 0, io.EOF
+	}
+
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	end := off + int64(len(p))
+	if end > o.size {
+		end = o.size
+	}
+
+	if off < o.at || end > o.at+int64(len(o.block)) {
+		last := off + int64(len(p))
+		if last < off+s3ReadAhead {
+			last = off + s3ReadAhead
+		}
+		if last > o.size {
+			last = o.size
+		}
+
+		body, _, err := o.storage.get(o.key, off, last-1)
+		if err != nil {
+			return 0, errors.Wrap(err, "failed to get object range")
+		}
+		defer body.Close()
+
+		block := make([]byte, last-off)
+		if _, err = io.ReadFull(body, block); err != nil {
+			return 0, errors.Wrap(err, "failed to read object range")
+		}
+		o.block, o.at = block, off
+	}
+
+	n := copy(p, o.block[off-o.at:end-o.at])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (o *s3Object) Close() error {
+	if o.body == nil {
+		return nil
+	}
+	return o.body.Close()
+}
+
+// s3Failure makes an error of unexpected response, with os.ErrNotExist for
+// missing objects so that transport could tell them apart.
+func s3Failure(resp *http.Response) error {
+	if resp.StatusCode == http.StatusNotFound {
+		return os.ErrNotExist
+	}
+
+	failure := &S3Error{Status: resp.StatusCode}
+	contents, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	xml.Unmarshal(contents, failure)
+	return failure
+}
+
+func canonicalQuery(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	params := []string{}
+	for _, name := range names {
+		values := append([]string{}, query[name]...)
+		sort.Strings(values)
+		for _, value := range values {
+			params = append(params, escape(name, false)+"="+escape(value, false))
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+func escapePath(path string) string {
+	return escape(path, true)
+}
+
+// escape encodes everything but unreserved characters (and slashes if asked to), as signature v4 wants.
+func escape(s string, keepSlashes bool) string {
+	var escaped bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && keepSlashes:
+			escaped.WriteByte(c)
+		default:
+			fmt.Fprintf(&escaped, "%%%02X", c)
+		}
+	}
+	return escaped.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func randomName() string {
+	name := make([]byte, 16)
+	rand.Read(name)
+	return hex.EncodeToString(name)
+}
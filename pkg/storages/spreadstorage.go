@@ -0,0 +1,257 @@
+package storages
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+)
+
+// SpreadDisk takes files in proportion to its Weight, zero weight drains it.
+type SpreadDisk struct {
+	Storage *FileSystemStorage
+	Weight  float64
+}
+
+// SpreadStorage spreads files over several disks by weighted rendezvous
+// hashing on their names, skipping disks with less than MinFree bytes left.
+// Files are found by probing disks in the order they are preferred for them,
+// so adding a disk only takes an extra probe for files which would go there
+// now, until Rebalance moves them.
+// NOTE: file name is only known once it is written, so uploads are written
+// to the disk having the most space and moved to their disk afterwards.
+type SpreadStorage struct {
+	Disks         []SpreadDisk
+	MinFree       uint64
+	NameGenerator drweb.FileNameGenerator
+	FreeSpace     func(path string) (uint64, error)
+}
+
+// ParseSpreadDisks parses space separated `weight:path` disks, where weight
+// may be omitted for 1, e.g. `2:/mnt/large /mnt/small`.
+func ParseSpreadDisks(spec string, disk func(path string) (*FileSystemStorage, error)) ([]SpreadDisk, error) {
+	disks := []SpreadDisk{}
+
+	for _, field := range strings.Fields(spec) {
+		weight, path := 1.0, field
+		if parts := strings.SplitN(field, ":", 2); len(parts) == 2 {
+			parsed, err := strconv.ParseFloat(parts[0], 64)
+			if err == nil {
+				weight, path = parsed, parts[1]
+			}
+		}
+		if weight < 0 || math.IsNaN(weight) || math.IsInf(weight, 0) {
+			return nil, fmt.Errorf("disk '%s' should have a non-negative weight", field)
+		}
+
+		storage, err := disk(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to create storage of disk '%s'", field)
+		}
+		disks = append(disks, SpreadDisk{Storage: storage, Weight: weight})
+	}
+
+	if len(disks) == 0 {
+		return nil, errors.New("no disks given")
+	}
+
+	return disks, nil
+}
+
+// space tells free space of the disk, and whether it takes files.
+func (s *SpreadStorage) space(disk int) (uint64, bool) {
+	if s.Disks[disk].Weight <= 0 {
+		return 0, false
+	}
+
+	measure := s.FreeSpace
+	if measure == nil {
+		measure = freeSpace
+	}
+
+	free, err := measure(s.Disks[disk].Storage.BasePath)
+	switch {
+	case os.IsNotExist(errors.Cause(err)):
+		// NOTE: base paths are created with the first file
+		return 0, true
+	case err != nil:
+		log.WithError(err).WithField("path", s.Disks[disk].Storage.BasePath).Warn("spread storage disk skipped")
+		return 0, false
+	}
+	return free, free >= s.MinFree
+}
+
+// rank lists disks in the order they are preferred for the file.
+// NOTE: every disk scores -weight/ln(hash), hash taken in (0, 1),
+// which gives each disk its weight share of files
+func (s *SpreadStorage) rank(filename string) []int {
+	scores := make([]float64, len(s.Disks))
+	disks := make([]int, len(s.Disks))
+
+	for i, disk := range s.Disks {
+		hasher := fnv.New64a()
+		hasher.Write([]byte(disk.Storage.BasePath))
+		hasher.Write([]byte{0})
+		hasher.Write([]byte(filename))
+
+		// NOTE: splitmix64 finalizer, fnv alone mixes short inputs poorly
+		hash := hasher.Sum64()
+		hash = (hash ^ (hash >> 30)) * 0xbf58476d1ce4e5b9
+		hash = (hash ^ (hash >> 27)) * 0x94d049bb133111eb
+		hash ^= hash >> 31
+
+		unit := (float64(hash>>11) + 0.5) / (1 << 53)
+		scores[i] = -disk.Weight / math.Log(unit)
+		disks[i] = i
+	}
+
+	sort.SliceStable(disks, func(i, j int) bool {
+		return scores[disks[i]] > scores[disks[j]]
+	})
+	return disks
+}
+
+// place tells the disk which takes the file now.
+func (s *SpreadStorage) place(filename string) (int, error) {
+	for _, disk := range s.rank(filename) {
+		if _, ok := s.space(disk); ok {
+			return disk, nil
+		}
+	}
+	return -1, errors.Wrap(drweb.ErrStorageFull, "failed to find disk with enough space")
+}
+
+// Locate tells the disk holding the file.
+func (s *SpreadStorage) Locate(filename string) (int, error) {
+	for _, disk := range s.rank(filename) {
+		path, err := s.Disks[disk].Storage.filepath(filename)
+		if err != nil {
+			return -1, errors.Wrap(err, "failed to generate filepath")
+		}
+
+		_, err = os.Stat(path)
+		if err == nil {
+			return disk, nil
+		}
+		if !os.IsNotExist(err) {
+			return -1, errors.Wrap(err, "failed to locate file")
+		}
+	}
+
+	return -1, errors.Wrap(os.ErrNotExist, "failed to find file")
+}
+
+// move copies file to another disk, checking it on the way, and deletes the original.
+func (s *SpreadStorage) move(filename string, from, to int, generator drweb.FileNameGenerator) error {
+	if err := copyVerified(s.Disks[from].Storage, s.Disks[to].Storage, filename, generator); err != nil {
+		return err
+	}
+
+	return s.Disks[from].Storage.Delete(filename)
+}
+
+func (s *SpreadStorage) Save(file *drweb.FileCreateRequest) (string, error) {
+	staging, most := -1, uint64(0)
+	for disk := range s.Disks {
+		if free, ok := s.space(disk); ok && (staging < 0 || free > most) {
+			staging, most = disk, free
+		}
+	}
+	if staging < 0 {
+		return "", errors.Wrap(drweb.ErrStorageFull, "failed to find disk with enough space")
+	}
+
+	filename, err := s.Disks[staging].Storage.Save(file)
+	if err != nil {
+		return filename, err
+	}
+
+	disk, err := s.place(filename)
+	if err != nil || disk == staging {
+		return filename, nil
+	}
+
+	// NOTE: file is found where it was written until it is rebalanced
+	if err = s.move(filename, staging, disk, file.NameGenerator); err != nil {
+		log.WithError(err).WithField("filename", filename).Warn("failed to move file to its disk")
+	}
+	return filename, nil
+}
+
+func (s *SpreadStorage) Load(filename string) (*drweb.File, error) {
+	disk, err := s.Locate(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Disks[disk].Storage.Load(filename)
+}
+
+// Delete removes the file from every disk, as moves may leave copies behind.
+func (s *SpreadStorage) Delete(filename string) error {
+	found := false
+
+	for _, disk := range s.Disks {
+		err := disk.Storage.Delete(filename)
+		if err != nil && !os.IsNotExist(errors.Cause(err)) {
+			return err
+		}
+		found = found || err == nil
+	}
+
+	if !found {
+		return errors.Wrap(os.ErrNotExist, "failed to find file")
+	}
+	return nil
+}
+
+// Walk calls fn for every stored file in lexical order of their names.
+func (s *SpreadStorage) Walk(fn func(filename string) error) error {
+	walkables := []drweb.WalkableStorage{}
+	for _, disk := range s.Disks {
+		walkables = append(walkables, disk.Storage)
+	}
+
+	return mergeWalks(walkables, fn)
+}
+
+// Rebalance moves files to the disks they are preferred for, e.g. once
+// disks are added or drained, telling how many files were moved.
+// NOTE: files are left where they are if no disk preferred to it has
+// enough space, moves are safe while files are served.
+func (s *SpreadStorage) Rebalance() (int, error) {
+	moved := 0
+
+	for from, disk := range s.Disks {
+		err := disk.Storage.Walk(func(filename string) error {
+			for _, to := range s.rank(filename) {
+				if to == from && disk.Weight > 0 {
+					return nil
+				}
+				if _, ok := s.space(to); !ok {
+					continue
+				}
+
+				if err := s.move(filename, from, to, s.NameGenerator); err != nil {
+					return errors.Wrapf(err, "failed to move file '%s'", filename)
+				}
+				moved++
+				return nil
+			}
+
+			return errors.Wrapf(drweb.ErrStorageFull, "failed to move file '%s'", filename)
+		})
+		if err != nil {
+			return moved, err
+		}
+	}
+
+	return moved, nil
+}
@@ -0,0 +1,221 @@
+package storages_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+	"github.com/twonegatives/drweb_challenge/pkg/namegenerators"
+	"github.com/twonegatives/drweb_challenge/pkg/storages"
+	"github.com/twonegatives/drweb_challenge/pkg/testutils"
+)
+
+func newSpreadStorage(t *testing.T, weights ...float64) (*storages.SpreadStorage, func()) {
+	disks, cleanup := testutils.GenerateDisks(t, len(weights))
+	storage := &storages.SpreadStorage{NameGenerator: &namegenerators.SHA256{}}
+	for i, disk := range disks {
+		storage.Disks = append(storage.Disks, storages.SpreadDisk{Storage: disk, Weight: weights[i]})
+	}
+	return storage, cleanup
+}
+
+// countFiles tells how many files every disk holds.
+func countFiles(t *testing.T, storage *storages.SpreadStorage) []int {
+	counts := []int{}
+	for _, disk := range storage.Disks {
+		count := 0
+		if err := disk.Storage.Walk(func(string) error {
+			count++
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		counts = append(counts, count)
+	}
+	return counts
+}
+
+func TestSpreadStorageWeights(t *testing.T) {
+	storage, cleanup := newSpreadStorage(t, 1, 1, 2)
+	defer cleanup()
+
+	filenames := testutils.SaveFiles(t, storage, 400)
+	counts := countFiles(t, storage)
+	assert.Equal(t, 400, counts[0]+counts[1]+counts[2])
+	for i, expected := range []int{100, 100, 200} {
+		assert.InDelta(t, expected, counts[i], 40, "disk %d", i)
+	}
+
+	// NOTE: files are where they are preferred, so nothing is moved
+	moved, err := storage.Rebalance()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, moved)
+
+	for _, filename := range filenames {
+		disk, err := storage.Locate(filename)
+		assert.Nil(t, err)
+		_, err = storage.Disks[disk].Storage.Load(filename)
+		assert.Nil(t, err)
+	}
+}
+
+func TestSpreadStorageWatermark(t *testing.T) {
+	storage, cleanup := newSpreadStorage(t, 1, 1, 1)
+	defer cleanup()
+
+	free := map[string]uint64{}
+	for _, disk := range storage.Disks {
+		free[disk.Storage.BasePath] = 1 << 30
+	}
+	storage.MinFree = 1 << 20
+	storage.FreeSpace = func(path string) (uint64, error) {
+		return free[path], nil
+	}
+
+	free[storage.Disks[0].Storage.BasePath] = 1 << 10
+	filenames := testutils.SaveFiles(t, storage, 50)
+	assert.Equal(t, 0, countFiles(t, storage)[0])
+
+	// NOTE: files go where they are preferred once there is space again
+	free[storage.Disks[0].Storage.BasePath] = 1 << 30
+	moved, err := storage.Rebalance()
+	assert.Nil(t, err)
+	assert.True(t, moved > 0)
+	assert.Equal(t, moved, countFiles(t, storage)[0])
+
+	for _, path := range []string{storage.Disks[1].Storage.BasePath, storage.Disks[2].Storage.BasePath} {
+		free[path] = 1 << 10
+	}
+	free[storage.Disks[0].Storage.BasePath] = 1 << 10
+	_, err = testutils.SaveFile(storage, []byte("File contents"))
+	assert.Equal(t, drweb.ErrStorageFull, errors.Cause(err))
+
+	for _, filename := range filenames {
+		_, err := storage.Load(filename)
+		assert.Nil(t, err)
+	}
+}
+
+func TestSpreadStorageFreeSpaceUnknown(t *testing.T) {
+	storage, cleanup := newSpreadStorage(t, 1, 1, 1)
+	defer cleanup()
+
+	// NOTE: missing base path is an empty disk, failing one is not written to
+	storage.FreeSpace = func(path string) (uint64, error) {
+		switch path {
+		case storage.Disks[0].Storage.BasePath:
+			return 0, errors.Wrap(os.ErrNotExist, "failed to get free space")
+		case storage.Disks[1].Storage.BasePath:
+			return 0, errors.New("input/output error")
+		}
+		return 1 << 30, nil
+	}
+
+	testutils.SaveFiles(t, storage, 30)
+	counts := countFiles(t, storage)
+	assert.True(t, counts[0] > 0)
+	assert.Equal(t, 0, counts[1])
+	assert.True(t, counts[2] > 0)
+}
+
+func TestSpreadStorageDiskAdded(t *testing.T) {
+	storage, cleanup := newSpreadStorage(t, 1, 1, 1)
+	defer cleanup()
+	added := storage.Disks[2]
+	storage.Disks = storage.Disks[:2]
+
+	filenames := testutils.SaveFiles(t, storage, 90)
+	storage.Disks = append(storage.Disks, added)
+
+	// NOTE: files are found before they are rebalanced
+	for _, filename := range filenames {
+		_, err := storage.Load(filename)
+		assert.Nil(t, err)
+	}
+
+	moved, err := storage.Rebalance()
+	assert.Nil(t, err)
+	assert.InDelta(t, 30, moved, 15)
+	assert.Equal(t, moved, countFiles(t, storage)[2])
+
+	moved, err = storage.Rebalance()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, moved)
+
+	for _, filename := range filenames {
+		disk, err := storage.Locate(filename)
+		assert.Nil(t, err)
+		assert.Nil(t, storage.Delete(filename))
+		_, err = storage.Disks[disk].Storage.Load(filename)
+		assert.True(t, os.IsNotExist(errors.Cause(err)))
+	}
+}
+
+func TestSpreadStorageDiskDrained(t *testing.T) {
+	storage, cleanup := newSpreadStorage(t, 1, 1, 1)
+	defer cleanup()
+
+	filenames := testutils.SaveFiles(t, storage, 60)
+	drained := countFiles(t, storage)[1]
+	storage.Disks[1].Weight = 0
+
+	moved, err := storage.Rebalance()
+	assert.Nil(t, err)
+	assert.Equal(t, drained, moved)
+	assert.Equal(t, 0, countFiles(t, storage)[1])
+
+	for _, filename := range filenames {
+		_, err := storage.Load(filename)
+		assert.Nil(t, err)
+	}
+}
+
+func TestParseSpreadDisks(t *testing.T) {
+	disk := func(path string) (*storages.FileSystemStorage, error) {
+		if path == "" {
+			return nil, errors.New("no path")
+		}
+		return &storages.FileSystemStorage{BasePath: path}, nil
+	}
+
+	var specs = map[string]struct {
+		Spec    string
+		Paths   []string
+		Weights []float64
+		Error   string
+	}{
+		"weighted":   {Spec: "2:/mnt/large  /mnt/small 0:/mnt/old", Paths: []string{"/mnt/large", "/mnt/small", "/mnt/old"}, Weights: []float64{2, 1, 0}},
+		"colon path": {Spec: "c:/files", Paths: []string{"c:/files"}, Weights: []float64{1}},
+		"empty":      {Spec: "", Error: "no disks given"},
+		"negative":   {Spec: "-1:/mnt/large", Error: "should have a non-negative weight"},
+		"no path":    {Spec: "2:", Error: "failed to create storage of disk '2:'"},
+	}
+
+	for testName, testSpec := range specs {
+		t.Run(testName, func(t *testing.T) {
+			disks, err := storages.ParseSpreadDisks(testSpec.Spec, disk)
+			if testSpec.Error != "" {
+				assert.NotNil(t, err)
+				assert.Contains(t, err.Error(), testSpec.Error)
+				return
+			}
+
+			assert.Nil(t, err)
+			paths, weights := []string{}, []float64{}
+			for _, disk := range disks {
+				paths = append(paths, disk.Storage.BasePath)
+				weights = append(weights, disk.Weight)
+			}
+			assert.Equal(t, testSpec.Paths, paths)
+			assert.Equal(t, testSpec.Weights, weights)
+		})
+	}
+}
+
+func TestSpreadStorageSuite(t *testing.T) {
+	testStorageSuite(t, func(t *testing.T) (drweb.WalkableStorage, func()) {
+		return newSpreadStorage(t, 1, 2, 1)
+	})
+}
@@ -0,0 +1,572 @@
+package storages
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+)
+
+// NOTE: the driver is registered by the pure Go modernc.org/sqlite,
+// which is only built in with the "sqlite" build tag
+const sqliteDriver = "sqlite"
+const sqliteWalkPage = 1000
+
+var sqliteSchema = []string{
+	"CREATE TABLE IF NOT EXISTS files (filename TEXT PRIMARY KEY, upload_id BLOB NOT NULL, size INTEGER NOT NULL, chunk_size INTEGER NOT NULL)",
+	"CREATE TABLE IF NOT EXISTS chunks (upload_id BLOB NOT NULL, idx INTEGER NOT NULL, data BLOB NOT NULL, PRIMARY KEY (upload_id, idx))",
+	"CREATE TABLE IF NOT EXISTS metadata (filename TEXT PRIMARY KEY, document TEXT NOT NULL)",
+}
+
+// SQLiteStorage keeps files along with their metadata in a single SQLite database,
+// which makes the whole store one portable file.
+// NOTE: database/sql gives no incremental blob handle, so files are split into
+// chunks of ChunkSize, which are written and read one at a time.
+// The database is in WAL mode, so readers are not blocked by a writer,
+// and uploads are written chunk by chunk under a random id, having their name
+// linked to that id once hashed and inspected.
+type SQLiteStorage struct {
+	Path      string
+	ChunkSize int
+	db        *sql.DB
+	mutex     sync.RWMutex
+}
+
+// sqliteEntry heads a stored file, which refers to chunks by upload id and chunk index.
+type sqliteEntry struct {
+	id        []byte
+	size      int64
+	chunkSize int64
+}
+
+func (s *SQLiteStorage) Open() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	registered := false
+	for _, driver := range sql.Drivers() {
+		registered = registered || driver == sqliteDriver
+	}
+	if !registered {
+		return errors.New("sqlite driver is not built in, build with '-tags sqlite'")
+	}
+
+	// NOTE: pragmas are applied to every connection of the pool
+	dsn := "file:" + s.Path + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate"
+	db, err := sql.Open(sqliteDriver, dsn)
+	if err != nil {
+		return errors.Wrap(err, "failed to open database")
+	}
+
+	for _, statement := range sqliteSchema {
+		if _, err = db.Exec(statement); err != nil {
+			db.Close()
+			return errors.Wrap(err, "failed to create tables")
+		}
+	}
+
+	s.db = db
+	return nil
+}
+
+func (s *SQLiteStorage) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.db == nil {
+		return nil
+	}
+
+	err := s.db.Close()
+	s.db = nil
+	return errors.Wrap(err, "failed to close database")
+}
+
+func (s *SQLiteStorage) chunkSize() int64 {
+	if s.ChunkSize < 1 {
+		return 64 << 10
+	}
+	return int64(s.ChunkSize)
+}
+
+func (s *SQLiteStorage) database() (*sql.DB, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if s.db == nil {
+		return nil, errors.New("storage is closed")
+	}
+	return s.db, nil
+}
+
+func (s *SQLiteStorage) Save(file *drweb.FileCreateRequest) (string, error) {
+	var filename string
+	var err error
+
+	if file.NameGenerator == nil {
+		return filename, errors.New("failed to save file without name generator")
+	}
+
+	id := make([]byte, 16)
+	if _, err = rand.Read(id); err != nil {
+		return filename, errors.Wrap(err, "failed to generate chunks id")
+	}
+
+	db, err := s.database()
+	if err != nil {
+		return filename, errors.Wrap(err, "failed to save file")
+	}
+
+	upload := &sqliteUpload{db: db, entry: &sqliteEntry{id: id, chunkSize: s.chunkSize()}}
+	defer upload.discard()
+
+	writers := []io.Writer{upload}
+	for _, inspector := range file.Inspectors {
+		writers = append(writers, inspector)
+	}
+
+	filenameReader := io.TeeReader(file.Body, io.MultiWriter(writers...))
+	if filename, err = file.NameGenerator.Generate(filenameReader); err != nil {
+		return filename, errors.Wrap(err, "failed to generate filename")
+	}
+
+	if err = inspect(file, filename); err != nil {
+		return filename, err
+	}
+
+	return filename, errors.Wrap(upload.link(filename), "failed to write to storage")
+}
+
+func (s *SQLiteStorage) Load(filename string) (*drweb.File, error) {
+	entry, err := s.entry(filename)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get file entry")
+	}
+
+	return &drweb.File{Body: &sqliteReader{storage: s, entry: entry}, Size: entry.size}, nil
+}
+
+func (s *SQLiteStorage) Delete(filename string) error {
+	db, err := s.database()
+	if err != nil {
+		return errors.Wrap(err, "failed to delete file")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "failed to delete file")
+	}
+	defer tx.Rollback()
+
+	var id []byte
+	if err = tx.QueryRow("SELECT upload_id FROM files WHERE filename = ?", filename).Scan(&id); err != nil {
+		if err == sql.ErrNoRows {
+			err = os.ErrNotExist
+		}
+		return errors.Wrap(err, "failed to delete file")
+	}
+
+	if _, err = tx.Exec("DELETE FROM chunks WHERE upload_id = ?", id); err != nil {
+		return errors.Wrap(err, "failed to delete file")
+	}
+	if _, err = tx.Exec("DELETE FROM files WHERE filename = ?", filename); err != nil {
+		return errors.Wrap(err, "failed to delete file")
+	}
+
+	return errors.Wrap(tx.Commit(), "failed to delete file")
+}
+
+// Walk calls fn for every stored file in lexical order of their names.
+// NOTE: names are taken page by page, so that fn is free to use the storage.
+func (s *SQLiteStorage) Walk(fn func(filename string) error) error {
+	last := ""
+
+	for {
+		page, err := s.page(last)
+		if err != nil {
+			return errors.Wrap(err, "failed to walk storage")
+		}
+
+		for _, filename := range page {
+			if err = fn(filename); err != nil {
+				return err
+			}
+		}
+
+		if len(page) < sqliteWalkPage {
+			return nil
+		}
+		last = page[len(page)-1]
+	}
+}
+
+func (s *SQLiteStorage) page(last string) ([]string, error) {
+	db, err := s.database()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query("SELECT filename FROM files WHERE filename > ? ORDER BY filename LIMIT ?", last, sqliteWalkPage)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := []string{}
+	for rows.Next() {
+		var filename string
+		if err = rows.Scan(&filename); err != nil {
+			return nil, err
+		}
+		page = append(page, filename)
+	}
+
+	return page, rows.Err()
+}
+
+// Vacuum rebuilds the database, giving space of deleted files back to the disk.
+// It returns database sizes before and after.
+// NOTE: uploads wait for it to finish, while files may still be read.
+func (s *SQLiteStorage) Vacuum() (int64, int64, error) {
+	db, err := s.database()
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "failed to vacuum database")
+	}
+
+	before, err := s.size(db)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if _, err = db.Exec("VACUUM"); err != nil {
+		return 0, 0, errors.Wrap(err, "failed to vacuum database")
+	}
+
+	after, err := s.size(db)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return before, after, nil
+}
+
+// NOTE: pages written to the log are moved into the database first,
+// so that its file tells its whole size
+func (s *SQLiteStorage) size(db *sql.DB) (int64, error) {
+	if _, err := db.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		return 0, errors.Wrap(err, "failed to checkpoint database")
+	}
+
+	info, err := os.Stat(s.Path)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get database info")
+	}
+	return info.Size(), nil
+}
+
+// Backup writes a consistent copy of the database to path, which should not exist yet.
+// NOTE: the storage stays available meanwhile, the copy is vacuumed as well.
+func (s *SQLiteStorage) Backup(path string) error {
+	db, err := s.database()
+	if err != nil {
+		return errors.Wrap(err, "failed to back up database")
+	}
+
+	if _, err = os.Stat(path); err == nil {
+		return errors.Errorf("backup '%s' already exists", path)
+	}
+
+	_, err = db.Exec("VACUUM INTO ?", path)
+	return errors.Wrap(err, "failed to back up database")
+}
+
+func (s *SQLiteStorage) entry(filename string) (*sqliteEntry, error) {
+	db, err := s.database()
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &sqliteEntry{}
+	err = db.QueryRow("SELECT upload_id, size, chunk_size FROM files WHERE filename = ?", filename).Scan(&entry.id, &entry.size, &entry.chunkSize)
+	if err == sql.ErrNoRows {
+		return nil, os.ErrNotExist
+	}
+	return entry, err
+}
+
+func (s *SQLiteStorage) chunk(id []byte, index int64) ([]byte, error) {
+	db, err := s.database()
+	if err != nil {
+		return nil, err
+	}
+
+	var chunk []byte
+	err = db.QueryRow("SELECT data FROM chunks WHERE upload_id = ? AND idx = ?", id, index).Scan(&chunk)
+	if err == sql.ErrNoRows {
+		return nil, errors.Errorf("chunk %d is missing", index)
+	}
+	return chunk, err
+}
+
+// sqliteUpload buffers written contents, putting them to chunks once they
+// outgrow a single one.
+type sqliteUpload struct {
+	db     *sql.DB
+	entry  *sqliteEntry
+	buffer []byte
+	chunks int64
+	linked bool
+}
+
+func (u *sqliteUpload) Write(p []byte) (int, error) {
+	u.buffer = append(u.buffer, p...)
+	u.entry.size += int64(len(p))
+
+	for int64(len(u.buffer)) >= u.entry.chunkSize {
+		if err := u.flush(u.buffer[:u.entry.chunkSize]); err != nil {
+			return 0, err
+		}
+		u.buffer = u.buffer[:copy(u.buffer, u.buffer[u.entry.chunkSize:])]
+	}
+
+	return len(p), nil
+}
+
+func (u *sqliteUpload) flush(chunk []byte) error {
+	_, err := u.db.Exec("INSERT INTO chunks (upload_id, idx, data) VALUES (?, ?, ?)", u.entry.id, u.chunks, chunk)
+	if err != nil {
+		return errors.Wrap(err, "failed to write chunk")
+	}
+
+	u.chunks++
+	return nil
+}
+
+func (u *sqliteUpload) link(filename string) error {
+	if len(u.buffer) > 0 {
+		if err := u.flush(u.buffer); err != nil {
+			return err
+		}
+	}
+
+	// NOTE: same contents are stored already, chunks of ours get discarded
+	result, err := u.db.Exec(
+		"INSERT OR IGNORE INTO files (filename, upload_id, size, chunk_size) VALUES (?, ?, ?, ?)",
+		filename, u.entry.id, u.entry.size, u.entry.chunkSize,
+	)
+	if err != nil {
+		return err
+	}
+
+	linked, err := result.RowsAffected()
+	u.linked = linked > 0
+	return err
+}
+
+func (u *sqliteUpload) discard() error {
+	if u.linked || u.chunks == 0 {
+		return nil
+	}
+
+	_, err := u.db.Exec("DELETE FROM chunks WHERE upload_id = ?", u.entry.id)
+	return err
+}
+
+// sqliteReader streams a file chunk by chunk, keeping the last chunk read.
+type sqliteReader struct {
+	storage *SQLiteStorage
+	entry   *sqliteEntry
+	offset  int64
+	mutex   sync.Mutex
+	index   int64
+	chunk   []byte
+}
+
+func (r *sqliteReader) Read(p []byte) (int, error) {
+	n, err := r.ReadAt(p, r.offset)
+	r.offset += int64(n)
+
+	if n > 0 && err == io.EOF {
+		return n, nil
+	}
+	return n, err
+}
+
+func (r *sqliteReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	n := 0
+	for n < len(p) {
+		if off >= r.entry.size {
+			return n, io.EOF
+		}
+
+		index := off / r.entry.chunkSize
+		if r.chunk == nil || r.index != index {
+			chunk, err := r.storage.chunk(r.entry.id, index)
+			if err != nil {
+				return n, errors.Wrap(err, "failed to read chunk")
+			}
+			r.chunk, r.index = chunk, index
+		}
+
+		copied := copy(p[n:], r.chunk[off-index*r.entry.chunkSize:])
+		n += copied
+		off += int64(copied)
+	}
+
+	return n, nil
+}
+
+func (r *sqliteReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.entry.size
+	default:
+		return r.offset, errors.New("invalid whence")
+	}
+
+	if offset < 0 {
+		return r.offset, errors.New("negative position")
+	}
+
+	r.offset = offset
+	return offset, nil
+}
+
+func (r *sqliteReader) Close() error {
+	return nil
+}
+
+// SQLiteMetadataStore keeps metadata of every file as a json document
+// in the database of SQLiteStorage, next to file contents.
+type SQLiteMetadataStore struct {
+	Storage *SQLiteStorage
+	mutex   sync.Mutex
+}
+
+func (s *SQLiteMetadataStore) Get(filename string) (*drweb.Metadata, error) {
+	db, err := s.Storage.database()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read metadata")
+	}
+
+	return readSQLiteMetadata(db.QueryRow("SELECT document FROM metadata WHERE filename = ?", filename))
+}
+
+// Update applies fn to stored metadata, or to a blank one if there is none yet.
+func (s *SQLiteMetadataStore) Update(filename string, fn func(metadata *drweb.Metadata) error) error {
+	var metadata *drweb.Metadata
+	var contents []byte
+
+	// NOTE: updates of a single process do not have to retry on a busy database
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	db, err := s.Storage.database()
+	if err != nil {
+		return errors.Wrap(err, "failed to write metadata")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "failed to write metadata")
+	}
+	defer tx.Rollback()
+
+	if metadata, err = readSQLiteMetadata(tx.QueryRow("SELECT document FROM metadata WHERE filename = ?", filename)); err != nil {
+		if !os.IsNotExist(errors.Cause(err)) {
+			return err
+		}
+		metadata = &drweb.Metadata{Filename: filename}
+	}
+
+	if err = fn(metadata); err != nil {
+		return err
+	}
+
+	if contents, err = json.Marshal(metadata); err != nil {
+		return errors.Wrap(err, "failed to encode metadata")
+	}
+
+	if _, err = tx.Exec("INSERT OR REPLACE INTO metadata (filename, document) VALUES (?, ?)", filename, string(contents)); err != nil {
+		return errors.Wrap(err, "failed to write metadata")
+	}
+
+	return errors.Wrap(tx.Commit(), "failed to write metadata")
+}
+
+func (s *SQLiteMetadataStore) Delete(filename string) error {
+	db, err := s.Storage.database()
+	if err != nil {
+		return errors.Wrap(err, "failed to delete metadata")
+	}
+
+	result, err := db.Exec("DELETE FROM metadata WHERE filename = ?", filename)
+	if err != nil {
+		return errors.Wrap(err, "failed to delete metadata")
+	}
+
+	deleted, err := result.RowsAffected()
+	if err == nil && deleted == 0 {
+		err = os.ErrNotExist
+	}
+	return errors.Wrap(err, "failed to delete metadata")
+}
+
+func (s *SQLiteMetadataStore) List() ([]*drweb.Metadata, error) {
+	db, err := s.Storage.database()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list metadata")
+	}
+
+	rows, err := db.Query("SELECT document FROM metadata ORDER BY filename")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list metadata")
+	}
+	defer rows.Close()
+
+	list := []*drweb.Metadata{}
+	for rows.Next() {
+		metadata, err := readSQLiteMetadata(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, metadata)
+	}
+
+	return list, errors.Wrap(rows.Err(), "failed to list metadata")
+}
+
+func readSQLiteMetadata(row interface {
+	Scan(dest ...interface{}) error
+}) (*drweb.Metadata, error) {
+	var metadata drweb.Metadata
+	var contents string
+
+	if err := row.Scan(&contents); err != nil {
+		if err == sql.ErrNoRows {
+			err = os.ErrNotExist
+		}
+		return nil, errors.Wrap(err, "failed to read metadata")
+	}
+
+	if err := json.Unmarshal([]byte(contents), &metadata); err != nil {
+		return nil, errors.Wrap(err, "failed to decode metadata")
+	}
+
+	return &metadata, nil
+}
@@ -0,0 +1,178 @@
+//go:build sqlite
+// +build sqlite
+
+package storages_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+	"github.com/twonegatives/drweb_challenge/pkg/namegenerators"
+	"github.com/twonegatives/drweb_challenge/pkg/storages"
+	_ "modernc.org/sqlite"
+)
+
+func newSQLiteStorage(t *testing.T) (*storages.SQLiteStorage, func()) {
+	base, err := ioutil.TempDir("../../tmp", "sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	storage := &storages.SQLiteStorage{Path: path.Join(base, "files.sqlite"), ChunkSize: 1 << 16}
+	if err = storage.Open(); err != nil {
+		os.RemoveAll(base)
+		t.Fatal(err)
+	}
+	return storage, func() {
+		storage.Close()
+		os.RemoveAll(base)
+	}
+}
+
+func TestSQLiteStorageSuite(t *testing.T) {
+	testStorageSuite(t, func(t *testing.T) (drweb.WalkableStorage, func()) {
+		return newSQLiteStorage(t)
+	})
+}
+
+func TestSQLiteStorageVacuum(t *testing.T) {
+	storage, cleanup := newSQLiteStorage(t)
+	defer cleanup()
+
+	filenames := []string{}
+	for i := 0; i < 10; i++ {
+		filename, err := storage.Save(&drweb.FileCreateRequest{
+			Body:          ioutil.NopCloser(bytes.NewReader(bytes.Repeat([]byte(fmt.Sprintf("file #%d", i)), 100000))),
+			NameGenerator: &namegenerators.SHA256{},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		filenames = append(filenames, filename)
+	}
+
+	for _, filename := range filenames[1:] {
+		if err := storage.Delete(filename); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// NOTE: files being read are not affected by vacuum
+	file, err := storage.Load(filenames[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	before, after, err := storage.Vacuum()
+	assert.Nil(t, err)
+	assert.True(t, after < before/5, "vacuumed from %d to %d bytes", before, after)
+
+	contents, err := ioutil.ReadAll(file.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, bytes.Repeat([]byte("file #0"), 100000), contents)
+}
+
+func TestSQLiteStorageBackup(t *testing.T) {
+	storage, cleanup := newSQLiteStorage(t)
+	defer cleanup()
+
+	contents := bytes.Repeat([]byte("0123456789abcdef"), 10000)
+	filename, err := storage.Save(&drweb.FileCreateRequest{
+		Body:          ioutil.NopCloser(bytes.NewReader(contents)),
+		NameGenerator: &namegenerators.SHA256{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metadata := &storages.SQLiteMetadataStore{Storage: storage}
+	if err = metadata.Update(filename, func(m *drweb.Metadata) error {
+		m.Size = int64(len(contents))
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	backupPath := path.Join(path.Dir(storage.Path), "backup.sqlite")
+	assert.Nil(t, storage.Backup(backupPath))
+	assert.NotNil(t, storage.Backup(backupPath))
+
+	backup := &storages.SQLiteStorage{Path: backupPath}
+	if err = backup.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer backup.Close()
+
+	file, err := backup.Load(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	loaded, err := ioutil.ReadAll(file.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, contents, loaded)
+
+	backedUp, err := (&storages.SQLiteMetadataStore{Storage: backup}).Get(filename)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(len(contents)), backedUp.Size)
+}
+
+func TestSQLiteMetadataStore(t *testing.T) {
+	storage, cleanup := newSQLiteStorage(t)
+	defer cleanup()
+	metadata := &storages.SQLiteMetadataStore{Storage: storage}
+
+	_, err := metadata.Get("abcdef")
+	assert.True(t, os.IsNotExist(errors.Cause(err)))
+
+	for _, filename := range []string{"bcdef0", "abcdef"} {
+		err = metadata.Update(filename, func(m *drweb.Metadata) error {
+			m.Tags = append(m.Tags, "tagged")
+			return nil
+		})
+		assert.Nil(t, err)
+	}
+
+	failure := errors.New("failed")
+	assert.Equal(t, failure, metadata.Update("abcdef", func(m *drweb.Metadata) error {
+		m.Tags = append(m.Tags, "discarded")
+		return failure
+	}))
+
+	stored, err := metadata.Get("abcdef")
+	assert.Nil(t, err)
+	assert.Equal(t, "abcdef", stored.Filename)
+	assert.Equal(t, []string{"tagged"}, stored.Tags)
+
+	list, err := metadata.List()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(list))
+	assert.Equal(t, "abcdef", list[0].Filename)
+
+	assert.Nil(t, metadata.Delete("abcdef"))
+	assert.True(t, os.IsNotExist(errors.Cause(metadata.Delete("abcdef"))))
+	_, err = metadata.Get("abcdef")
+	assert.True(t, os.IsNotExist(errors.Cause(err)))
+}
+
+func TestSQLiteStorageClosed(t *testing.T) {
+	storage := &storages.SQLiteStorage{}
+
+	_, err := storage.Save(&drweb.FileCreateRequest{NameGenerator: &namegenerators.SHA256{}})
+	assert.NotNil(t, err)
+	_, err = storage.Load("abcdef")
+	assert.NotNil(t, err)
+	assert.NotNil(t, storage.Delete("abcdef"))
+	_, _, err = storage.Vacuum()
+	assert.NotNil(t, err)
+	assert.NotNil(t, storage.Backup("backup.sqlite"))
+}
@@ -0,0 +1,297 @@
+package storages
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+)
+
+const (
+	TierHot  = "hot"
+	TierCold = "cold"
+)
+
+// NOTE: reads are recorded at most that often, sparing metadata writes
+const accessResolution = time.Hour
+
+// TieredStorage keeps files being read in Hot storage, e.g. local SSD,
+// and the rest in Cold one, e.g. object storage. Uploads go to Hot, files
+// not read for MaxAge are moved to Cold by Demote and are moved back once
+// read, before they are served if SyncPromotion is set or in background.
+// NOTE: reads are recorded in metadata along with the tier files are in,
+// rather than relying on atime, which is mostly turned off. Moves and
+// deletions of a file never interleave, so that deleted files are not brought back.
+type TieredStorage struct {
+	Hot           drweb.WalkableStorage
+	Cold          drweb.WalkableStorage
+	Metadata      drweb.MetadataStore
+	MaxAge        time.Duration
+	SyncPromotion bool
+	NameGenerator drweb.FileNameGenerator
+
+	mutex  sync.Mutex
+	locked map[string]chan struct{}
+}
+
+// lock takes the file over for a move or a deletion. Unless wait is set,
+// it gives up on a file which is taken over already.
+func (s *TieredStorage) lock(filename string, wait bool) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.locked == nil {
+		s.locked = map[string]chan struct{}{}
+	}
+
+	for {
+		done, ok := s.locked[filename]
+		if !ok {
+			break
+		}
+		if !wait {
+			return false
+		}
+
+		s.mutex.Unlock()
+		<-done
+		s.mutex.Lock()
+	}
+
+	s.locked[filename] = make(chan struct{})
+	return true
+}
+
+func (s *TieredStorage) unlock(filename string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	close(s.locked[filename])
+	delete(s.locked, filename)
+}
+
+func (s *TieredStorage) Save(file *drweb.FileCreateRequest) (string, error) {
+	filename, err := s.Hot.Save(file)
+	if err != nil {
+		return filename, err
+	}
+
+	// NOTE: uploaded again while being cold
+	if err = s.Cold.Delete(filename); err != nil && !os.IsNotExist(errors.Cause(err)) {
+		log.WithError(err).WithField("filename", filename).Warn("failed to delete cold copy of file")
+	}
+
+	if file.Metadata == nil {
+		file.Metadata = &drweb.Metadata{}
+	}
+	now := time.Now().UTC()
+	file.Metadata.Tier = TierHot
+	file.Metadata.AccessedAt = &now
+	return filename, nil
+}
+
+// load reads file out of either tier, telling which one.
+func (s *TieredStorage) load(filename string) (*drweb.File, string, error) {
+	file, err := s.Hot.Load(filename)
+	if err == nil || !os.IsNotExist(errors.Cause(err)) {
+		return file, TierHot, err
+	}
+
+	file, err = s.Cold.Load(filename)
+	return file, TierCold, err
+}
+
+func (s *TieredStorage) Load(filename string) (*drweb.File, error) {
+	file, tier, err := s.load(filename)
+	if err != nil {
+		return nil, err
+	}
+	s.touch(filename)
+
+	if tier == TierHot {
+		return file, nil
+	}
+	if !s.SyncPromotion {
+		s.promoteLater(filename)
+		return file, nil
+	}
+
+	file.Close()
+	s.lock(filename, true)
+	if err = s.move(filename, s.Cold, s.Hot, TierHot); err != nil {
+		log.WithError(err).WithField("filename", filename).Warn("failed to promote file")
+	}
+	s.unlock(filename)
+
+	file, _, err = s.load(filename)
+	return file, err
+}
+
+// Delete removes the file out of both tiers, once its move in progress is over.
+func (s *TieredStorage) Delete(filename string) error {
+	found := false
+
+	s.lock(filename, true)
+	defer s.unlock(filename)
+
+	for _, tier := range []drweb.Storage{s.Hot, s.Cold} {
+		err := tier.Delete(filename)
+		if err != nil && !os.IsNotExist(errors.Cause(err)) {
+			return err
+		}
+		found = found || err == nil
+	}
+
+	if !found {
+		return errors.Wrap(os.ErrNotExist, "failed to find file")
+	}
+	return nil
+}
+
+// Walk calls fn for every stored file in lexical order of their names.
+func (s *TieredStorage) Walk(fn func(filename string) error) error {
+	return mergeWalks([]drweb.WalkableStorage{s.Hot, s.Cold}, fn)
+}
+
+// Untracked gives the storage reading files without recording reads or
+// promoting files, for background jobs going through every file.
+func (s *TieredStorage) Untracked() drweb.WalkableStorage {
+	return &untrackedTiers{s}
+}
+
+type untrackedTiers struct {
+	*TieredStorage
+}
+
+func (u *untrackedTiers) Load(filename string) (*drweb.File, error) {
+	file, _, err := u.load(filename)
+	return file, err
+}
+
+// update changes metadata of the file, unless it has none.
+func (s *TieredStorage) update(filename string, fn func(metadata *drweb.Metadata) bool) {
+	metadata, err := s.Metadata.Get(filename)
+	if err == nil && !fn(metadata) {
+		return
+	}
+	if err == nil {
+		err = s.Metadata.Update(filename, func(metadata *drweb.Metadata) error {
+			fn(metadata)
+			return nil
+		})
+	}
+	if err != nil && !os.IsNotExist(errors.Cause(err)) {
+		log.WithError(err).WithField("filename", filename).Warn("failed to update file tier")
+	}
+}
+
+func (s *TieredStorage) touch(filename string) {
+	now := time.Now().UTC()
+	s.update(filename, func(metadata *drweb.Metadata) bool {
+		if metadata.AccessedAt != nil && now.Sub(*metadata.AccessedAt) < accessResolution {
+			return false
+		}
+		metadata.AccessedAt = &now
+		return true
+	})
+}
+
+// move copies file to another tier, checking it on the way, and deletes the original.
+// NOTE: should be called with the file locked
+func (s *TieredStorage) move(filename string, from, to drweb.Storage, tier string) error {
+	if err := copyVerified(from, to, filename, s.NameGenerator); err != nil {
+		return err
+	}
+
+	// NOTE: copy is taken back if the original is gone meanwhile, e.g. deleted past the storage
+	err := from.Delete(filename)
+	if os.IsNotExist(errors.Cause(err)) {
+		to.Delete(filename)
+		return err
+	}
+
+	s.update(filename, func(metadata *drweb.Metadata) bool {
+		metadata.Tier = tier
+		return true
+	})
+	return err
+}
+
+// promoteLater moves the file to Hot in background, unless it is being
+// moved or deleted already.
+func (s *TieredStorage) promoteLater(filename string) {
+	if !s.lock(filename, false) {
+		return
+	}
+
+	go func() {
+		defer s.unlock(filename)
+
+		if err := s.move(filename, s.Cold, s.Hot, TierHot); err != nil && !os.IsNotExist(errors.Cause(err)) {
+			log.WithError(err).WithField("filename", filename).Warn("failed to promote file")
+		}
+	}()
+}
+
+// Demote moves files not read for MaxAge to Cold, telling how many were moved.
+// NOTE: files without metadata are left alone, as it is not known when they were read.
+func (s *TieredStorage) Demote() (int, error) {
+	deadline := time.Now().Add(-s.MaxAge)
+	demoted := 0
+
+	err := s.Hot.Walk(func(filename string) error {
+		metadata, err := s.Metadata.Get(filename)
+		if err != nil {
+			if !os.IsNotExist(errors.Cause(err)) {
+				log.WithError(err).WithField("filename", filename).Warn("failed to get file metadata")
+			}
+			return nil
+		}
+
+		accessed := metadata.CreatedAt
+		if metadata.AccessedAt != nil {
+			accessed = *metadata.AccessedAt
+		}
+		if accessed.IsZero() || accessed.After(deadline) {
+			return nil
+		}
+
+		// NOTE: files being promoted or deleted are read right now
+		if !s.lock(filename, false) {
+			return nil
+		}
+		defer s.unlock(filename)
+
+		if err = s.move(filename, s.Hot, s.Cold, TierCold); err != nil {
+			log.WithError(err).WithField("filename", filename).Warn("failed to demote file")
+			return nil
+		}
+		demoted++
+		return nil
+	})
+
+	return demoted, errors.Wrap(err, "failed to demote files")
+}
+
+// Watch demotes files every interval until stopped.
+func (s *TieredStorage) Watch(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if demoted, err := s.Demote(); err != nil {
+			log.WithError(err).Error("failed to demote files")
+		} else if demoted > 0 {
+			log.WithField("files", demoted).Info("files demoted")
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
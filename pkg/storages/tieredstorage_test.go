@@ -0,0 +1,209 @@
+package storages_test
+
+import (
+	"io/ioutil"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+	"github.com/twonegatives/drweb_challenge/pkg/namegenerators"
+	"github.com/twonegatives/drweb_challenge/pkg/storages"
+	"github.com/twonegatives/drweb_challenge/pkg/testutils"
+)
+
+func newTieredStorage(t *testing.T) (*storages.TieredStorage, func()) {
+	disks, cleanup := testutils.GenerateDisks(t, 2)
+	metadata, cleanupMetadata := testutils.GenerateMetadataStore(t)
+
+	storage := &storages.TieredStorage{
+		Hot:           disks[0],
+		Cold:          disks[1],
+		Metadata:      metadata,
+		MaxAge:        30 * 24 * time.Hour,
+		NameGenerator: &namegenerators.SHA256{},
+	}
+	return storage, func() {
+		cleanup()
+		cleanupMetadata()
+	}
+}
+
+// accessedAgo pretends the file was last read some time ago.
+func accessedAgo(t *testing.T, storage *storages.TieredStorage, filename string, ago time.Duration) {
+	accessed := time.Now().UTC().Add(-ago)
+	if err := storage.Metadata.Update(filename, func(metadata *drweb.Metadata) error {
+		metadata.AccessedAt = &accessed
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func tier(t *testing.T, storage *storages.TieredStorage, filename string) string {
+	metadata, err := storage.Metadata.Get(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return metadata.Tier
+}
+
+func TestTieredStorageDemote(t *testing.T) {
+	storage, cleanup := newTieredStorage(t)
+	defer cleanup()
+	indexed := &storages.IndexedStorage{Storage: storage, Metadata: storage.Metadata}
+
+	filenames := testutils.SaveFiles(t, indexed, 3)
+	for _, filename := range filenames {
+		assert.Equal(t, storages.TierHot, tier(t, storage, filename))
+	}
+	accessedAgo(t, storage, filenames[0], 40*24*time.Hour)
+	accessedAgo(t, storage, filenames[1], 20*24*time.Hour)
+
+	// NOTE: files without metadata are never demoted
+	untracked, _ := testutils.SaveFile(storage, []byte("File contents"))
+
+	demoted, err := storage.Demote()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, demoted)
+	assert.Equal(t, storages.TierCold, tier(t, storage, filenames[0]))
+	assert.Equal(t, storages.TierHot, tier(t, storage, filenames[1]))
+
+	_, err = storage.Hot.Load(filenames[0])
+	assert.True(t, os.IsNotExist(errors.Cause(err)))
+	_, err = storage.Cold.Load(filenames[0])
+	assert.Nil(t, err)
+	_, err = storage.Hot.Load(untracked)
+	assert.Nil(t, err)
+
+	demoted, err = storage.Demote()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, demoted)
+}
+
+func TestTieredStorageDemoteCorrupt(t *testing.T) {
+	storage, cleanup := newTieredStorage(t)
+	defer cleanup()
+	indexed := &storages.IndexedStorage{Storage: storage, Metadata: storage.Metadata}
+
+	filename := testutils.SaveFiles(t, indexed, 1)[0]
+	accessedAgo(t, storage, filename, 40*24*time.Hour)
+	path, _ := storage.Hot.(*storages.FileSystemStorage).FilePathGenerator.Generate(filename)
+	ioutil.WriteFile(path, []byte("file #O"), 0700)
+
+	// NOTE: copies not matching their names are dropped, originals are kept
+	demoted, err := storage.Demote()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, demoted)
+	assert.Equal(t, storages.TierHot, tier(t, storage, filename))
+	assert.Equal(t, []byte("file #O"), testutils.LoadFile(t, storage.Hot, filename))
+	assert.Nil(t, storage.Cold.Walk(func(filename string) error {
+		t.Errorf("unexpected cold file '%s'", filename)
+		return nil
+	}))
+}
+
+func TestTieredStoragePromote(t *testing.T) {
+	for _, sync := range []bool{true, false} {
+		storage, cleanup := newTieredStorage(t)
+		defer cleanup()
+		storage.SyncPromotion = sync
+		indexed := &storages.IndexedStorage{Storage: storage, Metadata: storage.Metadata}
+
+		filename := testutils.SaveFiles(t, indexed, 1)[0]
+		accessedAgo(t, storage, filename, 40*24*time.Hour)
+		if _, err := storage.Demote(); err != nil {
+			t.Fatal(err)
+		}
+
+		// NOTE: background jobs neither record reads nor promote files
+		assert.Equal(t, []byte("file #0"), testutils.LoadFile(t, storage.Untracked(), filename))
+		assert.Equal(t, storages.TierCold, tier(t, storage, filename))
+
+		assert.Equal(t, []byte("file #0"), testutils.LoadFile(t, storage, filename))
+		if !sync {
+			deadline := time.Now().Add(5 * time.Second)
+			for time.Now().Before(deadline) && tier(t, storage, filename) != storages.TierHot {
+				time.Sleep(10 * time.Millisecond)
+			}
+		}
+
+		metadata, err := storage.Metadata.Get(filename)
+		assert.Nil(t, err)
+		assert.Equal(t, storages.TierHot, metadata.Tier, "sync %v", sync)
+		assert.WithinDuration(t, time.Now(), *metadata.AccessedAt, time.Minute)
+
+		_, err = storage.Cold.Load(filename)
+		assert.True(t, os.IsNotExist(errors.Cause(err)))
+		assert.Equal(t, []byte("file #0"), testutils.LoadFile(t, storage.Hot, filename))
+	}
+}
+
+func TestTieredStorageDeletedMeanwhile(t *testing.T) {
+	for _, pastStorage := range []bool{false, true} {
+		storage, cleanup := newTieredStorage(t)
+		defer cleanup()
+		indexed := &storages.IndexedStorage{Storage: storage, Metadata: storage.Metadata}
+
+		filename := testutils.SaveFiles(t, indexed, 1)[0]
+		accessedAgo(t, storage, filename, 40*24*time.Hour)
+		if _, err := storage.Demote(); err != nil {
+			t.Fatal(err)
+		}
+
+		hot := storage.Hot
+		held := &heldStorage{WalkableStorage: hot, release: make(chan struct{})}
+		storage.Hot = held
+
+		assert.Equal(t, []byte("file #0"), testutils.LoadFile(t, storage, filename))
+		assert.True(t, eventually(func() bool { return atomic.LoadInt32(&held.saves) == 1 }))
+
+		// NOTE: deletion waits for the promotion in progress, and the promotion
+		// takes its copy back once the original is gone past the storage
+		deleted := make(chan error)
+		go func() {
+			if pastStorage {
+				deleted <- storage.Cold.Delete(filename)
+			} else {
+				deleted <- storage.Delete(filename)
+			}
+		}()
+		time.Sleep(50 * time.Millisecond)
+		close(held.release)
+		assert.Nil(t, <-deleted)
+
+		storage.Hot = hot
+		assert.True(t, eventually(func() bool {
+			_, err := storage.Load(filename)
+			return os.IsNotExist(errors.Cause(err))
+		}), "past storage %v", pastStorage)
+		_, err := hot.Load(filename)
+		assert.True(t, os.IsNotExist(errors.Cause(err)))
+	}
+}
+
+func TestTieredStorageReupload(t *testing.T) {
+	storage, cleanup := newTieredStorage(t)
+	defer cleanup()
+	indexed := &storages.IndexedStorage{Storage: storage, Metadata: storage.Metadata}
+
+	filename := testutils.SaveFiles(t, indexed, 1)[0]
+	accessedAgo(t, storage, filename, 40*24*time.Hour)
+	if _, err := storage.Demote(); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []string{filename}, testutils.SaveFiles(t, indexed, 1))
+	assert.Equal(t, storages.TierHot, tier(t, storage, filename))
+	_, err := storage.Cold.Load(filename)
+	assert.True(t, os.IsNotExist(errors.Cause(err)))
+}
+
+func TestTieredStorageSuite(t *testing.T) {
+	testStorageSuite(t, func(t *testing.T) (drweb.WalkableStorage, func()) {
+		return newTieredStorage(t)
+	})
+}
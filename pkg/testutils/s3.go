@@ -0,0 +1,308 @@
+package testutils
+
+import (
+	"crypto/md5"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// FakeS3 is an in-process S3 server, good enough for storage tests: path-style
+// buckets, plain, copied and multipart uploads, range reads and paginated listing.
+// NOTE: requests should be signed by AccessKey, signatures themselves are not verified.
+type FakeS3 struct {
+	*httptest.Server
+	AccessKey string
+	PageSize  int
+	// MaxCopySize is how large an object may be to be copied at once, 5GB as S3 has it
+	MaxCopySize int
+	// Multipart counts completed multipart uploads
+	Multipart int
+	objects   map[string][]byte
+	uploads   map[string]map[int][]byte
+	mutex     sync.Mutex
+}
+
+func NewFakeS3(accessKey string) *FakeS3 {
+	s3 := &FakeS3{
+		AccessKey:   accessKey,
+		PageSize:    1000,
+		MaxCopySize: 5 << 30,
+		objects:     map[string][]byte{},
+		uploads:     map[string]map[int][]byte{},
+	}
+	s3.Server = httptest.NewServer(http.HandlerFunc(s3.serve))
+	return s3
+}
+
+// Keys lists objects of the bucket in lexical order.
+func (s *FakeS3) Keys(bucket string) []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.keys(bucket)
+}
+
+func (s *FakeS3) Object(bucket string, key string) ([]byte, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	contents, ok := s.objects[bucket+"/"+key]
+	return contents, ok
+}
+
+// PendingUploads counts multipart uploads neither completed nor aborted.
+func (s *FakeS3) PendingUploads() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.uploads)
+}
+
+func (s *FakeS3) keys(bucket string) []string {
+	keys := []string{}
+	for name := range s.objects {
+		if strings.HasPrefix(name, bucket+"/") {
+			keys = append(keys, strings.TrimPrefix(name, bucket+"/"))
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+type fakeS3Error struct {
+	XMLName xml.Name `xml:"Error"`
+	Code    string   `xml:"Code"`
+	Message string   `xml:"Message"`
+}
+
+func (s *FakeS3) fail(w http.ResponseWriter, status int, code string) {
+	w.WriteHeader(status)
+	xml.NewEncoder(w).Encode(&fakeS3Error{Code: code, Message: http.StatusText(status)})
+}
+
+func (s *FakeS3) respond(w http.ResponseWriter, status int, result interface{}) {
+	w.WriteHeader(status)
+	if result != nil {
+		xml.NewEncoder(w).Encode(result)
+	}
+}
+
+func (s *FakeS3) serve(w http.ResponseWriter, r *http.Request) {
+	if s.AccessKey != "" && !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential="+s.AccessKey+"/") {
+		s.fail(w, http.StatusForbidden, "AccessDenied")
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	bucket, key := parts[0], ""
+	if len(parts) > 1 {
+		key = parts[1]
+	}
+	name := bucket + "/" + key
+	query := r.URL.Query()
+
+	switch {
+	case r.Method == "GET" && key == "":
+		s.list(w, bucket, query.Get("continuation-token"))
+	case r.Method == "GET" || r.Method == "HEAD":
+		s.get(w, r, name)
+	case r.Method == "PUT" && query.Get("partNumber") != "":
+		s.putPart(w, r, query.Get("uploadId"), query.Get("partNumber"))
+	case r.Method == "PUT" && r.Header.Get("X-Amz-Copy-Source") != "":
+		source, _ := url.PathUnescape(strings.TrimPrefix(r.Header.Get("X-Amz-Copy-Source"), "/"))
+		contents, ok := s.objects[source]
+		if !ok {
+			s.fail(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		if len(contents) > s.MaxCopySize {
+			s.fail(w, http.StatusBadRequest, "InvalidRequest")
+			return
+		}
+		s.objects[name] = contents
+		s.respond(w, http.StatusOK, &struct {
+			XMLName xml.Name `xml:"CopyObjectResult"`
+			ETag    string   `xml:"ETag"`
+		}{ETag: etag(contents)})
+	case r.Method == "PUT":
+		contents, _ := ioutil.ReadAll(r.Body)
+		s.objects[name] = contents
+		w.Header().Set("ETag", etag(contents))
+	case r.Method == "POST" && query.Get("uploadId") != "":
+		s.complete(w, r, name, query.Get("uploadId"))
+	case r.Method == "POST" && hasParam(query, "uploads"):
+		uploadID := fmt.Sprintf("upload-%d", len(s.uploads)+s.Multipart+1)
+		s.uploads[uploadID] = map[int][]byte{}
+		s.respond(w, http.StatusOK, &struct {
+			XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+			UploadID string   `xml:"UploadId"`
+		}{UploadID: uploadID})
+	case r.Method == "DELETE" && query.Get("uploadId") != "":
+		delete(s.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == "DELETE":
+		delete(s.objects, name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		s.fail(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+func (s *FakeS3) list(w http.ResponseWriter, bucket string, token string) {
+	keys := s.keys(bucket)
+	start := sort.SearchStrings(keys, token)
+	if start < len(keys) && keys[start] == token {
+		start++
+	}
+
+	type object struct {
+		Key  string `xml:"Key"`
+		Size int    `xml:"Size"`
+	}
+	result := struct {
+		XMLName               xml.Name `xml:"ListBucketResult"`
+		Contents              []object `xml:"Contents"`
+		IsTruncated           bool     `xml:"IsTruncated"`
+		NextContinuationToken string   `xml:"NextContinuationToken,omitempty"`
+	}{}
+
+	for _, key := range keys[start:] {
+		if len(result.Contents) == s.PageSize {
+			result.IsTruncated = true
+			result.NextContinuationToken = result.Contents[len(result.Contents)-1].Key
+			break
+		}
+		result.Contents = append(result.Contents, object{Key: key, Size: len(s.objects[bucket+"/"+key])})
+	}
+
+	s.respond(w, http.StatusOK, &result)
+}
+
+func (s *FakeS3) get(w http.ResponseWriter, r *http.Request, name string) {
+	contents, ok := s.objects[name]
+	if !ok {
+		s.fail(w, http.StatusNotFound, "NoSuchKey")
+		return
+	}
+
+	status, first, last := http.StatusOK, 0, len(contents)-1
+	if rng := r.Header.Get("Range"); rng != "" {
+		bounds := strings.SplitN(strings.TrimPrefix(rng, "bytes="), "-", 2)
+		first, _ = strconv.Atoi(bounds[0])
+		if len(bounds) > 1 && bounds[1] != "" {
+			last, _ = strconv.Atoi(bounds[1])
+		}
+		if last > len(contents)-1 {
+			last = len(contents) - 1
+		}
+		if first > last {
+			s.fail(w, http.StatusRequestedRangeNotSatisfiable, "InvalidRange")
+			return
+		}
+		status = http.StatusPartialContent
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", first, last, len(contents)))
+	}
+
+	w.Header().Set("Content-Length", strconv.Itoa(last-first+1))
+	w.Header().Set("ETag", etag(contents))
+	w.WriteHeader(status)
+	if r.Method == "GET" {
+		w.Write(contents[first : last+1])
+	}
+}
+
+func (s *FakeS3) putPart(w http.ResponseWriter, r *http.Request, uploadID string, partNumber string) {
+	upload, ok := s.uploads[uploadID]
+	if !ok {
+		s.fail(w, http.StatusNotFound, "NoSuchUpload")
+		return
+	}
+
+	number, _ := strconv.Atoi(partNumber)
+	if r.Header.Get("X-Amz-Copy-Source") == "" {
+		contents, _ := ioutil.ReadAll(r.Body)
+		upload[number] = contents
+		w.Header().Set("ETag", etag(contents))
+		return
+	}
+
+	source, _ := url.PathUnescape(strings.TrimPrefix(r.Header.Get("X-Amz-Copy-Source"), "/"))
+	contents, ok := s.objects[source]
+	if !ok {
+		s.fail(w, http.StatusNotFound, "NoSuchKey")
+		return
+	}
+
+	var first, last int
+	if _, err := fmt.Sscanf(r.Header.Get("X-Amz-Copy-Source-Range"), "bytes=%d-%d", &first, &last); err != nil || first > last || last >= len(contents) || last-first+1 > s.MaxCopySize {
+		s.fail(w, http.StatusBadRequest, "InvalidRequest")
+		return
+	}
+
+	upload[number] = contents[first : last+1]
+	s.respond(w, http.StatusOK, &struct {
+		XMLName xml.Name `xml:"CopyPartResult"`
+		ETag    string   `xml:"ETag"`
+	}{ETag: etag(upload[number])})
+}
+
+func (s *FakeS3) complete(w http.ResponseWriter, r *http.Request, name string, uploadID string) {
+	var completion struct {
+		Parts []struct {
+			Number int    `xml:"PartNumber"`
+			ETag   string `xml:"ETag"`
+		} `xml:"Part"`
+	}
+
+	upload, ok := s.uploads[uploadID]
+	if !ok {
+		s.fail(w, http.StatusNotFound, "NoSuchUpload")
+		return
+	}
+
+	body, _ := ioutil.ReadAll(r.Body)
+	if err := xml.Unmarshal(body, &completion); err != nil {
+		s.fail(w, http.StatusBadRequest, "MalformedXML")
+		return
+	}
+
+	contents := []byte{}
+	for i, part := range completion.Parts {
+		chunk, ok := upload[part.Number]
+		if !ok || part.Number != i+1 || part.ETag != etag(chunk) {
+			// NOTE: real S3 sends errors of completion along with 200 OK
+			s.respond(w, http.StatusOK, &fakeS3Error{Code: "InvalidPart", Message: "part is missing"})
+			return
+		}
+		if i < len(completion.Parts)-1 && len(chunk) < 5<<20 {
+			s.fail(w, http.StatusBadRequest, "EntityTooSmall")
+			return
+		}
+		contents = append(contents, chunk...)
+	}
+
+	s.objects[name] = contents
+	delete(s.uploads, uploadID)
+	s.Multipart++
+	s.respond(w, http.StatusOK, &struct {
+		XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+		ETag    string   `xml:"ETag"`
+	}{ETag: etag(contents)})
+}
+
+func hasParam(query url.Values, name string) bool {
+	_, ok := query[name]
+	return ok
+}
+
+func etag(contents []byte) string {
+	return fmt.Sprintf("\"%x\"", md5.Sum(contents))
+}
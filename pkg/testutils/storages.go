@@ -1,9 +1,17 @@
 package testutils
 
 import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
 	"github.com/golang/mock/gomock"
 	"github.com/twonegatives/drweb_challenge/pkg/drweb"
 	"github.com/twonegatives/drweb_challenge/pkg/mocks"
+	"github.com/twonegatives/drweb_challenge/pkg/namegenerators"
+	"github.com/twonegatives/drweb_challenge/pkg/pathgenerators"
 	"github.com/twonegatives/drweb_challenge/pkg/storages"
 )
 
@@ -14,3 +22,77 @@ func GenerateStorage(filename string, path string, err error, ctrl *gomock.Contr
 		FilePathGenerator: pathgen,
 	}
 }
+
+// GenerateDisks gives file system storages, each in its own folder as if on its own disk.
+func GenerateDisks(t *testing.T, count int) ([]*storages.FileSystemStorage, func()) {
+	base, err := ioutil.TempDir("../../tmp", "disks")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	disks := []*storages.FileSystemStorage{}
+	for i := 0; i < count; i++ {
+		path := fmt.Sprintf("%s/%d", base, i)
+		if err := os.MkdirAll(path+"/tmp", 0700); err != nil {
+			t.Fatal(err)
+		}
+		disks = append(disks, &storages.FileSystemStorage{
+			BasePath:          path,
+			TempPath:          path + "/tmp",
+			FileMode:          0700,
+			FilePathGenerator: &pathgenerators.NestedGenerator{BasePath: path, Levels: 1, FolderLength: 2},
+		})
+	}
+	return disks, func() { os.RemoveAll(base) }
+}
+
+func GenerateMetadataStore(t *testing.T) (*storages.FileSystemMetadataStore, func()) {
+	base, err := ioutil.TempDir("../../tmp", "metadata")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := &storages.FileSystemMetadataStore{
+		BasePath:          base,
+		FileMode:          0700,
+		FilePathGenerator: &pathgenerators.NestedGenerator{BasePath: base, Levels: 1, FolderLength: 2},
+	}
+
+	return store, func() { os.RemoveAll(base) }
+}
+
+// SaveFile saves contents named by their sha256, as uploads are.
+func SaveFile(storage drweb.Storage, contents []byte, inspectors ...drweb.Inspector) (string, error) {
+	return storage.Save(&drweb.FileCreateRequest{
+		Body:          ioutil.NopCloser(bytes.NewReader(contents)),
+		NameGenerator: &namegenerators.SHA256{},
+		Inspectors:    inspectors,
+	})
+}
+
+// SaveFiles saves count distinct files of 7 bytes each.
+func SaveFiles(t *testing.T, storage drweb.Storage, count int) []string {
+	filenames := []string{}
+	for i := 0; i < count; i++ {
+		filename, err := SaveFile(storage, []byte(fmt.Sprintf("file #%d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		filenames = append(filenames, filename)
+	}
+	return filenames
+}
+
+func LoadFile(t *testing.T, storage drweb.Storage, filename string) []byte {
+	file, err := storage.Load(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	loaded, err := ioutil.ReadAll(file.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loaded
+}
@@ -0,0 +1,84 @@
+package thumbnails
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+)
+
+// bounds tells which part of the source is taken and how large the result is.
+func bounds(source image.Rectangle, spec *drweb.ThumbnailSpec) (image.Rectangle, int, int) {
+	width, height := source.Dx(), source.Dy()
+
+	switch spec.Fit {
+	case drweb.ThumbnailCover:
+		// NOTE: the largest centered part having requested aspect ratio
+		crop := image.Rect(0, 0, width, maxInt(1, width*spec.Height/spec.Width))
+		if crop.Dy() > height {
+			crop = image.Rect(0, 0, maxInt(1, height*spec.Width/spec.Height), height)
+		}
+		crop = crop.Add(source.Min).Add(image.Pt((width-crop.Dx())/2, (height-crop.Dy())/2))
+		return crop, minInt(spec.Width, crop.Dx()), minInt(spec.Height, crop.Dy())
+	case drweb.ThumbnailFill:
+		return source, minInt(spec.Width, width), minInt(spec.Height, height)
+	}
+
+	if width <= spec.Width && height <= spec.Height {
+		return source, width, height
+	}
+
+	if width*spec.Height > height*spec.Width {
+		return source, spec.Width, maxInt(1, height*spec.Width/width)
+	}
+	return source, maxInt(1, width*spec.Height/height), spec.Height
+}
+
+// resize averages every source pixel falling into a thumbnail one (box filter),
+// which is fine for downscaling, the only scaling done.
+func resize(source image.Image, spec *drweb.ThumbnailSpec) image.Image {
+	crop, width, height := bounds(source.Bounds(), spec)
+	result := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		top := crop.Min.Y + y*crop.Dy()/height
+		bottom := maxInt(top+1, crop.Min.Y+(y+1)*crop.Dy()/height)
+
+		for x := 0; x < width; x++ {
+			left := crop.Min.X + x*crop.Dx()/width
+			right := maxInt(left+1, crop.Min.X+(x+1)*crop.Dx()/width)
+
+			var r, g, b, a, count uint64
+			for sy := top; sy < bottom; sy++ {
+				for sx := left; sx < right; sx++ {
+					pr, pg, pb, pa := source.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa)
+					count++
+				}
+			}
+
+			result.SetRGBA(x, y, color.RGBA{
+				R: uint8(r / count >> 8),
+				G: uint8(g / count >> 8),
+				B: uint8(b / count >> 8),
+				A: uint8(a / count >> 8),
+			})
+		}
+	}
+
+	return result
+}
+
+func minInt(x, y int) int {
+	if x < y {
+		return x
+	}
+	return y
+}
+
+func maxInt(x, y int) int {
+	if x > y {
+		return x
+	}
+	return y
+}
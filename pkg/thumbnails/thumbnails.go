@@ -0,0 +1,162 @@
+package thumbnails
+
+import (
+	"bytes"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+)
+
+const jpegQuality = 85
+
+// NOTE: see drweb.ThumbnailSpec.Key
+const thumbnailKeyPrefix = "thumbnail:"
+
+// Thumbnailer renders thumbnails with pure go image packages. Rendered ones
+// are stored through Storage as files of their own (derived files),
+// linked with their sources in metadata, so that they are rendered once.
+// NOTE: Storage is expected to delete derived files along with their sources,
+// as storages.IndexedStorage does.
+type Thumbnailer struct {
+	Storage       drweb.Storage
+	Metadata      drweb.MetadataStore
+	NameGenerator drweb.FileNameGenerator
+	MaxPixels     int64
+}
+
+func (t *Thumbnailer) Thumbnail(filename string, spec *drweb.ThumbnailSpec) (*drweb.File, error) {
+	metadata, err := t.Metadata.Get(filename)
+	if err != nil && !os.IsNotExist(errors.Cause(err)) {
+		return nil, err
+	}
+
+	// NOTE: a cached thumbnail might be gone, it is rendered anew then
+	if metadata != nil && metadata.Derived[spec.Key()] != "" {
+		file, err := t.Storage.Load(metadata.Derived[spec.Key()])
+		if err == nil || !os.IsNotExist(errors.Cause(err)) {
+			return file, err
+		}
+	}
+
+	source, err := t.Storage.Load(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer source.Close()
+
+	contents, err := t.render(source.Body, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	derived, err := t.Storage.Save(&drweb.FileCreateRequest{
+		Body:          ioutil.NopCloser(bytes.NewReader(contents)),
+		NameGenerator: t.NameGenerator,
+		Metadata:      &drweb.Metadata{DerivedFrom: []string{filename}},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to save thumbnail")
+	}
+
+	err = t.Metadata.Update(filename, func(metadata *drweb.Metadata) error {
+		metadata.AddDerived(spec.Key(), derived)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to link thumbnail")
+	}
+
+	return &drweb.File{Body: ioutil.NopCloser(bytes.NewReader(contents)), Size: int64(len(contents))}, nil
+}
+
+// Enqueue does nothing, as thumbnails are only rendered once asked for.
+func (t *Thumbnailer) Enqueue(filename string) {}
+
+// Forget deletes thumbnails of the file, e.g. once it is quarantined,
+// so that they are not served in its place. They are rendered anew
+// if the file is back.
+func (t *Thumbnailer) Forget(filename string) error {
+	metadata, err := t.Metadata.Get(filename)
+	if err != nil {
+		if os.IsNotExist(errors.Cause(err)) {
+			return nil
+		}
+		return err
+	}
+
+	for key, derived := range metadata.Derived {
+		if !strings.HasPrefix(key, thumbnailKeyPrefix) {
+			continue
+		}
+		if err = t.Storage.Delete(derived); err != nil && !os.IsNotExist(errors.Cause(err)) {
+			return errors.Wrap(err, "failed to delete thumbnail")
+		}
+	}
+
+	err = t.Metadata.Update(filename, func(metadata *drweb.Metadata) error {
+		for key := range metadata.Derived {
+			if strings.HasPrefix(key, thumbnailKeyPrefix) {
+				delete(metadata.Derived, key)
+			}
+		}
+		return nil
+	})
+	return errors.Wrap(err, "failed to unlink thumbnails")
+}
+
+// render checks image dimensions before decoding it, so that
+// a tiny file claiming gigapixels is never allocated for.
+func (t *Thumbnailer) render(body io.Reader, spec *drweb.ThumbnailSpec) ([]byte, error) {
+	var head bytes.Buffer
+
+	config, format, err := image.DecodeConfig(io.TeeReader(body, &head))
+	if err != nil {
+		return nil, malformed(err)
+	}
+
+	if config.Width <= 0 || config.Height <= 0 || t.MaxPixels > 0 && int64(config.Width)*int64(config.Height) > t.MaxPixels {
+		return nil, &drweb.ImageLimitError{Width: config.Width, Height: config.Height}
+	}
+
+	var source image.Image
+	switch format {
+	case "jpeg":
+		source, err = jpeg.Decode(io.MultiReader(&head, body))
+	case "png":
+		source, err = png.Decode(io.MultiReader(&head, body))
+	case "gif":
+		// NOTE: only the first frame of an animation is taken
+		source, err = gif.Decode(io.MultiReader(&head, body))
+	default:
+		return nil, drweb.ErrNotImage
+	}
+	if err != nil {
+		return nil, malformed(err)
+	}
+
+	thumbnail := resize(source, spec)
+
+	var output bytes.Buffer
+	if format == "jpeg" {
+		err = jpeg.Encode(&output, thumbnail, &jpeg.Options{Quality: jpegQuality})
+	} else {
+		err = png.Encode(&output, thumbnail)
+	}
+
+	return output.Bytes(), errors.Wrap(err, "failed to encode thumbnail")
+}
+
+func malformed(err error) error {
+	if err == image.ErrFormat {
+		return drweb.ErrNotImage
+	}
+	return errors.Wrap(drweb.ErrNotImage, "malformed image: "+err.Error())
+}
@@ -0,0 +1,223 @@
+package thumbnails_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	pkgerrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/twonegatives/drweb_challenge/pkg/drweb"
+	"github.com/twonegatives/drweb_challenge/pkg/namegenerators"
+	"github.com/twonegatives/drweb_challenge/pkg/pathgenerators"
+	"github.com/twonegatives/drweb_challenge/pkg/storages"
+	"github.com/twonegatives/drweb_challenge/pkg/thumbnails"
+)
+
+func generateThumbnailer(t *testing.T) (*thumbnailerFixture, func()) {
+	base, err := ioutil.TempDir("../../tmp", "thumbnails")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := path.Join(base, "files")
+	storage := &storages.FileSystemStorage{
+		BasePath:          files,
+		FileMode:          0700,
+		FilePathGenerator: &pathgenerators.NestedGenerator{BasePath: files, Levels: 1, FolderLength: 2},
+	}
+
+	metadata := &storages.FileSystemMetadataStore{
+		BasePath:          path.Join(base, "metadata"),
+		FileMode:          0700,
+		FilePathGenerator: &pathgenerators.NestedGenerator{BasePath: path.Join(base, "metadata"), Levels: 1, FolderLength: 2},
+	}
+
+	indexed := &storages.IndexedStorage{Storage: storage, Metadata: metadata}
+	fixture := &thumbnailerFixture{
+		storage:  indexed,
+		metadata: metadata,
+		thumbnailer: &thumbnails.Thumbnailer{
+			Storage:       indexed,
+			Metadata:      metadata,
+			NameGenerator: &namegenerators.SHA256{},
+			MaxPixels:     1000000,
+		},
+	}
+
+	return fixture, func() { os.RemoveAll(base) }
+}
+
+type thumbnailerFixture struct {
+	storage     *storages.IndexedStorage
+	metadata    *storages.FileSystemMetadataStore
+	thumbnailer *thumbnails.Thumbnailer
+}
+
+func (f *thumbnailerFixture) store(t *testing.T, contents []byte) string {
+	filename, err := f.storage.Save(&drweb.FileCreateRequest{
+		Body:          ioutil.NopCloser(bytes.NewReader(contents)),
+		NameGenerator: &namegenerators.SHA256{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func decode(t *testing.T, file *drweb.File) (image.Config, string) {
+	defer file.Close()
+	contents, err := ioutil.ReadAll(file.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, int64(len(contents)), file.Size)
+	config, format, err := image.DecodeConfig(bytes.NewReader(contents))
+	assert.Nil(t, err)
+	return config, format
+}
+
+func TestThumbnail(t *testing.T) {
+	fixture, cleanup := generateThumbnailer(t)
+	defer cleanup()
+
+	gopher, err := ioutil.ReadFile("../testdata/gopher.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := fixture.store(t, gopher)
+
+	var objects = map[string]struct {
+		Spec   drweb.ThumbnailSpec
+		Width  int
+		Height int
+	}{
+		"contain":     {Spec: drweb.ThumbnailSpec{Width: 100, Height: 100, Fit: drweb.ThumbnailContain}, Width: 91, Height: 100},
+		"cover":       {Spec: drweb.ThumbnailSpec{Width: 100, Height: 50, Fit: drweb.ThumbnailCover}, Width: 100, Height: 50},
+		"fill":        {Spec: drweb.ThumbnailSpec{Width: 300, Height: 100, Fit: drweb.ThumbnailFill}, Width: 210, Height: 100},
+		"no upscale":  {Spec: drweb.ThumbnailSpec{Width: 500, Height: 500, Fit: drweb.ThumbnailContain}, Width: 210, Height: 230},
+		"single line": {Spec: drweb.ThumbnailSpec{Width: 1, Height: 1, Fit: drweb.ThumbnailCover}, Width: 1, Height: 1},
+	}
+
+	for testName, testObject := range objects {
+		t.Run(testName, func(t *testing.T) {
+			thumbnail, err := fixture.thumbnailer.Thumbnail(filename, &testObject.Spec)
+			assert.Nil(t, err)
+
+			config, format := decode(t, thumbnail)
+			assert.Equal(t, "jpeg", format)
+			assert.Equal(t, testObject.Width, config.Width)
+			assert.Equal(t, testObject.Height, config.Height)
+		})
+	}
+}
+
+func TestThumbnailCache(t *testing.T) {
+	fixture, cleanup := generateThumbnailer(t)
+	defer cleanup()
+
+	gopher, err := ioutil.ReadFile("../testdata/gopher.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := fixture.store(t, gopher)
+	spec := &drweb.ThumbnailSpec{Width: 64, Height: 64, Fit: drweb.ThumbnailContain}
+
+	rendered, err := fixture.thumbnailer.Thumbnail(filename, spec)
+	assert.Nil(t, err)
+	decode(t, rendered)
+
+	metadata, err := fixture.metadata.Get(filename)
+	assert.Nil(t, err)
+	derived := metadata.Derived["thumbnail:64x64:contain"]
+	assert.NotEmpty(t, derived)
+
+	derivedMetadata, err := fixture.metadata.Get(derived)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{filename}, derivedMetadata.DerivedFrom)
+
+	// NOTE: the cached one is served as long as it is there
+	cached, err := fixture.thumbnailer.Thumbnail(filename, spec)
+	assert.Nil(t, err)
+	config, _ := decode(t, cached)
+	assert.Equal(t, 64, config.Height)
+
+	assert.Nil(t, fixture.storage.Delete(filename))
+	_, err = fixture.storage.Load(derived)
+	assert.True(t, os.IsNotExist(pkgerrors.Cause(err)))
+	_, err = fixture.metadata.Get(derived)
+	assert.True(t, os.IsNotExist(pkgerrors.Cause(err)))
+
+	_, err = fixture.thumbnailer.Thumbnail(filename, spec)
+	assert.True(t, os.IsNotExist(pkgerrors.Cause(err)))
+}
+
+func TestThumbnailForget(t *testing.T) {
+	fixture, cleanup := generateThumbnailer(t)
+	defer cleanup()
+
+	gopher, err := ioutil.ReadFile("../testdata/gopher.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := fixture.store(t, gopher)
+	spec := &drweb.ThumbnailSpec{Width: 64, Height: 64, Fit: drweb.ThumbnailContain}
+
+	rendered, err := fixture.thumbnailer.Thumbnail(filename, spec)
+	assert.Nil(t, err)
+	decode(t, rendered)
+	metadata, _ := fixture.metadata.Get(filename)
+	derived := metadata.Derived[spec.Key()]
+
+	// NOTE: the source stays, as quarantine moves it away on its own
+	assert.Nil(t, fixture.thumbnailer.Forget(filename))
+	_, err = fixture.storage.Load(derived)
+	assert.True(t, os.IsNotExist(pkgerrors.Cause(err)))
+	metadata, err = fixture.metadata.Get(filename)
+	assert.Nil(t, err)
+	assert.Empty(t, metadata.Derived)
+
+	rendered, err = fixture.thumbnailer.Thumbnail(filename, spec)
+	assert.Nil(t, err)
+	decode(t, rendered)
+
+	assert.Nil(t, fixture.thumbnailer.Forget("0000"))
+}
+
+// pngHeader claims given dimensions, with no pixel data following.
+func pngHeader(width uint32, height uint32) []byte {
+	chunk := make([]byte, 17)
+	copy(chunk, "IHDR")
+	binary.BigEndian.PutUint32(chunk[4:], width)
+	binary.BigEndian.PutUint32(chunk[8:], height)
+	chunk[12], chunk[13] = 8, 6
+
+	header := bytes.NewBufferString("\x89PNG\r\n\x1a\n")
+	binary.Write(header, binary.BigEndian, uint32(13))
+	header.Write(chunk)
+	binary.Write(header, binary.BigEndian, crc32.ChecksumIEEE(chunk))
+	return header.Bytes()
+}
+
+func TestThumbnailRejects(t *testing.T) {
+	fixture, cleanup := generateThumbnailer(t)
+	defer cleanup()
+
+	spec := &drweb.ThumbnailSpec{Width: 64, Height: 64, Fit: drweb.ThumbnailContain}
+
+	_, err := fixture.thumbnailer.Thumbnail(fixture.store(t, []byte("just a text")), spec)
+	assert.Equal(t, drweb.ErrNotImage, pkgerrors.Cause(err))
+
+	_, err = fixture.thumbnailer.Thumbnail(fixture.store(t, pngHeader(100000, 100000)), spec)
+	assert.Equal(t, &drweb.ImageLimitError{Width: 100000, Height: 100000}, pkgerrors.Cause(err))
+
+	_, err = fixture.thumbnailer.Thumbnail(fixture.store(t, pngHeader(100, 100)), spec)
+	assert.Equal(t, drweb.ErrNotImage, pkgerrors.Cause(err))
+	assert.Contains(t, err.Error(), "malformed image")
+}
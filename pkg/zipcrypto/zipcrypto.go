@@ -0,0 +1,122 @@
+package zipcrypto
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"crypto/rand"
+	"hash/crc32"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// encryptedFlag is general purpose flag of encrypted zip members.
+const encryptedFlag = 0x1
+
+const headerLength = 12
+
+// Wrapper packs files into zip archives encrypted with traditional PKWARE
+// encryption (ZipCrypto). It is weak by today's standards, but any unzip tool
+// understands it and all we need is to keep samples away from antiviruses.
+// NOTE: archive is streamed as it goes, nothing is buffered but a few bytes.
+type Wrapper struct {
+	Password string
+}
+
+func (z *Wrapper) Wrap(w io.Writer, filename string, body io.Reader) error {
+	archive := zip.NewWriter(w)
+
+	header := &zip.FileHeader{Name: filename, Method: zip.Deflate, Flags: encryptedFlag}
+	header.SetModTime(time.Now())
+
+	archive.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+		// NOTE: sizes and CRC follow the data in a data descriptor,
+		// so the check byte is taken from modification time instead of CRC
+		encrypted, err := NewEncrypter(out, z.Password, byte(header.ModifiedTime>>8))
+		if err != nil {
+			return nil, err
+		}
+		return flate.NewWriter(encrypted, flate.DefaultCompression)
+	})
+
+	entry, err := archive.CreateHeader(header)
+	if err != nil {
+		return errors.Wrap(err, "failed to create zip entry")
+	}
+
+	if _, err = io.Copy(entry, body); err != nil {
+		return errors.Wrap(err, "failed to write zip entry")
+	}
+
+	return errors.Wrap(archive.Close(), "failed to finish zip archive")
+}
+
+type keys [3]uint32
+
+func newKeys(password string) *keys {
+	k := &keys{0x12345678, 0x23456789, 0x34567890}
+	for i := 0; i < len(password); i++ {
+		k.update(password[i])
+	}
+	return k
+}
+
+func crc32Update(crc uint32, b byte) uint32 {
+	return crc32.IEEETable[byte(crc)^b] ^ (crc >> 8)
+}
+
+func (k *keys) update(b byte) {
+	k[0] = crc32Update(k[0], b)
+	k[1] += k[0] & 0xff
+	k[1] = k[1]*134775813 + 1
+	k[2] = crc32Update(k[2], byte(k[1]>>24))
+}
+
+func (k *keys) stream() byte {
+	t := k[2] | 2
+	return byte((t * (t ^ 1)) >> 8)
+}
+
+type encrypter struct {
+	writer io.Writer
+	keys   *keys
+	header []byte
+	buffer []byte
+}
+
+// NewEncrypter encrypts whatever is written to w, preceded by encryption header
+// which ends up with check byte.
+// NOTE: header is written along with the first chunk, since zip.Writer
+// creates compressors before it writes local file header.
+func NewEncrypter(w io.Writer, password string, check byte) (io.Writer, error) {
+	header := make([]byte, headerLength)
+	if _, err := rand.Read(header[:headerLength-1]); err != nil {
+		return nil, errors.Wrap(err, "failed to generate encryption header")
+	}
+	header[headerLength-1] = check
+
+	return &encrypter{writer: w, keys: newKeys(password), header: header}, nil
+}
+
+func (e *encrypter) Write(p []byte) (int, error) {
+	if e.header != nil {
+		header := e.header
+		e.header = nil
+		if _, err := e.Write(header); err != nil {
+			return 0, err
+		}
+	}
+
+	if cap(e.buffer) < len(p) {
+		e.buffer = make([]byte, len(p))
+	}
+	encrypted := e.buffer[:len(p)]
+
+	for i, b := range p {
+		encrypted[i] = b ^ e.keys.stream()
+		e.keys.update(b)
+	}
+
+	return e.writer.Write(encrypted)
+}
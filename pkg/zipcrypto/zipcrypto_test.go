@@ -0,0 +1,67 @@
+package zipcrypto_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"hash/crc32"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/twonegatives/drweb_challenge/pkg/zipcrypto"
+)
+
+// decrypt follows traditional PKWARE decryption, as unzip tools do.
+func decrypt(data []byte, password string) ([]byte, byte) {
+	keys := [3]uint32{0x12345678, 0x23456789, 0x34567890}
+	update := func(b byte) {
+		keys[0] = crc32.IEEETable[byte(keys[0])^b] ^ (keys[0] >> 8)
+		keys[1] = (keys[1]+keys[0]&0xff)*134775813 + 1
+		keys[2] = crc32.IEEETable[byte(keys[2])^byte(keys[1]>>24)] ^ (keys[2] >> 8)
+	}
+
+	for i := 0; i < len(password); i++ {
+		update(password[i])
+	}
+
+	plain := make([]byte, len(data))
+	for i, b := range data {
+		t := keys[2] | 2
+		plain[i] = b ^ byte((t*(t^1))>>8)
+		update(plain[i])
+	}
+
+	return plain[12:], plain[11]
+}
+
+func TestWrap(t *testing.T) {
+	for _, contents := range []string{"", strings.Repeat("X5O!P%@AP[4\\PZX54(P^)7CC)7}$EICAR", 100)} {
+		buf := new(bytes.Buffer)
+		wrapper := zipcrypto.Wrapper{Password: "infected"}
+		assert.Nil(t, wrapper.Wrap(buf, "abcdef", strings.NewReader(contents)))
+
+		archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Len(t, archive.File, 1)
+		member := archive.File[0]
+		assert.Equal(t, "abcdef", member.Name)
+		assert.Equal(t, uint16(0x1), member.Flags&0x1)
+		assert.Equal(t, uint64(len(contents)), member.UncompressedSize64)
+		assert.Equal(t, crc32.ChecksumIEEE([]byte(contents)), member.CRC32)
+
+		offset, err := member.DataOffset()
+		assert.Nil(t, err)
+
+		compressed, check := decrypt(buf.Bytes()[offset:offset+int64(member.CompressedSize64)], "infected")
+		assert.Equal(t, byte(member.ModifiedTime>>8), check)
+
+		inflated, err := ioutil.ReadAll(flate.NewReader(bytes.NewReader(compressed)))
+		assert.Nil(t, err)
+		assert.Equal(t, contents, string(inflated))
+	}
+}